@@ -0,0 +1,319 @@
+// activity.go
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/stellar/go/ingest"
+)
+
+// Defaults of the account_activity config block.
+const (
+	defaultActivityMaxWindowLedgers  = 120960 // about a week
+	defaultActivityBucketLedgers     = 720    // about an hour
+	defaultActivityExpectedAccounts  = 100000 // per bucket
+	defaultActivityFalsePositiveRate = 0.01
+)
+
+// accountActivityFile is the state file of the oracle in state_dir.
+const accountActivityFile = "account_activity.json"
+
+// bloomFilter is a fixed-size Bloom filter over strings, using double
+// hashing of a 64-bit FNV-1a hash to derive its k probe positions.
+type bloomFilter struct {
+	bits []uint64
+	k    int
+}
+
+// newBloomFilter sizes a filter for n keys at false positive rate p.
+func newBloomFilter(n int, p float64) *bloomFilter {
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, int(m+63)/64), k: k}
+}
+
+func (f *bloomFilter) probes(key string) (h1, h2, m uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum & 0xffffffff, sum>>32 | 1, uint64(len(f.bits)) * 64
+}
+
+func (f *bloomFilter) add(key string) {
+	h1, h2, m := f.probes(key)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *bloomFilter) has(key string) bool {
+	h1, h2, m := f.probes(key)
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// activityBucket holds the accounts active in bucketLedgers consecutive
+// ledgers, starting at a multiple of bucketLedgers.
+type activityBucket struct {
+	start  uint32
+	filter *bloomFilter
+}
+
+// accountActivityOracle answers whether an account was active within a
+// recent window of ledgers, from a ring of Bloom filters that each cover a
+// bucket of ledgers. Answers may be false positives, at about the configured
+// rate per bucket searched, but never false negatives for observed ledgers.
+type accountActivityOracle struct {
+	maxWindow     uint32
+	bucketLedgers uint32
+	expected      int
+	fpRate        float64
+	path          string // empty unless persisted in state_dir
+
+	mu         sync.RWMutex
+	buckets    []*activityBucket // oldest first
+	since      uint32            // first ledger observed
+	lastLedger uint32            // most recently observed ledger
+	dirty      int               // ledgers observed since the last save
+}
+
+// accountActivityFileState is the on-disk form of the oracle.
+type accountActivityFileState struct {
+	MaxWindow         uint32                      `json:"max_window_ledgers"`
+	BucketLedgers     uint32                      `json:"bucket_ledgers"`
+	ExpectedAccounts  int                         `json:"expected_accounts"`
+	FalsePositiveRate float64                     `json:"false_positive_rate"`
+	Since             uint32                      `json:"since"`
+	LastLedger        uint32                      `json:"last_ledger"`
+	Buckets           []accountActivityFileBucket `json:"buckets"`
+}
+
+type accountActivityFileBucket struct {
+	Start uint32 `json:"start"`
+	K     int    `json:"k"`
+	Bits  []byte `json:"bits"`
+}
+
+// newAccountActivityOracleFromConfig parses the optional account_activity
+// config block:
+//
+//	"account_activity": {
+//	  "max_window_ledgers": 120960,
+//	  "bucket_ledgers": 720,
+//	  "expected_accounts": 100000,
+//	  "false_positive_rate": 0.01
+//	}
+//
+// expected_accounts is the number of distinct accounts expected per bucket.
+// It returns nil when the block is absent.
+func newAccountActivityOracleFromConfig(config map[string]interface{}, stateDir string) (*accountActivityOracle, error) {
+	raw, ok := config["account_activity"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("account_activity must be an object, got %T", raw)
+	}
+	maxWindow, err := configInt(block, "max_window_ledgers", defaultActivityMaxWindowLedgers)
+	if err != nil {
+		return nil, fmt.Errorf("account_activity: %w", err)
+	}
+	bucketLedgers, err := configInt(block, "bucket_ledgers", defaultActivityBucketLedgers)
+	if err != nil {
+		return nil, fmt.Errorf("account_activity: %w", err)
+	}
+	expected, err := configInt(block, "expected_accounts", defaultActivityExpectedAccounts)
+	if err != nil {
+		return nil, fmt.Errorf("account_activity: %w", err)
+	}
+	if maxWindow < 1 || bucketLedgers < 1 || expected < 1 {
+		return nil, fmt.Errorf("account_activity: max_window_ledgers, bucket_ledgers and expected_accounts must be at least 1")
+	}
+	fpRate, err := configFloat(block, "false_positive_rate", defaultActivityFalsePositiveRate)
+	if err != nil {
+		return nil, fmt.Errorf("account_activity: %w", err)
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, fmt.Errorf("account_activity: false_positive_rate must be between 0 and 1, got %v", fpRate)
+	}
+
+	o := &accountActivityOracle{
+		maxWindow:     uint32(maxWindow),
+		bucketLedgers: uint32(bucketLedgers),
+		expected:      expected,
+		fpRate:        fpRate,
+	}
+	if stateDir != "" {
+		o.path = filepath.Join(stateDir, accountActivityFile)
+		if err := o.load(); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// load restores the persisted filters. State saved with different settings
+// is discarded.
+func (o *accountActivityOracle) load() error {
+	data, err := os.ReadFile(o.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading state %s: %w", o.path, err)
+	}
+	var file accountActivityFileState
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("error decoding state %s: %w", o.path, err)
+	}
+	if file.MaxWindow != o.maxWindow || file.BucketLedgers != o.bucketLedgers ||
+		file.ExpectedAccounts != o.expected || file.FalsePositiveRate != o.fpRate {
+		return nil
+	}
+	for _, b := range file.Buckets {
+		words := make([]uint64, len(b.Bits)/8)
+		for i := range words {
+			words[i] = binary.LittleEndian.Uint64(b.Bits[i*8:])
+		}
+		o.buckets = append(o.buckets, &activityBucket{start: b.Start, filter: &bloomFilter{bits: words, k: b.K}})
+	}
+	o.since = file.Since
+	o.lastLedger = file.LastLedger
+	return nil
+}
+
+// flush saves the filters if they are persisted and enough ledgers have been
+// observed since the last save. The file is replaced atomically.
+func (o *accountActivityOracle) flush() error {
+	if o.path == "" || o.dirty < windowedStateFlushLedgers {
+		return nil
+	}
+	file := accountActivityFileState{
+		MaxWindow:         o.maxWindow,
+		BucketLedgers:     o.bucketLedgers,
+		ExpectedAccounts:  o.expected,
+		FalsePositiveRate: o.fpRate,
+		Since:             o.since,
+		LastLedger:        o.lastLedger,
+	}
+	for _, b := range o.buckets {
+		bits := make([]byte, 0, len(b.filter.bits)*8)
+		for _, word := range b.filter.bits {
+			bits = binary.LittleEndian.AppendUint64(bits, word)
+		}
+		file.Buckets = append(file.Buckets, accountActivityFileBucket{Start: b.start, K: b.filter.k, Bits: bits})
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing state %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return fmt.Errorf("error replacing state %s: %w", o.path, err)
+	}
+	o.dirty = 0
+	return nil
+}
+
+// ledgerAccounts collects the accounts active in a ledger.
+type ledgerAccounts map[string]bool
+
+// add records the accounts a transaction touches: its source, the fee
+// source of a fee bump, and the accounts of its operations. Failed
+// transactions count, since their sources were charged a fee.
+func (a ledgerAccounts) add(tx ingest.LedgerTransaction) {
+	if tx.Envelope.IsFeeBump() {
+		a[muxedAccountID(tx.Envelope.FeeBumpAccount())] = true
+	}
+	a[muxedAccountID(tx.Envelope.SourceAccount())] = true
+	for _, op := range tx.Envelope.Operations() {
+		for _, account := range operationAccounts(tx, op) {
+			a[account] = true
+		}
+	}
+}
+
+// observe records the accounts active in ledger seq, starting a new bucket
+// and dropping buckets that left the maximum window as needed.
+func (o *accountActivityOracle) observe(seq uint32, accounts ledgerAccounts) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.since == 0 || seq < o.lastLedger {
+		// First ledger, or the stream moved backwards: start afresh.
+		o.since = seq
+		o.buckets = nil
+	}
+	o.lastLedger = seq
+	o.dirty++
+
+	start := seq - seq%o.bucketLedgers
+	if len(o.buckets) == 0 || o.buckets[len(o.buckets)-1].start != start {
+		o.buckets = append(o.buckets, &activityBucket{start: start, filter: newBloomFilter(o.expected, o.fpRate)})
+	}
+	for len(o.buckets) > 0 && seq >= o.maxWindow && o.buckets[0].start+o.bucketLedgers <= seq-o.maxWindow+1 {
+		o.buckets = o.buckets[1:]
+	}
+	filter := o.buckets[len(o.buckets)-1].filter
+	for account := range accounts {
+		filter.add(account)
+	}
+	if err := o.flush(); err != nil {
+		log.Printf("Warning: could not save account activity state: %v", err)
+	}
+}
+
+// WasActive reports whether account was active within the last
+// windowLedgers ledgers processed, up to the configured max_window_ledgers.
+// Whole buckets are searched, so activity up to bucket_ledgers-1 ledgers
+// before the window may also count, and a true answer may be a false
+// positive. Ledgers before the processor's first observed ledger are not
+// covered.
+func (p *LatestLedgerProcessor) WasActive(account string, windowLedgers int) (bool, error) {
+	o := p.activity
+	if o == nil {
+		return false, fmt.Errorf("account activity is not enabled")
+	}
+	if windowLedgers < 1 || windowLedgers > int(o.maxWindow) {
+		return false, fmt.Errorf("window must be between 1 and %d ledgers, got %d", o.maxWindow, windowLedgers)
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.lastLedger == 0 {
+		return false, fmt.Errorf("no ledger processed yet")
+	}
+	var from uint32
+	if o.lastLedger >= uint32(windowLedgers) {
+		from = o.lastLedger - uint32(windowLedgers) + 1
+	}
+	for i := len(o.buckets) - 1; i >= 0; i-- {
+		b := o.buckets[i]
+		if b.start+o.bucketLedgers <= from {
+			break
+		}
+		if b.filter.has(account) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,69 @@
+// authexpiration.go
+package main
+
+import (
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// authHeadroomBuckets are the upper bounds, in ledgers, of the auth
+// expiration histogram: about a minute, five minutes, an hour, a day and a
+// week at five-second ledgers.
+var authHeadroomBuckets = []uint64{12, 60, 720, 17280, 120960}
+
+// SorobanAuthExpiration describes how far ahead of the current ledger
+// Soroban address credentials were set to expire, i.e. how much headroom
+// wallets give their signed authorizations.
+type SorobanAuthExpiration struct {
+	EntryCount         int               `json:"entry_count"`          // Auth entries signed with address credentials
+	MinHeadroomLedgers int64             `json:"min_headroom_ledgers"` // Smallest signature_expiration_ledger - sequence
+	MaxHeadroomLedgers int64             `json:"max_headroom_ledgers"` // Largest signature_expiration_ledger - sequence
+	Histogram          []HistogramBucket `json:"histogram"`            // Entries by headroom in ledgers; negative headroom counts in the first bucket
+}
+
+// authExpirationTally accumulates the signature expiration ledgers of
+// Soroban auth entries while a ledger is processed.
+type authExpirationTally struct {
+	expirations []uint32
+}
+
+// add records the address credentials of the InvokeHostFunction operations
+// of a transaction, successful or not. Source account credentials carry no
+// expiration and are not counted.
+func (t *authExpirationTally) add(tx ingest.LedgerTransaction) {
+	for _, op := range tx.Envelope.Operations() {
+		if op.Body.Type != xdr.OperationTypeInvokeHostFunction {
+			continue
+		}
+		for _, entry := range op.Body.MustInvokeHostFunctionOp().Auth {
+			if entry.Credentials.Type != xdr.SorobanCredentialsTypeSorobanCredentialsAddress || entry.Credentials.Address == nil {
+				continue
+			}
+			t.expirations = append(t.expirations, uint32(entry.Credentials.Address.SignatureExpirationLedger))
+		}
+	}
+}
+
+// metrics returns the expiration headroom relative to sequence, or nil when
+// the ledger had no address credentials so the field can be left out of the
+// payload.
+func (t *authExpirationTally) metrics(sequence uint32) *SorobanAuthExpiration {
+	if len(t.expirations) == 0 {
+		return nil
+	}
+	m := &SorobanAuthExpiration{
+		EntryCount: len(t.expirations),
+		Histogram:  newHistogram(authHeadroomBuckets),
+	}
+	for i, expiration := range t.expirations {
+		headroom := int64(expiration) - int64(sequence)
+		if i == 0 || headroom < m.MinHeadroomLedgers {
+			m.MinHeadroomLedgers = headroom
+		}
+		if i == 0 || headroom > m.MaxHeadroomLedgers {
+			m.MaxHeadroomLedgers = headroom
+		}
+		observeHistogram(m.Histogram, uint64(max(headroom, 0)))
+	}
+	return m
+}
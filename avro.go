@@ -0,0 +1,274 @@
+// avro.go
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// avroNamespace is the namespace of every record in the generated schemas.
+const avroNamespace = "io.withobsrvr.latestledger"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// avroEncoder writes payloads as Avro binary datums. Schemas are derived
+// from the payload's Go type: field names follow the json tags (and the
+// configured key casing), pointers become nullable unions, time.Time becomes
+// a timestamp-micros long and every top-level record starts with the
+// network_id, network and schema_version fields.
+type avroEncoder struct {
+	keyCase   string
+	networkID string
+	network   string
+	registry  *schemaRegistry // nil unless schemas are registered
+
+	mu      sync.Mutex
+	schemas map[reflect.Type]string
+}
+
+func newAvroEncoder(keyCase, networkID, network string) *avroEncoder {
+	return &avroEncoder{
+		keyCase:   keyCase,
+		networkID: networkID,
+		network:   network,
+		schemas:   make(map[reflect.Type]string),
+	}
+}
+
+// AvroSchema returns the Avro schema JSON of the payload emitted with the
+// given data_type, using the processor's key casing.
+func (p *LatestLedgerProcessor) AvroSchema(dataType string) (string, error) {
+	t, ok := payloadTypes[dataType]
+	if !ok {
+		return "", fmt.Errorf("unknown data type %q", dataType)
+	}
+	enc := p.avro
+	if enc == nil {
+		enc = newAvroEncoder(p.keyCase, "", "")
+	}
+	return enc.schema(t)
+}
+
+// schema returns the cached schema JSON of a top-level payload type.
+func (e *avroEncoder) schema(t reflect.Type) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s, ok := e.schemas[t]; ok {
+		return s, nil
+	}
+	if t.Kind() != reflect.Struct {
+		return "", fmt.Errorf("avro: payload must be a struct, got %s", t)
+	}
+
+	named := make(map[reflect.Type]bool)
+	record, err := e.recordSchema(t, named)
+	if err != nil {
+		return "", err
+	}
+	networkFields := []map[string]interface{}{
+		{"name": e.fieldName("network_id"), "type": "string"},
+		{"name": "network", "type": "string"},
+		{"name": e.fieldName("schema_version"), "type": "string"},
+	}
+	record["fields"] = append(networkFields, record["fields"].([]map[string]interface{})...)
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	e.schemas[t] = string(data)
+	return e.schemas[t], nil
+}
+
+// marshal encodes v as an Avro binary datum of its schema.
+// With a schema registry, the datum is prefixed with the registered schema
+// ID in the Confluent wire format.
+func (e *avroEncoder) marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	schema, err := e.schema(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	buf := appendAvroString(nil, e.networkID)
+	buf = appendAvroString(buf, e.network)
+	buf = appendAvroString(buf, outputSchemaVersion)
+	if buf, err = appendAvroValue(buf, rv); err != nil {
+		return nil, err
+	}
+	if e.registry == nil {
+		return buf, nil
+	}
+	id, err := e.registry.schemaID(avroNamespace+"."+rv.Type().Name(), schema)
+	if err != nil {
+		return nil, err
+	}
+	return frameSchemaPayload(id, buf), nil
+}
+
+func (e *avroEncoder) fieldName(name string) string {
+	if e.keyCase == keyCaseCamel {
+		return snakeToCamel(name)
+	}
+	return name
+}
+
+func (e *avroEncoder) recordSchema(t reflect.Type, named map[reflect.Type]bool) (map[string]interface{}, error) {
+	named[t] = true
+	fields := []map[string]interface{}{}
+	for _, f := range payloadFields(t) {
+		fieldType := t.Field(f.index).Type
+		typ, err := e.typeSchema(fieldType, named)
+		if err != nil {
+			return nil, fmt.Errorf("avro: %s.%s: %w", t.Name(), f.name, err)
+		}
+		field := map[string]interface{}{"name": e.fieldName(f.name), "type": typ}
+		if fieldType.Kind() == reflect.Ptr {
+			field["default"] = nil
+		}
+		fields = append(fields, field)
+	}
+	return map[string]interface{}{
+		"type":      "record",
+		"name":      t.Name(),
+		"namespace": avroNamespace,
+		"fields":    fields,
+	}, nil
+}
+
+func (e *avroEncoder) typeSchema(t reflect.Type, named map[reflect.Type]bool) (interface{}, error) {
+	if t == timeType {
+		return map[string]interface{}{"type": "long", "logicalType": "timestamp-micros"}, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "long", nil
+	case reflect.Float32, reflect.Float64:
+		return "double", nil
+	case reflect.String:
+		return "string", nil
+	case reflect.Ptr:
+		elem, err := e.typeSchema(t.Elem(), named)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{"null", elem}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes", nil
+		}
+		items, err := e.typeSchema(t.Elem(), named)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := e.typeSchema(t.Elem(), named)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "map", "values": values}, nil
+	case reflect.Struct:
+		if named[t] {
+			// Avro types may only be defined once per schema; later uses
+			// refer to the earlier definition by name.
+			return avroNamespace + "." + t.Name(), nil
+		}
+		return e.recordSchema(t, named)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// appendAvroValue appends the binary encoding of v. It must be kept in step
+// with typeSchema.
+func appendAvroValue(buf []byte, v reflect.Value) ([]byte, error) {
+	if v.Type() == timeType {
+		return appendAvroLong(buf, v.Interface().(time.Time).UnixMicro()), nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendAvroLong(buf, v.Int()), nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := v.Uint()
+		if u > math.MaxInt64 {
+			return nil, fmt.Errorf("avro: %d overflows long", u)
+		}
+		return appendAvroLong(buf, int64(u)), nil
+	case reflect.Float32, reflect.Float64:
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return appendAvroString(buf, v.String()), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return appendAvroLong(buf, 0), nil
+		}
+		return appendAvroValue(appendAvroLong(buf, 1), v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			buf = appendAvroLong(buf, int64(v.Len()))
+			return append(buf, v.Bytes()...), nil
+		}
+		if v.Len() > 0 {
+			buf = appendAvroLong(buf, int64(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				var err error
+				if buf, err = appendAvroValue(buf, v.Index(i)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return appendAvroLong(buf, 0), nil
+	case reflect.Map:
+		if v.Len() > 0 {
+			keys := make([]string, 0, v.Len())
+			for _, k := range v.MapKeys() {
+				keys = append(keys, k.String())
+			}
+			sort.Strings(keys)
+			buf = appendAvroLong(buf, int64(len(keys)))
+			for _, k := range keys {
+				buf = appendAvroString(buf, k)
+				var err error
+				if buf, err = appendAvroValue(buf, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return appendAvroLong(buf, 0), nil
+	case reflect.Struct:
+		for _, f := range payloadFields(v.Type()) {
+			var err error
+			if buf, err = appendAvroValue(buf, v.Field(f.index)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("avro: unsupported type %s", v.Type())
+}
+
+// appendAvroLong appends a zig-zag varint.
+func appendAvroLong(buf []byte, n int64) []byte {
+	return binary.AppendUvarint(buf, uint64((n<<1)^(n>>63)))
+}
+
+func appendAvroString(buf []byte, s string) []byte {
+	buf = appendAvroLong(buf, int64(len(s)))
+	return append(buf, s...)
+}
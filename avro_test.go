@@ -0,0 +1,143 @@
+// avro_test.go
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// avroTestRecord has a field of every kind the encoder supports.
+type avroTestRecord struct {
+	Flag  bool             `json:"flag"`
+	Count int              `json:"count"`
+	Ratio float64          `json:"ratio"`
+	Name  string           `json:"name"`
+	Note  *string          `json:"note,omitempty"`
+	Tags  []string         `json:"tags"`
+	Fees  map[string]int64 `json:"fees"`
+	Raw   []byte           `json:"raw"`
+	At    time.Time        `json:"at"`
+}
+
+func TestAppendAvroLong(t *testing.T) {
+	// Zig-zag varints from the examples of the Avro specification.
+	tests := []struct {
+		n    int64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{-1, []byte{0x01}},
+		{1, []byte{0x02}},
+		{-2, []byte{0x03}},
+		{2, []byte{0x04}},
+		{-64, []byte{0x7f}},
+		{64, []byte{0x80, 0x01}},
+		{-8193, []byte{0x81, 0x80, 0x01}},
+	}
+	for _, tt := range tests {
+		if got := appendAvroLong(nil, tt.n); !bytes.Equal(got, tt.want) {
+			t.Errorf("appendAvroLong(%d) = % x, want % x", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestAvroMarshalGolden(t *testing.T) {
+	note := "hi"
+	enc := newAvroEncoder(keyCaseSnake, "ab", "n")
+	tests := []struct {
+		name   string
+		record avroTestRecord
+		want   []byte
+	}{
+		{
+			name: "empty",
+			want: []byte{
+				0x04, 'a', 'b', // network_id
+				0x02, 'n', // network
+				0x06, '1', '.', '0', // schema_version
+				0x00,                                           // flag
+				0x00,                                           // count
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // ratio
+				0x00,                                                 // name
+				0x00,                                                 // note: null branch
+				0x00,                                                 // tags: end of array
+				0x00,                                                 // fees: end of map
+				0x00,                                                 // raw
+				0xff, 0xff, 0xdd, 0xf2, 0xdf, 0xff, 0xdf, 0xdc, 0x01, // at: the zero time in microseconds
+			},
+		},
+		{
+			name: "set",
+			record: avroTestRecord{
+				Flag:  true,
+				Count: 3,
+				Ratio: 1.5,
+				Name:  "ab",
+				Note:  &note,
+				Tags:  []string{"x"},
+				Fees:  map[string]int64{"b": 2, "a": -1},
+				Raw:   []byte{0xde, 0xad},
+				At:    time.UnixMicro(1),
+			},
+			want: []byte{
+				0x04, 'a', 'b',
+				0x02, 'n',
+				0x06, '1', '.', '0',
+				0x01,
+				0x06,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f,
+				0x04, 'a', 'b',
+				0x02, 0x04, 'h', 'i', // note: value branch
+				0x02, 0x02, 'x', 0x00, // one block of one item
+				0x04, 0x02, 'a', 0x01, 0x02, 'b', 0x04, 0x00, // keys in order
+				0x04, 0xde, 0xad,
+				0x02,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := enc.marshal(tt.record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("marshal = % x\nwant      % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAvroSchemaGolden(t *testing.T) {
+	schema, err := newAvroEncoder(keyCaseCamel, "", "").schema(reflect.TypeOf(avroTestRecord{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"fields":[` +
+		`{"name":"networkId","type":"string"},` +
+		`{"name":"network","type":"string"},` +
+		`{"name":"schemaVersion","type":"string"},` +
+		`{"name":"flag","type":"boolean"},` +
+		`{"name":"count","type":"long"},` +
+		`{"name":"ratio","type":"double"},` +
+		`{"name":"name","type":"string"},` +
+		`{"default":null,"name":"note","type":["null","string"]},` +
+		`{"name":"tags","type":{"items":"string","type":"array"}},` +
+		`{"name":"fees","type":{"type":"map","values":"long"}},` +
+		`{"name":"raw","type":"bytes"},` +
+		`{"name":"at","type":{"logicalType":"timestamp-micros","type":"long"}}` +
+		`],"name":"avroTestRecord","namespace":"io.withobsrvr.latestledger","type":"record"}`
+	if schema != want {
+		t.Errorf("schema =\n%s\nwant\n%s", schema, want)
+	}
+}
+
+func TestFrameSchemaPayload(t *testing.T) {
+	got := frameSchemaPayload(0x01020304, []byte{0xaa})
+	want := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0xaa}
+	if !bytes.Equal(got, want) {
+		t.Errorf("frameSchemaPayload = % x, want % x", got, want)
+	}
+}
@@ -0,0 +1,143 @@
+// backfill.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// BackfillComplete is emitted once the last ledger of the configured backfill
+// range has been processed, so orchestration systems can trigger downstream
+// jobs.
+type BackfillComplete struct {
+	StartLedger              uint32    `json:"start_ledger"`
+	EndLedger                uint32    `json:"end_ledger"`
+	StartedAt                time.Time `json:"started_at"`
+	CompletedAt              time.Time `json:"completed_at"`
+	DurationSeconds          float64   `json:"duration_seconds"`
+	LedgersProcessed         int       `json:"ledgers_processed"`
+	TransactionCount         int       `json:"transaction_count"`
+	TxSetOperationCount      int       `json:"tx_set_operation_count"`
+	SuccessfulOperationCount int       `json:"successful_operation_count"`
+	TotalFeeCharged          int64     `json:"total_fee_charged"`
+	ProcessingErrors         int       `json:"processing_errors"` // Ledgers in the range that failed to process
+	DeliveryErrors           int       `json:"delivery_errors"`   // Failed deliveries to downstream consumers and processors
+}
+
+// backfillTracker accumulates the summary of a configured ledger range.
+type backfillTracker struct {
+	summary BackfillComplete
+	started bool
+	done    bool
+}
+
+// newBackfillTrackerFromConfig parses the optional backfill config block:
+//
+//	"backfill": {"start_ledger": 50000000, "end_ledger": 50100000}
+//
+// It returns nil when no backfill range is configured.
+func newBackfillTrackerFromConfig(config map[string]interface{}) (*backfillTracker, error) {
+	raw, ok := config["backfill"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("backfill must be an object, got %T", raw)
+	}
+	start, err := configInt(block, "start_ledger", 0)
+	if err != nil {
+		return nil, fmt.Errorf("backfill: %w", err)
+	}
+	end, err := configInt(block, "end_ledger", 0)
+	if err != nil {
+		return nil, fmt.Errorf("backfill: %w", err)
+	}
+	if start < 1 || end < start {
+		return nil, fmt.Errorf("backfill: start_ledger and end_ledger must form a range of positive sequences, got %d-%d", start, end)
+	}
+	return &backfillTracker{summary: BackfillComplete{
+		StartLedger: uint32(start),
+		EndLedger:   uint32(end),
+	}}, nil
+}
+
+// inRange reports whether seq belongs to the backfill range.
+func (t *backfillTracker) inRange(seq uint32) bool {
+	return seq >= t.summary.StartLedger && seq <= t.summary.EndLedger
+}
+
+// active reports whether the range is currently being processed.
+func (t *backfillTracker) active() bool {
+	return t.started && !t.done
+}
+
+// start marks the beginning of the range the first time one of its ledgers
+// is seen.
+func (t *backfillTracker) start(seq uint32) {
+	if t.started || !t.inRange(seq) {
+		return
+	}
+	t.started = true
+	t.summary.StartedAt = time.Now().UTC()
+}
+
+// add folds the metrics of a processed ledger into the summary.
+func (t *backfillTracker) add(metrics LatestLedger) {
+	if t.done || !t.inRange(metrics.Sequence) {
+		return
+	}
+	t.summary.LedgersProcessed++
+	t.summary.TransactionCount += metrics.TransactionCount
+	t.summary.TxSetOperationCount += metrics.TxSetOperationCount
+	t.summary.SuccessfulOperationCount += metrics.SuccessfulOperationCount
+	t.summary.TotalFeeCharged += metrics.TotalFeeCharged
+}
+
+// deliveryFailed records n failed downstream deliveries.
+func (t *backfillTracker) deliveryFailed(n int) {
+	if t.active() {
+		t.summary.DeliveryErrors += n
+	}
+}
+
+// finishBackfillLedger records the outcome of processing seq and emits the
+// backfill_complete event once the end of the range has been processed.
+func (p *LatestLedgerProcessor) finishBackfillLedger(ctx context.Context, seq uint32, processErr error) {
+	t := p.backfill
+	if !t.active() || !t.inRange(seq) {
+		return
+	}
+	if processErr != nil {
+		t.summary.ProcessingErrors++
+	}
+	if seq != t.summary.EndLedger {
+		return
+	}
+	t.done = true
+	t.summary.CompletedAt = time.Now().UTC()
+	t.summary.DurationSeconds = t.summary.CompletedAt.Sub(t.summary.StartedAt).Seconds()
+
+	log.Printf("Backfill complete: ledgers %d-%d (processed: %d, processing errors: %d, delivery errors: %d, duration: %.1fs)",
+		t.summary.StartLedger, t.summary.EndLedger, t.summary.LedgersProcessed,
+		t.summary.ProcessingErrors, t.summary.DeliveryErrors, t.summary.DurationSeconds)
+
+	payload, err := p.encodePayload(t.summary)
+	if err != nil {
+		log.Printf("Error marshaling backfill summary: %v", err)
+		return
+	}
+	p.forward(ctx, pluginapi.Message{
+		Payload:   payload,
+		Timestamp: t.summary.CompletedAt,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": seq,
+			"source":          "latest-ledger-processor",
+			"data_type":       "backfill_complete",
+		},
+	})
+}
@@ -0,0 +1,44 @@
+// basefeemultiples.go
+package main
+
+import "github.com/stellar/go/ingest"
+
+// BaseFeeMultipleDistribution counts transactions by how many multiples of
+// the ledger's base fee they bid per operation, showing how aggressively
+// users compete for inclusion.
+type BaseFeeMultipleDistribution struct {
+	OneX          int `json:"one_x"`            // Below 2x the base fee
+	TwoToTenX     int `json:"two_to_ten_x"`     // 2x up to and including 10x
+	TenToHundredX int `json:"ten_to_hundred_x"` // Above 10x up to and including 100x
+	OverHundredX  int `json:"over_hundred_x"`   // Above 100x
+}
+
+// add counts a transaction by its inclusion fee bid. As in the fee stats,
+// the bid is the maximum fee per operation, with fee-bump envelopes counted
+// as an extra operation and using the outer max fee. The declared resource
+// fee of Soroban transactions is not part of the bid.
+func (d *BaseFeeMultipleDistribution) add(tx ingest.LedgerTransaction, baseFee uint32) {
+	ops := int64(len(tx.Envelope.Operations()))
+	maxFee := int64(tx.Envelope.Fee())
+	if newMaxFee, ok := tx.NewMaxFee(); ok {
+		maxFee = int64(newMaxFee)
+		ops++
+	}
+	if ops == 0 || baseFee == 0 {
+		return
+	}
+	if hasSorobanTransaction(tx) {
+		maxFee -= getSorobanMetrics(tx).resourceFee
+	}
+	bid, base := ceilDiv(maxFee, ops), int64(baseFee)
+	switch {
+	case bid < 2*base:
+		d.OneX++
+	case bid <= 10*base:
+		d.TwoToTenX++
+	case bid <= 100*base:
+		d.TenToHundredX++
+	default:
+		d.OverHundredX++
+	}
+}
@@ -0,0 +1,78 @@
+// batchinput.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stellar/go/ingest/ledger"
+	"github.com/stellar/go/xdr"
+	"github.com/withObsrvr/pluginapi"
+)
+
+// zstdMagic starts every zstd frame. Ledger export files are
+// zstd-compressed XDR LedgerCloseMetaBatch objects.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// ledgerBatchFromPayload extracts a LedgerCloseMetaBatch from a message
+// payload: either the decoded struct or its XDR encoding, optionally zstd
+// compressed as written by ledger export tooling. ok is false when the
+// payload is not a batch.
+func ledgerBatchFromPayload(payload interface{}) (batch xdr.LedgerCloseMetaBatch, ok bool, err error) {
+	switch v := payload.(type) {
+	case xdr.LedgerCloseMetaBatch:
+		return v, true, nil
+	case *xdr.LedgerCloseMetaBatch:
+		if v == nil {
+			return batch, true, fmt.Errorf("nil LedgerCloseMetaBatch")
+		}
+		return *v, true, nil
+	case []byte:
+		data := v
+		if bytes.HasPrefix(data, zstdMagic) {
+			decoder, err := zstd.NewReader(nil)
+			if err != nil {
+				return batch, true, err
+			}
+			defer decoder.Close()
+			if data, err = decoder.DecodeAll(data, nil); err != nil {
+				return batch, true, fmt.Errorf("error decompressing ledger batch: %w", err)
+			}
+		}
+		if err := batch.UnmarshalBinary(data); err != nil {
+			return batch, true, fmt.Errorf("error decoding ledger batch: %w", err)
+		}
+		return batch, true, nil
+	}
+	return batch, false, nil
+}
+
+// processBatch processes the ledgers of a batch in order, as if each had
+// arrived in its own message with the batch's metadata. The batch is
+// checked up front so that a malformed batch emits nothing.
+func (p *LatestLedgerProcessor) processBatch(ctx context.Context, msg pluginapi.Message, batch xdr.LedgerCloseMetaBatch) error {
+	if n := len(batch.LedgerCloseMetas); batch.EndSequence < batch.StartSequence ||
+		n != int(batch.EndSequence-batch.StartSequence)+1 {
+		return fmt.Errorf("ledger batch %d-%d holds %d ledgers", batch.StartSequence, batch.EndSequence, n)
+	}
+	for i, lcm := range batch.LedgerCloseMetas {
+		want := uint32(batch.StartSequence) + uint32(i)
+		if seq := ledger.Sequence(lcm); seq != want {
+			return fmt.Errorf("ledger batch %d-%d: expected ledger %d at position %d, got %d",
+				batch.StartSequence, batch.EndSequence, want, i, seq)
+		}
+	}
+
+	for _, lcm := range batch.LedgerCloseMetas {
+		if err := p.processMessage(ctx, pluginapi.Message{
+			Payload:   lcm,
+			Timestamp: msg.Timestamp,
+			Metadata:  msg.Metadata,
+		}); err != nil {
+			return fmt.Errorf("ledger %d: %w", ledger.Sequence(lcm), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+// bigquery.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// bigQueryField is a column of a BigQuery table schema.
+type bigQueryField struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Mode   string          `json:"mode"`
+	Fields []bigQueryField `json:"fields,omitempty"`
+}
+
+// bigQueryTable is the part of a BigQuery table resource that describes
+// its layout.
+type bigQueryTable struct {
+	Schema struct {
+		Fields []bigQueryField `json:"fields"`
+	} `json:"schema"`
+	TimePartitioning *bigQueryTimePartitioning `json:"timePartitioning,omitempty"`
+}
+
+type bigQueryTimePartitioning struct {
+	Type  string `json:"type"`
+	Field string `json:"field"`
+}
+
+// BigQueryTableSchema returns the BigQuery table resource, schema and time
+// partitioning, that the JSON payloads emitted with the given data_type load
+// into directly. Nested objects are RECORD columns, lists are REPEATED,
+// optional values are NULLABLE and tables of payloads with a closed_at
+// timestamp are partitioned by its day. Field names follow the key casing
+// and, for latest_ledger, the field selection of the processor.
+func (p *LatestLedgerProcessor) BigQueryTableSchema(dataType string) (string, error) {
+	t, ok := payloadTypes[dataType]
+	if !ok {
+		return "", fmt.Errorf("unknown data type %q", dataType)
+	}
+	fieldName := func(name string) string {
+		if p.keyCase == keyCaseCamel {
+			return snakeToCamel(name)
+		}
+		return name
+	}
+
+	var table bigQueryTable
+	table.Schema.Fields = []bigQueryField{
+		{Name: fieldName("network_id"), Type: "STRING", Mode: "REQUIRED"},
+		{Name: "network", Type: "STRING", Mode: "REQUIRED"},
+		{Name: fieldName("schema_version"), Type: "STRING", Mode: "REQUIRED"},
+	}
+	for _, f := range payloadFields(t) {
+		if t == payloadTypes["latest_ledger"] && p.fields != nil && !p.fields.keep[f.name] {
+			continue
+		}
+		field, err := bigQueryColumn(t.Field(f.index), f.name, fieldName)
+		if err != nil {
+			return "", fmt.Errorf("bigquery: %s.%s: %w", t.Name(), f.name, err)
+		}
+		table.Schema.Fields = append(table.Schema.Fields, field)
+		if f.name == "closed_at" && field.Type == "TIMESTAMP" {
+			table.TimePartitioning = &bigQueryTimePartitioning{Type: "DAY", Field: field.Name}
+		}
+	}
+
+	data, err := json.MarshalIndent(table, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// bigQueryColumn maps a payload field to a column. Fields that may be left
+// out of the JSON are NULLABLE, and unsigned 64-bit values, which may
+// exceed INT64, are NUMERIC.
+func bigQueryColumn(sf reflect.StructField, name string, fieldName func(string) string) (bigQueryField, error) {
+	t := sf.Type
+	field := bigQueryField{Name: fieldName(name), Mode: "REQUIRED"}
+	if strings.Contains(sf.Tag.Get("json"), ",omitempty") {
+		field.Mode = "NULLABLE"
+	}
+	if t.Kind() == reflect.Ptr {
+		field.Mode = "NULLABLE"
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		field.Mode = "REPEATED"
+		t = t.Elem()
+		if t.Kind() == reflect.Ptr || (t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8) {
+			return field, fmt.Errorf("unsupported list element type %s", t)
+		}
+	}
+
+	switch {
+	case t == timeType:
+		field.Type = "TIMESTAMP"
+	case t.Kind() == reflect.Bool:
+		field.Type = "BOOL"
+	case t.Kind() == reflect.Uint64:
+		field.Type = "NUMERIC"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64,
+		t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint32:
+		field.Type = "INT64"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		field.Type = "FLOAT64"
+	case t.Kind() == reflect.String:
+		field.Type = "STRING"
+	case t.Kind() == reflect.Slice:
+		field.Type = "BYTES"
+	case t.Kind() == reflect.Map:
+		field.Type = "JSON"
+		if field.Mode == "REQUIRED" {
+			// Nil maps are encoded as null.
+			field.Mode = "NULLABLE"
+		}
+	case t.Kind() == reflect.Struct:
+		field.Type = "RECORD"
+		for _, f := range payloadFields(t) {
+			child, err := bigQueryColumn(t.Field(f.index), f.name, fieldName)
+			if err != nil {
+				return field, err
+			}
+			field.Fields = append(field.Fields, child)
+		}
+	default:
+		return field, fmt.Errorf("unsupported type %s", t)
+	}
+	return field, nil
+}
+
+// runBigQuerySchema implements the bigquery-schema command: it prints the
+// BigQuery table resource of a message type for the given processor config.
+func runBigQuerySchema(args []string) error {
+	fs := flag.NewFlagSet("bigquery-schema", flag.ContinueOnError)
+	dataType := fs.String("data-type", "latest_ledger", "data_type of the messages loaded into the table")
+	configPath := fs.String("config", "", "optional JSON file with processor config")
+	fieldsOnly := fs.Bool("fields-only", false, "print only the schema fields, as accepted by bq mk --schema")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config := map[string]interface{}{}
+	if *configPath != "" {
+		var err error
+		if config, err = loadConfigFile(*configPath); err != nil {
+			return err
+		}
+	}
+	// Only the settings that shape the payload matter; building a full
+	// processor would also start exporters and open outputs.
+	keyCase, err := configString(config, "json_key_case", keyCaseSnake)
+	if err != nil {
+		return err
+	}
+	if keyCase != keyCaseSnake && keyCase != keyCaseCamel {
+		return fmt.Errorf("json_key_case must be %q or %q, got %q", keyCaseSnake, keyCaseCamel, keyCase)
+	}
+	fields, err := newFieldSelectionFromConfig(config)
+	if err != nil {
+		return err
+	}
+	processor := &LatestLedgerProcessor{keyCase: keyCase, fields: fields}
+
+	schema, err := processor.BigQueryTableSchema(*dataType)
+	if err != nil {
+		return err
+	}
+	if *fieldsOnly {
+		var table bigQueryTable
+		if err := json.Unmarshal([]byte(schema), &table); err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(table.Schema.Fields, "", "  ")
+		if err != nil {
+			return err
+		}
+		schema = string(data)
+	}
+	fmt.Println(schema)
+	return nil
+}
@@ -0,0 +1,106 @@
+// blobstore.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stellar/go/support/datastore"
+)
+
+// blobStore writes whole files to a local directory or object storage
+// bucket.
+type blobStore interface {
+	put(ctx context.Context, name string, data []byte) error
+}
+
+// newBlobStore returns the store for a destination path: s3://bucket/prefix,
+// gs://bucket/prefix (or gcs://), or a local directory. Cloud credentials
+// are taken from the environment, as with the respective CLIs.
+func newBlobStore(dest string) (blobStore, error) {
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(dest, "s3://"), "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid S3 path %q", dest)
+		}
+		sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+		if err != nil {
+			return nil, fmt.Errorf("error creating AWS session: %w", err)
+		}
+		return &s3BlobStore{client: s3.New(sess), bucket: bucket, prefix: prefix}, nil
+	case strings.HasPrefix(dest, "gs://"), strings.HasPrefix(dest, "gcs://"):
+		_, bucketPath, _ := strings.Cut(dest, "://")
+		if bucketPath == "" {
+			return nil, fmt.Errorf("invalid GCS path %q", dest)
+		}
+		return &gcsBlobStore{bucketPath: bucketPath}, nil
+	default:
+		if err := os.MkdirAll(dest, 0o755); err != nil {
+			return nil, err
+		}
+		return localBlobStore{dir: dest}, nil
+	}
+}
+
+// localBlobStore writes files atomically into a directory.
+type localBlobStore struct {
+	dir string
+}
+
+func (s localBlobStore) put(ctx context.Context, name string, data []byte) error {
+	target := filepath.Join(s.dir, name)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+type s3BlobStore struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+func (s *s3BlobStore) put(ctx context.Context, name string, data []byte) error {
+	_, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path.Join(s.prefix, name)),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+// gcsBlobStore connects lazily, since opening the bucket needs the network.
+type gcsBlobStore struct {
+	bucketPath string
+
+	mu    sync.Mutex
+	store datastore.DataStore
+}
+
+func (s *gcsBlobStore) put(ctx context.Context, name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil {
+		store, err := datastore.NewGCSDataStore(ctx, s.bucketPath, datastore.DataStoreSchema{})
+		if err != nil {
+			return fmt.Errorf("error opening GCS bucket: %w", err)
+		}
+		s.store = store
+	}
+	return s.store.PutFile(ctx, name, bytes.NewReader(data), nil)
+}
@@ -0,0 +1,122 @@
+// canonical.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// canonicalJSON re-encodes a JSON document in canonical form, so that equal
+// payloads are byte-identical: object keys sorted, no insignificant
+// whitespace, no HTML escaping, integers written as is and other numbers in
+// their shortest round-trip form (ECMAScript style, as in RFC 8785). With
+// floatDecimals of 0 or more, non-integer numbers are instead rounded to
+// that many decimal places, without trailing zeros.
+func canonicalJSON(data []byte, floatDecimals int) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := appendCanonical(&buf, v, floatDecimals); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func appendCanonical(buf *bytes.Buffer, v interface{}, floatDecimals int) error {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			appendCanonicalString(buf, k)
+			buf.WriteByte(':')
+			if err := appendCanonical(buf, t[k], floatDecimals); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := appendCanonical(buf, item, floatDecimals); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case json.Number:
+		return appendCanonicalNumber(buf, t, floatDecimals)
+	case string:
+		appendCanonicalString(buf, t)
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case nil:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+// appendCanonicalNumber writes integers digit for digit, so 64-bit values
+// stay exact, and formats fractional numbers from their float64 value.
+func appendCanonicalNumber(buf *bytes.Buffer, n json.Number, floatDecimals int) error {
+	s := n.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if s == "-0" {
+			s = "0"
+		}
+		buf.WriteString(s)
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	if floatDecimals >= 0 {
+		s := strconv.FormatFloat(f, 'f', floatDecimals, 64)
+		if strings.Contains(s, ".") {
+			s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+		}
+		if strings.Trim(s, "-0") == "" {
+			// Rounded to zero, possibly negative.
+			s = "0"
+		}
+		buf.WriteString(s)
+		return nil
+	}
+	if f == 0 {
+		// Covers -0.
+		buf.WriteByte('0')
+		return nil
+	}
+	// encoding/json formats float64 the ECMAScript way.
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
+
+func appendCanonicalString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode terminates the value with a newline.
+	buf.Truncate(buf.Len() - 1)
+}
@@ -0,0 +1,127 @@
+// cbor.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CBOR major types (RFC 8949).
+const (
+	cborUnsigned = 0 << 5
+	cborNegative = 1 << 5
+	cborText     = 3 << 5
+	cborArray    = 4 << 5
+	cborMap      = 5 << 5
+
+	cborFalse   = 0xf4
+	cborTrue    = 0xf5
+	cborNull    = 0xf6
+	cborFloat64 = 0xfb
+)
+
+// jsonToCBOR transcodes a JSON document to CBOR, so CBOR payloads carry
+// exactly the fields, key casing and key order of the JSON ones. Integers
+// are encoded as CBOR integers and other numbers as 64-bit floats; maps and
+// arrays use definite lengths for the benefit of small decoders.
+func jsonToCBOR(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	out, err := appendCBORValue(nil, dec)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func appendCBORValue(buf []byte, dec *json.Decoder) ([]byte, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		var items []byte
+		n := 0
+		for ; dec.More(); n++ {
+			if t == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				s, ok := key.(string)
+				if !ok {
+					return nil, fmt.Errorf("unexpected object key %v", key)
+				}
+				items = appendCBORHead(items, cborText, uint64(len(s)))
+				items = append(items, s...)
+			}
+			if items, err = appendCBORValue(items, dec); err != nil {
+				return nil, err
+			}
+		}
+		// Consume the closing delimiter.
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		major := byte(cborArray)
+		if t == '{' {
+			major = cborMap
+		}
+		buf = appendCBORHead(buf, major, uint64(n))
+		return append(buf, items...), nil
+	case json.Number:
+		return appendCBORNumber(buf, t)
+	case string:
+		buf = appendCBORHead(buf, cborText, uint64(len(t)))
+		return append(buf, t...), nil
+	case bool:
+		if t {
+			return append(buf, cborTrue), nil
+		}
+		return append(buf, cborFalse), nil
+	case nil:
+		return append(buf, cborNull), nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
+
+func appendCBORNumber(buf []byte, n json.Number) ([]byte, error) {
+	s := n.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if strings.HasPrefix(s, "-") {
+			if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return appendCBORHead(buf, cborNegative, uint64(-1-v)), nil
+			}
+		} else if v, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return appendCBORHead(buf, cborUnsigned, v), nil
+		}
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, cborFloat64)
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(f)), nil
+}
+
+// appendCBORHead appends the initial byte and argument of a data item.
+func appendCBORHead(buf []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(buf, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, major|27), n)
+}
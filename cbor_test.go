@@ -0,0 +1,87 @@
+// cbor_test.go
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestJSONToCBORGolden(t *testing.T) {
+	// Encodings from Appendix A of RFC 8949, except where JSON numbers
+	// written as floats or beyond 64 bits are encoded as 64-bit floats.
+	tests := []struct {
+		json string
+		want string
+	}{
+		{`0`, "00"},
+		{`23`, "17"},
+		{`24`, "1818"},
+		{`100`, "1864"},
+		{`1000`, "1903e8"},
+		{`1000000`, "1a000f4240"},
+		{`1000000000000`, "1b000000e8d4a51000"},
+		{`18446744073709551615`, "1bffffffffffffffff"},
+		{`-1`, "20"},
+		{`-10`, "29"},
+		{`-100`, "3863"},
+		{`-1000`, "3903e7"},
+		{`-9223372036854775808`, "3b7fffffffffffffff"},
+		{`-18446744073709551616`, "fbc3f0000000000000"},
+		{`1.1`, "fb3ff199999999999a"},
+		{`-4.1`, "fbc010666666666666"},
+		{`1e3`, "fb408f400000000000"},
+		{`false`, "f4"},
+		{`true`, "f5"},
+		{`null`, "f6"},
+		{`""`, "60"},
+		{`"a"`, "6161"},
+		{`"IETF"`, "6449455446"},
+		{`"ü"`, "62c3bc"},
+		{`[]`, "80"},
+		{`[1, 2, 3]`, "83010203"},
+		{`[1, [2, 3], [4, 5]]`, "8301820203820405"},
+		{`{}`, "a0"},
+		{`{"a": 1, "b": [2, 3]}`, "a26161016162820203"},
+		{`["a", {"b": "c"}]`, "826161a161626163"},
+		// Keys keep the order of the JSON document.
+		{`{"b": 1, "a": 2}`, "a2616201616102"},
+	}
+	for _, tt := range tests {
+		got, err := jsonToCBOR([]byte(tt.json))
+		if err != nil {
+			t.Errorf("jsonToCBOR(%s): %v", tt.json, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("jsonToCBOR(%s) = %x, want %s", tt.json, got, tt.want)
+		}
+	}
+}
+
+func TestJSONToCBORLongItems(t *testing.T) {
+	// A 24-byte string and a 256-item array need a one- and a two-byte
+	// length argument.
+	got, err := jsonToCBOR([]byte(`"abcdefghijklmnopqrstuvwx"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "7818" + hex.EncodeToString([]byte("abcdefghijklmnopqrstuvwx")); hex.EncodeToString(got) != want {
+		t.Errorf("24-byte string = %x, want %s", got, want)
+	}
+
+	array := []byte{'['}
+	for i := 0; i < 256; i++ {
+		if i > 0 {
+			array = append(array, ',')
+		}
+		array = append(array, '0')
+	}
+	array = append(array, ']')
+	got, err = jsonToCBOR(array)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3+256 || hex.EncodeToString(got[:3]) != "990100" {
+		t.Errorf("256-item array starts %x, want 990100", got[:3])
+	}
+}
@@ -0,0 +1,86 @@
+// clawback.go
+package main
+
+import (
+	"log"
+	"sort"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// ClawbackMetrics summarizes clawbacks executed by successful transactions.
+type ClawbackMetrics struct {
+	ClawbackCount                 int           `json:"clawback_count"`
+	ClawbackClaimableBalanceCount int           `json:"clawback_claimable_balance_count"`
+	Amounts                       []AssetAmount `json:"amounts"` // Clawed-back amounts per asset, sorted by asset
+}
+
+// AssetAmount is an amount in stroops of a single asset. Assets use the
+// canonical "CODE:ISSUER" form, or "native" for lumens.
+type AssetAmount struct {
+	Asset  string `json:"asset"`
+	Amount int64  `json:"amount"`
+}
+
+// clawbackTally accumulates clawbacks while a ledger is processed.
+type clawbackTally struct {
+	clawbacks                 int
+	claimableBalanceClawbacks int
+	amounts                   map[string]int64
+}
+
+// add records the clawback operations of a successful transaction. The asset
+// and amount of a clawed-back claimable balance are taken from the balance
+// entry the operation removed.
+func (t *clawbackTally) add(tx ingest.LedgerTransaction) {
+	if !tx.Result.Successful() {
+		return
+	}
+	for i, op := range tx.Envelope.Operations() {
+		switch op.Body.Type {
+		case xdr.OperationTypeClawback:
+			t.clawbacks++
+			clawback := op.Body.MustClawbackOp()
+			t.addAmount(clawback.Asset, int64(clawback.Amount))
+		case xdr.OperationTypeClawbackClaimableBalance:
+			t.claimableBalanceClawbacks++
+			changes, err := tx.GetOperationChanges(uint32(i))
+			if err != nil {
+				log.Printf("Warning: could not read clawback changes for tx %s: %v", tx.Result.TransactionHash.HexString(), err)
+				continue
+			}
+			for _, change := range changes {
+				if change.Type == xdr.LedgerEntryTypeClaimableBalance && change.Pre != nil && change.Post == nil {
+					balance := change.Pre.Data.MustClaimableBalance()
+					t.addAmount(balance.Asset, int64(balance.Amount))
+				}
+			}
+		}
+	}
+}
+
+func (t *clawbackTally) addAmount(asset xdr.Asset, amount int64) {
+	if t.amounts == nil {
+		t.amounts = make(map[string]int64)
+	}
+	t.amounts[asset.StringCanonical()] += amount
+}
+
+// metrics returns the tallied clawbacks, or nil when the ledger had none so
+// the field can be left out of the payload.
+func (t *clawbackTally) metrics() *ClawbackMetrics {
+	if t.clawbacks == 0 && t.claimableBalanceClawbacks == 0 {
+		return nil
+	}
+	m := &ClawbackMetrics{
+		ClawbackCount:                 t.clawbacks,
+		ClawbackClaimableBalanceCount: t.claimableBalanceClawbacks,
+		Amounts:                       make([]AssetAmount, 0, len(t.amounts)),
+	}
+	for asset, amount := range t.amounts {
+		m.Amounts = append(m.Amounts, AssetAmount{Asset: asset, Amount: amount})
+	}
+	sort.Slice(m.Amounts, func(i, j int) bool { return m.Amounts[i].Asset < m.Amounts[j].Asset })
+	return m
+}
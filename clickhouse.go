@@ -0,0 +1,375 @@
+// clickhouse.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the clickhouse config block. Batches are large because the
+// writer targets historical backfills.
+const (
+	defaultClickHouseURL             = "http://localhost:8123"
+	defaultClickHouseTable           = "latest_ledger"
+	defaultClickHouseBatchLedgers    = 1000
+	defaultClickHouseBatchSeconds    = 10
+	defaultClickHouseMaxBufferedRows = 100000
+	clickHouseRequestTimeout         = 60 * time.Second
+)
+
+// clickHouseColumn is a column of the ledger table.
+type clickHouseColumn struct {
+	name    string
+	sqlType string
+}
+
+// clickHouseWriter writes one row per ledger to a ClickHouse table over
+// the HTTP interface, in batches of JSONEachRow inserts sent as
+// asynchronous inserts, so the server coalesces small batches from live
+// streaming and large ones from backfills alike. Rows that fail to write
+// are kept and retried with the next batch.
+type clickHouseWriter struct {
+	insertURL   string
+	user        string
+	password    string
+	database    string
+	table       string
+	createTable bool
+	encoder     *sqlEncoder
+	columns     []clickHouseColumn
+	maxLedgers  int
+	maxAge      time.Duration
+	maxBuffered int
+	client      *http.Client
+
+	mu      sync.Mutex
+	created bool
+	rows    [][]byte  // JSONEachRow lines
+	started time.Time // when the first buffered row was added
+}
+
+// newClickHouseWriterFromConfig parses the optional clickhouse config
+// block:
+//
+//	"clickhouse": {
+//	  "url": "http://localhost:8123",
+//	  "user": "default",
+//	  "password": "",
+//	  "database": "stellar",
+//	  "table": "latest_ledger",
+//	  "create_table": true,
+//	  "async_insert": true,
+//	  "batch_ledgers": 1000,
+//	  "batch_seconds": 10,
+//	  "max_buffered_rows": 100000
+//	}
+//
+// It returns nil when no ClickHouse output is configured.
+func newClickHouseWriterFromConfig(config map[string]interface{}, networkPassphrase, network string) (*clickHouseWriter, error) {
+	raw, ok := config["clickhouse"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("clickhouse must be an object, got %T", raw)
+	}
+	settings := make(map[string]string)
+	for key, def := range map[string]string{
+		"url":      defaultClickHouseURL,
+		"user":     "",
+		"password": "",
+		"database": "",
+		"table":    defaultClickHouseTable,
+	} {
+		value, err := configString(block, key, def)
+		if err != nil {
+			return nil, fmt.Errorf("clickhouse: %w", err)
+		}
+		settings[key] = value
+	}
+	if settings["table"] == "" {
+		return nil, fmt.Errorf("clickhouse: table must not be empty")
+	}
+	createTable, err := configBool(block, "create_table", true)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+	async, err := configBool(block, "async_insert", true)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+	maxLedgers, err := configInt(block, "batch_ledgers", defaultClickHouseBatchLedgers)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+	maxSeconds, err := configInt(block, "batch_seconds", defaultClickHouseBatchSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+	if maxLedgers < 1 || maxSeconds < 1 {
+		return nil, fmt.Errorf("clickhouse: batch_ledgers and batch_seconds must be at least 1")
+	}
+	maxBuffered, err := configInt(block, "max_buffered_rows", defaultClickHouseMaxBufferedRows)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+	if maxBuffered < maxLedgers {
+		return nil, fmt.Errorf("clickhouse: max_buffered_rows must be at least batch_ledgers")
+	}
+
+	base, err := url.Parse(strings.TrimRight(settings["url"], "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("clickhouse: invalid url %q", settings["url"])
+	}
+	w := &clickHouseWriter{
+		user:        settings["user"],
+		password:    settings["password"],
+		database:    settings["database"],
+		table:       settings["table"],
+		createTable: createTable,
+		encoder: &sqlEncoder{
+			dialect:   sqlDialectClickHouse,
+			rename:    parquetRename(keyCaseSnake),
+			constants: networkConstants(networkPassphrase, network),
+		},
+		maxLedgers:  maxLedgers,
+		maxAge:      time.Duration(maxSeconds) * time.Second,
+		maxBuffered: maxBuffered,
+		client:      &http.Client{Timeout: clickHouseRequestTimeout},
+	}
+	if w.columns, err = clickHouseColumns(); err != nil {
+		return nil, fmt.Errorf("clickhouse: %w", err)
+	}
+	query := url.Values{
+		"query": {"INSERT INTO " + w.quotedTable() + " FORMAT JSONEachRow"},
+		// Timestamps are RFC 3339 strings.
+		"date_time_input_format": {"best_effort"},
+	}
+	if async {
+		query.Set("async_insert", "1")
+		query.Set("wait_for_async_insert", "1")
+	}
+	base.RawQuery = query.Encode()
+	w.insertURL = base.String()
+	return w, nil
+}
+
+// clickHouseColumns returns the columns of the ledger table: the network
+// constants, then the latest_ledger fields flattened as in the sql payload
+// encoding.
+func clickHouseColumns() ([]clickHouseColumn, error) {
+	columns := []clickHouseColumn{
+		{"network_id", "LowCardinality(String)"},
+		{"network", "LowCardinality(String)"},
+		{"schema_version", "LowCardinality(String)"},
+	}
+	err := appendClickHouseColumns(reflect.TypeOf(LatestLedger{}), "", false, &columns)
+	return columns, err
+}
+
+// appendClickHouseColumns appends the columns of a payload type in the
+// order of sqlEncoder.flattenValue. Optional values are Nullable; lists
+// and maps are JSON text. Nulls sent for other columns, such as nil lists,
+// are stored as the column default.
+func appendClickHouseColumns(t reflect.Type, name string, optional bool, columns *[]clickHouseColumn) error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		optional = true
+	}
+	if t.Kind() == reflect.Struct && t != timeType {
+		prefix := ""
+		if name != "" {
+			prefix = name + "_"
+		}
+		for _, f := range payloadFields(t) {
+			if err := appendClickHouseColumns(t.Field(f.index).Type, prefix+f.name, optional, columns); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var sqlType string
+	switch {
+	case t == timeType:
+		sqlType = "DateTime64(3, 'UTC')"
+	case t.Kind() == reflect.Bool:
+		sqlType = "Bool"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		sqlType = "Int64"
+	case t.Kind() == reflect.Uint64 || t.Kind() == reflect.Uint:
+		sqlType = "UInt64"
+	case t.Kind() >= reflect.Uint8 && t.Kind() <= reflect.Uint32:
+		sqlType = "UInt32"
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		sqlType = "Float64"
+	case t.Kind() == reflect.String:
+		sqlType = "String"
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Map:
+		*columns = append(*columns, clickHouseColumn{name, "String"})
+		return nil
+	default:
+		return fmt.Errorf("%s: unsupported type %s", name, t)
+	}
+	if optional {
+		sqlType = "Nullable(" + sqlType + ")"
+	}
+	*columns = append(*columns, clickHouseColumn{name, sqlType})
+	return nil
+}
+
+// quoteClickHouse quotes an identifier with backquotes.
+func quoteClickHouse(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quotedTable returns the quoted table name, qualified with the database
+// when one is set.
+func (w *clickHouseWriter) quotedTable() string {
+	if w.database == "" {
+		return quoteClickHouse(w.table)
+	}
+	return quoteClickHouse(w.database) + "." + quoteClickHouse(w.table)
+}
+
+// clickHouseTableDDL returns the CREATE TABLE statement of the ledger
+// table. It is a ReplacingMergeTree ordered by network and sequence, so
+// rows of replayed and corrected ledgers replace the earlier ones when
+// parts are merged, and partitioned by month of close time.
+func clickHouseTableDDL(table string, columns []clickHouseColumn) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %s\n(\n", table)
+	for i, c := range columns {
+		sep := ","
+		if i == len(columns)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, "    %s %s%s\n", quoteClickHouse(c.name), c.sqlType, sep)
+	}
+	b.WriteString(")\nENGINE = ReplacingMergeTree\nPARTITION BY toYYYYMM(closed_at)\nORDER BY (network_id, sequence)")
+	return b.String()
+}
+
+// add buffers the row of a ledger and writes the batch once it is due.
+func (w *clickHouseWriter) add(ctx context.Context, metrics LatestLedger) {
+	columns, values, err := w.encoder.row(reflect.ValueOf(metrics))
+	if err != nil {
+		log.Printf("Warning: ClickHouse row for ledger %d: %v", metrics.Sequence, err)
+		return
+	}
+	row := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		if f, ok := values[i].(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			values[i] = nil // not representable in JSON
+		}
+		row[column] = values[i]
+	}
+	line, err := json.Marshal(row)
+	if err != nil {
+		log.Printf("Warning: ClickHouse row for ledger %d: %v", metrics.Sequence, err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.rows) == 0 {
+		w.started = time.Now()
+	}
+	w.rows = append(w.rows, line)
+	if dropped := len(w.rows) - w.maxBuffered; dropped > 0 {
+		log.Printf("Warning: ClickHouse buffer full, dropping the %d oldest rows", dropped)
+		w.rows = w.rows[dropped:]
+	}
+	if len(w.rows) < w.maxLedgers && time.Since(w.started) < w.maxAge {
+		return
+	}
+	if err := w.write(ctx); err != nil {
+		log.Printf("Warning: writing %d ledgers to ClickHouse failed: %v", len(w.rows), err)
+	}
+}
+
+// write inserts the buffered rows in one request, creating the table first
+// if this is the first write and create_table is set.
+func (w *clickHouseWriter) write(ctx context.Context) error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	if w.createTable && !w.created {
+		base, err := url.Parse(w.insertURL)
+		if err != nil {
+			return err
+		}
+		base.RawQuery = ""
+		ddl := clickHouseTableDDL(w.quotedTable(), w.columns)
+		if err := w.post(ctx, base.String(), []byte(ddl)); err != nil {
+			return fmt.Errorf("creating table: %w", err)
+		}
+		w.created = true
+	}
+	if err := w.post(ctx, w.insertURL, bytes.Join(w.rows, []byte{'\n'})); err != nil {
+		return err
+	}
+	w.rows = w.rows[:0]
+	return nil
+}
+
+// post sends a request body to the HTTP interface.
+func (w *clickHouseWriter) post(ctx context.Context, endpoint string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if w.user != "" {
+		req.Header.Set("X-ClickHouse-User", w.user)
+		req.Header.Set("X-ClickHouse-Key", w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// flush writes the buffered rows, if any.
+func (w *clickHouseWriter) flush(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.write(ctx)
+}
+
+// runClickHouseDDL implements the clickhouse-ddl command: it prints the
+// CREATE TABLE statement of the ClickHouse ledger table.
+func runClickHouseDDL(args []string) error {
+	fs := flag.NewFlagSet("clickhouse-ddl", flag.ContinueOnError)
+	table := fs.String("table", defaultClickHouseTable, "table name")
+	database := fs.String("database", "", "optional database of the table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	columns, err := clickHouseColumns()
+	if err != nil {
+		return err
+	}
+	w := &clickHouseWriter{database: *database, table: *table}
+	fmt.Println(clickHouseTableDDL(w.quotedTable(), columns) + ";")
+	return nil
+}
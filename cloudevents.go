@@ -0,0 +1,145 @@
+// cloudevents.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// defaultCloudEventTypePrefix is prepended to the data_type to form the
+// CloudEvents type, e.g. io.withobsrvr.latestledger.latest_ledger.
+const defaultCloudEventTypePrefix = "io.withobsrvr.latestledger."
+
+// cloudEventContentTypes maps payload encodings to their content type.
+var cloudEventContentTypes = map[string]string{
+	payloadEncodingJSON:    "application/json",
+	payloadEncodingAvro:    "application/avro",
+	payloadEncodingCSV:     "text/csv",
+	payloadEncodingCBOR:    "application/cbor",
+	payloadEncodingSQL:     "application/sql",
+	payloadEncodingParquet: "application/vnd.apache.parquet",
+	payloadEncodingNDJSON:  "application/x-ndjson",
+}
+
+// cloudEvent is a CloudEvents 1.0 envelope in structured JSON mode. JSON
+// payloads are embedded as data; other encodings are carried in data_base64.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+// cloudEventSettings configures the optional CloudEvents envelope.
+type cloudEventSettings struct {
+	source     string
+	typePrefix string
+}
+
+// newCloudEventSettingsFromConfig parses the optional cloudevents config
+// block:
+//
+//	"cloudevents": {"source": "urn:obsrvr:latest-ledger:pubnet", "type_prefix": "io.withobsrvr.latestledger."}
+//
+// It returns nil when forwarded messages are not wrapped.
+func newCloudEventSettingsFromConfig(config map[string]interface{}, network string) (*cloudEventSettings, error) {
+	raw, ok := config["cloudevents"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cloudevents must be an object, got %T", raw)
+	}
+	source, err := configString(block, "source", "latest-ledger-processor/"+network)
+	if err != nil {
+		return nil, fmt.Errorf("cloudevents: %w", err)
+	}
+	if source == "" {
+		return nil, fmt.Errorf("cloudevents: source must not be empty")
+	}
+	typePrefix, err := configString(block, "type_prefix", defaultCloudEventTypePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("cloudevents: %w", err)
+	}
+	return &cloudEventSettings{source: source, typePrefix: typePrefix}, nil
+}
+
+// messageID returns the deterministic ID of a decorated message, built from
+// its network ID, data_type and ledger sequence, plus what tells apart the
+// messages of a ledger with the same type: transaction hash, event, or
+// schedule and schedule time. Corrections get an ID of their own.
+func messageID(metadata map[string]interface{}) string {
+	networkID, _ := metadata["network_id"].(string)
+	id := networkID + ":" + fmt.Sprint(metadata["data_type"]) + ":" + fmt.Sprint(metadata["ledger_sequence"])
+	if hash, ok := metadata["transaction_hash"].(string); ok {
+		id += ":" + hash
+	}
+	if event, ok := metadata["event"].(string); ok {
+		id += ":" + event
+	}
+	if scheduledAt, ok := metadata["scheduled_at"].(string); ok {
+		id += ":" + fmt.Sprint(metadata["schedule"]) + ":" + scheduledAt
+	}
+	if correction, _ := metadata["correction"].(bool); correction {
+		id += ":correction"
+	}
+	return id
+}
+
+// wrapCloudEvent replaces the payload of msg with a CloudEvents envelope.
+// The subject is the ledger sequence and the time is the close time of the
+// ledger being processed, or the schedule time of a scheduled report. IDs
+// are deterministic, so a redelivered message keeps its ID while
+// corrections get their own.
+func (p *LatestLedgerProcessor) wrapCloudEvent(msg *pluginapi.Message) {
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return
+	}
+	dataType := fmt.Sprint(msg.Metadata["data_type"])
+	subject := fmt.Sprint(msg.Metadata["ledger_sequence"])
+	id := messageID(msg.Metadata)
+	scheduledAt, scheduled := msg.Metadata["scheduled_at"].(string)
+
+	// Messages such as ledger blocks set their own encoding.
+	encoding, _ := msg.Metadata["encoding"].(string)
+	if encoding == "" {
+		encoding = payloadEncodingJSON
+	}
+	event := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              id,
+		Source:          p.cloudEvents.source,
+		Type:            p.cloudEvents.typePrefix + dataType,
+		Subject:         subject,
+		DataContentType: cloudEventContentTypes[encoding],
+	}
+	if scheduled {
+		event.Time = scheduledAt
+	} else if !p.closedAt.IsZero() {
+		event.Time = p.closedAt.Format(time.RFC3339)
+	}
+	if encoding == payloadEncodingJSON {
+		event.Data = payload
+	} else {
+		event.DataBase64 = payload
+	}
+
+	wrapped, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Warning: wrapping %s in a CloudEvent failed: %v", dataType, err)
+		return
+	}
+	msg.Payload = wrapped
+	msg.Metadata["content_type"] = "application/cloudevents+json"
+}
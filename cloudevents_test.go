@@ -0,0 +1,52 @@
+// cloudevents_test.go
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+func TestWrapCloudEventContentTypes(t *testing.T) {
+	tests := []struct {
+		encoding    string
+		payload     string
+		contentType string
+		embedded    bool
+	}{
+		{payloadEncodingJSON, `{"sequence":7}`, "application/json", true},
+		{payloadEncodingSQL, "INSERT INTO latest_ledger VALUES (7);", "application/sql", false},
+		{payloadEncodingCSV, "7\n", "text/csv", false},
+		{payloadEncodingParquet, "PAR1", "application/vnd.apache.parquet", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			p := &LatestLedgerProcessor{cloudEvents: &cloudEventSettings{source: "test", typePrefix: defaultCloudEventTypePrefix}}
+			msg := pluginapi.Message{
+				Payload: []byte(tt.payload),
+				Metadata: map[string]interface{}{
+					"data_type":       "latest_ledger",
+					"ledger_sequence": uint32(7),
+					"encoding":        tt.encoding,
+				},
+			}
+			p.wrapCloudEvent(&msg)
+
+			var event cloudEvent
+			if err := json.Unmarshal(msg.Payload.([]byte), &event); err != nil {
+				t.Fatal(err)
+			}
+			if event.DataContentType != tt.contentType {
+				t.Errorf("datacontenttype = %q, want %q", event.DataContentType, tt.contentType)
+			}
+			if tt.embedded {
+				if string(event.Data) != tt.payload || event.DataBase64 != nil {
+					t.Errorf("data = %s, data_base64 = %q, want the payload embedded as data", event.Data, event.DataBase64)
+				}
+			} else if string(event.DataBase64) != tt.payload || event.Data != nil {
+				t.Errorf("data = %s, data_base64 = %q, want the payload in data_base64", event.Data, event.DataBase64)
+			}
+		})
+	}
+}
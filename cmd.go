@@ -0,0 +1,56 @@
+// cmd.go
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// main provides command line tooling around the processor. It is ignored
+// when the package is built with -buildmode=plugin.
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "compare":
+		err = runCompare(os.Args[2:])
+	case "serve":
+		err = runServe(os.Args[2:])
+	case "bigquery-schema":
+		err = runBigQuerySchema(os.Args[2:])
+	case "clickhouse-ddl":
+		err = runClickHouseDDL(os.Args[2:])
+	case "grpc-proto":
+		err = runGRPCProto(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: %s <command> [flags]
+
+Commands:
+  compare   Diff the output of the current processor against the frozen baseline
+  serve     Run the processor over an archive and serve the metrics over HTTP
+  bigquery-schema
+            Print the BigQuery table schema of a message type
+  clickhouse-ddl
+            Print the CREATE TABLE statement of the ClickHouse ledger table
+  grpc-proto
+            Print the protobuf definition of the gRPC ledger service
+`, os.Args[0])
+}
@@ -0,0 +1,328 @@
+// compare.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/stellar/go/support/datastore"
+	"github.com/withObsrvr/pluginapi"
+
+	"github.com/withObsrvr/flow-processor-latestledger/internal/baseline"
+)
+
+// fieldDiff summarizes how a single output field differs between the
+// baseline and the current processor across the compared range.
+type fieldDiff struct {
+	Field          string   `json:"field"`
+	Status         string   `json:"status"` // "added", "removed", "changed" or "identical"
+	ChangedLedgers int      `json:"changed_ledgers"`
+	Examples       []string `json:"examples,omitempty"` // First few differing values
+}
+
+// compareReport is the result of the compare command.
+type compareReport struct {
+	BaselineVersion string      `json:"baseline_version"`
+	CurrentVersion  string      `json:"current_version"`
+	From            uint32      `json:"from"`
+	To              uint32      `json:"to"`
+	Ledgers         int         `json:"ledgers"`
+	Fields          []fieldDiff `json:"fields"`
+}
+
+// maxDiffExamples caps the example values kept per field.
+const maxDiffExamples = 3
+
+// captureConsumer collects the payloads forwarded by the processor.
+type captureConsumer struct {
+	dataType string
+	payloads [][]byte
+}
+
+func (c *captureConsumer) Name() string                                   { return "compare-capture" }
+func (c *captureConsumer) Version() string                                { return "1.0.0" }
+func (c *captureConsumer) Type() pluginapi.PluginType                     { return pluginapi.ConsumerPlugin }
+func (c *captureConsumer) Initialize(config map[string]interface{}) error { return nil }
+func (c *captureConsumer) Close() error                                   { return nil }
+
+func (c *captureConsumer) Process(ctx context.Context, msg pluginapi.Message) error {
+	if msg.Metadata["data_type"] != c.dataType {
+		return nil
+	}
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("unexpected payload type %T", msg.Payload)
+	}
+	c.payloads = append(c.payloads, payload)
+	return nil
+}
+
+// runCompare implements the compare command: it runs the frozen baseline
+// extraction and the current processor over the same ledgers and reports
+// field-level differences.
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	passphrase := fs.String("network-passphrase", "", "network passphrase of the ledgers (required)")
+	configPath := fs.String("config", "", "optional JSON file with processor config for the current version")
+	fixtures := fs.String("fixtures", "", "directory of <sequence>.xdr LedgerCloseMeta fixtures")
+	datastoreType := fs.String("datastore-type", "GCS", "ledger export data store type")
+	datastorePath := fs.String("datastore-path", "", "ledger export bucket path (used when -fixtures is not set)")
+	ledgersPerFile := fs.Uint("ledgers-per-file", 1, "ledgers per file in the data store")
+	filesPerPartition := fs.Uint("files-per-partition", 64000, "files per partition in the data store")
+	from := fs.Uint("from", 0, "first ledger sequence (required)")
+	to := fs.Uint("to", 0, "last ledger sequence (required)")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	failOnChange := fs.Bool("fail-on-change", false, "exit with an error when any existing field changed value")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *passphrase == "" || *from == 0 || *to < *from {
+		return fmt.Errorf("-network-passphrase, -from and -to (>= from) are required")
+	}
+
+	ctx := context.Background()
+	var source ledgerSource
+	switch {
+	case *fixtures != "":
+		source = newFixtureSource(*fixtures)
+	case *datastorePath != "":
+		ds, err := newDatastoreSource(ctx, datastore.DataStoreConfig{
+			Type:   *datastoreType,
+			Params: map[string]string{"destination_bucket_path": *datastorePath},
+			Schema: datastore.DataStoreSchema{
+				LedgersPerFile:    uint32(*ledgersPerFile),
+				FilesPerPartition: uint32(*filesPerPartition),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		source = ds
+	default:
+		return fmt.Errorf("either -fixtures or -datastore-path is required")
+	}
+	defer source.Close()
+
+	config := map[string]interface{}{}
+	if *configPath != "" {
+		var err error
+		if config, err = loadConfigFile(*configPath); err != nil {
+			return err
+		}
+	}
+	config["network_passphrase"] = *passphrase
+	// Comparison decodes the emitted plain JSON payloads.
+	config["payload_encoding"] = payloadEncodingJSON
+	delete(config, "cloudevents")
+	delete(config, "ledger_blocks")
+	delete(config, "json_lines")
+	delete(config, "latest_ledger_output")
+	delete(config, "file_sink")
+	for k := range builtinSinkSettings {
+		delete(config, k)
+	}
+	delete(config, "payload_compression")
+	delete(config, "schema_registry")
+	delete(config, "namespace")
+	delete(config, "int64_as_string")
+	delete(config, "timestamp_format")
+	// Comparisons are not live measurements.
+	delete(config, "telemetry")
+	delete(config, "influxdb")
+	delete(config, "postgres")
+	delete(config, "clickhouse")
+	delete(config, "object_storage")
+	delete(config, "history_store")
+
+	report, err := compareRange(ctx, source, config, uint32(*from), uint32(*to))
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printCompareReport(os.Stdout, report)
+	}
+
+	if *failOnChange {
+		for _, f := range report.Fields {
+			if f.Status == "changed" || f.Status == "removed" {
+				return fmt.Errorf("output differs from baseline %s", report.BaselineVersion)
+			}
+		}
+	}
+	return nil
+}
+
+// compareRange processes [from, to] with both extractors and diffs the
+// resulting records field by field.
+func compareRange(ctx context.Context, source ledgerSource, config map[string]interface{}, from, to uint32) (*compareReport, error) {
+	processor, err := NewLatestLedgerProcessor(config)
+	if err != nil {
+		return nil, err
+	}
+	capture := &captureConsumer{dataType: "latest_ledger"}
+	processor.RegisterConsumer(capture)
+	extractor := baseline.NewExtractor(processor.networkPassphrase)
+
+	if err := source.PrepareRange(ctx, from, to); err != nil {
+		return nil, fmt.Errorf("error preparing range: %w", err)
+	}
+
+	report := &compareReport{
+		BaselineVersion: baseline.Version,
+		CurrentVersion:  processor.Version(),
+		From:            from,
+		To:              to,
+	}
+	diffs := make(map[string]*fieldDiff)
+
+	for seq := from; seq <= to; seq++ {
+		lcm, err := source.GetLedger(ctx, seq)
+		if err != nil {
+			return nil, fmt.Errorf("error getting ledger %d: %w", seq, err)
+		}
+
+		baseMetrics, err := extractor.Extract(lcm)
+		if err != nil {
+			return nil, fmt.Errorf("baseline failed on ledger %d: %w", seq, err)
+		}
+		baseJSON, err := json.Marshal(baseMetrics)
+		if err != nil {
+			return nil, err
+		}
+
+		capture.payloads = nil
+		if err := processor.Process(ctx, pluginapi.Message{Payload: lcm}); err != nil {
+			return nil, fmt.Errorf("current processor failed on ledger %d: %w", seq, err)
+		}
+		if len(capture.payloads) != 1 {
+			return nil, fmt.Errorf("expected one latest_ledger record for ledger %d, got %d", seq, len(capture.payloads))
+		}
+
+		baseFields, err := flattenJSON(baseJSON)
+		if err != nil {
+			return nil, err
+		}
+		currentFields, err := flattenJSON(capture.payloads[0])
+		if err != nil {
+			return nil, err
+		}
+		diffFields(diffs, seq, baseFields, currentFields)
+		report.Ledgers++
+	}
+
+	for _, d := range diffs {
+		report.Fields = append(report.Fields, *d)
+	}
+	sort.Slice(report.Fields, func(i, j int) bool { return report.Fields[i].Field < report.Fields[j].Field })
+	return report, nil
+}
+
+// diffFields folds the differences of one ledger into diffs.
+func diffFields(diffs map[string]*fieldDiff, seq uint32, base, current map[string]string) {
+	get := func(field string) *fieldDiff {
+		d, ok := diffs[field]
+		if !ok {
+			d = &fieldDiff{Field: field, Status: "identical"}
+			diffs[field] = d
+		}
+		return d
+	}
+
+	for field, baseValue := range base {
+		d := get(field)
+		currentValue, ok := current[field]
+		if !ok {
+			d.Status = "removed"
+			continue
+		}
+		if currentValue != baseValue {
+			if d.Status == "identical" {
+				d.Status = "changed"
+			}
+			d.ChangedLedgers++
+			if len(d.Examples) < maxDiffExamples {
+				d.Examples = append(d.Examples, fmt.Sprintf("ledger %d: %s -> %s", seq, baseValue, currentValue))
+			}
+		}
+	}
+	for field := range current {
+		if _, ok := base[field]; !ok {
+			get(field).Status = "added"
+		}
+	}
+}
+
+// flattenJSON flattens a JSON object into dotted field paths mapped to the
+// JSON encoding of their scalar values.
+func flattenJSON(data []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	flattenValue(fields, "", v)
+	return fields, nil
+}
+
+func flattenValue(fields map[string]string, prefix string, v interface{}) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, child := range t {
+			flattenValue(fields, join(key), child)
+		}
+	case []interface{}:
+		for i, child := range t {
+			flattenValue(fields, join(strconv.Itoa(i)), child)
+		}
+	default:
+		encoded, _ := json.Marshal(t)
+		fields[prefix] = string(encoded)
+	}
+}
+
+func printCompareReport(w io.Writer, report *compareReport) {
+	fmt.Fprintf(w, "Compared %d ledgers (%d-%d): baseline %s vs current %s\n\n",
+		report.Ledgers, report.From, report.To, report.BaselineVersion, report.CurrentVersion)
+	for _, f := range report.Fields {
+		switch f.Status {
+		case "identical":
+			continue
+		case "changed":
+			fmt.Fprintf(w, "  changed  %s (%d ledgers)\n", f.Field, f.ChangedLedgers)
+			for _, example := range f.Examples {
+				fmt.Fprintf(w, "             %s\n", example)
+			}
+		default:
+			fmt.Fprintf(w, "  %-8s %s\n", f.Status, f.Field)
+		}
+	}
+	identical := 0
+	for _, f := range report.Fields {
+		if f.Status == "identical" {
+			identical++
+		}
+	}
+	fmt.Fprintf(w, "\n%d fields identical\n", identical)
+}
@@ -0,0 +1,89 @@
+// compression.go
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"log"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/withObsrvr/pluginapi"
+)
+
+// compressionGzip is the gzip value of the payload_compression setting; the
+// other values are shared with the Parquet compression setting.
+const compressionGzip = "gzip"
+
+// payloadCompressor compresses serialized payloads before they are
+// forwarded.
+type payloadCompressor struct {
+	algorithm string
+	zstd      *zstd.Encoder // safe for concurrent EncodeAll calls
+}
+
+// newPayloadCompressorFromConfig parses the payload_compression setting:
+// "none" (the default), "gzip" or "zstd". It returns nil without
+// compression.
+func newPayloadCompressorFromConfig(config map[string]interface{}) (*payloadCompressor, error) {
+	algorithm, err := configString(config, "payload_compression", compressionNone)
+	if err != nil {
+		return nil, err
+	}
+	compressor, err := newPayloadCompressor(algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("payload_compression %w", err)
+	}
+	return compressor, nil
+}
+
+// newPayloadCompressor returns the compressor of an algorithm, or nil for
+// "none".
+func newPayloadCompressor(algorithm string) (*payloadCompressor, error) {
+	switch algorithm {
+	case compressionNone:
+		return nil, nil
+	case compressionGzip:
+		return &payloadCompressor{algorithm: algorithm}, nil
+	case compressionZstd:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creating zstd encoder: %w", err)
+		}
+		return &payloadCompressor{algorithm: algorithm, zstd: encoder}, nil
+	}
+	return nil, fmt.Errorf("must be %q, %q or %q, got %q", compressionNone, compressionGzip, compressionZstd, algorithm)
+}
+
+func (c *payloadCompressor) compress(data []byte) ([]byte, error) {
+	if c.zstd != nil {
+		return c.zstd.EncodeAll(data, make([]byte, 0, len(data)/4)), nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressPayload compresses the payload of msg and records the algorithm in
+// its content_encoding metadata. A payload that fails to compress is
+// forwarded as is.
+func (p *LatestLedgerProcessor) compressPayload(msg *pluginapi.Message) {
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return
+	}
+	compressed, err := p.compressor.compress(payload)
+	if err != nil {
+		log.Printf("Warning: compressing %v payload for ledger %v failed, forwarding it uncompressed: %v",
+			msg.Metadata["data_type"], msg.Metadata["ledger_sequence"], err)
+		return
+	}
+	msg.Payload = compressed
+	msg.Metadata["content_encoding"] = p.compressor.algorithm
+}
@@ -0,0 +1,163 @@
+// config.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// configBool reads an optional boolean setting, falling back to def when the
+// key is absent.
+func configBool(config map[string]interface{}, key string, def bool) (bool, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return def, nil
+	}
+	v, ok := raw.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s must be a boolean, got %T", key, raw)
+	}
+	return v, nil
+}
+
+// configInt reads an optional integer setting, falling back to def when the
+// key is absent. Numbers decoded from JSON arrive as float64, or as
+// json.Number when decoded with UseNumber, so both are accepted as long as
+// they are whole.
+func configInt(config map[string]interface{}, key string, def int) (int, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return def, nil
+	}
+	switch v := raw.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%s must be an integer, got %v", key, v)
+		}
+		return int(v), nil
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("%s must be an integer, got %v", key, v)
+		}
+		return int(n), nil
+	default:
+		return 0, fmt.Errorf("%s must be an integer, got %T", key, raw)
+	}
+}
+
+// configFloat reads an optional number.
+func configFloat(config map[string]interface{}, key string, def float64) (float64, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return def, nil
+	}
+	switch v := raw.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a number, got %v", key, v)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("%s must be a number, got %T", key, raw)
+	}
+}
+
+// configStringSlice reads an optional list of strings.
+func configStringSlice(config map[string]interface{}, key string) ([]string, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	switch v := raw.(type) {
+	case []string:
+		return v, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of strings, got element of type %T", key, item)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("%s must be a list of strings, got %T", key, raw)
+	}
+}
+
+// configString reads an optional string setting, falling back to def when the
+// key is absent.
+func configString(config map[string]interface{}, key string, def string) (string, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return def, nil
+	}
+	v, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string, got %T", key, raw)
+	}
+	return v, nil
+}
+
+// configStringMap reads an optional object whose values are all strings.
+func configStringMap(config map[string]interface{}, key string) (map[string]string, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	switch v := raw.(type) {
+	case map[string]string:
+		return v, nil
+	case map[string]interface{}:
+		values := make(map[string]string, len(v))
+		for k, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s.%s must be a string, got %T", key, k, item)
+			}
+			values[k] = s
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("%s must be an object of strings, got %T", key, raw)
+	}
+}
+
+// configIntSlice reads an optional list of integers. Like configInt, it
+// accepts whole floats as decoded from JSON.
+func configIntSlice(config map[string]interface{}, key string) ([]int, error) {
+	raw, ok := config[key]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	switch v := raw.(type) {
+	case []int:
+		return v, nil
+	case []interface{}:
+		values := make([]int, 0, len(v))
+		for i, item := range v {
+			n, err := configInt(map[string]interface{}{key: item}, key, 0)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d] must be an integer, got %v", key, i, item)
+			}
+			values = append(values, n)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("%s must be a list of integers, got %T", key, raw)
+	}
+}
@@ -0,0 +1,101 @@
+// consensus.go
+package main
+
+import (
+	"time"
+
+	"github.com/stellar/go/xdr"
+)
+
+// targetCloseSeconds is the ledger close interval the network aims for.
+const targetCloseSeconds = 5.0
+
+// ConsensusTiming describes how long consensus took to close a ledger,
+// relative to the network's target close interval. Durations have the
+// one-second resolution of ledger close times.
+type ConsensusTiming struct {
+	CloseTimeDelta   float64 `json:"close_time_delta_seconds"`  // Seconds since the previous ledger closed
+	TargetCloseTime  float64 `json:"target_close_time_seconds"` // Network target close interval
+	DeviationSeconds float64 `json:"deviation_seconds"`         // Close time delta minus the target
+	// SCP statistics, only present when the ledger close meta carries SCP info
+	ScpMessageCount   *int `json:"scp_message_count,omitempty"`
+	ScpValidatorCount *int `json:"scp_validator_count,omitempty"` // Distinct nodes that sent SCP messages
+	// Seconds from the earliest close time proposed in SCP nomination to the
+	// agreed close time, an estimate of how long nomination took. Only
+	// present when the SCP info carries nomination statements.
+	NominationSeconds *float64 `json:"nomination_seconds,omitempty"`
+}
+
+// consensusTiming returns the consensus timing of a ledger, or nil when the
+// previous ledger was not processed and the delta is unknown.
+func consensusTiming(lcm xdr.LedgerCloseMeta, metrics LatestLedger, previous *ledgerHeaderValues) *ConsensusTiming {
+	if previous == nil {
+		return nil
+	}
+	delta := metrics.ClosedAt.Sub(previous.closedAt).Seconds()
+	timing := &ConsensusTiming{
+		CloseTimeDelta:   delta,
+		TargetCloseTime:  targetCloseSeconds,
+		DeviationSeconds: delta - targetCloseSeconds,
+	}
+
+	var scpInfo []xdr.ScpHistoryEntry
+	if v0, ok := lcm.GetV0(); ok {
+		scpInfo = v0.ScpInfo
+	} else if v1, ok := lcm.GetV1(); ok {
+		scpInfo = v1.ScpInfo
+	}
+	if len(scpInfo) == 0 {
+		return timing
+	}
+
+	messages := 0
+	validators := make(map[string]bool)
+	var earliest time.Time
+	for _, entry := range scpInfo {
+		if entry.V0 == nil {
+			continue
+		}
+		for _, envelope := range entry.V0.LedgerMessages.Messages {
+			messages++
+			validators[xdr.AccountId(envelope.Statement.NodeId).Address()] = true
+			if nomination, ok := envelope.Statement.Pledges.GetNominate(); ok {
+				for _, proposed := range nominatedCloseTimes(nomination, previous.closedAt, metrics.ClosedAt) {
+					if earliest.IsZero() || proposed.Before(earliest) {
+						earliest = proposed
+					}
+				}
+			}
+		}
+	}
+	validatorCount := len(validators)
+	timing.ScpMessageCount = &messages
+	timing.ScpValidatorCount = &validatorCount
+	if !earliest.IsZero() {
+		nomination := metrics.ClosedAt.Sub(earliest).Seconds()
+		timing.NominationSeconds = &nomination
+	}
+	return timing
+}
+
+// nominatedCloseTimes returns the close times of the values voted for or
+// accepted in a nomination statement. Validators propose the time they
+// start nominating and the highest proposal is agreed on, so only times
+// after the previous close and up to the agreed close are returned;
+// values that do not decode are skipped.
+func nominatedCloseTimes(nomination xdr.ScpNomination, previousClose, closedAt time.Time) []time.Time {
+	var times []time.Time
+	for _, values := range [][]xdr.Value{nomination.Votes, nomination.Accepted} {
+		for _, value := range values {
+			var stellarValue xdr.StellarValue
+			if err := xdr.SafeUnmarshal(value, &stellarValue); err != nil {
+				continue
+			}
+			proposed := time.Unix(int64(stellarValue.CloseTime), 0).UTC()
+			if proposed.After(previousClose) && !proposed.After(closedAt) {
+				times = append(times, proposed)
+			}
+		}
+	}
+	return times
+}
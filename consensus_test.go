@@ -0,0 +1,73 @@
+// consensus_test.go
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/xdr"
+)
+
+// nominationEnvelope returns a NOMINATE statement by a random node voting
+// for values with the close times.
+func nominationEnvelope(t *testing.T, closeTimes ...int64) xdr.ScpEnvelope {
+	t.Helper()
+	var votes []xdr.Value
+	for _, closeTime := range closeTimes {
+		value, err := xdr.StellarValue{CloseTime: xdr.TimePoint(closeTime)}.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		votes = append(votes, value)
+	}
+	node := xdr.MustAddress(keypair.MustRandom().Address())
+	return xdr.ScpEnvelope{Statement: xdr.ScpStatement{
+		NodeId: xdr.NodeId(node),
+		Pledges: xdr.ScpStatementPledges{
+			Type:     xdr.ScpStatementTypeScpStNominate,
+			Nominate: &xdr.ScpNomination{Votes: votes},
+		},
+	}}
+}
+
+func TestConsensusTimingNomination(t *testing.T) {
+	previous := &ledgerHeaderValues{closedAt: time.Unix(1000, 0).UTC()}
+	metrics := LatestLedger{ClosedAt: time.Unix(1006, 0).UTC()}
+	lcm := xdr.LedgerCloseMeta{V: 1, V1: &xdr.LedgerCloseMetaV1{
+		ScpInfo: []xdr.ScpHistoryEntry{{V0: &xdr.ScpHistoryEntryV0{
+			LedgerMessages: xdr.LedgerScpMessages{Messages: []xdr.ScpEnvelope{
+				// 999 predates the previous close and 1010 follows the agreed
+				// close, so neither is a proposal for this ledger.
+				nominationEnvelope(t, 1004, 999),
+				nominationEnvelope(t, 1002, 1006, 1010),
+			}},
+		}}},
+	}}
+
+	timing := consensusTiming(lcm, metrics, previous)
+	if timing.CloseTimeDelta != 6 || timing.DeviationSeconds != 1 {
+		t.Errorf("close time delta %v, deviation %v, want 6 and 1", timing.CloseTimeDelta, timing.DeviationSeconds)
+	}
+	if timing.ScpMessageCount == nil || *timing.ScpMessageCount != 2 {
+		t.Errorf("scp_message_count = %v, want 2", timing.ScpMessageCount)
+	}
+	if timing.ScpValidatorCount == nil || *timing.ScpValidatorCount != 2 {
+		t.Errorf("scp_validator_count = %v, want 2", timing.ScpValidatorCount)
+	}
+	if timing.NominationSeconds == nil || *timing.NominationSeconds != 4 {
+		t.Errorf("nomination_seconds = %v, want 4", timing.NominationSeconds)
+	}
+}
+
+func TestConsensusTimingWithoutSCPInfo(t *testing.T) {
+	previous := &ledgerHeaderValues{closedAt: time.Unix(1000, 0).UTC()}
+	metrics := LatestLedger{ClosedAt: time.Unix(1005, 0).UTC()}
+	timing := consensusTiming(xdr.LedgerCloseMeta{V: 1, V1: &xdr.LedgerCloseMetaV1{}}, metrics, previous)
+	if timing.ScpMessageCount != nil || timing.NominationSeconds != nil {
+		t.Errorf("SCP fields set without SCP info: %+v", timing)
+	}
+	if consensusTiming(xdr.LedgerCloseMeta{V: 1, V1: &xdr.LedgerCloseMetaV1{}}, metrics, nil) != nil {
+		t.Error("timing reported without the previous ledger")
+	}
+}
@@ -0,0 +1,192 @@
+// csv.go
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// csvEncoder writes payloads as CSV rows for spreadsheet and ETL tools.
+// Nested objects are flattened into parent_child columns, lists are written
+// as JSON and every row starts with the network_id and network columns.
+type csvEncoder struct {
+	columns     []string // selected columns in output order; all columns when empty
+	headerEvery int      // repeat the header every this many rows of a type; 0 writes it once
+	rename      func(string) string
+	constants   []parquetConstant
+	timeFormat  string
+
+	mu   sync.Mutex
+	rows map[reflect.Type]int // rows written per payload type
+}
+
+// newCSVEncoderFromConfig parses the csv settings:
+//
+//	"csv": {"columns": ["sequence", "closed_at", "transaction_count"], "header_every": 720}
+func newCSVEncoderFromConfig(config map[string]interface{}, keyCase, timeFormat, networkPassphrase, network string) (*csvEncoder, error) {
+	block := map[string]interface{}{}
+	if raw, ok := config["csv"]; ok && raw != nil {
+		if block, ok = raw.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("csv must be an object, got %T", raw)
+		}
+	}
+	columns, err := configStringSlice(block, "columns")
+	if err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+	headerEvery, err := configInt(block, "header_every", 0)
+	if err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+	if headerEvery < 0 {
+		return nil, fmt.Errorf("csv: header_every must not be negative, got %d", headerEvery)
+	}
+
+	rename := func(s string) string { return s }
+	if keyCase == keyCaseCamel {
+		rename = snakeToCamel
+	}
+	return &csvEncoder{
+		columns:     columns,
+		headerEvery: headerEvery,
+		rename:      rename,
+		constants: []parquetConstant{
+			{rename("network_id"), networkIDHex(networkPassphrase)},
+			{"network", network},
+			{rename("schema_version"), outputSchemaVersion},
+		},
+		timeFormat: timeFormat,
+		rows:       make(map[reflect.Type]int),
+	}, nil
+}
+
+// marshal encodes v as one CSV row, preceded by the header row for the
+// first row of each payload type and then every headerEvery rows, so files
+// rotated on that boundary start with a header.
+func (e *csvEncoder) marshal(v interface{}) ([]byte, error) {
+	names, values, err := e.flatten(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	n := e.rows[reflect.TypeOf(v)]
+	e.rows[reflect.TypeOf(v)]++
+	e.mu.Unlock()
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if n == 0 || (e.headerEvery > 0 && n%e.headerEvery == 0) {
+		w.Write(names)
+	}
+	w.Write(values)
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// header returns the header row of a payload type, without line ending.
+func (e *csvEncoder) header(t reflect.Type) string {
+	names, _, err := e.flatten(reflect.Zero(t))
+	if err != nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(names)
+	w.Flush()
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// flatten returns the selected column names and values of a payload.
+func (e *csvEncoder) flatten(v reflect.Value) ([]string, []string, error) {
+	var names, values []string
+	for _, constant := range e.constants {
+		names = append(names, constant.name)
+		values = append(values, constant.value)
+	}
+	if err := e.flattenValue(v, "", true, &names, &values); err != nil {
+		return nil, nil, err
+	}
+	if len(e.columns) == 0 {
+		return names, values, nil
+	}
+
+	byName := make(map[string]string, len(names))
+	for i, name := range names {
+		byName[name] = values[i]
+	}
+	selected := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		// Columns a payload type does not have are left empty.
+		selected[i] = byName[column]
+	}
+	return e.columns, selected, nil
+}
+
+func (e *csvEncoder) flattenValue(v reflect.Value, name string, present bool, names, values *[]string) error {
+	typ := v.Type()
+	switch {
+	case typ == timeType:
+	case typ.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return e.flattenValue(reflect.Zero(typ.Elem()), name, false, names, values)
+		}
+		return e.flattenValue(v.Elem(), name, present, names, values)
+	case typ.Kind() == reflect.Struct:
+		prefix := ""
+		if name != "" {
+			prefix = name + "_"
+		}
+		for _, f := range payloadFields(typ) {
+			if err := e.flattenValue(v.Field(f.index), prefix+f.name, present, names, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	*names = append(*names, e.rename(name))
+	if (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map) && v.IsNil() {
+		present = false
+	}
+	if !present {
+		*values = append(*values, "")
+		return nil
+	}
+
+	var value string
+	switch {
+	case typ == timeType:
+		value = formatTime(v.Interface().(time.Time), e.timeFormat)
+	case typ.Kind() == reflect.Bool:
+		value = strconv.FormatBool(v.Bool())
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Int64:
+		value = strconv.FormatInt(v.Int(), 10)
+	case typ.Kind() >= reflect.Uint && typ.Kind() <= reflect.Uint64:
+		value = strconv.FormatUint(v.Uint(), 10)
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		value = strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case typ.Kind() == reflect.String:
+		value = v.String()
+	case typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map:
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return fmt.Errorf("csv: %s: %w", name, err)
+		}
+		if data, err = rewriteJSONKeys(data, e.rename); err != nil {
+			return fmt.Errorf("csv: %s: %w", name, err)
+		}
+		value = string(data)
+	default:
+		return fmt.Errorf("csv: %s: unsupported type %s", name, typ)
+	}
+	*values = append(*values, value)
+	return nil
+}
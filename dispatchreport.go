@@ -0,0 +1,124 @@
+// dispatchreport.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Outcomes of a delivery in a dispatch report.
+const (
+	dispatchDelivered = "delivered"
+	dispatchFailed    = "failed"
+	dispatchHeld      = "held"
+	dispatchDropped   = "dropped"
+)
+
+// DispatchReport lists what happened to every message forwarded for a
+// ledger, so pipeline problems can be traced without correlating log lines.
+type DispatchReport struct {
+	LedgerSequence uint32            `json:"ledger_sequence"`
+	Deliveries     []DispatchOutcome `json:"deliveries"`
+}
+
+// DispatchOutcome is the delivery of one message to one consumer or
+// processor. Messages held while forwarding is paused have a single
+// outcome without a consumer.
+type DispatchOutcome struct {
+	DataType  string  `json:"data_type"`
+	Consumer  string  `json:"consumer,omitempty"`
+	Outcome   string  `json:"outcome"` // delivered, failed, held or dropped
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+	Attempts  int     `json:"attempts"` // 1 unless the sink retries failed deliveries itself
+}
+
+// retryingTarget is implemented by sinks that retry failed deliveries
+// themselves: webhooks, Kafka and NATS.
+type retryingTarget interface {
+	// lastAttempts returns the number of attempts of the latest delivery.
+	lastAttempts() int
+}
+
+// dispatchTrace collects the delivery outcomes of the ledger being
+// processed. Concurrent deliveries record into it from several goroutines.
+type dispatchTrace struct {
+	mu         sync.Mutex
+	active     bool
+	deliveries []DispatchOutcome
+}
+
+// start begins tracing the deliveries of a new ledger.
+func (t *dispatchTrace) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active = true
+	t.deliveries = nil
+}
+
+// record adds an outcome while a ledger is traced. Messages forwarded
+// outside of ledger processing, such as scheduled reports, are not traced.
+func (t *dispatchTrace) record(outcome DispatchOutcome) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active {
+		t.deliveries = append(t.deliveries, outcome)
+	}
+}
+
+// finish stops tracing and returns the recorded outcomes.
+func (t *dispatchTrace) finish() []DispatchOutcome {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active = false
+	deliveries := t.deliveries
+	t.deliveries = nil
+	return deliveries
+}
+
+// recordDelivery traces the delivery of msg to a target.
+func (p *LatestLedgerProcessor) recordDelivery(msg pluginapi.Message, target downstream, started time.Time, err error) {
+	outcome := DispatchOutcome{
+		DataType:  fmt.Sprint(msg.Metadata["data_type"]),
+		Consumer:  target.Name(),
+		Outcome:   dispatchDelivered,
+		LatencyMs: float64(time.Since(started).Microseconds()) / 1000,
+		Attempts:  1,
+	}
+	if retrying, ok := target.(retryingTarget); ok {
+		outcome.Attempts = retrying.lastAttempts()
+	}
+	if err != nil {
+		outcome.Outcome = dispatchFailed
+		outcome.Error = err.Error()
+	}
+	p.dispatchTrace.record(outcome)
+}
+
+// forwardDispatchReport emits the dispatch_report of a ledger once all of
+// its messages have been forwarded. The report's own delivery is not traced.
+func (p *LatestLedgerProcessor) forwardDispatchReport(ctx context.Context, msg pluginapi.Message, seq uint32) {
+	report := DispatchReport{LedgerSequence: seq, Deliveries: p.dispatchTrace.finish()}
+	if report.Deliveries == nil {
+		report.Deliveries = []DispatchOutcome{}
+	}
+	payload, err := p.encodePayload(report)
+	if err != nil {
+		log.Printf("Warning: marshaling dispatch report for ledger %d failed: %v", seq, err)
+		return
+	}
+	p.forward(ctx, pluginapi.Message{
+		Payload:   payload,
+		Timestamp: msg.Timestamp,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": seq,
+			"source":          "latest-ledger-processor",
+			"data_type":       "dispatch_report",
+		},
+	})
+}
@@ -0,0 +1,68 @@
+// dispatchreport_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stellar/go/network"
+	"github.com/withObsrvr/pluginapi"
+)
+
+func TestDispatchReportCountsRetries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every first request of a message fails.
+		if requests.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	processor, err := NewLatestLedgerProcessor(map[string]interface{}{
+		"network_passphrase": network.TestNetworkPassphrase,
+		"dispatch_report":    true,
+		"webhooks":           []interface{}{map[string]interface{}{"url": server.URL, "name": "hook", "retry_backoff_ms": 0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.Close()
+	consumer := &recordingConsumer{}
+	processor.RegisterConsumer(consumer)
+
+	lcm := testLedger(t, network.TestNetworkPassphrase, 5, 1_700_000_000, 1)
+	if err := processor.Process(context.Background(), pluginapi.Message{Payload: lcm}); err != nil {
+		t.Fatal(err)
+	}
+	var report *DispatchReport
+	for _, msg := range consumer.messages {
+		if msg.Metadata["data_type"] == "dispatch_report" {
+			report = &DispatchReport{}
+			if err := json.Unmarshal(msg.Payload.([]byte), report); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if report == nil || len(report.Deliveries) == 0 {
+		t.Fatalf("no dispatch report forwarded: %+v", report)
+	}
+	retried := 0
+	for _, delivery := range report.Deliveries {
+		want := 1
+		if delivery.Consumer == "hook" {
+			want = 2
+			retried++
+		}
+		if delivery.Outcome != dispatchDelivered || delivery.Attempts != want {
+			t.Errorf("delivery to %s: %s after %d attempts, want delivered after %d", delivery.Consumer, delivery.Outcome, delivery.Attempts, want)
+		}
+	}
+	if retried == 0 {
+		t.Errorf("no delivery to the webhook in %+v", report.Deliveries)
+	}
+}
@@ -0,0 +1,53 @@
+// duplicates.go
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// duplicateTxDetector counts transaction hashes that reappear within a
+// rolling window of ledgers. A valid ledger stream never repeats a hash, so
+// any reappearance points at a reconstructed or merged source replaying
+// data.
+type duplicateTxDetector struct {
+	seen *windowedSet
+}
+
+// newDuplicateTxDetectorFromConfig builds the detector when
+// duplicate_tx_window_ledgers is set. It returns nil when detection is
+// disabled.
+func newDuplicateTxDetectorFromConfig(config map[string]interface{}, stateDir string) (*duplicateTxDetector, error) {
+	window, err := configInt(config, "duplicate_tx_window_ledgers", 0)
+	if err != nil {
+		return nil, err
+	}
+	if window < 0 {
+		return nil, fmt.Errorf("duplicate_tx_window_ledgers must not be negative, got %d", window)
+	}
+	if window == 0 {
+		return nil, nil
+	}
+	seen, err := newWindowedSet(uint32(window), stateDir, "tx_hashes")
+	if err != nil {
+		return nil, err
+	}
+	return &duplicateTxDetector{seen: seen}, nil
+}
+
+// count advances the window to seq, records the ledger's transaction hashes
+// and returns how many of them were already seen within the window.
+func (d *duplicateTxDetector) count(seq uint32, hashes []string) int {
+	d.seen.advance(seq)
+	duplicates := 0
+	for _, hash := range hashes {
+		if !d.seen.observe(hash) {
+			duplicates++
+			log.Printf("Warning: transaction %s in ledger %d was already seen within the last %d ledgers", hash, seq, d.seen.retention)
+		}
+	}
+	if err := d.seen.flush(); err != nil {
+		log.Printf("Warning: could not save transaction hash state: %v", err)
+	}
+	return duplicates
+}
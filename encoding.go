@@ -0,0 +1,237 @@
+// encoding.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Supported values for the json_key_case setting.
+const (
+	keyCaseSnake = "snake_case"
+	keyCaseCamel = "camelCase"
+)
+
+// Supported values for the payload_encoding setting.
+const (
+	payloadEncodingJSON = "json"
+	payloadEncodingAvro = "avro"
+	payloadEncodingCSV  = "csv"
+	payloadEncodingCBOR = "cbor"
+	payloadEncodingSQL  = "sql"
+	// payloadEncodingStruct forwards the payload structs themselves, for
+	// in-process consumers.
+	payloadEncodingStruct = "struct"
+)
+
+// Encodings of messages that carry the records of several ledgers, set in
+// their encoding metadata.
+const (
+	payloadEncodingParquet = "parquet"
+	payloadEncodingNDJSON  = "ndjson"
+)
+
+// payloadTypes maps each emitted data_type to the Go type of its payload.
+var payloadTypes = map[string]reflect.Type{
+	"latest_ledger":         reflect.TypeOf(LatestLedger{}),
+	"latest_ledger_raw":     reflect.TypeOf(LatestLedgerRaw{}),
+	"latest_ledger_derived": reflect.TypeOf(LatestLedgerDerived{}),
+	"fee_stats":             reflect.TypeOf(FeeStats{}),
+	"config_alert":          reflect.TypeOf(ConfigAlert{}),
+	"ledger_upgrade":        reflect.TypeOf(LedgerUpgradeEvent{}),
+	"backfill_complete":     reflect.TypeOf(BackfillComplete{}),
+	"ledger_transaction":    reflect.TypeOf(LedgerTransactionRecord{}),
+	"hot_keys":              reflect.TypeOf(HotKeyReport{}),
+	"fee_surge":             reflect.TypeOf(FeeSurgeEvent{}),
+	"scheduled_report":      reflect.TypeOf(ScheduledReport{}),
+	"dispatch_report":       reflect.TypeOf(DispatchReport{}),
+	"new_contract_seen":     reflect.TypeOf(NewContractSeenEvent{}),
+	"new_asset_seen":        reflect.TypeOf(NewAssetSeenEvent{}),
+}
+
+// encodePayload returns the payload of a forwarded message. With the struct
+// payload encoding, it is a pointer to a copy of v that the processor does
+// not retain, so consumers may keep it; otherwise it is v serialized by
+// marshalPayload.
+func (p *LatestLedgerProcessor) encodePayload(v interface{}) (interface{}, error) {
+	if p.payloadEncoding != payloadEncodingStruct {
+		return p.marshalPayload(v)
+	}
+	if metrics, ok := v.(LatestLedger); ok {
+		clone := metrics.Clone()
+		return &clone, nil
+	}
+	copied := reflect.New(reflect.TypeOf(v))
+	copied.Elem().Set(reflect.ValueOf(v))
+	return copied.Interface(), nil
+}
+
+// marshalPayload serializes an emitted record, identifying the network and
+// applying the configured key casing. Every payload leaving the processor
+// goes through here so that all message types share the same conventions.
+// With Avro, CSV or SQL encoding the payload is an Avro binary datum (see
+// AvroSchema), CSV rows or an INSERT statement instead; CBOR payloads are
+// transcoded from the JSON ones.
+func (p *LatestLedgerProcessor) marshalPayload(v interface{}) ([]byte, error) {
+	switch {
+	case p.avro != nil:
+		return p.avro.marshal(v)
+	case p.csv != nil:
+		return p.csv.marshal(v)
+	case p.sql != nil:
+		return p.sql.marshal(v)
+	}
+	_, isLedger := v.(LatestLedger)
+	filtered := isLedger && p.fields != nil
+	prefix := p.networkFields
+	if filtered {
+		// The network members are added after field selection.
+		prefix = nil
+	}
+	data, err := marshalJSONPayload(v, jsonOptions{int64Strings: p.int64Strings, timeFormat: p.timeFormat}, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if filtered {
+		if data, err = p.fields.filter(data); err != nil {
+			return nil, err
+		}
+		data = withNetworkFields(data, p.networkFields)
+	}
+	if p.keyCase == keyCaseCamel {
+		if data, err = rewriteJSONKeys(data, snakeToCamel); err != nil {
+			return nil, err
+		}
+	}
+	if p.flatKeys {
+		if data, err = flattenPayload(data, p.keyCase); err != nil {
+			return nil, err
+		}
+	}
+	if p.canonicalJSON {
+		if data, err = canonicalJSON(data, p.floatDecimals); err != nil {
+			return nil, err
+		}
+	}
+	if p.payloadEncoding == payloadEncodingCBOR {
+		return jsonToCBOR(data)
+	}
+	return data, nil
+}
+
+// payloadField is a struct field that appears in the JSON encoding of a
+// payload.
+type payloadField struct {
+	index int
+	name  string
+}
+
+// payloadFields lists the fields of a struct that appear in its JSON
+// encoding, in declaration order.
+func payloadFields(t reflect.Type) []payloadField {
+	var fields []payloadField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		fields = append(fields, payloadField{index: i, name: name})
+	}
+	return fields
+}
+
+// rewriteJSONKeys returns a copy of the JSON document with every object key
+// passed through rename. Key order and number literals are preserved.
+func rewriteJSONKeys(data []byte, rename func(string) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := rewriteJSONValue(dec, &buf, rename); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func rewriteJSONValue(dec *json.Decoder, buf *bytes.Buffer, rename func(string) string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			buf.WriteByte('{')
+			for i := 0; dec.More(); i++ {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key, ok := keyTok.(string)
+				if !ok {
+					return fmt.Errorf("unexpected object key %v", keyTok)
+				}
+				keyBytes, _ := json.Marshal(rename(key))
+				buf.Write(keyBytes)
+				buf.WriteByte(':')
+				if err := rewriteJSONValue(dec, buf, rename); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte('}')
+		case '[':
+			buf.WriteByte('[')
+			for i := 0; dec.More(); i++ {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := rewriteJSONValue(dec, buf, rename); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+		}
+		// Consume the closing delimiter.
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	case json.Number:
+		buf.WriteString(t.String())
+	default:
+		scalar, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		buf.Write(scalar)
+	}
+	return nil
+}
+
+// snakeToCamel converts snake_case to camelCase, e.g.
+// "tx_set_operation_count" becomes "txSetOperationCount".
+func snakeToCamel(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,187 @@
+// failover.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/stellar/go/xdr"
+)
+
+// failoverHealthInterval is how often the archives that are not being read
+// are health checked, and how long a failed check or read counts against an
+// archive.
+const failoverHealthInterval = 30 * time.Second
+
+// failoverProbeTimeout bounds a single health check.
+const failoverProbeTimeout = 10 * time.Second
+
+// failoverSource reads ledgers from the first healthy archive of a list
+// ordered by preference. While reading, the other archives are health
+// checked every failoverHealthInterval by probing them for the last ledger
+// read. When the active archive fails, reading continues at the same ledger
+// from the next archive whose latest check passed, checking it first if
+// that result is stale; once a preferred archive passes a check again,
+// reading is handed back to it.
+//
+// Only one archive is open at a time: the data store backends cannot
+// re-prepare a range, so every handoff opens the next archive afresh at the
+// cursor.
+type failoverSource struct {
+	archives       []*archiveConfig
+	health         []archiveHealth
+	healthInterval time.Duration
+	checkedAt      time.Time // when the standby archives were last checked
+	to             uint32
+	lastRead       uint32 // 0 until a ledger has been read
+
+	current int
+	source  ledgerSource // nil when no archive is open
+}
+
+// archiveHealth is the outcome of the latest health check or read of an
+// archive.
+type archiveHealth struct {
+	at  time.Time // zero until the archive is checked
+	err error     // nil when the check passed
+}
+
+func newFailoverSource(archives []*archiveConfig) *failoverSource {
+	return &failoverSource{
+		archives:       archives,
+		health:         make([]archiveHealth, len(archives)),
+		healthInterval: failoverHealthInterval,
+	}
+}
+
+func (s *failoverSource) PrepareRange(ctx context.Context, from, to uint32) error {
+	s.to = to
+	return s.activate(ctx, from)
+}
+
+func (s *failoverSource) GetLedger(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error) {
+	if s.source != nil && time.Since(s.checkedAt) >= s.healthInterval {
+		s.checkStandbys(ctx, sequence)
+		if s.preferredHealthy() {
+			log.Printf("Failover: preferred archive passed its health check, switching back at ledger %d", sequence)
+			s.closeSource()
+		}
+	}
+	for {
+		if s.source == nil {
+			if err := s.activate(ctx, sequence); err != nil {
+				return xdr.LedgerCloseMeta{}, err
+			}
+		}
+		lcm, err := s.source.GetLedger(ctx, sequence)
+		if err == nil {
+			s.lastRead = sequence
+			return lcm, nil
+		}
+		if ctx.Err() != nil {
+			return lcm, err
+		}
+		log.Printf("Warning: archive %s failed at ledger %d, failing over: %v", s.archives[s.current].describe(), sequence, err)
+		s.health[s.current] = archiveHealth{at: time.Now(), err: err}
+		s.closeSource()
+	}
+}
+
+func (s *failoverSource) Close() error {
+	return s.closeSource()
+}
+
+// activate opens the most preferred healthy archive and prepares it to read
+// from the given ledger onwards. An archive is only opened after passing a
+// health check within the health interval, except for the most preferred
+// archive when reading starts.
+func (s *failoverSource) activate(ctx context.Context, from uint32) error {
+	var errs []error
+	for i, archive := range s.archives {
+		if i > 0 || s.lastRead != 0 {
+			if err := s.checkedHealth(ctx, i, from); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", archive.describe(), err))
+				continue
+			}
+		}
+		source, err := archive.openSingle(ctx)
+		if err == nil {
+			if err = source.PrepareRange(ctx, from, s.to); err != nil {
+				source.Close()
+			}
+		}
+		if err != nil {
+			log.Printf("Warning: archive %s unavailable at ledger %d: %v", archive.describe(), from, err)
+			s.health[i] = archiveHealth{at: time.Now(), err: err}
+			errs = append(errs, fmt.Errorf("%s: %w", archive.describe(), err))
+			continue
+		}
+		if i != s.current {
+			log.Printf("Failover: reading from archive %s at ledger %d", archive.describe(), from)
+		}
+		s.current, s.source = i, source
+		return nil
+	}
+	return fmt.Errorf("no archive available at ledger %d: %w", from, errors.Join(errs...))
+}
+
+// checkedHealth returns the error of the latest health check of archive i,
+// checking it first if that result is older than the health interval.
+func (s *failoverSource) checkedHealth(ctx context.Context, i int, from uint32) error {
+	if h := s.health[i]; !h.at.IsZero() && time.Since(h.at) < s.healthInterval {
+		return h.err
+	}
+	s.probe(ctx, i, from)
+	return s.health[i].err
+}
+
+// checkStandbys health checks every archive other than the active one.
+func (s *failoverSource) checkStandbys(ctx context.Context, sequence uint32) {
+	for i := range s.archives {
+		if i != s.current {
+			s.probe(ctx, i, sequence)
+		}
+	}
+	s.checkedAt = time.Now()
+}
+
+// probe checks that archive i holds the last ledger read, or the first
+// ledger to read when nothing has been read yet. The ledger being waited
+// for at the tip of the network may not be published anywhere yet, so it
+// is not probed.
+func (s *failoverSource) probe(ctx context.Context, i int, from uint32) {
+	sequence := from
+	if s.lastRead != 0 {
+		sequence = s.lastRead
+	}
+	ctx, cancel := context.WithTimeout(ctx, failoverProbeTimeout)
+	defer cancel()
+	err := s.archives[i].probe(ctx, sequence)
+	if err != nil && s.health[i].err == nil {
+		log.Printf("Warning: archive %s failed its health check at ledger %d: %v", s.archives[i].describe(), sequence, err)
+	}
+	s.health[i] = archiveHealth{at: time.Now(), err: err}
+}
+
+// preferredHealthy reports whether an archive preferred over the active one
+// passed its latest health check.
+func (s *failoverSource) preferredHealthy() bool {
+	for i := 0; i < s.current; i++ {
+		if h := s.health[i]; !h.at.IsZero() && h.err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *failoverSource) closeSource() error {
+	if s.source == nil {
+		return nil
+	}
+	err := s.source.Close()
+	s.source = nil
+	return err
+}
@@ -0,0 +1,102 @@
+// failover_test.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stellar/go/xdr"
+)
+
+// writeFixtures writes fixture ledgers whose total coins identify the
+// archive they were read from.
+func writeFixtures(t *testing.T, dir string, archive int64, sequences ...uint32) {
+	t.Helper()
+	for _, seq := range sequences {
+		lcm := xdr.LedgerCloseMeta{V: 0, V0: &xdr.LedgerCloseMetaV0{
+			LedgerHeader: xdr.LedgerHeaderHistoryEntry{Header: xdr.LedgerHeader{
+				LedgerSeq:  xdr.Uint32(seq),
+				TotalCoins: xdr.Int64(archive),
+			}},
+		}}
+		data, err := lcm.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.xdr", seq)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readArchive returns the archive a ledger was read from.
+func readArchive(t *testing.T, s *failoverSource, seq uint32) int64 {
+	t.Helper()
+	lcm, err := s.GetLedger(context.Background(), seq)
+	if err != nil {
+		t.Fatalf("ledger %d: %v", seq, err)
+	}
+	return int64(lcm.V0.LedgerHeader.Header.TotalCoins)
+}
+
+func TestFailoverSkipsStandbysFailingHealthChecks(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	writeFixtures(t, dirs[0], 0, 10, 11)
+	// The first standby is down: it holds none of the ledgers.
+	writeFixtures(t, dirs[2], 2, 10, 11, 12, 13, 14)
+	var archives []*archiveConfig
+	for _, dir := range dirs {
+		archives = append(archives, &archiveConfig{sourceType: "fixtures", path: dir})
+	}
+	s := newFailoverSource(archives)
+	defer s.Close()
+	if err := s.PrepareRange(context.Background(), 10, 14); err != nil {
+		t.Fatal(err)
+	}
+
+	for seq, want := range map[uint32]int64{10: 0, 11: 0} {
+		if got := readArchive(t, s, seq); got != want {
+			t.Errorf("ledger %d read from archive %d, want %d", seq, got, want)
+		}
+	}
+	if got := readArchive(t, s, 12); got != 2 {
+		t.Errorf("ledger 12 read from archive %d, want 2", got)
+	}
+	if s.health[1].err == nil {
+		t.Error("standby without ledgers passed its health check")
+	}
+
+	// Once the preferred archive catches up and passes a check, reading is
+	// handed back to it.
+	writeFixtures(t, dirs[0], 0, 12, 13, 14)
+	if got := readArchive(t, s, 13); got != 2 {
+		t.Errorf("ledger 13 read from archive %d before the next check, want 2", got)
+	}
+	s.healthInterval = 0
+	if got := readArchive(t, s, 14); got != 0 {
+		t.Errorf("ledger 14 read from archive %d, want the preferred archive 0", got)
+	}
+}
+
+func TestFailoverFailsWithoutHealthyStandby(t *testing.T) {
+	primary, standby := t.TempDir(), t.TempDir()
+	writeFixtures(t, primary, 0, 10)
+	s := newFailoverSource([]*archiveConfig{
+		{sourceType: "fixtures", path: primary},
+		{sourceType: "fixtures", path: standby},
+	})
+	defer s.Close()
+	if err := s.PrepareRange(context.Background(), 10, 11); err != nil {
+		t.Fatal(err)
+	}
+	readArchive(t, s, 10)
+	if _, err := s.GetLedger(context.Background(), 11); err == nil {
+		t.Fatal("ledger 11 read although no archive holds it")
+	}
+	if s.source != nil {
+		t.Error("standby opened although it failed its health check")
+	}
+}
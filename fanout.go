@@ -0,0 +1,193 @@
+// fanout.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultForwardConcurrency keeps the original behavior of dispatching to
+// one downstream plugin at a time.
+const defaultForwardConcurrency = 1
+
+// downstream is a registered consumer or processor.
+type downstream interface {
+	Name() string
+	Process(ctx context.Context, msg pluginapi.Message) error
+}
+
+// forward sends a message to every registered consumer and processor, with
+// at most forwardConcurrency deliveries in flight. Downstream errors are
+// collected and logged rather than returned so a single failing sink does
+// not stall the pipeline. While paused, messages are held instead.
+func (p *LatestLedgerProcessor) forward(ctx context.Context, msg pluginapi.Message) {
+	if p.correction {
+		msg.Metadata["correction"] = true
+	}
+	p.addLineage(msg.Metadata)
+	if p.networkID != "" {
+		msg.Metadata["network_id"] = p.networkID
+		msg.Metadata["network"] = p.network
+	}
+	msg.Metadata["schema_version"] = outputSchemaVersion
+	if _, scheduled := msg.Metadata["scheduled_at"]; !scheduled && !p.closedAt.IsZero() {
+		msg.Metadata["closed_at"] = p.closedAt.UTC().Format(time.RFC3339)
+	}
+	if _, set := msg.Metadata["encoding"]; !set && p.payloadEncoding != "" && p.payloadEncoding != payloadEncodingJSON {
+		msg.Metadata["encoding"] = p.payloadEncoding
+	}
+	if p.csv != nil {
+		if t, ok := payloadTypes[fmt.Sprint(msg.Metadata["data_type"])]; ok {
+			msg.Metadata["csv_header"] = p.csv.header(t)
+		}
+	}
+	dataType := fmt.Sprint(msg.Metadata["data_type"])
+	if p.namespace != "" {
+		msg.Metadata["data_type"] = p.namespace + dataType
+	}
+	if p.router != nil {
+		topic := p.router.topic(dataType, fmt.Sprint(msg.Metadata["data_type"]))
+		msg.Metadata["topic"] = topic
+		msg.Metadata["routing_key"] = topic
+	}
+	if p.cloudEvents != nil {
+		p.wrapCloudEvent(&msg)
+	}
+	if p.compressor != nil {
+		p.compressPayload(&msg)
+	}
+	if p.gate != nil {
+		if outcome := p.gate.hold(msg); outcome != "" {
+			if p.dispatchTrace != nil {
+				p.dispatchTrace.record(DispatchOutcome{DataType: fmt.Sprint(msg.Metadata["data_type"]), Outcome: outcome})
+			}
+			return
+		}
+	}
+	p.send(ctx, msg)
+}
+
+// send delivers a fully decorated message to the registered consumers and
+// processors.
+func (p *LatestLedgerProcessor) send(ctx context.Context, msg pluginapi.Message) {
+	targets := make([]downstream, 0, len(p.consumers)+len(p.processors)+len(p.outputs)+1)
+	for _, consumer := range p.consumers {
+		targets = append(targets, consumer)
+	}
+	for _, proc := range p.processors {
+		targets = append(targets, proc)
+	}
+	if p.fileSink != nil {
+		targets = append(targets, p.fileSink)
+	}
+	targets = append(targets, p.outputs...)
+
+	if err := p.dispatch(ctx, msg, targets); err != nil {
+		failed := countErrors(err)
+		if p.backfill != nil {
+			p.backfill.deliveryFailed(failed)
+		}
+		if p.telemetry != nil {
+			p.telemetry.deliveryFailed(failed)
+		}
+		log.Printf("LatestLedgerProcessor: Forwarding %v for ledger %v: %v",
+			msg.Metadata["data_type"], msg.Metadata["ledger_sequence"], err)
+	}
+}
+
+// dispatch delivers msg to all targets and returns the joined errors of the
+// failed deliveries. Targets are processed in registration order when the
+// concurrency is 1; otherwise each concurrent delivery gets its own copy of
+// the metadata so downstream plugins may modify it safely.
+func (p *LatestLedgerProcessor) dispatch(ctx context.Context, msg pluginapi.Message, targets []downstream) error {
+	errs := make([]error, len(targets))
+
+	if p.forwardConcurrency <= 1 || len(targets) <= 1 {
+		for i, target := range targets {
+			log.Printf("LatestLedgerProcessor: Forwarding to %s", target.Name())
+			errs[i] = p.deliver(ctx, target, msg)
+		}
+		p.accountDeliveries(msg, targets, errs)
+		return errors.Join(errs...)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, p.forwardConcurrency)
+	for i, target := range targets {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, target downstream, msg pluginapi.Message) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			log.Printf("LatestLedgerProcessor: Forwarding to %s", target.Name())
+			errs[i] = p.deliver(ctx, target, msg)
+		}(i, target, withMetadataCopy(msg))
+	}
+	wg.Wait()
+	p.accountDeliveries(msg, targets, errs)
+	return errors.Join(errs...)
+}
+
+// accountDeliveries reports the payload bytes delivered to each target, so
+// egress can be attributed to individual downstream sinks.
+func (p *LatestLedgerProcessor) accountDeliveries(msg pluginapi.Message, targets []downstream, errs []error) {
+	if p.telemetry == nil {
+		return
+	}
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return
+	}
+	for i, target := range targets {
+		if errs[i] == nil {
+			p.telemetry.forwarded(target.Name(), len(payload))
+		}
+	}
+}
+
+// deliver sends msg to a single target, wrapping any error with its name.
+func (p *LatestLedgerProcessor) deliver(ctx context.Context, target downstream, msg pluginapi.Message) error {
+	var span trace.Span
+	if p.tracing != nil {
+		ctx, msg, span = p.tracedDelivery(ctx, target, msg)
+	}
+	started := time.Now()
+	err := target.Process(ctx, msg)
+	if span != nil {
+		endSpan(span, err)
+	}
+	if p.dispatchTrace != nil {
+		p.recordDelivery(msg, target, started, err)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", target.Name(), err)
+	}
+	return nil
+}
+
+// countErrors returns the number of errors joined in err.
+func countErrors(err error) int {
+	if err == nil {
+		return 0
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return len(joined.Unwrap())
+	}
+	return 1
+}
+
+func withMetadataCopy(msg pluginapi.Message) pluginapi.Message {
+	metadata := make(map[string]interface{}, len(msg.Metadata))
+	for k, v := range msg.Metadata {
+		metadata[k] = v
+	}
+	msg.Metadata = metadata
+	return msg
+}
@@ -0,0 +1,31 @@
+// feebump.go
+package main
+
+import (
+	"github.com/stellar/go/ingest"
+)
+
+// FeeAttribution splits TotalFeeCharged by who paid it. Fees of regular
+// transactions are charged to the transaction source, while fees of
+// fee-bump transactions are charged to the fee source sponsoring the inner
+// transaction, so SourceFeeCharged + FeeBumpFeeCharged = TotalFeeCharged.
+type FeeAttribution struct {
+	SourceFeeCharged  int64 `json:"source_fee_charged"`   // Charged to the source accounts of regular transactions
+	FeeBumpTxCount    int   `json:"fee_bump_tx_count"`    // Fee-bump transactions in the ledger
+	FeeBumpFeeCharged int64 `json:"fee_bump_fee_charged"` // Charged to fee-bump fee sources
+	FeeBumpMaxFees    int64 `json:"fee_bump_max_fees"`    // Maximum fees declared by fee-bump fee sources
+	InnerDeclaredFees int64 `json:"inner_declared_fees"`  // Fees declared by the inner transactions of fee bumps (not charged)
+}
+
+// addFeeAttribution attributes the fee charged for a transaction to either
+// its source account or, for fee bumps, its fee source.
+func addFeeAttribution(f *FeeAttribution, tx ingest.LedgerTransaction, feeCharged int64) {
+	if !tx.Envelope.IsFeeBump() {
+		f.SourceFeeCharged += feeCharged
+		return
+	}
+	f.FeeBumpTxCount++
+	f.FeeBumpFeeCharged += feeCharged
+	f.FeeBumpMaxFees += tx.Envelope.FeeBumpFee()
+	f.InnerDeclaredFees += int64(tx.Envelope.Fee())
+}
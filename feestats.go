@@ -0,0 +1,207 @@
+// feestats.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+
+	"github.com/stellar/go/ingest"
+	"github.com/withObsrvr/pluginapi"
+)
+
+// defaultFeeStatsWindow matches the number of ledgers Horizon aggregates
+// over when serving /fee_stats.
+const defaultFeeStatsWindow = 5
+
+// FeeStats mirrors the response body of Horizon's /fee_stats endpoint so that
+// wallets can switch their fee guidance source without code changes. As in
+// Horizon, every value is encoded as a string.
+type FeeStats struct {
+	LastLedger          string          `json:"last_ledger"`
+	LastLedgerBaseFee   string          `json:"last_ledger_base_fee"`
+	LedgerCapacityUsage string          `json:"ledger_capacity_usage"`
+	FeeCharged          FeeDistribution `json:"fee_charged"`
+	MaxFee              FeeDistribution `json:"max_fee"`
+}
+
+// FeeDistribution holds per-operation fee percentiles in stroops.
+type FeeDistribution struct {
+	Max  string `json:"max"`
+	Min  string `json:"min"`
+	Mode string `json:"mode"`
+	P10  string `json:"p10"`
+	P20  string `json:"p20"`
+	P30  string `json:"p30"`
+	P40  string `json:"p40"`
+	P50  string `json:"p50"`
+	P60  string `json:"p60"`
+	P70  string `json:"p70"`
+	P80  string `json:"p80"`
+	P90  string `json:"p90"`
+	P95  string `json:"p95"`
+	P99  string `json:"p99"`
+}
+
+// ledgerFeeSample collects the per-operation fees of every transaction in a
+// single ledger.
+type ledgerFeeSample struct {
+	feeCharged []int64
+	maxFee     []int64
+}
+
+// add records the per-operation charged and maximum fee of a transaction.
+// Fee-bump transactions count the outer envelope as an extra operation and
+// use the outer max fee, the same way Horizon does.
+func (s *ledgerFeeSample) add(tx ingest.LedgerTransaction) {
+	ops := int64(len(tx.Envelope.Operations()))
+	maxFee := int64(tx.Envelope.Fee())
+	if newMaxFee, ok := tx.NewMaxFee(); ok {
+		maxFee = int64(newMaxFee)
+		ops++
+	}
+	if ops == 0 {
+		return
+	}
+	s.feeCharged = append(s.feeCharged, ceilDiv(int64(tx.Result.Result.FeeCharged), ops))
+	s.maxFee = append(s.maxFee, ceilDiv(maxFee, ops))
+}
+
+// feeStatsWindow retains fee samples for the most recent ledgers.
+type feeStatsWindow struct {
+	size    int
+	ledgers []ledgerFeeSample
+}
+
+func newFeeStatsWindow(size int) *feeStatsWindow {
+	return &feeStatsWindow{size: size}
+}
+
+// push appends a copy of a ledger's samples, evicting the oldest ledger
+// once the window is full. The evicted ledger's storage holds the copy, so
+// the window does not keep the caller's slices, which are reused for the
+// next ledger.
+func (w *feeStatsWindow) push(sample ledgerFeeSample) {
+	var kept ledgerFeeSample
+	if len(w.ledgers) >= w.size {
+		kept = w.ledgers[0]
+		w.ledgers = w.ledgers[1:]
+	}
+	kept.feeCharged = append(kept.feeCharged[:0], sample.feeCharged...)
+	kept.maxFee = append(kept.maxFee[:0], sample.maxFee...)
+	w.ledgers = append(w.ledgers, kept)
+}
+
+// distributions computes charged and max fee distributions over the window.
+func (w *feeStatsWindow) distributions() (FeeDistribution, FeeDistribution) {
+	charged, maxFees := getInt64Slice(), getInt64Slice()
+	defer putInt64Slice(charged)
+	defer putInt64Slice(maxFees)
+	for _, l := range w.ledgers {
+		*charged = append(*charged, l.feeCharged...)
+		*maxFees = append(*maxFees, l.maxFee...)
+	}
+	return newFeeDistribution(*charged), newFeeDistribution(*maxFees)
+}
+
+// newFeeDistribution computes nearest-rank percentiles of the given values,
+// sorting them in place. An empty input yields all-zero values, matching
+// Horizon's behavior for empty ledgers.
+func newFeeDistribution(values []int64) FeeDistribution {
+	if len(values) == 0 {
+		return FeeDistribution{
+			Max: "0", Min: "0", Mode: "0",
+			P10: "0", P20: "0", P30: "0", P40: "0", P50: "0",
+			P60: "0", P70: "0", P80: "0", P90: "0", P95: "0", P99: "0",
+		}
+	}
+
+	sorted := values
+	slices.Sort(sorted)
+
+	pct := func(p int) string {
+		// Nearest-rank: the smallest value with at least p% of samples at or below it.
+		idx := (p*len(sorted)+99)/100 - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return strconv.FormatInt(sorted[idx], 10)
+	}
+
+	return FeeDistribution{
+		Max:  strconv.FormatInt(sorted[len(sorted)-1], 10),
+		Min:  strconv.FormatInt(sorted[0], 10),
+		Mode: strconv.FormatInt(mode(sorted), 10),
+		P10:  pct(10),
+		P20:  pct(20),
+		P30:  pct(30),
+		P40:  pct(40),
+		P50:  pct(50),
+		P60:  pct(60),
+		P70:  pct(70),
+		P80:  pct(80),
+		P90:  pct(90),
+		P95:  pct(95),
+		P99:  pct(99),
+	}
+}
+
+// mode returns the most frequent value of a sorted slice, preferring the
+// smallest value on ties.
+func mode(sorted []int64) int64 {
+	best, bestCount := sorted[0], 0
+	for i := 0; i < len(sorted); {
+		j := i
+		for j < len(sorted) && sorted[j] == sorted[i] {
+			j++
+		}
+		if j-i > bestCount {
+			best, bestCount = sorted[i], j-i
+		}
+		i = j
+	}
+	return best
+}
+
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+// forwardFeeStats folds the ledger's fee samples into the window and emits a
+// fee_stats message describing the window.
+func (p *LatestLedgerProcessor) forwardFeeStats(ctx context.Context, msg pluginapi.Message, metrics LatestLedger, sample ledgerFeeSample, maxTxSetSize uint32) error {
+	p.feeStats.push(sample)
+
+	var capacityUsage float64
+	if maxTxSetSize > 0 {
+		capacityUsage = float64(metrics.TxSetOperationCount) / float64(maxTxSetSize)
+	}
+
+	stats := FeeStats{
+		LastLedger:          strconv.FormatUint(uint64(metrics.Sequence), 10),
+		LastLedgerBaseFee:   strconv.FormatUint(uint64(metrics.BaseFee), 10),
+		LedgerCapacityUsage: strconv.FormatFloat(capacityUsage, 'f', 2, 64),
+	}
+	stats.FeeCharged, stats.MaxFee = p.feeStats.distributions()
+
+	payload, err := p.encodePayload(stats)
+	if err != nil {
+		return fmt.Errorf("error marshaling fee stats: %w", err)
+	}
+
+	log.Printf("Fee stats: ledger %d (p50 charged: %s, p99 charged: %s, capacity: %s)",
+		metrics.Sequence, stats.FeeCharged.P50, stats.FeeCharged.P99, stats.LedgerCapacityUsage)
+
+	p.forward(ctx, pluginapi.Message{
+		Payload:   payload,
+		Timestamp: msg.Timestamp,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": metrics.Sequence,
+			"source":          "latest-ledger-processor",
+			"data_type":       "fee_stats",
+		},
+	})
+	return nil
+}
@@ -0,0 +1,189 @@
+// feesurge.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// defaultFeeSurgeLedgers is the number of consecutive ledgers required to
+// enter or leave a fee surge.
+const defaultFeeSurgeLedgers = 3
+
+// Values of FeeSurgeEvent.Event.
+const (
+	feeSurgeStarted = "surge_started"
+	feeSurgeEnded   = "surge_ended"
+)
+
+// FeeSurgeEvent is emitted when the network enters or leaves surge pricing.
+// The surge spans StartLedger to EndLedger, the first and last ledgers whose
+// effective minimum fee exceeded the base fee; for surge_started events the
+// surge is still ongoing and EndLedger is the current ledger.
+type FeeSurgeEvent struct {
+	Event           string    `json:"event"`
+	LedgerSequence  uint32    `json:"ledger_sequence"`
+	ClosedAt        time.Time `json:"closed_at"`
+	StartLedger     uint32    `json:"start_ledger"`
+	EndLedger       uint32    `json:"end_ledger"`
+	DurationLedgers int       `json:"duration_ledgers"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	PeakMinFee      int64     `json:"peak_min_fee"`
+	PeakLedger      uint32    `json:"peak_ledger"`
+	BaseFee         uint32    `json:"base_fee"`
+}
+
+// feeSurgeDetector tracks surge pricing with hysteresis: a surge starts after
+// enterLedgers consecutive ledgers whose effective minimum fee per operation
+// exceeds the base fee, and ends after exitLedgers consecutive ledgers at or
+// below it.
+type feeSurgeDetector struct {
+	enterLedgers int
+	exitLedgers  int
+
+	surging bool
+	streak  int // consecutive ledgers contradicting the current state
+
+	// The current or candidate surge.
+	startLedger uint32
+	startTime   time.Time
+	lastLedger  uint32
+	lastTime    time.Time
+	peakMinFee  int64
+	peakLedger  uint32
+}
+
+// newFeeSurgeDetectorFromConfig parses the optional fee_surge config block:
+//
+//	"fee_surge": {"enter_ledgers": 3, "exit_ledgers": 3}
+//
+// It returns nil when surge detection is not configured.
+func newFeeSurgeDetectorFromConfig(config map[string]interface{}) (*feeSurgeDetector, error) {
+	raw, ok := config["fee_surge"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("fee_surge must be an object, got %T", raw)
+	}
+	enter, err := configInt(block, "enter_ledgers", defaultFeeSurgeLedgers)
+	if err != nil {
+		return nil, fmt.Errorf("fee_surge: %w", err)
+	}
+	exit, err := configInt(block, "exit_ledgers", defaultFeeSurgeLedgers)
+	if err != nil {
+		return nil, fmt.Errorf("fee_surge: %w", err)
+	}
+	if enter < 1 || exit < 1 {
+		return nil, fmt.Errorf("fee_surge: enter_ledgers and exit_ledgers must be at least 1")
+	}
+	return &feeSurgeDetector{enterLedgers: enter, exitLedgers: exit}, nil
+}
+
+// minFeeCharged returns the lowest per-operation fee charged in the sample,
+// or false for an empty ledger.
+func (s ledgerFeeSample) minFeeCharged() (int64, bool) {
+	if len(s.feeCharged) == 0 {
+		return 0, false
+	}
+	lowest := s.feeCharged[0]
+	for _, fee := range s.feeCharged[1:] {
+		if fee < lowest {
+			lowest = fee
+		}
+	}
+	return lowest, true
+}
+
+// observe folds in a ledger and returns the event it triggers, if any.
+// Empty ledgers count as not surging.
+func (d *feeSurgeDetector) observe(metrics LatestLedger, sample ledgerFeeSample) *FeeSurgeEvent {
+	minFee, ok := sample.minFeeCharged()
+	above := ok && minFee > int64(metrics.BaseFee)
+
+	if !d.surging {
+		if !above {
+			d.streak = 0
+			return nil
+		}
+		if d.streak == 0 {
+			d.startLedger, d.startTime = metrics.Sequence, metrics.ClosedAt
+			d.peakMinFee = 0
+		}
+		d.streak++
+		d.recordSurgeLedger(metrics, minFee)
+		if d.streak < d.enterLedgers {
+			return nil
+		}
+		d.surging, d.streak = true, 0
+		return d.event(feeSurgeStarted, metrics)
+	}
+
+	if above {
+		d.streak = 0
+		d.recordSurgeLedger(metrics, minFee)
+		return nil
+	}
+	d.streak++
+	if d.streak < d.exitLedgers {
+		return nil
+	}
+	d.surging, d.streak = false, 0
+	return d.event(feeSurgeEnded, metrics)
+}
+
+func (d *feeSurgeDetector) recordSurgeLedger(metrics LatestLedger, minFee int64) {
+	d.lastLedger, d.lastTime = metrics.Sequence, metrics.ClosedAt
+	if minFee > d.peakMinFee {
+		d.peakMinFee, d.peakLedger = minFee, metrics.Sequence
+	}
+}
+
+func (d *feeSurgeDetector) event(kind string, metrics LatestLedger) *FeeSurgeEvent {
+	return &FeeSurgeEvent{
+		Event:           kind,
+		LedgerSequence:  metrics.Sequence,
+		ClosedAt:        metrics.ClosedAt,
+		StartLedger:     d.startLedger,
+		EndLedger:       d.lastLedger,
+		DurationLedgers: int(d.lastLedger-d.startLedger) + 1,
+		DurationSeconds: d.lastTime.Sub(d.startTime).Seconds(),
+		PeakMinFee:      d.peakMinFee,
+		PeakLedger:      d.peakLedger,
+		BaseFee:         metrics.BaseFee,
+	}
+}
+
+// forwardFeeSurge emits a fee_surge message when the ledger starts or ends a
+// surge.
+func (p *LatestLedgerProcessor) forwardFeeSurge(ctx context.Context, msg pluginapi.Message, metrics LatestLedger, sample ledgerFeeSample) error {
+	event := p.feeSurge.observe(metrics, sample)
+	if event == nil {
+		return nil
+	}
+
+	payload, err := p.encodePayload(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling fee surge: %w", err)
+	}
+
+	log.Printf("Fee surge: %s at ledger %d (since ledger %d, peak min fee %d)",
+		event.Event, event.LedgerSequence, event.StartLedger, event.PeakMinFee)
+
+	p.forward(ctx, pluginapi.Message{
+		Payload:   payload,
+		Timestamp: msg.Timestamp,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": metrics.Sequence,
+			"source":          "latest-ledger-processor",
+			"data_type":       "fee_surge",
+			"event":           event.Event,
+		},
+	})
+	return nil
+}
@@ -0,0 +1,145 @@
+// fieldselect.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// fieldSelection trims latest_ledger payloads to a subset of their
+// top-level fields.
+type fieldSelection struct {
+	keep map[string]bool // snake_case JSON keys that are emitted
+}
+
+// newFieldSelectionFromConfig parses the include_fields and exclude_fields
+// settings, lists of top-level latest_ledger fields given by their
+// snake_case or camelCase names:
+//
+//	"exclude_fields": ["soroban_instruction_histogram", "soroban_by_outcome"]
+//
+// At most one of the two may be set. It returns nil when neither is.
+func newFieldSelectionFromConfig(config map[string]interface{}) (*fieldSelection, error) {
+	include, err := configStringSlice(config, "include_fields")
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := configStringSlice(config, "exclude_fields")
+	if err != nil {
+		return nil, err
+	}
+	if len(include) > 0 && len(exclude) > 0 {
+		return nil, fmt.Errorf("include_fields and exclude_fields cannot both be set")
+	}
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]string) // snake_case and camelCase name to snake_case name
+	for _, f := range payloadFields(reflect.TypeOf(LatestLedger{})) {
+		known[f.name] = f.name
+		known[snakeToCamel(f.name)] = f.name
+	}
+	resolve := func(setting string, names []string) (map[string]bool, error) {
+		fields := make(map[string]bool)
+		for _, name := range names {
+			field, ok := known[name]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown field %q", setting, name)
+			}
+			fields[field] = true
+		}
+		return fields, nil
+	}
+
+	if len(include) > 0 {
+		keep, err := resolve("include_fields", include)
+		if err != nil {
+			return nil, err
+		}
+		return &fieldSelection{keep: keep}, nil
+	}
+	drop, err := resolve("exclude_fields", exclude)
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[string]bool)
+	for _, field := range known {
+		if !drop[field] {
+			keep[field] = true
+		}
+	}
+	return &fieldSelection{keep: keep}, nil
+}
+
+// filter returns a copy of a JSON object with only the selected members, in
+// their original order. Values are copied verbatim.
+func (s *fieldSelection) filter(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("field selection: payload is not a JSON object")
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if !s.keep[key] {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		keyBytes, _ := json.Marshal(key)
+		buf.Write(keyBytes)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// trimSchema removes the fields that are not emitted from the LatestLedger
+// type of a GraphQL schema. The network and schema version fields are
+// always kept. Types that
+// are no longer referenced are left in place.
+func (s *fieldSelection) trimSchema(schema string) string {
+	lines := strings.Split(schema, "\n")
+	out := lines[:0]
+	inLatestLedger := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "type LatestLedger {":
+			inLatestLedger = true
+		case trimmed == "}":
+			inLatestLedger = false
+		case inLatestLedger:
+			name, _, _ := strings.Cut(trimmed, ":")
+			if name != "networkId" && name != "network" && name != "schemaVersion" && !s.keepsGraphQLField(name) {
+				continue
+			}
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+func (s *fieldSelection) keepsGraphQLField(name string) bool {
+	for field := range s.keep {
+		if snakeToCamel(field) == name {
+			return true
+		}
+	}
+	return false
+}
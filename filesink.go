@@ -0,0 +1,205 @@
+// filesink.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Defaults of the file_sink config block.
+const (
+	defaultFileSinkMaxBytes   = 100 << 20
+	defaultFileSinkMaxSeconds = 3600
+)
+
+// fileSink appends forwarded JSON payloads to local NDJSON files, one
+// payload per line, so minimal deployments can persist the processor's
+// output without a consumer plugin. It is dispatched to like a registered
+// consumer.
+type fileSink struct {
+	template string // path with {network}, {data_type}, {date} and {sequence} placeholders
+	network  string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu    sync.Mutex
+	files map[string]*sinkFile // open files by data_type, or by "" when types share files
+}
+
+// sinkFile is an open output file.
+type sinkFile struct {
+	f      *os.File
+	path   string
+	date   string // {date} of the path
+	size   int64
+	opened time.Time
+}
+
+// newFileSinkFromConfig parses the optional file_sink config block:
+//
+//	"file_sink": {
+//	  "path": "/var/lib/latest-ledger/{network}/{date}/{data_type}-{sequence}.ndjson",
+//	  "max_bytes": 104857600,
+//	  "max_seconds": 3600
+//	}
+//
+// It returns nil when no file sink is configured.
+func newFileSinkFromConfig(config map[string]interface{}, network string) (*fileSink, error) {
+	raw, ok := config["file_sink"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("file_sink must be an object, got %T", raw)
+	}
+	template, err := configString(block, "path", "")
+	if err != nil {
+		return nil, fmt.Errorf("file_sink: %w", err)
+	}
+	if template == "" {
+		return nil, fmt.Errorf("file_sink: path is required")
+	}
+	if !strings.Contains(template, "{sequence}") {
+		return nil, fmt.Errorf("file_sink: path must contain {sequence}, so rotated files get distinct names")
+	}
+	maxBytes, err := configInt(block, "max_bytes", defaultFileSinkMaxBytes)
+	if err != nil {
+		return nil, fmt.Errorf("file_sink: %w", err)
+	}
+	maxSeconds, err := configInt(block, "max_seconds", defaultFileSinkMaxSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("file_sink: %w", err)
+	}
+	if maxBytes < 1 || maxSeconds < 1 {
+		return nil, fmt.Errorf("file_sink: max_bytes and max_seconds must be at least 1")
+	}
+	return &fileSink{
+		template: template,
+		network:  network,
+		maxBytes: int64(maxBytes),
+		maxAge:   time.Duration(maxSeconds) * time.Second,
+		files:    make(map[string]*sinkFile),
+	}, nil
+}
+
+// Name identifies the sink in logs and dispatch reports.
+func (s *fileSink) Name() string {
+	return "file-sink"
+}
+
+// Process appends the payload of msg as a line, first rotating the file
+// when it is full or old enough, or when the message belongs to another
+// {date}.
+func (s *fileSink) Process(ctx context.Context, msg pluginapi.Message) error {
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("unsupported payload type %T", msg.Payload)
+	}
+	dataType := fmt.Sprint(msg.Metadata["data_type"])
+	date := messageDate(msg.Metadata)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := ""
+	if strings.Contains(s.template, "{data_type}") {
+		key = dataType
+	}
+	file := s.files[key]
+	line := int64(len(payload)) + 1
+	if file != nil && (file.size > 0 && file.size+line > s.maxBytes || time.Since(file.opened) >= s.maxAge ||
+		file.date != date && strings.Contains(s.template, "{date}")) {
+		delete(s.files, key)
+		if err := file.f.Close(); err != nil {
+			return fmt.Errorf("error closing %s: %w", file.path, err)
+		}
+		file = nil
+	}
+	if file == nil {
+		var err error
+		if file, err = s.open(dataType, date, msg.Metadata["ledger_sequence"]); err != nil {
+			return err
+		}
+		s.files[key] = file
+	}
+
+	buf := make([]byte, 0, line)
+	buf = append(append(buf, payload...), '\n')
+	n, err := file.f.Write(buf)
+	file.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", file.path, err)
+	}
+	return nil
+}
+
+// messageDate returns the UTC date of a message: the close date of its
+// ledger, the date of a scheduled report, or else the current date.
+func messageDate(metadata map[string]interface{}) string {
+	for _, key := range []string{"closed_at", "scheduled_at"} {
+		if v, ok := metadata[key].(string); ok {
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				return t.UTC().Format("2006-01-02")
+			}
+		}
+	}
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// open creates the file for a message, named after its data type, date and
+// ledger. A file of that name left by a previous rotation or run is not
+// appended to; a numeric suffix is added instead.
+func (s *fileSink) open(dataType, date string, seq interface{}) (*sinkFile, error) {
+	sequence := "0"
+	if seq != nil {
+		sequence = fmt.Sprint(seq)
+	}
+	if len(sequence) < 10 {
+		sequence = strings.Repeat("0", 10-len(sequence)) + sequence
+	}
+	path := strings.NewReplacer(
+		"{network}", s.network,
+		"{data_type}", dataType,
+		"{date}", date,
+		"{sequence}", sequence,
+	).Replace(s.template)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			return &sinkFile{f: f, path: path, date: date, opened: time.Now()}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		path = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+}
+
+// Close closes the open files.
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for key, file := range s.files {
+		if err := file.f.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing %s: %w", file.path, err))
+		}
+		delete(s.files, key)
+	}
+	return errors.Join(errs...)
+}
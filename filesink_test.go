@@ -0,0 +1,47 @@
+// filesink_test.go
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stellar/go/network"
+	"github.com/withObsrvr/pluginapi"
+)
+
+func TestFileSinkDatesFilesByLedgerCloseTime(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewLatestLedgerProcessor(map[string]interface{}{
+		"network_passphrase": network.TestNetworkPassphrase,
+		"file_sink":          map[string]interface{}{"path": filepath.Join(dir, "{date}", "{data_type}-{sequence}.ndjson")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2023-11-14 22:13:20 UTC, then five seconds and a day later.
+	for i, closeTime := range []int64{1_700_000_000, 1_700_000_005, 1_700_086_400} {
+		lcm := testLedger(t, network.TestNetworkPassphrase, uint32(10+i), closeTime, 1)
+		if err := p.Process(context.Background(), pluginapi.Message{Payload: lcm}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, ledgers := range map[string]int{
+		"2023-11-14/latest_ledger-0000000010.ndjson": 2,
+		"2023-11-15/latest_ledger-0000000012.ndjson": 1,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(string(data), "\n"); lines != ledgers {
+			t.Errorf("%s holds %d lines, want %d", path, lines, ledgers)
+		}
+	}
+}
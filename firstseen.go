@@ -0,0 +1,214 @@
+// firstseen.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+	"github.com/withObsrvr/pluginapi"
+)
+
+// firstSeenFile is the state file of the first-seen sets in state_dir.
+const firstSeenFile = "first_seen.json"
+
+// NewContractSeenEvent is emitted the first time the processor sees a
+// contract, for catalogs and explorers that index contracts as they appear.
+type NewContractSeenEvent struct {
+	ContractID     string    `json:"contract_id"`
+	LedgerSequence uint32    `json:"ledger_sequence"`
+	ClosedAt       time.Time `json:"closed_at"`
+}
+
+// NewAssetSeenEvent is emitted the first time the processor sees a
+// non-native asset.
+type NewAssetSeenEvent struct {
+	Asset          string    `json:"asset"` // CODE:ISSUER
+	LedgerSequence uint32    `json:"ledger_sequence"`
+	ClosedAt       time.Time `json:"closed_at"`
+}
+
+// firstSeenTracker remembers every contract and asset seen, with the ledger
+// of its first appearance. Unlike the windowed detectors, nothing is ever
+// forgotten. When a path is set, the sets are loaded from and periodically
+// saved to that file so they survive restarts.
+type firstSeenTracker struct {
+	path string
+
+	contracts  map[string]uint32
+	assets     map[string]uint32
+	lastLedger uint32 // most recently observed ledger
+	dirty      int    // ledgers observed since the last save
+}
+
+// firstSeenFileState is the on-disk form of a firstSeenTracker.
+type firstSeenFileState struct {
+	LastLedger uint32            `json:"last_ledger"`
+	Contracts  map[string]uint32 `json:"contracts"`
+	Assets     map[string]uint32 `json:"assets"`
+}
+
+// newFirstSeenTrackerFromConfig builds the tracker when emit_first_seen is
+// set. It returns nil when first-seen events are disabled.
+func newFirstSeenTrackerFromConfig(config map[string]interface{}, stateDir string) (*firstSeenTracker, error) {
+	enabled, err := configBool(config, "emit_first_seen", false)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, nil
+	}
+	t := &firstSeenTracker{contracts: make(map[string]uint32), assets: make(map[string]uint32)}
+	if stateDir == "" {
+		return t, nil
+	}
+	t.path = filepath.Join(stateDir, firstSeenFile)
+
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state %s: %w", t.path, err)
+	}
+	var file firstSeenFileState
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error decoding state %s: %w", t.path, err)
+	}
+	t.lastLedger = file.LastLedger
+	if file.Contracts != nil {
+		t.contracts = file.Contracts
+	}
+	if file.Assets != nil {
+		t.assets = file.Assets
+	}
+	return t, nil
+}
+
+// ledgerContracts collects the contracts of a ledger: those invoked by
+// successful transactions, and those whose instance was created.
+type ledgerContracts map[string]bool
+
+func (c ledgerContracts) add(tx ingest.LedgerTransaction) {
+	if !tx.Result.Successful() {
+		return
+	}
+	for _, op := range tx.Envelope.Operations() {
+		if contract, ok := operationContract(op); ok {
+			c[contract] = true
+		}
+	}
+	if !hasSorobanTransaction(tx) {
+		return
+	}
+	changes, err := tx.GetChanges()
+	if err != nil {
+		log.Printf("Warning: could not read changes for tx %s: %v", tx.Result.TransactionHash.HexString(), err)
+		return
+	}
+	for _, change := range changes {
+		if change.Type != xdr.LedgerEntryTypeContractData || change.Pre != nil || change.Post == nil {
+			continue
+		}
+		data := change.Post.Data.MustContractData()
+		if data.Key.Type != xdr.ScValTypeScvLedgerKeyContractInstance {
+			continue
+		}
+		if contract, err := data.Contract.String(); err == nil {
+			c[contract] = true
+		}
+	}
+}
+
+// observe records the ledger's contracts and assets and returns those not
+// seen before, sorted.
+func (t *firstSeenTracker) observe(seq uint32, contracts ledgerContracts, assets ledgerAssets) (newContracts, newAssets []string) {
+	newContracts = firstSeen(t.contracts, seq, contracts)
+	newAssets = firstSeen(t.assets, seq, assets)
+	t.lastLedger = seq
+	t.dirty++
+	if err := t.flush(); err != nil {
+		log.Printf("Warning: could not save first-seen state: %v", err)
+	}
+	return newContracts, newAssets
+}
+
+// firstSeen adds the keys missing from seen, recording seq as their first
+// ledger, and returns them sorted.
+func firstSeen(seen map[string]uint32, seq uint32, keys map[string]bool) []string {
+	added := make(map[string]bool)
+	for key := range keys {
+		if _, ok := seen[key]; !ok {
+			seen[key] = seq
+			added[key] = true
+		}
+	}
+	return sortedKeys(added)
+}
+
+// flush saves the sets if they are persisted and enough ledgers have been
+// observed since the last save. The file is replaced atomically.
+func (t *firstSeenTracker) flush() error {
+	if t.path == "" || t.dirty < windowedStateFlushLedgers {
+		return nil
+	}
+	data, err := json.Marshal(firstSeenFileState{
+		LastLedger: t.lastLedger,
+		Contracts:  t.contracts,
+		Assets:     t.assets,
+	})
+	if err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing state %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		return fmt.Errorf("error replacing state %s: %w", t.path, err)
+	}
+	t.dirty = 0
+	return nil
+}
+
+// forwardFirstSeen emits a new_contract_seen or new_asset_seen message for
+// every contract and asset of the ledger that was not seen before.
+func (p *LatestLedgerProcessor) forwardFirstSeen(ctx context.Context, msg pluginapi.Message, metrics LatestLedger, contracts ledgerContracts, assets ledgerAssets) error {
+	newContracts, newAssets := p.firstSeen.observe(metrics.Sequence, contracts, assets)
+	for _, contract := range newContracts {
+		event := NewContractSeenEvent{ContractID: contract, LedgerSequence: metrics.Sequence, ClosedAt: metrics.ClosedAt}
+		if err := p.forwardFirstSeenEvent(ctx, msg, metrics.Sequence, "new_contract_seen", event); err != nil {
+			return err
+		}
+	}
+	for _, asset := range newAssets {
+		event := NewAssetSeenEvent{Asset: asset, LedgerSequence: metrics.Sequence, ClosedAt: metrics.ClosedAt}
+		if err := p.forwardFirstSeenEvent(ctx, msg, metrics.Sequence, "new_asset_seen", event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *LatestLedgerProcessor) forwardFirstSeenEvent(ctx context.Context, msg pluginapi.Message, seq uint32, dataType string, event interface{}) error {
+	payload, err := p.encodePayload(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling %s event: %w", dataType, err)
+	}
+	p.forward(ctx, pluginapi.Message{
+		Payload:   payload,
+		Timestamp: msg.Timestamp,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": seq,
+			"source":          "latest-ledger-processor",
+			"data_type":       dataType,
+		},
+	})
+	return nil
+}
@@ -0,0 +1,78 @@
+// flatkeys.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// flattenPayload returns a copy of a JSON object without nested objects:
+// members of nested objects are lifted to the top level under their joined
+// keys, e.g. {"soroban":{"tx_count":1}} becomes {"soroban_tx_count":1}, and
+// arrays are replaced by their JSON text. Key order and number literals are
+// preserved.
+func flattenPayload(data []byte, keyCase string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("flatten: payload is not a JSON object")
+	}
+	join := func(parent, child string) string { return parent + "_" + child }
+	if keyCase == keyCaseCamel {
+		join = func(parent, child string) string { return snakeToCamel(parent + "_" + child) }
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	if err := flattenPayloadObject(dec, &buf, "", join); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// flattenPayloadObject writes the members of the object whose opening brace
+// was just read, prefixing keys with prefix.
+func flattenPayloadObject(dec *json.Decoder, buf *bytes.Buffer, prefix string, join func(string, string) string) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		if prefix != "" {
+			key = join(prefix, key)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		value = bytes.TrimSpace(value)
+
+		if len(value) > 0 && value[0] == '{' {
+			nested := json.NewDecoder(bytes.NewReader(value))
+			nested.UseNumber()
+			nested.Token()
+			if err := flattenPayloadObject(nested, buf, key, join); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(value) > 0 && value[0] == '[' {
+			if value, err = json.Marshal(string(value)); err != nil {
+				return err
+			}
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		keyBytes, _ := json.Marshal(key)
+		buf.Write(keyBytes)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	// Consume the closing brace.
+	_, err := dec.Token()
+	return err
+}
@@ -0,0 +1,422 @@
+// grpc.go
+package main
+
+import (
+	"context"
+	_ "embed"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/withObsrvr/pluginapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// latestLedgerProto is the published definition of the gRPC service.
+//
+//go:embed latest_ledger.proto
+var latestLedgerProto string
+
+// Defaults of the grpc config block.
+const (
+	defaultGRPCListenAddress  = ":9090"
+	defaultGRPCRetain         = 1000
+	defaultGRPCMaxSubscribers = 1000
+)
+
+// grpcSendBuffer is the number of ledgers queued for a subscriber before
+// it is considered too slow and its stream is ended.
+const grpcSendBuffer = 16
+
+// grpcLedgerServer serves the LatestLedgerService of latest_ledger.proto:
+// GetLedger looks up a retained ledger and SubscribeLedgers streams new
+// ones, so services in any language can consume the metrics without the
+// Flow message bus. It is dispatched to like a registered consumer and
+// ignores messages other than latest_ledger.
+type grpcLedgerServer struct {
+	server         *grpc.Server
+	listener       net.Listener
+	retain         int
+	maxSubscribers int
+	dataType       string // data_type of the messages served
+
+	mu          sync.Mutex
+	subscribers map[*grpcSubscriber]struct{}
+	ledgers     []*grpcLedger // retained ledgers, oldest first
+	closed      bool
+}
+
+// grpcSubscriber is an open SubscribeLedgers stream.
+type grpcSubscriber struct {
+	send chan *grpcLedger
+	done chan struct{}
+	once sync.Once
+	err  error // status the stream ends with once done is closed
+}
+
+// newGRPCLedgerServerFromConfig parses the optional grpc config block:
+//
+//	"grpc": {
+//	  "listen_address": ":9090",
+//	  "retain": 1000,
+//	  "max_subscribers": 1000
+//	}
+//
+// The listener is opened here, so an address in use fails the config. It
+// returns nil when no gRPC server is configured.
+func newGRPCLedgerServerFromConfig(config map[string]interface{}, namespace string) (*grpcLedgerServer, error) {
+	raw, ok := config["grpc"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("grpc must be an object, got %T", raw)
+	}
+	address, err := configString(block, "listen_address", defaultGRPCListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("grpc: %w", err)
+	}
+	retain, err := configInt(block, "retain", defaultGRPCRetain)
+	if err != nil {
+		return nil, fmt.Errorf("grpc: %w", err)
+	}
+	maxSubscribers, err := configInt(block, "max_subscribers", defaultGRPCMaxSubscribers)
+	if err != nil {
+		return nil, fmt.Errorf("grpc: %w", err)
+	}
+	if retain < 1 || maxSubscribers < 1 {
+		return nil, fmt.Errorf("grpc: retain and max_subscribers must be at least 1")
+	}
+
+	s := &grpcLedgerServer{
+		retain:         retain,
+		maxSubscribers: maxSubscribers,
+		dataType:       namespace + "latest_ledger",
+		subscribers:    make(map[*grpcSubscriber]struct{}),
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("grpc: %w", err)
+	}
+	s.listener = listener
+	s.server = grpc.NewServer(grpc.ForceServerCodec(grpcLedgerCodec{}))
+	s.server.RegisterService(&latestLedgerServiceDesc, s)
+	go func() {
+		if err := s.server.Serve(listener); err != nil {
+			log.Printf("Warning: grpc server stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving gRPC LatestLedgerService on %s", listener.Addr())
+	return s, nil
+}
+
+// Name identifies the server in logs and dispatch reports.
+func (s *grpcLedgerServer) Name() string {
+	return "grpc"
+}
+
+// Process retains the payload of a latest_ledger message and sends it to
+// every subscriber. Messages of an older ledger than the last one served,
+// such as reprocessed corrections, are skipped. A subscriber whose queue
+// is full has its stream ended with RESOURCE_EXHAUSTED rather than holding
+// up the pipeline; it can resubscribe from the next sequence.
+func (s *grpcLedgerServer) Process(ctx context.Context, msg pluginapi.Message) error {
+	if msg.Metadata["data_type"] != s.dataType {
+		return nil
+	}
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("unsupported payload type %T", msg.Payload)
+	}
+	seq, _ := strconv.ParseUint(fmt.Sprint(msg.Metadata["ledger_sequence"]), 10, 32)
+	ledger := &grpcLedger{
+		sequence:      uint32(seq),
+		dataType:      s.dataType,
+		contentType:   payloadContentType(msg.Metadata),
+		payload:       payload,
+		network:       metadataString(msg.Metadata, "network"),
+		networkID:     metadataString(msg.Metadata, "network_id"),
+		schemaVersion: metadataString(msg.Metadata, "schema_version"),
+	}
+	ledger.contentEncoding, _ = msg.Metadata["content_encoding"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.ledgers); n > 0 && ledger.sequence <= s.ledgers[n-1].sequence {
+		return nil
+	}
+	s.ledgers = append(s.ledgers, ledger)
+	if len(s.ledgers) > s.retain {
+		s.ledgers = s.ledgers[len(s.ledgers)-s.retain:]
+	}
+	for sub := range s.subscribers {
+		select {
+		case sub.send <- ledger:
+		default:
+			log.Printf("Warning: ending slow grpc subscription")
+			sub.shutdown(status.Error(codes.ResourceExhausted, "subscriber fell behind"))
+		}
+	}
+	return nil
+}
+
+// getLedger implements GetLedger.
+func (s *grpcLedgerServer) getLedger(ctx context.Context, req *getLedgerRequest) (*grpcLedger, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.ledgers)
+	if n == 0 {
+		return nil, status.Error(codes.NotFound, "no ledger processed yet")
+	}
+	if req.sequence == 0 {
+		return s.ledgers[n-1], nil
+	}
+	i := sort.Search(n, func(i int) bool { return s.ledgers[i].sequence >= req.sequence })
+	if i == n || s.ledgers[i].sequence != req.sequence {
+		return nil, status.Errorf(codes.NotFound, "ledger %d not retained", req.sequence)
+	}
+	return s.ledgers[i], nil
+}
+
+// subscribeLedgers implements SubscribeLedgers.
+func (s *grpcLedgerServer) subscribeLedgers(req *subscribeLedgersRequest, stream grpc.ServerStream) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	if len(s.subscribers) >= s.maxSubscribers {
+		s.mu.Unlock()
+		return status.Error(codes.ResourceExhausted, "too many subscribers")
+	}
+	backlog := s.ledgers
+	if req.startSequence != 0 {
+		backlog = backlog[sort.Search(len(backlog), func(i int) bool { return backlog[i].sequence >= req.startSequence }):]
+	} else if n := len(backlog); n > 0 {
+		backlog = backlog[n-1:]
+	}
+	sub := &grpcSubscriber{
+		send: make(chan *grpcLedger, len(backlog)+grpcSendBuffer),
+		done: make(chan struct{}),
+	}
+	for _, ledger := range backlog {
+		sub.send <- ledger
+	}
+	s.subscribers[sub] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, sub)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case ledger := <-sub.send:
+			if err := stream.SendMsg(ledger); err != nil {
+				return err
+			}
+		case <-sub.done:
+			return sub.err
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// Close ends the open subscriptions and stops the server.
+func (s *grpcLedgerServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for sub := range s.subscribers {
+		sub.shutdown(status.Error(codes.Unavailable, "server is shutting down"))
+	}
+	s.mu.Unlock()
+	s.server.GracefulStop()
+	s.listener.Close() // in case Serve has not started yet
+	return nil
+}
+
+// shutdown ends the subscription with the error.
+func (sub *grpcSubscriber) shutdown(err error) {
+	sub.once.Do(func() {
+		sub.err = err
+		close(sub.done)
+	})
+}
+
+// latestLedgerService is implemented by grpcLedgerServer, and is the
+// handler type the service descriptor is registered with.
+type latestLedgerService interface {
+	getLedger(context.Context, *getLedgerRequest) (*grpcLedger, error)
+	subscribeLedgers(*subscribeLedgersRequest, grpc.ServerStream) error
+}
+
+// latestLedgerServiceDesc describes the service of latest_ledger.proto, as
+// protoc-gen-go-grpc would generate it.
+var latestLedgerServiceDesc = grpc.ServiceDesc{
+	ServiceName: "obsrvr.latestledger.v1.LatestLedgerService",
+	HandlerType: (*latestLedgerService)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "GetLedger",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(getLedgerRequest)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(latestLedgerService).getLedger(ctx, req.(*getLedgerRequest))
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/obsrvr.latestledger.v1.LatestLedgerService/GetLedger"}
+			return interceptor(ctx, req, info, handler)
+		},
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName: "SubscribeLedgers",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			req := new(subscribeLedgersRequest)
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return srv.(latestLedgerService).subscribeLedgers(req, stream)
+		},
+		ServerStreams: true,
+	}},
+	Metadata: "latest_ledger.proto",
+}
+
+// getLedgerRequest is the GetLedgerRequest message.
+type getLedgerRequest struct {
+	sequence uint32
+}
+
+func (m *getLedgerRequest) unmarshalProto(b []byte) (err error) {
+	m.sequence, err = consumeUint32Field(b, 1)
+	return err
+}
+
+// subscribeLedgersRequest is the SubscribeLedgersRequest message.
+type subscribeLedgersRequest struct {
+	startSequence uint32
+}
+
+func (m *subscribeLedgersRequest) unmarshalProto(b []byte) (err error) {
+	m.startSequence, err = consumeUint32Field(b, 1)
+	return err
+}
+
+// grpcLedger is the Ledger message.
+type grpcLedger struct {
+	sequence        uint32
+	network         string
+	networkID       string
+	dataType        string
+	schemaVersion   string
+	contentType     string
+	contentEncoding string
+	payload         []byte
+}
+
+// marshalProto encodes the message, leaving out fields with default values
+// as proto3 does.
+func (m *grpcLedger) marshalProto() []byte {
+	b := make([]byte, 0, len(m.payload)+128)
+	if m.sequence != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(m.sequence))
+	}
+	for i, s := range []string{m.network, m.networkID, m.dataType, m.schemaVersion, m.contentType, m.contentEncoding} {
+		if s != "" {
+			b = protowire.AppendTag(b, protowire.Number(i+2), protowire.BytesType)
+			b = protowire.AppendString(b, s)
+		}
+	}
+	if len(m.payload) > 0 {
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.payload)
+	}
+	return b
+}
+
+// consumeUint32Field decodes a message and returns its uint32 field num,
+// skipping other fields.
+func consumeUint32Field(b []byte, num protowire.Number) (uint32, error) {
+	var value uint32
+	for len(b) > 0 {
+		n, typ, tagLen := protowire.ConsumeTag(b)
+		if tagLen < 0 {
+			return 0, protowire.ParseError(tagLen)
+		}
+		b = b[tagLen:]
+		var fieldLen int
+		if n == num && typ == protowire.VarintType {
+			var v uint64
+			v, fieldLen = protowire.ConsumeVarint(b)
+			value = uint32(v)
+		} else {
+			fieldLen = protowire.ConsumeFieldValue(n, typ, b)
+		}
+		if fieldLen < 0 {
+			return 0, protowire.ParseError(fieldLen)
+		}
+		b = b[fieldLen:]
+	}
+	return value, nil
+}
+
+// grpcLedgerCodec encodes the messages of latest_ledger.proto in the
+// protobuf wire format, standing in for the codec of generated types.
+type grpcLedgerCodec struct{}
+
+func (grpcLedgerCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(interface{ marshalProto() []byte })
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+	return m.marshalProto(), nil
+}
+
+func (grpcLedgerCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(interface{ unmarshalProto([]byte) error })
+	if !ok {
+		return fmt.Errorf("cannot unmarshal %T", v)
+	}
+	return m.unmarshalProto(data)
+}
+
+func (grpcLedgerCodec) Name() string {
+	return "proto"
+}
+
+// metadataString returns a metadata value as a string, or "" when it is
+// missing.
+func metadataString(metadata map[string]interface{}, key string) string {
+	v, ok := metadata[key]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// runGRPCProto implements the grpc-proto command: it prints the definition
+// of the gRPC service, for generating clients.
+func runGRPCProto(args []string) error {
+	fs := flag.NewFlagSet("grpc-proto", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	_, err := os.Stdout.WriteString(latestLedgerProto)
+	return err
+}
@@ -0,0 +1,194 @@
+// grpc_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// rawProto is an encoded message, sent and received as is.
+type rawProto []byte
+
+func (m *rawProto) marshalProto() []byte { return *m }
+
+func (m *rawProto) unmarshalProto(b []byte) error {
+	*m = append((*m)[:0], b...)
+	return nil
+}
+
+// grpcTestLedgerProto is the Ledger message of grpcTestMessage(5).
+const grpcTestLedgerProto = "0805" + // sequence
+	"1206" + "7075626e6574" + // network "pubnet"
+	"1a02" + "6162" + // network_id "ab"
+	"220d" + "6c61746573745f6c6564676572" + // data_type "latest_ledger"
+	"2a03" + "312e30" + // schema_version "1.0"
+	"3210" + "6170706c69636174696f6e2f6a736f6e" + // content_type "application/json"
+	"3a04" + "677a6970" + // content_encoding "gzip"
+	"4202" + "7b7d" // payload "{}"
+
+func grpcTestMessage(seq uint32) pluginapi.Message {
+	return pluginapi.Message{
+		Payload: []byte("{}"),
+		Metadata: map[string]interface{}{
+			"data_type":        "latest_ledger",
+			"ledger_sequence":  seq,
+			"network":          "pubnet",
+			"network_id":       "ab",
+			"schema_version":   "1.0",
+			"encoding":         payloadEncodingJSON,
+			"content_encoding": "gzip",
+		},
+	}
+}
+
+func TestGRPCLedgerMarshalProtoGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		ledger grpcLedger
+		want   string
+	}{
+		{name: "empty", want: ""},
+		{
+			name:   "multi-byte varints",
+			ledger: grpcLedger{sequence: 300, payload: bytes.Repeat([]byte{'a'}, 200)},
+			want:   "08ac02" + "42c801" + hex.EncodeToString(bytes.Repeat([]byte{'a'}, 200)),
+		},
+		{
+			name:   "default values left out",
+			ledger: grpcLedger{dataType: "latest_ledger"},
+			want:   "220d6c61746573745f6c6564676572",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(tt.ledger.marshalProto()); got != tt.want {
+				t.Errorf("marshalProto = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsumeUint32Field(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    uint32
+		wantErr bool
+	}{
+		{name: "empty", message: "", want: 0},
+		{name: "field", message: "089601", want: 150},
+		// Unknown string, fixed64 and fixed32 fields are skipped.
+		{name: "unknown fields", message: "120178" + "190102030405060708" + "2501020304" + "089601", want: 150},
+		{name: "last value wins", message: "0801" + "0802", want: 2},
+		{name: "wrong wire type skipped", message: "0a0105", want: 0},
+		{name: "truncated varint", message: "0896", wantErr: true},
+		{name: "truncated string", message: "1205", wantErr: true},
+		{name: "field number 0", message: "0001", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := hex.DecodeString(tt.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := consumeUint32Field(message, 1)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("consumeUint32Field = %d, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("consumeUint32Field = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGRPCLedgerServiceWire(t *testing.T) {
+	address := freeAddress(t)
+	s, err := newGRPCLedgerServerFromConfig(map[string]interface{}{
+		"grpc": map[string]interface{}{"listen_address": address},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, seq := range []uint32{5, 6} {
+		if err := s.Process(context.Background(), grpcTestMessage(seq)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(grpcLedgerCodec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	const service = "/obsrvr.latestledger.v1.LatestLedgerService/"
+
+	req, resp := rawProto{0x08, 0x05}, rawProto{}
+	if err := conn.Invoke(ctx, service+"GetLedger", &req, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(resp) != grpcTestLedgerProto {
+		t.Errorf("GetLedger(5) = %x, want %s", []byte(resp), grpcTestLedgerProto)
+	}
+	req = rawProto{}
+	if err := conn.Invoke(ctx, service+"GetLedger", &req, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(resp, []byte{0x08, 0x06}) {
+		t.Errorf("GetLedger without a sequence = %x, want ledger 6", []byte(resp))
+	}
+	req = rawProto{0x08, 0x07}
+	if err := conn.Invoke(ctx, service+"GetLedger", &req, &resp); status.Code(err) != codes.NotFound {
+		t.Errorf("GetLedger(7) error = %v, want NotFound", err)
+	}
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, service+"SubscribeLedgers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = rawProto{0x08, 0x05}
+	if err := stream.SendMsg(&req); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range []byte{5, 6, 7} {
+		if seq == 7 {
+			if err := s.Process(context.Background(), grpcTestMessage(7)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var ledger rawProto
+		if err := stream.RecvMsg(&ledger); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(ledger, []byte{0x08, seq}) {
+			t.Errorf("streamed %x, want ledger %d", []byte(ledger), seq)
+		}
+	}
+
+	// Closing the server ends the stream with UNAVAILABLE.
+	s.Close()
+	var ledger rawProto
+	if err := stream.RecvMsg(&ledger); err == io.EOF || status.Code(err) != codes.Unavailable {
+		t.Errorf("stream ended with %v, want Unavailable", err)
+	}
+}
@@ -0,0 +1,61 @@
+// histogram.go
+package main
+
+import (
+	"fmt"
+)
+
+// defaultInstructionBuckets are the default upper bounds of the Soroban
+// instruction histogram, up to the 100M per-transaction network limit.
+var defaultInstructionBuckets = []int{1000000, 5000000, 10000000, 25000000, 50000000, 100000000}
+
+// HistogramBucket counts the values up to and including UpperBound that did
+// not fall into a lower bucket. The last bucket has no upper bound.
+type HistogramBucket struct {
+	UpperBound *uint64 `json:"upper_bound"` // null for the overflow bucket
+	Count      int     `json:"count"`
+}
+
+// newInstructionBucketsFromConfig reads instruction_histogram_buckets,
+// which must be strictly ascending positive bounds.
+func newInstructionBucketsFromConfig(config map[string]interface{}) ([]uint64, error) {
+	bounds, err := configIntSlice(config, "instruction_histogram_buckets")
+	if err != nil {
+		return nil, err
+	}
+	if bounds == nil {
+		bounds = defaultInstructionBuckets
+	}
+	if len(bounds) == 0 {
+		return nil, fmt.Errorf("instruction_histogram_buckets must not be empty")
+	}
+	buckets := make([]uint64, len(bounds))
+	for i, bound := range bounds {
+		if bound < 1 || (i > 0 && bound <= bounds[i-1]) {
+			return nil, fmt.Errorf("instruction_histogram_buckets must be strictly ascending positive numbers, got %v", bounds)
+		}
+		buckets[i] = uint64(bound)
+	}
+	return buckets, nil
+}
+
+// newHistogram returns empty buckets for the given upper bounds, plus the
+// overflow bucket.
+func newHistogram(bounds []uint64) []HistogramBucket {
+	histogram := make([]HistogramBucket, len(bounds)+1)
+	for i := range bounds {
+		bound := bounds[i]
+		histogram[i].UpperBound = &bound
+	}
+	return histogram
+}
+
+// observeHistogram counts value in the first bucket that covers it.
+func observeHistogram(histogram []HistogramBucket, value uint64) {
+	for i := range histogram {
+		if histogram[i].UpperBound == nil || value <= *histogram[i].UpperBound {
+			histogram[i].Count++
+			return
+		}
+	}
+}
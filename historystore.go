@@ -0,0 +1,204 @@
+// historystore.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// maxHistoryPageSize is the most ledgers a range query of the history
+// store returns.
+const maxHistoryPageSize = 1000
+
+// historyStore keeps every processed ledger in a local SQLite database, one
+// row per ledger keyed on the network and sequence, so lookups by sequence
+// and range are served without external infrastructure. Rows hold the
+// ledger metrics as JSON; replayed and corrected ledgers replace their rows.
+type historyStore struct {
+	db        *sql.DB
+	networkID string
+}
+
+// newHistoryStoreFromConfig parses the optional history_store config block:
+//
+//	"history_store": {
+//	  "path": "/var/lib/flow/ledgers.db"
+//	}
+//
+// The database file is created, and its table migrated, here, so an
+// unwritable path fails the config. It returns nil when no history store is
+// configured.
+func newHistoryStoreFromConfig(config map[string]interface{}, networkPassphrase string) (*historyStore, error) {
+	raw, ok := config["history_store"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("history_store must be an object, got %T", raw)
+	}
+	path, err := configString(block, "path", "")
+	if err != nil {
+		return nil, fmt.Errorf("history_store: %w", err)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("history_store: path is required")
+	}
+	store, err := openHistoryStore(path, networkIDHex(networkPassphrase))
+	if err != nil {
+		return nil, fmt.Errorf("history_store: %w", err)
+	}
+	return store, nil
+}
+
+// openHistoryStore opens, creating if needed, the SQLite database at path.
+func openHistoryStore(path, networkID string) (*historyStore, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer; one connection avoids busy errors
+	// between the pool's own connections.
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ledgers (
+	network_id TEXT NOT NULL,
+	sequence INTEGER NOT NULL,
+	closed_at TEXT NOT NULL,
+	metrics TEXT NOT NULL,
+	PRIMARY KEY (network_id, sequence)
+)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating table: %w", err)
+	}
+	return &historyStore{db: db, networkID: networkID}, nil
+}
+
+// add stores the metrics of a ledger, replacing any earlier row of it.
+func (s *historyStore) add(metrics LatestLedger) error {
+	encoded, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO ledgers (network_id, sequence, closed_at, metrics) VALUES (?, ?, ?, ?)
+ON CONFLICT (network_id, sequence) DO UPDATE SET closed_at = excluded.closed_at, metrics = excluded.metrics`,
+		s.networkID, metrics.Sequence, metrics.ClosedAt.UTC().Format(time.RFC3339), string(encoded))
+	return err
+}
+
+// get returns the metrics of a stored ledger.
+func (s *historyStore) get(seq uint32) (LatestLedger, bool, error) {
+	var encoded string
+	err := s.db.QueryRow(`SELECT metrics FROM ledgers WHERE network_id = ? AND sequence = ?`, s.networkID, seq).Scan(&encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LatestLedger{}, false, nil
+	}
+	if err != nil {
+		return LatestLedger{}, false, err
+	}
+	var metrics LatestLedger
+	if err := json.Unmarshal([]byte(encoded), &metrics); err != nil {
+		return LatestLedger{}, false, fmt.Errorf("ledger %d: %w", seq, err)
+	}
+	return metrics, true, nil
+}
+
+// between returns the metrics of the stored ledgers from from to to,
+// inclusive, in sequence order, at most limit of them.
+func (s *historyStore) between(from, to uint32, limit int) ([]LatestLedger, error) {
+	rows, err := s.db.Query(`SELECT sequence, metrics FROM ledgers
+WHERE network_id = ? AND sequence BETWEEN ? AND ?
+ORDER BY sequence LIMIT ?`, s.networkID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ledgers []LatestLedger
+	for rows.Next() {
+		var seq uint32
+		var encoded string
+		if err := rows.Scan(&seq, &encoded); err != nil {
+			return nil, err
+		}
+		var metrics LatestLedger
+		if err := json.Unmarshal([]byte(encoded), &metrics); err != nil {
+			return nil, fmt.Errorf("ledger %d: %w", seq, err)
+		}
+		ledgers = append(ledgers, metrics)
+	}
+	return ledgers, rows.Err()
+}
+
+// Close closes the database.
+func (s *historyStore) Close() error {
+	return s.db.Close()
+}
+
+// LedgerBySequence returns the metrics of a ledger from the history store.
+// The boolean is false when the ledger has not been processed.
+func (p *LatestLedgerProcessor) LedgerBySequence(seq uint32) (LatestLedger, bool, error) {
+	if p.history == nil {
+		return LatestLedger{}, false, fmt.Errorf("no history_store is configured")
+	}
+	return p.history.get(seq)
+}
+
+// Ledgers returns the metrics of the processed ledgers from from to to,
+// inclusive, in sequence order, at most limit of them, from the history
+// store. Ledgers that were not processed are left out.
+func (p *LatestLedgerProcessor) Ledgers(from, to uint32, limit int) ([]LatestLedger, error) {
+	if p.history == nil {
+		return nil, fmt.Errorf("no history_store is configured")
+	}
+	if to < from {
+		return nil, fmt.Errorf("to must not be before from")
+	}
+	if limit < 1 || limit > maxHistoryPageSize {
+		return nil, fmt.Errorf("limit must be between 1 and %d, got %d", maxHistoryPageSize, limit)
+	}
+	return p.history.between(from, to, limit)
+}
+
+// historyRecord returns the record of a ledger from the history store,
+// serialized like the forwarded payload. The boolean is false when no
+// history store is configured or the ledger has not been processed.
+func (p *LatestLedgerProcessor) historyRecord(seq uint32) ([]byte, bool, error) {
+	if p.history == nil {
+		return nil, false, nil
+	}
+	metrics, ok, err := p.history.get(seq)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	payload, err := p.marshalPayload(metrics)
+	if err != nil {
+		return nil, false, err
+	}
+	return payload, true, nil
+}
+
+// historyRecords returns the records of the stored ledgers from from to to,
+// inclusive, in sequence order, at most limit of them, serialized like the
+// forwarded payload. It returns none when no history store is configured.
+func (p *LatestLedgerProcessor) historyRecords(from, to uint32, limit int) ([]ledgerRecord, error) {
+	if p.history == nil {
+		return nil, nil
+	}
+	ledgers, err := p.history.between(from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]ledgerRecord, len(ledgers))
+	for i, metrics := range ledgers {
+		if records[i].payload, err = p.marshalPayload(metrics); err != nil {
+			return nil, err
+		}
+		records[i].sequence = metrics.Sequence
+	}
+	return records, nil
+}
@@ -0,0 +1,154 @@
+// historystore_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/network"
+	"github.com/withObsrvr/pluginapi"
+)
+
+func TestHistoryStoreServesStoredLedgers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledgers.db")
+	config := map[string]interface{}{
+		"network_passphrase": network.TestNetworkPassphrase,
+		"history_store":      map[string]interface{}{"path": path},
+	}
+	p, err := NewLatestLedgerProcessor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAt := time.Unix(1_700_000_000, 0).UTC()
+	for seq := uint32(10); seq <= 14; seq++ {
+		metrics := LatestLedger{Sequence: seq, Hash: "h", TransactionCount: int(seq - 9), ClosedAt: closedAt.Add(time.Duration(seq) * 5 * time.Second)}
+		if err := p.history.add(metrics); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The history outlives the processor.
+	p, err = NewLatestLedgerProcessor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	metrics, ok, err := p.LedgerBySequence(14)
+	if err != nil || !ok {
+		t.Fatalf("LedgerBySequence(14) = %v, %v", ok, err)
+	}
+	if metrics.Hash != "h" || metrics.TransactionCount != 5 || !metrics.ClosedAt.Equal(closedAt.Add(70*time.Second)) {
+		t.Errorf("LedgerBySequence(14) = %+v", metrics)
+	}
+	if _, ok, err := p.LedgerBySequence(15); ok || err != nil {
+		t.Errorf("LedgerBySequence(15) = %v, %v, want not found", ok, err)
+	}
+
+	ledgers, err := p.Ledgers(9, 13, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sequences []uint32
+	for _, ledger := range ledgers {
+		sequences = append(sequences, ledger.Sequence)
+	}
+	if len(sequences) != 3 || sequences[0] != 10 || sequences[1] != 11 || sequences[2] != 12 {
+		t.Errorf("Ledgers(9, 13, 3) returned sequences %v, want [10 11 12]", sequences)
+	}
+	if _, err := p.Ledgers(13, 9, 3); err == nil {
+		t.Error("Ledgers accepted a range ending before it starts")
+	}
+}
+
+func TestHistoryStoreReplacesCorrections(t *testing.T) {
+	store, err := openHistoryStore(filepath.Join(t.TempDir(), "ledgers.db"), networkIDHex(network.TestNetworkPassphrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.add(LatestLedger{Sequence: 7, TransactionCount: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.add(LatestLedger{Sequence: 7, TransactionCount: 2}); err != nil {
+		t.Fatal(err)
+	}
+	ledgers, err := store.between(0, 100, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ledgers) != 1 || ledgers[0].TransactionCount != 2 {
+		t.Errorf("stored %+v, want only the correction", ledgers)
+	}
+
+	// Other networks sharing the file are kept apart.
+	other := &historyStore{db: store.db, networkID: networkIDHex(network.PublicNetworkPassphrase)}
+	if _, ok, err := other.get(7); ok || err != nil {
+		t.Errorf("ledger of another network found: %v, %v", ok, err)
+	}
+}
+
+func TestHTTPAPIFallsBackToHistoryStore(t *testing.T) {
+	address := freeAddress(t)
+	p, err := NewLatestLedgerProcessor(map[string]interface{}{
+		"network_passphrase": network.TestNetworkPassphrase,
+		"history_store":      map[string]interface{}{"path": filepath.Join(t.TempDir(), "ledgers.db")},
+		"http_api":           map[string]interface{}{"listen_address": address, "retain": 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for seq := uint32(10); seq <= 14; seq++ {
+		lcm := testLedger(t, network.TestNetworkPassphrase, seq, 1_700_000_000+int64(seq)*5, int(seq-9))
+		if err := p.Process(context.Background(), pluginapi.Message{Payload: lcm}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(path string) (int, []byte) {
+		t.Helper()
+		resp, err := http.Get("http://" + address + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, body
+	}
+
+	// Ledger 11 left the retained window of 2 ledgers.
+	status, body := get("/v1/ledgers/11")
+	var ledger LatestLedger
+	if status != http.StatusOK || json.Unmarshal(body, &ledger) != nil || ledger.Sequence != 11 || ledger.TransactionCount != 2 {
+		t.Errorf("GET /v1/ledgers/11 = %d %s", status, body)
+	}
+	if status, body := get("/v1/ledgers/15"); status != http.StatusNotFound {
+		t.Errorf("GET /v1/ledgers/15 = %d %s, want 404", status, body)
+	}
+
+	status, body = get("/v1/ledgers?from=11&limit=3")
+	var ledgers []LatestLedger
+	if status != http.StatusOK || json.Unmarshal(body, &ledgers) != nil {
+		t.Fatalf("GET /v1/ledgers?from=11&limit=3 = %d %s", status, body)
+	}
+	var sequences []uint32
+	for _, ledger := range ledgers {
+		sequences = append(sequences, ledger.Sequence)
+	}
+	if fmt.Sprint(sequences) != "[11 12 13]" {
+		t.Errorf("range returned sequences %v, want [11 12 13]", sequences)
+	}
+}
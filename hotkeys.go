@@ -0,0 +1,200 @@
+// hotkeys.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Defaults for the hot_keys config block.
+const (
+	defaultHotKeyWindowLedgers = 720 // about one hour
+	defaultHotKeyTopN          = 10
+)
+
+// HotKeyReport lists the contract data keys most often declared as written
+// by Soroban transactions over a rolling window of ledgers. Transactions
+// writing the same key cannot be applied in parallel, so hot keys point at
+// contention.
+type HotKeyReport struct {
+	LedgerSequence uint32   `json:"ledger_sequence"`
+	WindowLedgers  int      `json:"window_ledgers"` // Ledgers covered by the report
+	Keys           []HotKey `json:"keys"`
+}
+
+// HotKey is a contract data ledger key and its write count in the window.
+type HotKey struct {
+	Key        string `json:"key"` // Base64 XDR LedgerKey
+	ContractID string `json:"contract_id"`
+	Durability string `json:"durability"` // "persistent" or "temporary"
+	WriteCount int    `json:"write_count"`
+}
+
+// hotKeyTracker counts contract data writes per key over the window.
+type hotKeyTracker struct {
+	window int
+	topN   int
+
+	ledgers []map[string]int   // per-ledger write counts, oldest first
+	totals  map[string]int     // write counts over the window
+	keys    map[string]*HotKey // key details, for keys with a non-zero total
+}
+
+// newHotKeyTrackerFromConfig parses the optional hot_keys config block:
+//
+//	"hot_keys": {"window_ledgers": 720, "top_n": 10}
+//
+// It returns nil when hot key detection is not configured.
+func newHotKeyTrackerFromConfig(config map[string]interface{}) (*hotKeyTracker, error) {
+	raw, ok := config["hot_keys"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("hot_keys must be an object, got %T", raw)
+	}
+	window, err := configInt(block, "window_ledgers", defaultHotKeyWindowLedgers)
+	if err != nil {
+		return nil, fmt.Errorf("hot_keys: %w", err)
+	}
+	topN, err := configInt(block, "top_n", defaultHotKeyTopN)
+	if err != nil {
+		return nil, fmt.Errorf("hot_keys: %w", err)
+	}
+	if window < 1 || topN < 1 {
+		return nil, fmt.Errorf("hot_keys: window_ledgers and top_n must be at least 1")
+	}
+	return &hotKeyTracker{
+		window: window,
+		topN:   topN,
+		totals: make(map[string]int),
+		keys:   make(map[string]*HotKey),
+	}, nil
+}
+
+// ledgerKeyWrites collects the contract data keys in the read-write
+// footprints of a ledger's Soroban transactions.
+type ledgerKeyWrites struct {
+	counts map[string]int
+	keys   map[string]*HotKey
+}
+
+func (w *ledgerKeyWrites) add(tx ingest.LedgerTransaction) {
+	data, ok := transactionSorobanData(tx)
+	if !ok {
+		return
+	}
+	for _, key := range data.Resources.Footprint.ReadWrite {
+		contractData, ok := key.GetContractData()
+		if !ok {
+			continue
+		}
+		encoded, err := xdr.MarshalBase64(key)
+		if err != nil {
+			continue
+		}
+		if w.counts == nil {
+			w.counts = make(map[string]int)
+			w.keys = make(map[string]*HotKey)
+		}
+		w.counts[encoded]++
+		if _, seen := w.keys[encoded]; !seen {
+			contractID, _ := contractData.Contract.String()
+			durability := "persistent"
+			if contractData.Durability == xdr.ContractDataDurabilityTemporary {
+				durability = "temporary"
+			}
+			w.keys[encoded] = &HotKey{Key: encoded, ContractID: contractID, Durability: durability}
+		}
+	}
+}
+
+// add folds a ledger's writes into the window and evicts the oldest ledger
+// once the window is full.
+func (t *hotKeyTracker) add(writes ledgerKeyWrites) {
+	for key, count := range writes.counts {
+		t.totals[key] += count
+		if _, ok := t.keys[key]; !ok {
+			t.keys[key] = writes.keys[key]
+		}
+	}
+	t.ledgers = append(t.ledgers, writes.counts)
+	if len(t.ledgers) <= t.window {
+		return
+	}
+	for key, count := range t.ledgers[0] {
+		t.totals[key] -= count
+		if t.totals[key] <= 0 {
+			delete(t.totals, key)
+			delete(t.keys, key)
+		}
+	}
+	t.ledgers = t.ledgers[1:]
+}
+
+// report returns the top keys by write count, ties broken by key.
+func (t *hotKeyTracker) report(seq uint32) HotKeyReport {
+	keys := make([]string, 0, len(t.totals))
+	for key := range t.totals {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if t.totals[keys[i]] != t.totals[keys[j]] {
+			return t.totals[keys[i]] > t.totals[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > t.topN {
+		keys = keys[:t.topN]
+	}
+
+	report := HotKeyReport{
+		LedgerSequence: seq,
+		WindowLedgers:  len(t.ledgers),
+		Keys:           make([]HotKey, 0, len(keys)),
+	}
+	for _, key := range keys {
+		hotKey := *t.keys[key]
+		hotKey.WriteCount = t.totals[key]
+		report.Keys = append(report.Keys, hotKey)
+	}
+	return report
+}
+
+// forwardHotKeys folds the ledger's writes into the window and emits a
+// hot_keys report.
+func (p *LatestLedgerProcessor) forwardHotKeys(ctx context.Context, msg pluginapi.Message, seq uint32, writes ledgerKeyWrites) error {
+	p.hotKeys.add(writes)
+	payload, err := p.encodePayload(p.hotKeys.report(seq))
+	if err != nil {
+		return fmt.Errorf("error marshaling hot key report: %w", err)
+	}
+	p.forward(ctx, pluginapi.Message{
+		Payload:   payload,
+		Timestamp: msg.Timestamp,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": seq,
+			"source":          "latest-ledger-processor",
+			"data_type":       "hot_keys",
+		},
+	})
+	return nil
+}
+
+// transactionSorobanData returns the Soroban resources declared by a
+// transaction, or by the inner transaction of a fee bump.
+func transactionSorobanData(tx ingest.LedgerTransaction) (xdr.SorobanTransactionData, bool) {
+	switch tx.Envelope.Type {
+	case xdr.EnvelopeTypeEnvelopeTypeTx:
+		return tx.Envelope.V1.Tx.Ext.GetSorobanData()
+	case xdr.EnvelopeTypeEnvelopeTypeTxFeeBump:
+		return tx.Envelope.FeeBump.Tx.InnerTx.V1.Tx.Ext.GetSorobanData()
+	}
+	return xdr.SorobanTransactionData{}, false
+}
@@ -0,0 +1,255 @@
+// httpapi.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Defaults of the http_api config block.
+const (
+	defaultHTTPAPIListenAddress = ":8083"
+	defaultHTTPAPIRetain        = 1000
+)
+
+// Page sizes of /v1/ledgers range queries.
+const (
+	defaultLedgerPageSize = 100
+	maxLedgerPageSize     = 1000
+)
+
+// httpAPIServer serves the ledger API over HTTP from the ledgers it
+// retains, and from the history store when one is configured, so status
+// pages can query the processor directly. It is dispatched to like a
+// registered consumer and ignores messages other than latest_ledger.
+type httpAPIServer struct {
+	store    *ledgerStore
+	origins  []string
+	server   *http.Server
+	listener net.Listener
+}
+
+// ledgerHistory serves the records of ledgers that are no longer retained in
+// memory, serialized like forwarded payloads.
+type ledgerHistory interface {
+	historyRecord(seq uint32) ([]byte, bool, error)
+	historyRecords(from, to uint32, limit int) ([]ledgerRecord, error)
+}
+
+// ledgerRecord is the record of a ledger served by the ledger API.
+type ledgerRecord struct {
+	sequence uint32
+	payload  []byte
+}
+
+// newHTTPAPIServerFromConfig parses the optional http_api config block:
+//
+//	"http_api": {
+//	  "listen_address": ":8083",
+//	  "retain": 1000,
+//	  "allowed_origins": ["https://status.example.com"]
+//	}
+//
+// The listener is opened here, so an address in use fails the config;
+// requests are served once serve is called. It returns nil when no HTTP API
+// is configured.
+func newHTTPAPIServerFromConfig(config map[string]interface{}, namespace string) (*httpAPIServer, error) {
+	raw, ok := config["http_api"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("http_api must be an object, got %T", raw)
+	}
+	address, err := configString(block, "listen_address", defaultHTTPAPIListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("http_api: %w", err)
+	}
+	retain, err := configInt(block, "retain", defaultHTTPAPIRetain)
+	if err != nil {
+		return nil, fmt.Errorf("http_api: %w", err)
+	}
+	if retain < 1 {
+		return nil, fmt.Errorf("http_api: retain must be at least 1")
+	}
+	origins, err := configStringSlice(block, "allowed_origins")
+	if err != nil {
+		return nil, fmt.Errorf("http_api: %w", err)
+	}
+
+	s := &httpAPIServer{store: newLedgerStore(retain, namespace+"latest_ledger"), origins: origins}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("http_api: %w", err)
+	}
+	s.listener = listener
+	s.server = &http.Server{ReadHeaderTimeout: 10 * time.Second}
+	return s, nil
+}
+
+// serve starts serving requests, looking up ledgers that are not retained
+// in history.
+func (s *httpAPIServer) serve(history ledgerHistory) {
+	mux := http.NewServeMux()
+	registerLedgerAPI(mux, s.store, history)
+	s.server.Handler = allowOrigins(mux, s.origins)
+	go func() {
+		if err := s.server.Serve(s.listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Warning: http api stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving ledger API on %s/v1/ledgers", s.listener.Addr())
+}
+
+// Name identifies the server in logs and dispatch reports.
+func (s *httpAPIServer) Name() string {
+	return "http_api"
+}
+
+// Process retains the payload of a latest_ledger message. A reprocessed
+// correction replaces the retained payload of its ledger.
+func (s *httpAPIServer) Process(ctx context.Context, msg pluginapi.Message) error {
+	return s.store.Process(ctx, msg)
+}
+
+// Close stops the server.
+func (s *httpAPIServer) Close() error {
+	err := s.server.Close()
+	s.listener.Close() // in case Serve has not started yet
+	return err
+}
+
+// registerLedgerAPI adds the ledger API, served from the store and then
+// from history, to the mux:
+//
+//	GET /v1/ledgers/latest            the most recent ledger
+//	GET /v1/ledgers/{sequence}        a retained or stored ledger
+//	GET /v1/ledgers?from=&to=&limit=  retained and stored ledgers in sequence order
+func registerLedgerAPI(mux *http.ServeMux, store *ledgerStore, history ledgerHistory) {
+	mux.HandleFunc("GET /v1/ledgers/latest", func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := store.latest()
+		if !ok {
+			http.Error(w, "no ledger processed yet", http.StatusNotFound)
+			return
+		}
+		writeJSONPayload(w, payload)
+	})
+	mux.HandleFunc("GET /v1/ledgers/{sequence}", func(w http.ResponseWriter, r *http.Request) {
+		seq, err := strconv.ParseUint(r.PathValue("sequence"), 10, 32)
+		if err != nil {
+			http.Error(w, "invalid ledger sequence", http.StatusBadRequest)
+			return
+		}
+		payload, ok, err := lookupLedger(store, history, uint32(seq))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "ledger not retained", http.StatusNotFound)
+			return
+		}
+		writeJSONPayload(w, payload)
+	})
+	mux.HandleFunc("GET /v1/ledgers", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		from, to := uint64(0), uint64(math.MaxUint32)
+		limit := defaultLedgerPageSize
+		var err error
+		if v := query.Get("from"); v != "" {
+			if from, err = strconv.ParseUint(v, 10, 32); err != nil {
+				http.Error(w, "from must be a ledger sequence", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("to"); v != "" {
+			if to, err = strconv.ParseUint(v, 10, 32); err != nil {
+				http.Error(w, "to must be a ledger sequence", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := query.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxLedgerPageSize {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxLedgerPageSize), http.StatusBadRequest)
+				return
+			}
+		}
+		if to < from {
+			http.Error(w, "to must not be before from", http.StatusBadRequest)
+			return
+		}
+		records := store.between(uint32(from), uint32(to), limit)
+		if history != nil {
+			stored, err := history.historyRecords(uint32(from), uint32(to), limit)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			records = mergeLedgerRecords(records, stored, limit)
+		}
+		payloads := make([][]byte, len(records))
+		for i, record := range records {
+			payloads[i] = record.payload
+		}
+		writeJSONPayload(w, append(append([]byte{'['}, bytes.Join(payloads, []byte{','})...), ']'))
+	})
+}
+
+// lookupLedger returns the record of a ledger from the store or, once it
+// left the retained window, from history.
+func lookupLedger(store *ledgerStore, history ledgerHistory, seq uint32) ([]byte, bool, error) {
+	if payload, ok := store.get(seq); ok || history == nil {
+		return payload, ok, nil
+	}
+	return history.historyRecord(seq)
+}
+
+// mergeLedgerRecords merges two lists of records in sequence order into at
+// most limit records. Retained records, as forwarded, win over stored ones
+// of the same ledger.
+func mergeLedgerRecords(retained, stored []ledgerRecord, limit int) []ledgerRecord {
+	merged := make([]ledgerRecord, 0, min(len(retained)+len(stored), limit))
+	for len(merged) < limit && (len(retained) > 0 || len(stored) > 0) {
+		switch {
+		case len(stored) == 0 || len(retained) > 0 && retained[0].sequence < stored[0].sequence:
+			merged = append(merged, retained[0])
+			retained = retained[1:]
+		case len(retained) == 0 || stored[0].sequence < retained[0].sequence:
+			merged = append(merged, stored[0])
+			stored = stored[1:]
+		default:
+			merged = append(merged, retained[0])
+			retained, stored = retained[1:], stored[1:]
+		}
+	}
+	return merged
+}
+
+// allowOrigins sets the CORS headers of responses, so browser status pages
+// on other origins can call the API. Without origins, every origin is
+// allowed.
+func allowOrigins(next http.Handler, origins []string) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(origins) == 0 {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else if origin := r.Header.Get("Origin"); allowed[origin] {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Vary", "Origin")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
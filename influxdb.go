@@ -0,0 +1,273 @@
+// influxdb.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the influxdb config block.
+const (
+	defaultInfluxMeasurement = "latest_ledger"
+	// defaultInfluxMaxBufferedPoints bounds the points kept for retry while
+	// InfluxDB is unreachable, about a day of ledgers.
+	defaultInfluxMaxBufferedPoints = 17280
+	influxWriteTimeout             = 10 * time.Second
+)
+
+// influxWriter writes one point per ledger to InfluxDB v2 in line
+// protocol, so ledger metrics land in InfluxDB without a consumer plugin.
+// Points that fail to write are kept and retried with the next ledger.
+type influxWriter struct {
+	writeURL    string
+	token       string
+	measurement string
+	tags        string // escaped tag set, sorted by key
+	client      *http.Client
+	maxBuffered int
+
+	mu      sync.Mutex
+	pending [][]byte // lines not written yet
+}
+
+// newInfluxWriterFromConfig parses the optional influxdb config block:
+//
+//	"influxdb": {
+//	  "url": "http://localhost:8086",
+//	  "org": "obsrvr",
+//	  "bucket": "stellar",
+//	  "token": "secret",
+//	  "measurement": "latest_ledger",
+//	  "tags": {"region": "eu"}
+//	}
+//
+// Points are tagged with the network and the data_type. It returns nil
+// when no InfluxDB output is configured.
+func newInfluxWriterFromConfig(config map[string]interface{}, network, namespace string) (*influxWriter, error) {
+	raw, ok := config["influxdb"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("influxdb must be an object, got %T", raw)
+	}
+	settings := make(map[string]string)
+	for _, key := range []string{"url", "org", "bucket", "token"} {
+		value, err := configString(block, key, "")
+		if err != nil {
+			return nil, fmt.Errorf("influxdb: %w", err)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("influxdb: %s is required", key)
+		}
+		settings[key] = value
+	}
+	measurement, err := configString(block, "measurement", defaultInfluxMeasurement)
+	if err != nil {
+		return nil, fmt.Errorf("influxdb: %w", err)
+	}
+	if measurement == "" {
+		return nil, fmt.Errorf("influxdb: measurement must not be empty")
+	}
+	extraTags, err := configStringMap(block, "tags")
+	if err != nil {
+		return nil, fmt.Errorf("influxdb: %w", err)
+	}
+	maxBuffered, err := configInt(block, "max_buffered_points", defaultInfluxMaxBufferedPoints)
+	if err != nil {
+		return nil, fmt.Errorf("influxdb: %w", err)
+	}
+	if maxBuffered < 1 {
+		return nil, fmt.Errorf("influxdb: max_buffered_points must be at least 1")
+	}
+
+	base, err := url.Parse(strings.TrimRight(settings["url"], "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("influxdb: invalid url %q", settings["url"])
+	}
+	base.Path += "/api/v2/write"
+	base.RawQuery = url.Values{
+		"org":       {settings["org"]},
+		"bucket":    {settings["bucket"]},
+		"precision": {"s"},
+	}.Encode()
+
+	tags := map[string]string{"data_type": namespace + "latest_ledger"}
+	if network != "" {
+		tags["network"] = network
+	}
+	for k, v := range extraTags {
+		if k == "" || v == "" {
+			return nil, fmt.Errorf("influxdb: tags must have non-empty keys and values")
+		}
+		if _, reserved := tags[k]; reserved || k == "network" {
+			return nil, fmt.Errorf("influxdb: tag %s is set by the processor", k)
+		}
+		tags[k] = v
+	}
+
+	return &influxWriter{
+		writeURL:    base.String(),
+		token:       settings["token"],
+		measurement: measurement,
+		tags:        influxTagSet(tags),
+		client:      &http.Client{Timeout: influxWriteTimeout},
+		maxBuffered: maxBuffered,
+	}, nil
+}
+
+// influxTagSet returns the escaped ",key=value" pairs of tags, sorted by key
+// as InfluxDB recommends.
+func influxTagSet(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString("," + influxEscape(k, ",= ") + "=" + influxEscape(tags[k], ",= "))
+	}
+	return b.String()
+}
+
+// influxEscape backslash-escapes the given characters of a line protocol
+// element.
+func influxEscape(s, chars string) string {
+	if !strings.ContainsAny(s, chars+"\\") {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\\' || strings.ContainsRune(chars, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// add writes the point of a ledger, together with any points left by
+// failed writes.
+func (w *influxWriter) add(ctx context.Context, metrics LatestLedger) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, w.line(metrics))
+	if dropped := len(w.pending) - w.maxBuffered; dropped > 0 {
+		log.Printf("Warning: InfluxDB buffer full, dropping the %d oldest points", dropped)
+		w.pending = w.pending[dropped:]
+	}
+	if err := w.write(ctx); err != nil {
+		log.Printf("Warning: writing %d points to InfluxDB failed: %v", len(w.pending), err)
+	}
+}
+
+// line returns the line protocol point of a ledger. Its fields are the
+// numeric, boolean and string metrics, with nested values flattened into
+// names joined by underscores; lists are left out. The timestamp is the
+// ledger close time.
+func (w *influxWriter) line(metrics LatestLedger) []byte {
+	var fields []byte
+	appendInfluxFields(&fields, reflect.ValueOf(metrics), "")
+	buf := make([]byte, 0, len(w.measurement)+len(w.tags)+len(fields)+24)
+	buf = append(buf, influxEscape(w.measurement, ", ")...)
+	buf = append(buf, w.tags...)
+	buf = append(buf, ' ')
+	buf = append(buf, fields...)
+	buf = append(buf, ' ')
+	return strconv.AppendInt(buf, metrics.ClosedAt.Unix(), 10)
+}
+
+func appendInfluxFields(fields *[]byte, v reflect.Value, prefix string) {
+	for _, f := range payloadFields(v.Type()) {
+		field := v.Field(f.index)
+		name := prefix + f.name
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		if field.Type() == timeType {
+			continue
+		}
+		var value []byte
+		switch field.Kind() {
+		case reflect.Struct:
+			appendInfluxFields(fields, field, name+"_")
+			continue
+		case reflect.Bool:
+			value = strconv.AppendBool(nil, field.Bool())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			value = append(strconv.AppendInt(nil, field.Int(), 10), 'i')
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			value = append(strconv.AppendUint(nil, field.Uint(), 10), 'u')
+		case reflect.Float32, reflect.Float64:
+			if math.IsNaN(field.Float()) || math.IsInf(field.Float(), 0) {
+				continue // not representable in line protocol
+			}
+			value = strconv.AppendFloat(nil, field.Float(), 'g', -1, 64)
+		case reflect.String:
+			value = append(append([]byte{'"'}, influxEscape(field.String(), `"`)...), '"')
+		default:
+			continue
+		}
+		if len(*fields) > 0 {
+			*fields = append(*fields, ',')
+		}
+		*fields = append(*fields, influxEscape(name, ",= ")...)
+		*fields = append(*fields, '=')
+		*fields = append(*fields, value...)
+	}
+}
+
+// write sends the pending points in one request.
+func (w *influxWriter) write(ctx context.Context) error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	body := bytes.Join(w.pending, []byte{'\n'})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+w.token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+		if resp.StatusCode == http.StatusBadRequest {
+			// Malformed points are rejected on every retry.
+			w.pending = w.pending[:0]
+		}
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	w.pending = w.pending[:0]
+	return nil
+}
+
+// flush retries the pending points, if any.
+func (w *influxWriter) flush(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.write(ctx)
+}
@@ -0,0 +1,133 @@
+// Package baseline contains a frozen copy of the metric extraction shipped in
+// version 1.0.0 of the latest ledger processor. It exists so that the compare
+// command can diff the output of the current processor against known-stable
+// semantics. Do not change the extraction logic in this package; freeze a new
+// baseline package instead.
+package baseline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/ingest/ledger"
+	"github.com/stellar/go/xdr"
+)
+
+// Version is the processor version this baseline was frozen from.
+const Version = "1.0.0"
+
+// LatestLedger holds metrics extracted from a ledger.
+type LatestLedger struct {
+	Sequence                 uint32    `json:"sequence"`
+	Hash                     string    `json:"hash"`
+	TransactionCount         int       `json:"transaction_count"`
+	TxSetOperationCount      int       `json:"tx_set_operation_count"`
+	SuccessfulOperationCount int       `json:"successful_operation_count"`
+	SuccessfulTxCount        int       `json:"successful_tx_count"`
+	FailedTxCount            int       `json:"failed_tx_count"`
+	TotalFeeCharged          int64     `json:"total_fee_charged"`
+	ClosedAt                 time.Time `json:"closed_at"`
+	BaseFee                  uint32    `json:"base_fee"`
+
+	TransactionsPerSecond float64 `json:"transactions_per_second"`
+
+	SorobanTxCount            int    `json:"soroban_tx_count"`
+	TotalSorobanFees          int64  `json:"total_soroban_fees"`
+	TotalResourceInstructions uint64 `json:"total_resource_instructions"`
+
+	SkippedTxCount int `json:"skipped_tx_count"`
+	UnknownTxCount int `json:"unknown_tx_count"`
+}
+
+// Extractor computes baseline metrics for a sequence of ledgers. Like the
+// processor it was frozen from, it keeps the previous close time for the TPS
+// calculation, so ledgers must be fed in order.
+type Extractor struct {
+	networkPassphrase       string
+	previousLedgerCloseTime time.Time
+}
+
+// NewExtractor creates an Extractor for the given network.
+func NewExtractor(networkPassphrase string) *Extractor {
+	return &Extractor{networkPassphrase: networkPassphrase}
+}
+
+// Extract computes the metrics of a single ledger.
+func (e *Extractor) Extract(ledgerCloseMeta xdr.LedgerCloseMeta) (LatestLedger, error) {
+	txReader, err := ingest.NewLedgerTransactionReaderFromLedgerCloseMeta(
+		e.networkPassphrase,
+		ledgerCloseMeta,
+	)
+	if err != nil {
+		return LatestLedger{}, fmt.Errorf("error creating transaction reader: %v", err)
+	}
+	defer txReader.Close()
+
+	metrics := LatestLedger{
+		Sequence: ledger.Sequence(ledgerCloseMeta),
+		Hash:     ledger.Hash(ledgerCloseMeta),
+		BaseFee:  ledger.BaseFee(ledgerCloseMeta),
+		ClosedAt: ledger.ClosedAt(ledgerCloseMeta),
+	}
+
+	for {
+		tx, err := txReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if strings.Contains(err.Error(), "unknown tx hash") {
+				metrics.TransactionCount++
+				metrics.FailedTxCount++
+				metrics.UnknownTxCount++
+				continue
+			}
+			return LatestLedger{}, fmt.Errorf("error reading transaction: %v", err)
+		}
+
+		metrics.TransactionCount++
+		operationCount := len(tx.Envelope.Operations())
+		metrics.TxSetOperationCount += operationCount
+		metrics.TotalFeeCharged += int64(tx.Result.Result.FeeCharged)
+
+		if tx.Result.Successful() {
+			metrics.SuccessfulTxCount++
+			metrics.SuccessfulOperationCount += operationCount
+		} else {
+			metrics.FailedTxCount++
+		}
+
+		if sorobanData, ok := sorobanData(tx); ok {
+			metrics.SorobanTxCount++
+			metrics.TotalSorobanFees += int64(sorobanData.ResourceFee)
+			metrics.TotalResourceInstructions += uint64(uint32(sorobanData.Resources.Instructions))
+		}
+	}
+
+	if !e.previousLedgerCloseTime.IsZero() {
+		timeDiff := metrics.ClosedAt.Sub(e.previousLedgerCloseTime).Seconds()
+		if timeDiff > 0 {
+			metrics.TransactionsPerSecond = float64(metrics.SuccessfulOperationCount) / timeDiff
+		} else {
+			metrics.TransactionsPerSecond = float64(metrics.SuccessfulOperationCount) / 5.0
+		}
+	} else {
+		metrics.TransactionsPerSecond = float64(metrics.SuccessfulOperationCount) / 5.0
+	}
+	e.previousLedgerCloseTime = metrics.ClosedAt
+
+	return metrics, nil
+}
+
+func sorobanData(tx ingest.LedgerTransaction) (xdr.SorobanTransactionData, bool) {
+	switch tx.Envelope.Type {
+	case xdr.EnvelopeTypeEnvelopeTypeTx:
+		return tx.Envelope.V1.Tx.Ext.GetSorobanData()
+	case xdr.EnvelopeTypeEnvelopeTypeTxFeeBump:
+		return tx.Envelope.FeeBump.Tx.InnerTx.V1.Tx.Ext.GetSorobanData()
+	}
+	return xdr.SorobanTransactionData{}, false
+}
@@ -0,0 +1,167 @@
+// jsonlines.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Defaults of the json_lines config block.
+const (
+	defaultJSONLinesLedgers = 100
+	defaultJSONLinesSeconds = 60
+)
+
+// jsonLinesBatcher concatenates the JSON payloads of consecutive
+// latest_ledger messages into one newline-delimited JSON payload, so that
+// high-volume backfills forward one message per batch instead of one per
+// ledger, while consumers keep reading ordinary JSON records.
+type jsonLinesBatcher struct {
+	maxLedgers int
+	maxAge     time.Duration
+
+	buf     bytes.Buffer
+	count   int
+	first   uint32
+	last    uint32
+	started time.Time // when the first buffered ledger was added
+
+	stop chan struct{} // closed to stop the flush timer
+	done chan struct{} // closed once the flush timer stopped
+}
+
+// newJSONLinesBatcherFromConfig parses the optional json_lines config block:
+//
+//	"json_lines": {"ledgers": 100, "seconds": 60}
+//
+// It returns nil when latest_ledger messages are not batched.
+func newJSONLinesBatcherFromConfig(config map[string]interface{}) (*jsonLinesBatcher, error) {
+	raw, ok := config["json_lines"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("json_lines must be an object, got %T", raw)
+	}
+	maxLedgers, err := configInt(block, "ledgers", defaultJSONLinesLedgers)
+	if err != nil {
+		return nil, fmt.Errorf("json_lines: %w", err)
+	}
+	maxSeconds, err := configInt(block, "seconds", defaultJSONLinesSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("json_lines: %w", err)
+	}
+	if maxLedgers < 1 || maxSeconds < 1 {
+		return nil, fmt.Errorf("json_lines: ledgers and seconds must be at least 1")
+	}
+	return &jsonLinesBatcher{
+		maxLedgers: maxLedgers,
+		maxAge:     time.Duration(maxSeconds) * time.Second,
+	}, nil
+}
+
+// addToJSONLines buffers the JSON payload of a ledger and forwards the batch
+// once it holds enough ledgers or its first ledger is old enough. Batches
+// that age while no ledger arrives are forwarded by the flush timer.
+func (p *LatestLedgerProcessor) addToJSONLines(ctx context.Context, payload []byte, seq uint32, timestamp time.Time) {
+	b := p.jsonLines
+	if b.count == 0 {
+		b.started = time.Now()
+		b.first = seq
+	}
+	b.buf.Write(payload)
+	b.buf.WriteByte('\n')
+	b.count++
+	b.last = seq
+	if b.count < b.maxLedgers && time.Since(b.started) < b.maxAge {
+		return
+	}
+	p.forwardJSONLines(ctx, timestamp)
+}
+
+// startJSONLinesTimer starts the background timer that forwards a batch
+// once its first ledger is seconds old, even when no further ledger
+// arrives. Like the scheduler, it is called once the processor has its
+// final address.
+func (p *LatestLedgerProcessor) startJSONLinesTimer() {
+	b := p.jsonLines
+	if b == nil {
+		return
+	}
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+	go func() {
+		defer close(b.done)
+		for {
+			p.gate.processing.Lock()
+			wait := b.maxAge
+			if b.count > 0 {
+				wait -= time.Since(b.started)
+			}
+			p.gate.processing.Unlock()
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-b.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			p.flushAgedJSONLines()
+		}
+	}()
+}
+
+// stopJSONLinesTimer stops the flush timer and waits for a batch being
+// forwarded.
+func (p *LatestLedgerProcessor) stopJSONLinesTimer() {
+	if p.jsonLines == nil || p.jsonLines.stop == nil {
+		return
+	}
+	close(p.jsonLines.stop)
+	<-p.jsonLines.done
+	p.jsonLines.stop = nil
+}
+
+// flushAgedJSONLines forwards the batch if its first ledger is old enough.
+// Ledger processing is held off meanwhile, so downstream plugins never
+// receive messages concurrently.
+func (p *LatestLedgerProcessor) flushAgedJSONLines() {
+	p.gate.processing.Lock()
+	defer p.gate.processing.Unlock()
+	if b := p.jsonLines; b.count > 0 && time.Since(b.started) >= b.maxAge {
+		p.forwardJSONLines(context.Background(), time.Now())
+	}
+}
+
+// forwardJSONLines forwards the buffered ledgers, if any, as a
+// latest_ledger_batch message.
+func (p *LatestLedgerProcessor) forwardJSONLines(ctx context.Context, timestamp time.Time) {
+	b := p.jsonLines
+	if b.count == 0 {
+		return
+	}
+	data := bytes.Clone(b.buf.Bytes())
+	first, last, count := b.first, b.last, b.count
+	b.buf.Reset()
+	b.count = 0
+
+	p.forward(ctx, pluginapi.Message{
+		Payload:   data,
+		Timestamp: timestamp,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": last,
+			"source":          "latest-ledger-processor",
+			"data_type":       "latest_ledger_batch",
+			"encoding":        payloadEncodingNDJSON,
+			"first_ledger":    first,
+			"last_ledger":     last,
+			"ledger_count":    count,
+		},
+	})
+}
@@ -0,0 +1,54 @@
+// jsonlines_test.go
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/network"
+	"github.com/withObsrvr/pluginapi"
+)
+
+func TestJSONLinesTimerForwardsAgedBatch(t *testing.T) {
+	p, err := NewLatestLedgerProcessor(map[string]interface{}{
+		"network_passphrase": network.TestNetworkPassphrase,
+		"json_lines":         map[string]interface{}{"ledgers": 100, "seconds": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer := &recordingConsumer{}
+	p.RegisterConsumer(consumer)
+	p.startJSONLinesTimer()
+	defer p.Close()
+
+	for seq := uint32(10); seq <= 11; seq++ {
+		lcm := testLedger(t, network.TestNetworkPassphrase, seq, 1_700_000_000+int64(seq)*5, 1)
+		if err := p.Process(context.Background(), pluginapi.Message{Payload: lcm}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// No further ledger arrives; the timer forwards the batch.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		consumer.mu.Lock()
+		var batch *pluginapi.Message
+		for i, msg := range consumer.messages {
+			if msg.Metadata["data_type"] == "latest_ledger_batch" {
+				batch = &consumer.messages[i]
+			}
+		}
+		consumer.mu.Unlock()
+		if batch != nil {
+			if batch.Metadata["ledger_count"] != 2 || batch.Metadata["first_ledger"] != uint32(10) {
+				t.Errorf("batch metadata %v, want ledgers 10 and 11", batch.Metadata)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("aged batch not forwarded")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,64 @@
+// jsonnumbers.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+)
+
+// maxExactFloat is the largest integer magnitude a float64 represents
+// exactly (2^53). Larger integers decoded as float64 may have been rounded.
+const maxExactFloat = 1 << 53
+
+// loadConfigFile reads a JSON config file, keeping numbers as json.Number so
+// that 64-bit values are never rounded through float64.
+func loadConfigFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var config map[string]interface{}
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("error parsing config: %w", err)
+	}
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	return config, nil
+}
+
+// checkExactNumbers rejects float64 values in a decoded config that are too
+// large to be represented exactly, since the host may already have rounded
+// them. Such values must be passed as json.Number instead. It is applied
+// when strict_json_numbers is enabled.
+func checkExactNumbers(v interface{}, path string) error {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, child := range t {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if err := checkExactNumbers(child, childPath); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, child := range t {
+			if err := checkExactNumbers(child, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case float64:
+		if math.Abs(t) > maxExactFloat {
+			return fmt.Errorf("%s: %v exceeds 2^53 and may have lost precision as float64; decode the config with json.Number (strict_json_numbers)", path, t)
+		}
+	}
+	return nil
+}
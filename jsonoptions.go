@@ -0,0 +1,169 @@
+// jsonoptions.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// jsonOptions select the payload encodings that encoding/json cannot
+// express.
+type jsonOptions struct {
+	// int64Strings writes int64 and uint64 values as JSON strings, matching
+	// the String type they have in the GraphQL schema. JavaScript consumers
+	// parse JSON numbers as float64 and silently round values above 2^53;
+	// strings keep every digit.
+	int64Strings bool
+	// timeFormat writes times as RFC 3339 strings, like encoding/json, or
+	// as integer Unix seconds or milliseconds.
+	timeFormat string
+}
+
+// custom reports whether the options differ from plain json.Marshal.
+func (o jsonOptions) custom() bool {
+	return o.int64Strings || (o.timeFormat != "" && o.timeFormat != timeFormatRFC3339)
+}
+
+// appendJSON appends the JSON encoding of v to buf like json.Marshal,
+// except as selected by the options.
+func (o jsonOptions) appendJSON(buf []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(buf, "null"...), nil
+	}
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return append(buf, "null"...), nil
+		}
+		return o.appendJSON(buf, v.Elem())
+	}
+	if v.Type() == timeType && o.timeFormat != "" && o.timeFormat != timeFormatRFC3339 {
+		return appendUnixTime(buf, v.Interface().(time.Time), o.timeFormat), nil
+	}
+	if v.Type().Implements(jsonMarshalerType) {
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return append(buf, data...), nil
+	}
+	switch v.Kind() {
+	case reflect.Int64:
+		if !o.int64Strings {
+			return strconv.AppendInt(buf, v.Int(), 10), nil
+		}
+		return strconv.AppendQuote(buf, strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint64:
+		if !o.int64Strings {
+			return strconv.AppendUint(buf, v.Uint(), 10), nil
+		}
+		return strconv.AppendQuote(buf, strconv.FormatUint(v.Uint(), 10)), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(buf, "null"...), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		buf = append(buf, '[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			var err error
+			if buf, err = o.appendJSON(buf, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, ']'), nil
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, "null"...), nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		buf = append(buf, '{')
+		for i, k := range keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			keyBytes, _ := json.Marshal(k)
+			buf = append(append(buf, keyBytes...), ':')
+			var err error
+			if buf, err = o.appendJSON(buf, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, '}'), nil
+	case reflect.Struct:
+		buf = append(buf, '{')
+		first := true
+		for _, f := range payloadFields(v.Type()) {
+			field := v.Field(f.index)
+			if omitEmpty(v.Type().Field(f.index)) && isEmptyJSONValue(field) {
+				continue
+			}
+			if !first {
+				buf = append(buf, ',')
+			}
+			first = false
+			keyBytes, _ := json.Marshal(f.name)
+			buf = append(append(buf, keyBytes...), ':')
+			var err error
+			if buf, err = o.appendJSON(buf, field); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, '}'), nil
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return append(buf, data...), nil
+}
+
+// omitEmpty reports whether a struct field has the omitempty json option.
+func omitEmpty(f reflect.StructField) bool {
+	_, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == "omitempty" {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyJSONValue reports whether encoding/json treats v as empty for
+// omitempty.
+func isEmptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,551 @@
+// kafka.go
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Defaults of the kafka config block.
+const (
+	defaultKafkaClientID       = "latest-ledger-processor"
+	defaultKafkaAcks           = "all"
+	defaultKafkaTimeoutSeconds = 10
+)
+
+// Kafka protocol API keys and the versions the producer speaks.
+const (
+	kafkaAPIProduce       = 0
+	kafkaAPIMetadata      = 3
+	kafkaProduceVersion   = 3
+	kafkaMetadataVersion  = 1
+	kafkaMaxResponseBytes = 64 << 20
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// builtinSinkSettings are the config blocks of the built-in sinks in
+// LatestLedgerProcessor.outputs.
+var builtinSinkSettings = map[string]bool{
+	"kafka":     true,
+	"nats":      true,
+	"mqtt":      true,
+	"redis":     true,
+	"webhooks":  true,
+	"websocket": true,
+	"sse":       true,
+	"grpc":      true,
+	"http_api":  true,
+}
+
+// configuredSink returns the first built-in sink set in config, in
+// alphabetical order, or "" when none is.
+func configuredSink(config map[string]interface{}) string {
+	sinks := make([]string, 0, len(builtinSinkSettings))
+	for key := range builtinSinkSettings {
+		sinks = append(sinks, key)
+	}
+	sort.Strings(sinks)
+	for _, key := range sinks {
+		if config[key] != nil {
+			return key
+		}
+	}
+	return ""
+}
+
+// kafkaProducer publishes forwarded messages to Kafka over the plain Kafka
+// protocol, so the metrics stream reaches Kafka even when the host has no
+// Kafka consumer plugin. It is dispatched to like a registered consumer.
+// Each message becomes one record, keyed by its ledger sequence and
+// carrying the message metadata as headers.
+type kafkaProducer struct {
+	brokers  []string // bootstrap brokers
+	topic    string   // "" when the routing topic of each message is used
+	acks     int16
+	clientID string
+	timeout  time.Duration
+
+	mu            sync.Mutex
+	correlationID int32
+	addrs         map[int32]string   // broker addresses by node ID
+	conns         map[int32]net.Conn // open broker connections by node ID
+	leaders       map[string][]int32 // partition leaders by topic, indexed by partition
+	attempts      atomic.Int32       // produce attempts of the latest delivery
+}
+
+// newKafkaProducerFromConfig parses the optional kafka config block:
+//
+//	"kafka": {
+//	  "brokers": ["localhost:9092"],
+//	  "topic": "stellar.ledgers",
+//	  "acks": "all",
+//	  "client_id": "latest-ledger-processor",
+//	  "timeout_seconds": 10
+//	}
+//
+// The topic may be left out when a routing block sets the topic of each
+// message. It returns nil when no Kafka output is configured.
+func newKafkaProducerFromConfig(config map[string]interface{}, routed bool) (*kafkaProducer, error) {
+	raw, ok := config["kafka"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("kafka must be an object, got %T", raw)
+	}
+	brokers, err := configStringSlice(block, "brokers")
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("kafka: brokers is required")
+	}
+	topic, err := configString(block, "topic", "")
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	if topic == "" && !routed {
+		return nil, fmt.Errorf("kafka: topic is required without a routing block")
+	}
+	acksName, err := configString(block, "acks", defaultKafkaAcks)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	var acks int16
+	switch acksName {
+	case "all":
+		acks = -1
+	case "1":
+		acks = 1
+	case "0":
+		acks = 0
+	default:
+		return nil, fmt.Errorf("kafka: acks must be \"all\", \"1\" or \"0\", got %q", acksName)
+	}
+	clientID, err := configString(block, "client_id", defaultKafkaClientID)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	timeoutSeconds, err := configInt(block, "timeout_seconds", defaultKafkaTimeoutSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	if timeoutSeconds < 1 {
+		return nil, fmt.Errorf("kafka: timeout_seconds must be at least 1")
+	}
+	return &kafkaProducer{
+		brokers:  brokers,
+		topic:    topic,
+		acks:     acks,
+		clientID: clientID,
+		timeout:  time.Duration(timeoutSeconds) * time.Second,
+		addrs:    make(map[int32]string),
+		conns:    make(map[int32]net.Conn),
+		leaders:  make(map[string][]int32),
+	}, nil
+}
+
+// Name identifies the producer in logs and dispatch reports.
+func (k *kafkaProducer) Name() string {
+	return "kafka"
+}
+
+// Process publishes the payload of msg. The partition is the ledger
+// sequence modulo the topic's partition count, so the records of a ledger
+// share a partition. A failed publish is retried once with fresh metadata
+// and connections, which covers leader changes.
+func (k *kafkaProducer) Process(ctx context.Context, msg pluginapi.Message) error {
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("unsupported payload type %T", msg.Payload)
+	}
+	topic := k.topic
+	if routed, ok := msg.Metadata["topic"].(string); ok && routed != "" {
+		topic = routed
+	}
+	if topic == "" {
+		return fmt.Errorf("message of type %v has no topic", msg.Metadata["data_type"])
+	}
+	var key []byte
+	var seq uint64
+	if s, ok := msg.Metadata["ledger_sequence"]; ok {
+		key = []byte(fmt.Sprint(s))
+		seq, _ = strconv.ParseUint(string(key), 10, 64)
+	}
+	timestamp := msg.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	record := kafkaRecordBatch(key, payload, kafkaHeaders(msg.Metadata), timestamp)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.attempts.Store(1)
+	err := k.produce(topic, seq, record)
+	if err != nil {
+		k.reset()
+		k.attempts.Store(2)
+		err = k.produce(topic, seq, record)
+	}
+	if err != nil {
+		k.reset()
+	}
+	return err
+}
+
+// lastAttempts returns the number of produce attempts of the latest
+// delivery.
+func (k *kafkaProducer) lastAttempts() int {
+	return int(k.attempts.Load())
+}
+
+// kafkaHeaders returns the scalar metadata values as record headers,
+// sorted by key.
+func kafkaHeaders(metadata map[string]interface{}) [][2]string {
+	headers := make([][2]string, 0, len(metadata))
+	for k, v := range metadata {
+		switch v.(type) {
+		case string, bool, int, int64, uint32, uint64, float64:
+			headers = append(headers, [2]string{k, fmt.Sprint(v)})
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i][0] < headers[j][0] })
+	return headers
+}
+
+// produce sends a record batch to the leader of its partition.
+func (k *kafkaProducer) produce(topic string, seq uint64, batch []byte) error {
+	leaders, err := k.partitionLeaders(topic)
+	if err != nil {
+		return err
+	}
+	partition := int32(seq % uint64(len(leaders)))
+	conn, err := k.conn(leaders[partition])
+	if err != nil {
+		return err
+	}
+
+	var req kafkaEncoder
+	req.int16(-1) // null transactional_id
+	req.int16(k.acks)
+	req.int32(int32(k.timeout / time.Millisecond))
+	req.int32(1)
+	req.string(topic)
+	req.int32(1)
+	req.int32(partition)
+	req.bytes(batch)
+	resp, err := k.roundTrip(conn, kafkaAPIProduce, kafkaProduceVersion, req.buf, k.acks != 0)
+	if err != nil || k.acks == 0 {
+		return err
+	}
+
+	d := kafkaDecoder{buf: resp}
+	for topics := d.int32(); topics > 0 && d.err == nil; topics-- {
+		d.string()
+		for partitions := d.int32(); partitions > 0 && d.err == nil; partitions-- {
+			d.int32()
+			if code := d.int16(); code != 0 && d.err == nil {
+				return fmt.Errorf("producing to %s/%d: kafka error code %d", topic, partition, code)
+			}
+			d.int64()
+			d.int64()
+		}
+	}
+	return d.err
+}
+
+// partitionLeaders returns the leader of every partition of a topic,
+// requesting the topic's metadata from a bootstrap broker on first use.
+func (k *kafkaProducer) partitionLeaders(topic string) ([]int32, error) {
+	if leaders, ok := k.leaders[topic]; ok {
+		return leaders, nil
+	}
+	var req kafkaEncoder
+	req.int32(1)
+	req.string(topic)
+
+	var errs []error
+	for _, broker := range k.brokers {
+		conn, err := net.DialTimeout("tcp", broker, k.timeout)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp, err := k.roundTrip(conn, kafkaAPIMetadata, kafkaMetadataVersion, req.buf, true)
+		conn.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+			continue
+		}
+		return k.parseMetadata(topic, resp)
+	}
+	return nil, fmt.Errorf("requesting metadata of %s: %w", topic, errors.Join(errs...))
+}
+
+// parseMetadata records the brokers and partition leaders of a Metadata v1
+// response.
+func (k *kafkaProducer) parseMetadata(topic string, resp []byte) ([]int32, error) {
+	d := kafkaDecoder{buf: resp}
+	for brokers := d.int32(); brokers > 0 && d.err == nil; brokers-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		k.addrs[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller
+	var leaders []int32
+	for topics := d.int32(); topics > 0 && d.err == nil; topics-- {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is_internal
+		byPartition := make(map[int32]int32)
+		for partitions := d.int32(); partitions > 0 && d.err == nil; partitions-- {
+			d.int16()
+			partition := d.int32()
+			byPartition[partition] = d.int32()
+			for replicas := d.int32(); replicas > 0 && d.err == nil; replicas-- {
+				d.int32()
+			}
+			for isr := d.int32(); isr > 0 && d.err == nil; isr-- {
+				d.int32()
+			}
+		}
+		if name != topic {
+			continue
+		}
+		if code != 0 {
+			return nil, fmt.Errorf("metadata of %s: kafka error code %d", topic, code)
+		}
+		leaders = make([]int32, len(byPartition))
+		for partition, leader := range byPartition {
+			if partition < 0 || int(partition) >= len(leaders) || leader < 0 {
+				return nil, fmt.Errorf("metadata of %s: partition %d has no leader", topic, partition)
+			}
+			leaders[partition] = leader
+		}
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("decoding metadata: %w", d.err)
+	}
+	if len(leaders) == 0 {
+		return nil, fmt.Errorf("metadata of %s: topic has no partitions", topic)
+	}
+	k.leaders[topic] = leaders
+	return leaders, nil
+}
+
+// conn returns the connection to a broker, opening it on first use.
+func (k *kafkaProducer) conn(id int32) (net.Conn, error) {
+	if conn, ok := k.conns[id]; ok {
+		return conn, nil
+	}
+	addr, ok := k.addrs[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown kafka broker %d", id)
+	}
+	conn, err := net.DialTimeout("tcp", addr, k.timeout)
+	if err != nil {
+		return nil, err
+	}
+	k.conns[id] = conn
+	return conn, nil
+}
+
+// roundTrip sends a request and, if expected, reads its response body.
+func (k *kafkaProducer) roundTrip(conn net.Conn, apiKey, version int16, body []byte, response bool) ([]byte, error) {
+	k.correlationID++
+	var req kafkaEncoder
+	req.int32(0) // size, set below
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(k.correlationID)
+	req.string(k.clientID)
+	req.buf = append(req.buf, body...)
+	binary.BigEndian.PutUint32(req.buf, uint32(len(req.buf)-4))
+
+	if err := conn.SetDeadline(time.Now().Add(k.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(req.buf); err != nil {
+		return nil, err
+	}
+	if !response {
+		return nil, nil
+	}
+	var header [8]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size < 4 || size > kafkaMaxResponseBytes {
+		return nil, fmt.Errorf("invalid kafka response size %d", size)
+	}
+	if id := int32(binary.BigEndian.Uint32(header[4:])); id != k.correlationID {
+		return nil, fmt.Errorf("kafka response for request %d, want %d", id, k.correlationID)
+	}
+	resp := make([]byte, size-4)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// reset closes the connections and forgets the metadata, so the next
+// publish starts over from the bootstrap brokers.
+func (k *kafkaProducer) reset() {
+	for id, conn := range k.conns {
+		conn.Close()
+		delete(k.conns, id)
+	}
+	clear(k.leaders)
+}
+
+// Close closes the broker connections.
+func (k *kafkaProducer) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.reset()
+	return nil
+}
+
+// kafkaRecordBatch encodes a single record as a v2 record batch.
+func kafkaRecordBatch(key, value []byte, headers [][2]string, timestamp time.Time) []byte {
+	var rec kafkaEncoder
+	rec.int8(0)   // attributes
+	rec.varint(0) // timestamp delta
+	rec.varint(0) // offset delta
+	if key == nil {
+		rec.varint(-1)
+	} else {
+		rec.varint(int64(len(key)))
+		rec.buf = append(rec.buf, key...)
+	}
+	rec.varint(int64(len(value)))
+	rec.buf = append(rec.buf, value...)
+	rec.varint(int64(len(headers)))
+	for _, h := range headers {
+		rec.varint(int64(len(h[0])))
+		rec.buf = append(rec.buf, h[0]...)
+		rec.varint(int64(len(h[1])))
+		rec.buf = append(rec.buf, h[1]...)
+	}
+
+	ms := timestamp.UnixMilli()
+	var batch kafkaEncoder
+	batch.int64(0)  // base offset
+	batch.int32(0)  // batch length, set below
+	batch.int32(-1) // partition leader epoch
+	batch.int8(2)   // magic
+	batch.int32(0)  // crc, set below
+	crcStart := len(batch.buf)
+	batch.int16(0) // attributes: no compression, create time
+	batch.int32(0) // last offset delta
+	batch.int64(ms)
+	batch.int64(ms)
+	batch.int64(-1) // producer ID
+	batch.int16(-1) // producer epoch
+	batch.int32(-1) // base sequence
+	batch.int32(1)  // record count
+	batch.varint(int64(len(rec.buf)))
+	batch.buf = append(batch.buf, rec.buf...)
+
+	binary.BigEndian.PutUint32(batch.buf[8:], uint32(len(batch.buf)-12))
+	binary.BigEndian.PutUint32(batch.buf[crcStart-4:], crc32.Checksum(batch.buf[crcStart:], crc32c))
+	return batch.buf
+}
+
+// kafkaEncoder appends big-endian Kafka protocol primitives.
+type kafkaEncoder struct {
+	buf []byte
+}
+
+func (e *kafkaEncoder) int8(v int8)   { e.buf = append(e.buf, byte(v)) }
+func (e *kafkaEncoder) int16(v int16) { e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v)) }
+func (e *kafkaEncoder) int32(v int32) { e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v)) }
+func (e *kafkaEncoder) int64(v int64) { e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v)) }
+func (e *kafkaEncoder) varint(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *kafkaEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *kafkaEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// kafkaDecoder reads big-endian Kafka protocol primitives, recording the
+// first error.
+type kafkaDecoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || d.off+n > len(d.buf) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string reads a string, returning "" for a null one.
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
@@ -0,0 +1,247 @@
+// kafka_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// kafkaFrame builds protocol bytes independently of kafkaEncoder.
+type kafkaFrame []byte
+
+func (f kafkaFrame) i8(v int8) kafkaFrame   { return append(f, byte(v)) }
+func (f kafkaFrame) i16(v int16) kafkaFrame { return binary.BigEndian.AppendUint16(f, uint16(v)) }
+func (f kafkaFrame) i32(v int32) kafkaFrame { return binary.BigEndian.AppendUint32(f, uint32(v)) }
+func (f kafkaFrame) i64(v int64) kafkaFrame { return binary.BigEndian.AppendUint64(f, uint64(v)) }
+func (f kafkaFrame) str(s string) kafkaFrame {
+	return append(f.i16(int16(len(s))), s...)
+}
+
+// kafkaMetadataPartition is a partition of a Metadata v1 response.
+type kafkaMetadataPartition struct {
+	partition, leader int32
+}
+
+// kafkaMetadataResponse builds a Metadata v1 response with one broker and
+// the given topic.
+func kafkaMetadataResponse(host string, port int32, topic string, code int16, partitions ...kafkaMetadataPartition) []byte {
+	f := kafkaFrame{}.i32(1)
+	f = f.i32(1).str(host).i32(port).i16(-1) // null rack
+	f = f.i32(1)                             // controller
+	f = f.i32(2)
+	// A topic that was not asked for comes first and is skipped.
+	f = f.i16(0).str("other").i8(0).i32(1).i16(0).i32(0).i32(1).i32(1).i32(1).i32(1).i32(1)
+	f = f.i16(code).str(topic).i8(0).i32(int32(len(partitions)))
+	for _, p := range partitions {
+		f = f.i16(0).i32(p.partition).i32(p.leader)
+		f = f.i32(1).i32(p.leader) // replicas
+		f = f.i32(1).i32(p.leader) // isr
+	}
+	return f
+}
+
+func newTestKafkaProducer(brokers ...string) *kafkaProducer {
+	return &kafkaProducer{
+		brokers:  brokers,
+		topic:    "ledgers",
+		acks:     -1,
+		clientID: "c",
+		timeout:  5 * time.Second,
+		addrs:    make(map[int32]string),
+		conns:    make(map[int32]net.Conn),
+		leaders:  make(map[string][]int32),
+	}
+}
+
+func TestCRC32C(t *testing.T) {
+	// The check value of CRC-32C.
+	if got := crc32.Checksum([]byte("123456789"), crc32c); got != 0xe3069283 {
+		t.Errorf("crc32c = %#x, want 0xe3069283", got)
+	}
+}
+
+func TestKafkaRecordBatchGolden(t *testing.T) {
+	got := kafkaRecordBatch([]byte("7"), []byte("{}"), [][2]string{{"a", "b"}}, time.UnixMilli(1000))
+	want := "0000000000000000" + // base offset
+		"0000003f" + // batch length
+		"ffffffff" + // partition leader epoch
+		"02" + // magic
+		"e614998c" + // CRC-32C of the rest
+		"0000" + // attributes
+		"00000000" + // last offset delta
+		"00000000000003e8" + // first timestamp
+		"00000000000003e8" + // max timestamp
+		"ffffffffffffffff" + // producer ID
+		"ffff" + // producer epoch
+		"ffffffff" + // base sequence
+		"00000001" + // record count
+		"1a" + // record length
+		"000000" + // attributes, timestamp and offset deltas
+		"0237" + // key
+		"047b7d" + // value
+		"02" + "0261" + "0262" // one header
+	if hex.EncodeToString(got) != want {
+		t.Errorf("kafkaRecordBatch =\n%x\nwant\n%s", got, want)
+	}
+
+	null := kafkaRecordBatch(nil, nil, nil, time.UnixMilli(0))
+	if rec := null[len(null)-6:]; hex.EncodeToString(rec) != "000000010000" {
+		t.Errorf("record without key, value or headers = %x, want 000000010000", rec)
+	}
+}
+
+func TestKafkaParseMetadata(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       []byte
+		wantErr    bool
+		wantLeader []int32
+	}{
+		{
+			name:       "partitions out of order",
+			resp:       kafkaMetadataResponse("broker", 9092, "ledgers", 0, kafkaMetadataPartition{1, 1}, kafkaMetadataPartition{0, 1}),
+			wantLeader: []int32{1, 1},
+		},
+		{
+			name:    "topic error",
+			resp:    kafkaMetadataResponse("broker", 9092, "ledgers", 3),
+			wantErr: true,
+		},
+		{
+			name:    "no leader",
+			resp:    kafkaMetadataResponse("broker", 9092, "ledgers", 0, kafkaMetadataPartition{0, -1}),
+			wantErr: true,
+		},
+		{
+			name:    "missing partition",
+			resp:    kafkaMetadataResponse("broker", 9092, "ledgers", 0, kafkaMetadataPartition{1, 1}),
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			resp:    kafkaMetadataResponse("broker", 9092, "ledgers", 0, kafkaMetadataPartition{0, 1})[:40],
+			wantErr: true,
+		},
+		{
+			name:    "topic missing",
+			resp:    kafkaMetadataResponse("broker", 9092, "other-ledgers", 0, kafkaMetadataPartition{0, 1}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKafkaProducer()
+			leaders, err := k.parseMetadata("ledgers", tt.resp)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseMetadata returned leaders %v, want an error", leaders)
+				}
+				if _, cached := k.leaders["ledgers"]; cached {
+					t.Error("leaders cached after an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(leaders) != len(tt.wantLeader) || leaders[0] != tt.wantLeader[0] || leaders[1] != tt.wantLeader[1] {
+				t.Errorf("leaders = %v, want %v", leaders, tt.wantLeader)
+			}
+			if k.addrs[1] != "broker:9092" {
+				t.Errorf("broker 1 at %q, want broker:9092", k.addrs[1])
+			}
+		})
+	}
+}
+
+// readKafkaRequest reads a request and returns its API key, correlation ID
+// and body, checking the client ID.
+func readKafkaRequest(t *testing.T, conn net.Conn) (int16, int32, []byte) {
+	t.Helper()
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		t.Fatal(err)
+	}
+	req := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	if clientID := req[8:11]; !bytes.Equal(clientID, []byte{0, 1, 'c'}) {
+		t.Errorf("client ID % x, want 00 01 63", clientID)
+	}
+	return int16(binary.BigEndian.Uint16(req)), int32(binary.BigEndian.Uint32(req[4:])), req[11:]
+}
+
+func writeKafkaResponse(t *testing.T, conn net.Conn, correlationID int32, body []byte) {
+	t.Helper()
+	resp := kafkaFrame{}.i32(int32(4 + len(body))).i32(correlationID)
+	if _, err := conn.Write(append(resp, body...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKafkaProducerProducesRecordBatch(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	host, portText, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(portText)
+
+	timestamp := time.UnixMilli(1000)
+	wantBatch := kafkaRecordBatch([]byte("5"), []byte("{}"), [][2]string{{"data_type", "latest_ledger"}, {"ledger_sequence", "5"}}, timestamp)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// The metadata request goes to the bootstrap connection, the produce
+		// request to the leader's.
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		apiKey, id, body := readKafkaRequest(t, conn)
+		if apiKey != kafkaAPIMetadata || !bytes.Equal(body, kafkaFrame{}.i32(1).str("ledgers")) {
+			t.Errorf("metadata request key %d body % x", apiKey, body)
+		}
+		writeKafkaResponse(t, conn, id, kafkaMetadataResponse(host, int32(port), "ledgers", 0, kafkaMetadataPartition{0, 1}))
+		conn.Close()
+
+		conn, err = listener.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		apiKey, id, body = readKafkaRequest(t, conn)
+		want := kafkaFrame{}.i16(-1).i16(-1).i32(5000).i32(1).str("ledgers").i32(1).i32(0).i32(int32(len(wantBatch)))
+		want = append(want, wantBatch...)
+		if apiKey != kafkaAPIProduce || !bytes.Equal(body, want) {
+			t.Errorf("produce request key %d body\n%x\nwant\n%x", apiKey, body, []byte(want))
+		}
+		writeKafkaResponse(t, conn, id, kafkaFrame{}.i32(1).str("ledgers").i32(1).i32(0).i16(0).i64(0).i64(-1).i32(0))
+	}()
+
+	k := newTestKafkaProducer(listener.Addr().String())
+	defer k.Close()
+	err = k.Process(context.Background(), pluginapi.Message{
+		Payload:   []byte("{}"),
+		Timestamp: timestamp,
+		Metadata:  map[string]interface{}{"data_type": "latest_ledger", "ledger_sequence": uint32(5)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
@@ -0,0 +1,31 @@
+// lineage.go
+package main
+
+// upstreamMetadataPrefix is prepended to the upstream message's metadata
+// keys when they are propagated, so they cannot collide with the
+// processor's own keys.
+const upstreamMetadataPrefix = "upstream_"
+
+// upstreamLineage returns the metadata of the upstream message (the source
+// plugin, file, offset, cursor and so on) under prefixed keys, or nil when
+// there is none.
+func upstreamLineage(metadata map[string]interface{}) map[string]interface{} {
+	if len(metadata) == 0 {
+		return nil
+	}
+	lineage := make(map[string]interface{}, len(metadata))
+	for k, v := range metadata {
+		lineage[upstreamMetadataPrefix+k] = v
+	}
+	return lineage
+}
+
+// addLineage copies the lineage of the ledger being processed into the
+// metadata of a forwarded message, without overriding existing keys.
+func (p *LatestLedgerProcessor) addLineage(metadata map[string]interface{}) {
+	for k, v := range p.lineage {
+		if _, exists := metadata[k]; !exists {
+			metadata[k] = v
+		}
+	}
+}
@@ -3,7 +3,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -16,8 +16,13 @@ import (
 
 	// Import the core plugin API.
 	"github.com/withObsrvr/pluginapi"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// defaultLargeBatchOperations is the operation count above which a
+// transaction counts as a large batch.
+const defaultLargeBatchOperations = 20
+
 // LatestLedger holds metrics extracted from a ledger.
 type LatestLedger struct {
 	Sequence                 uint32    `json:"sequence"`
@@ -28,9 +33,40 @@ type LatestLedger struct {
 	SuccessfulTxCount        int       `json:"successful_tx_count"`
 	FailedTxCount            int       `json:"failed_tx_count"`
 	TotalFeeCharged          int64     `json:"total_fee_charged"`
+	AvgFeePerOperation       float64   `json:"avg_fee_per_operation"`  // TotalFeeCharged / SuccessfulOperationCount (0 without successful operations)
+	ClassicFees              int64     `json:"classic_fees"`           // Fees charged to classic transactions
+	SorobanInclusionFees     int64     `json:"soroban_inclusion_fees"` // Inclusion fees charged to Soroban transactions
+	SorobanResourceFees      int64     `json:"soroban_resource_fees"`  // Resource fees charged to Soroban transactions, after refunds
 	ClosedAt                 time.Time `json:"closed_at"`
+	ClosedAtEpochSeconds     *int64    `json:"closed_at_epoch_seconds,omitempty"` // Set when enabled by closed_at_epoch
+	ClosedAtEpochMillis      *int64    `json:"closed_at_epoch_ms,omitempty"`      // Set when enabled by closed_at_epoch
 	BaseFee                  uint32    `json:"base_fee"`
 
+	// Transactions with more than the configured number of operations, and
+	// the share of all submitted operations they account for
+	LargeBatchTxCount        int     `json:"large_batch_tx_count"`
+	LargeBatchOperationShare float64 `json:"large_batch_operation_share"`
+
+	// Transactions by operation count
+	OpsPerTx OpsPerTxDistribution `json:"ops_per_tx"`
+
+	// Transactions by their fee bid in multiples of the base fee
+	BaseFeeMultiples BaseFeeMultipleDistribution `json:"base_fee_multiples"`
+
+	// Fees split between transaction sources and fee-bump fee sources
+	FeeAttribution FeeAttribution `json:"fee_attribution"`
+
+	// Network totals from the ledger header, and their change since the
+	// previous ledger (deltas are omitted unless the previous ledger was processed)
+	FeePool         int64  `json:"fee_pool"`
+	TotalCoins      int64  `json:"total_coins"`
+	FeePoolDelta    *int64 `json:"fee_pool_delta,omitempty"`
+	TotalCoinsDelta *int64 `json:"total_coins_delta,omitempty"`
+
+	// Consensus timing relative to the target close interval (omitted unless
+	// the previous ledger was processed)
+	Consensus *ConsensusTiming `json:"consensus,omitempty"`
+
 	// Operations per second (called transactions per second in other blockchains)
 	TransactionsPerSecond float64 `json:"transactions_per_second"`
 
@@ -38,23 +74,203 @@ type LatestLedger struct {
 	SorobanTxCount            int    `json:"soroban_tx_count"`
 	TotalSorobanFees          int64  `json:"total_soroban_fees"`
 	TotalResourceInstructions uint64 `json:"total_resource_instructions"`
+	TotalResourceReadBytes    uint64 `json:"total_resource_read_bytes"`
+	TotalResourceWriteBytes   uint64 `json:"total_resource_write_bytes"`
+
+	// Soroban transactions by declared instructions
+	SorobanInstructionHistogram []HistogramBucket `json:"soroban_instruction_histogram"`
+
+	// Declared Soroban resources split by transaction outcome
+	SorobanByOutcome SorobanOutcomeTotals `json:"soroban_by_outcome"`
+
+	// Soroban utilization as a fraction of the network limits (omitted when the limit is unknown)
+	SorobanInstructionUtilization *float64 `json:"soroban_instruction_utilization,omitempty"`
+	SorobanReadBytesUtilization   *float64 `json:"soroban_read_bytes_utilization,omitempty"`
+	SorobanWriteBytesUtilization  *float64 `json:"soroban_write_bytes_utilization,omitempty"`
+	SorobanTxCountUtilization     *float64 `json:"soroban_tx_count_utilization,omitempty"`
+
+	// Estimated split of apply work between Soroban and classic (omitted for empty ledgers)
+	WorkShare *WorkShare `json:"work_share,omitempty"`
+
+	// Soroban state archival metrics
+	SorobanState SorobanState `json:"soroban_state"`
+
+	// Headroom of Soroban auth signature expirations (omitted when no auth
+	// entries with address credentials were submitted)
+	SorobanAuthExpiration *SorobanAuthExpiration `json:"soroban_auth_expiration,omitempty"`
+
+	// Ledger entries whose reserve sponsorship was established or revoked
+	SponsoredReservesCreated int `json:"sponsored_reserves_created"`
+	SponsoredReservesRemoved int `json:"sponsored_reserves_removed"`
+
+	// Account option changes from SetOptions operations
+	ConfigChanges ConfigChanges `json:"config_changes"`
+
+	// Account data entry writes from ManageData operations
+	ManageData ManageDataMetrics `json:"manage_data"`
+
+	// Sequence number manipulation
+	Sequences SequenceMetrics `json:"sequences"`
+
+	// Use of muxed (M...) addresses
+	MuxedAccountUsage MuxedAccountUsage `json:"muxed_account_usage"`
+
+	// Transaction memos by type
+	Memos MemoMetrics `json:"memos"`
+
+	// Clawbacks executed in this ledger (omitted when there were none)
+	Clawbacks *ClawbackMetrics `json:"clawbacks,omitempty"`
+
+	// Assets referenced for the first time within the new asset window
+	// (omitted when detection is disabled or the window is still warming up)
+	NewAssets []string `json:"new_assets,omitempty"`
+
+	// Activity of the entities on the configured watchlist (omitted without a watchlist)
+	Watched []WatchBreakdown `json:"watched,omitempty"`
+
+	// Operation counts restricted to the configured operation types (only set
+	// when an operation type filter is configured)
+	Filtered *FilteredOperationCounts `json:"filtered,omitempty"`
+
+	// Transactions whose hash was already seen within the duplicate window
+	// (only set when duplicate detection is enabled)
+	DuplicateTxCount *int `json:"duplicate_tx_count,omitempty"`
 
 	SkippedTxCount int `json:"skipped_tx_count"`
 	UnknownTxCount int `json:"unknown_tx_count"`
 }
 
+// ledgerHeaderValues holds the header values of a processed ledger that are
+// compared against the next ledger.
+type ledgerHeaderValues struct {
+	sequence        uint32
+	closedAt        time.Time
+	feePool         int64
+	totalCoins      int64
+	protocolVersion uint32
+	baseFee         uint32
+	baseReserve     uint32
+	maxTxSetSize    uint32
+}
+
 // LatestLedgerProcessor implements both pluginapi.Processor and pluginapi.ConsumerRegistry
 type LatestLedgerProcessor struct {
 	networkPassphrase       string
 	consumers               []pluginapi.Consumer  // downstream consumers
 	processors              []pluginapi.Processor // downstream processors
 	previousLedgerCloseTime time.Time             // store previous ledger close time for TPS calculation
+	previousHeader          *ledgerHeaderValues   // header values of the previous ledger for delta and upgrade tracking
+
+	emitTransactions bool // emit a ledger_transaction message per transaction
+
+	// Fee statistics (Horizon /fee_stats compatible)
+	emitFeeStats bool
+	feeStats     *feeStatsWindow
+
+	opFilter  *operationFilter // nil when no operation type filter is configured
+	watchlist *watchlist       // nil when no watchlist is configured
+
+	keyCase         string          // JSON key casing of emitted payloads
+	fields          *fieldSelection // nil unless latest_ledger payloads are trimmed
+	flatKeys        bool            // lift nested objects to the top level of JSON payloads
+	namespace       string          // deployment prefix of data_type values and metric names
+	router          *topicRouter    // nil unless topic metadata is added to forwarded messages
+	canonicalJSON   bool            // sort keys and normalize numbers of JSON payloads
+	floatDecimals   int             // decimal places of canonical non-integer numbers; -1 for shortest round-trip
+	int64Strings    bool            // write 64-bit integers of JSON payloads as strings
+	timeFormat      string          // format of times in JSON, CBOR and CSV payloads
+	networkID       string          // hex network ID, added to the metadata of every message
+	network         string          // network name, added to the metadata of every message
+	networkFields   []byte          // network_id and network members added to every payload
+	payloadEncoding string          // encoding of emitted payloads
+	avro            *avroEncoder    // nil unless payloads are Avro encoded
+	csv             *csvEncoder     // nil unless payloads are CSV encoded
+	sql             *sqlEncoder     // nil unless payloads are INSERT statements
+
+	cloudEvents *cloudEventSettings // nil unless messages are wrapped in CloudEvents
+	compressor  *payloadCompressor  // nil unless payloads are compressed
+	gate        *forwardGate        // holds messages back while paused
+	closedAt    time.Time           // close time of the most recently processed ledger
+
+	sorobanLimits sorobanLimits // network limits for utilization, updated from config upgrades
+	classicOpCost uint64        // instruction equivalents per classic operation for work share estimates
+
+	instructionBuckets []uint64 // upper bounds of the Soroban instruction histogram
+
+	epochSeconds bool // add closed_at_epoch_seconds
+	epochMillis  bool // add closed_at_epoch_ms
+
+	largeBatchOps int    // transactions with more operations count as large batches
+	opSuccessMode string // how successful operations are counted
+	skipRules     skipRules
+
+	snapshots *snapshotStore // immutable copies of emitted metrics
+
+	forwardConcurrency int            // maximum number of downstream deliveries in flight
+	dispatchTrace      *dispatchTrace // nil unless dispatch reports are emitted
+
+	propagateLineage bool                   // copy upstream metadata into forwarded messages
+	rawXDR           string                 // raw XDR attached to latest_ledger metadata: none, header or ledger
+	splitOutput      bool                   // emit latest_ledger_raw and latest_ledger_derived instead of latest_ledger
+	lineage          map[string]interface{} // upstream metadata of the ledger being processed
+
+	backfill *backfillTracker // nil when no backfill range is configured
+
+	newAssets  *newAssetDetector    // nil when new asset detection is disabled
+	duplicates *duplicateTxDetector // nil when duplicate detection is disabled
+
+	hotKeys *hotKeyTracker // nil when hot key detection is disabled
+
+	activity *accountActivityOracle // nil when account activity is not tracked
+
+	firstSeen *firstSeenTracker // nil unless first-seen events are emitted
+
+	feeSurge *feeSurgeDetector // nil when fee surge detection is disabled
+
+	telemetry *telemetry     // nil when no telemetry exporter is configured
+	tracing   *ledgerTracing // nil unless spans are created for each ledger
+
+	parquet    *parquetBatchWriter // nil when no Parquet output is configured
+	influx     *influxWriter       // nil when no InfluxDB output is configured
+	postgres   *postgresWriter     // nil when no Postgres output is configured
+	clickhouse *clickHouseWriter   // nil when no ClickHouse output is configured
+
+	history *historyStore // nil unless processed ledgers are kept in a local database
+
+	objectStorage *objectStorageWriter // nil when no object storage output is configured
+
+	ledgerBlocks *ledgerBlockBuilder // nil unless latest_ledger messages are batched into blocks
+	jsonLines    *jsonLinesBatcher   // nil unless latest_ledger messages are batched as JSON Lines
+
+	fileSink *fileSink    // nil unless forwarded payloads are also written to local files
+	outputs  []downstream // built-in sinks, such as the Kafka producer, dispatched to like consumers
+
+	scheduler *scheduler // nil unless scheduled reports are configured
+
+	// Network passphrase mismatch detection
+	passphraseMismatchLedgers int
+	unknownHashStreak         int
+	passphraseAlerted         bool
+
+	config     map[string]interface{} // config the processor was built from
+	archive    *archiveConfig         // raw ledger archive for reprocessing; nil when not configured
+	correction bool                   // set on processors re-emitting reprocessed ledgers
 }
 
 // GetSchemaDefinition returns GraphQL type definitions for this plugin
 func (p *LatestLedgerProcessor) GetSchemaDefinition() string {
-	return `
+	if p.fields != nil {
+		return p.fields.trimSchema(latestLedgerSchema)
+	}
+	return latestLedgerSchema
+}
+
+// latestLedgerSchema is the full GraphQL schema, before field selection.
+const latestLedgerSchema = `
 type LatestLedger {
+    networkId: String!
+    network: String!
+    schemaVersion: String!
     sequence: Int!
     hash: String!
     transactionCount: Int!
@@ -63,23 +279,227 @@ type LatestLedger {
     successfulTxCount: Int!
     failedTxCount: Int!
     totalFeeCharged: String!
+    avgFeePerOperation: Float!
+    classicFees: String!
+    sorobanInclusionFees: String!
+    sorobanResourceFees: String!
     closedAt: String!
+    closedAtEpochSeconds: String
+    closedAtEpochMs: String
     baseFee: Int!
+    largeBatchTxCount: Int!
+    largeBatchOperationShare: Float!
+    opsPerTx: OpsPerTxDistribution!
+    baseFeeMultiples: BaseFeeMultipleDistribution!
+    feeAttribution: FeeAttribution!
+    feePool: String!
+    totalCoins: String!
+    feePoolDelta: String
+    totalCoinsDelta: String
+    consensus: ConsensusTiming
     transactionsPerSecond: Float!
     sorobanTxCount: Int!
     totalSorobanFees: String!
     totalResourceInstructions: String!
+    totalResourceReadBytes: String!
+    totalResourceWriteBytes: String!
+    sorobanInstructionHistogram: [HistogramBucket!]!
+    sorobanByOutcome: SorobanOutcomeTotals!
+    sorobanInstructionUtilization: Float
+    sorobanReadBytesUtilization: Float
+    sorobanWriteBytesUtilization: Float
+    sorobanTxCountUtilization: Float
+    workShare: WorkShare
+    sorobanState: SorobanState!
+    sorobanAuthExpiration: SorobanAuthExpiration
+    sponsoredReservesCreated: Int!
+    sponsoredReservesRemoved: Int!
+    configChanges: ConfigChanges!
+    manageData: ManageDataMetrics!
+    sequences: SequenceMetrics!
+    muxedAccountUsage: MuxedAccountUsage!
+    memos: MemoMetrics!
+    clawbacks: ClawbackMetrics
+    newAssets: [String!]
+    watched: [WatchBreakdown!]
+    filtered: FilteredOperationCounts
+    duplicateTxCount: Int
     skippedTxCount: Int!
     unknownTxCount: Int!
 }
-`
+
+type OpsPerTxDistribution {
+    one: Int!
+    twoToFive: Int!
+    sixToTwenty: Int!
+    overTwenty: Int!
 }
 
+type BaseFeeMultipleDistribution {
+    oneX: Int!
+    twoToTenX: Int!
+    tenToHundredX: Int!
+    overHundredX: Int!
+}
+
+type FeeAttribution {
+    sourceFeeCharged: String!
+    feeBumpTxCount: Int!
+    feeBumpFeeCharged: String!
+    feeBumpMaxFees: String!
+    innerDeclaredFees: String!
+}
+
+type ConsensusTiming {
+    closeTimeDeltaSeconds: Float!
+    targetCloseTimeSeconds: Float!
+    deviationSeconds: Float!
+    scpMessageCount: Int
+    scpValidatorCount: Int
+    nominationSeconds: Float
+}
+
+type HistogramBucket {
+    upperBound: String
+    count: Int!
+}
+
+type SorobanOutcomeTotals {
+    successful: SorobanResourceTotals!
+    failed: SorobanResourceTotals!
+}
+
+type SorobanResourceTotals {
+    txCount: Int!
+    resourceFees: String!
+    instructions: String!
+    readBytes: String!
+    writeBytes: String!
+}
+
+type WorkShare {
+    sorobanInstructions: String!
+    classicInstructions: String!
+    sorobanShare: Float!
+    classicShare: Float!
+}
+
+type SorobanState {
+    extendFootprintTtlCount: Int!
+    restoreFootprintCount: Int!
+    entriesRestored: Int!
+}
+
+type SorobanAuthExpiration {
+    entryCount: Int!
+    minHeadroomLedgers: String!
+    maxHeadroomLedgers: String!
+    histogram: [HistogramBucket!]!
+}
+
+type ConfigChanges {
+    setOptionsCount: Int!
+    signersAdded: Int!
+    signersRemoved: Int!
+    thresholdChanges: Int!
+    homeDomainChanges: Int!
+}
+
+type ManageDataMetrics {
+    operationCount: Int!
+    entriesSet: Int!
+    entriesDeleted: Int!
+    bytesWritten: Int!
+}
+
+type SequenceMetrics {
+    bumpSequenceCount: Int!
+    sequenceJumpTxCount: Int!
+}
+
+type MuxedAccountUsage {
+    txCount: Int!
+    operationCount: Int!
+    sourceOperationCount: Int!
+    destinationOperationCount: Int!
+}
+
+type MemoMetrics {
+    textCount: Int!
+    textMaxLengthCount: Int!
+    textInvalidCount: Int!
+    idCount: Int!
+    hashCount: Int!
+    returnCount: Int!
+}
+
+type ClawbackMetrics {
+    clawbackCount: Int!
+    clawbackClaimableBalanceCount: Int!
+    amounts: [AssetAmount!]!
+}
+
+type AssetAmount {
+    asset: String!
+    amount: String!
+}
+
+type WatchBreakdown {
+    type: String!
+    id: String!
+    tags: [Tag!]
+    txCount: Int!
+    operationCount: Int!
+    successfulOperationCount: Int!
+    feeCharged: String!
+}
+
+type Tag {
+    key: String!
+    value: String!
+}
+
+type FilteredOperationCounts {
+    txSetOperationCount: Int!
+    successfulOperationCount: Int!
+    transactionsPerSecond: Float!
+}
+
+type LedgerStats {
+    ledgerCount: Int!
+    fromSequence: Int!
+    toSequence: Int!
+    transactionsPerSecond: StatSummary!
+    totalFeeCharged: StatSummary!
+    avgFeePerOperation: StatSummary!
+    closeTimeDelta: StatSummary
+    failureRate: StatSummary!
+}
+
+type StatSummary {
+    avg: Float!
+    min: Float!
+    max: Float!
+}
+`
+
 // GetQueryDefinitions returns GraphQL query definitions for this plugin
 func (p *LatestLedgerProcessor) GetQueryDefinitions() string {
 	return `
     latestLedger: LatestLedger
     ledgerBySequence(sequence: Int!): LatestLedger
+    ledgers(from: Int!, to: Int!, limit: Int = 100): [LatestLedger!]!
+    stats(lastN: Int!): LedgerStats
+    wasActive(account: String!, windowLedgers: Int!): Boolean
+`
+}
+
+// GetMutationDefinitions returns GraphQL mutation definitions for this
+// plugin. Both mutations return whether forwarding is paused afterwards.
+func (p *LatestLedgerProcessor) GetMutationDefinitions() string {
+	return `
+    pause: Boolean!
+    resume: Boolean!
 `
 }
 
@@ -95,16 +515,70 @@ func (p *LatestLedgerProcessor) Subscribe(proc pluginapi.Processor) {
 	p.processors = append(p.processors, proc)
 }
 
-// Process implements the core logic
+// Process implements the core logic. The payload is a single
+// xdr.LedgerCloseMeta or a LedgerCloseMetaBatch, whose ledgers are processed
+// in order.
 func (p *LatestLedgerProcessor) Process(ctx context.Context, msg pluginapi.Message) error {
+	if p.gate != nil {
+		p.gate.processing.Lock()
+		defer p.gate.processing.Unlock()
+	}
+	if batch, isBatch, err := ledgerBatchFromPayload(msg.Payload); isBatch {
+		if err != nil {
+			return err
+		}
+		return p.processBatch(ctx, msg, batch)
+	}
+	return p.processMessage(ctx, msg)
+}
+
+// processMessage processes a single ledger.
+func (p *LatestLedgerProcessor) processMessage(ctx context.Context, msg pluginapi.Message) error {
+	lcm, isLedger := msg.Payload.(xdr.LedgerCloseMeta)
+	var seq uint32
+	if isLedger {
+		seq = ledger.Sequence(lcm)
+	}
+
+	var span trace.Span
+	ctx, span = p.startLedgerSpan(ctx, msg, seq)
+	if isLedger && p.dispatchTrace != nil {
+		p.dispatchTrace.start()
+		defer p.forwardDispatchReport(ctx, msg, seq)
+	}
+	if isLedger && p.backfill != nil {
+		p.backfill.start(seq)
+	}
+	err := p.processLedger(ctx, msg)
+	if err != nil && p.telemetry != nil {
+		p.telemetry.processingFailed()
+	}
+	if isLedger && p.backfill != nil {
+		p.finishBackfillLedger(ctx, seq, err)
+	}
+	endSpan(span, err)
+	return err
+}
+
+// processLedger computes and forwards the metrics of a single ledger.
+func (p *LatestLedgerProcessor) processLedger(ctx context.Context, msg pluginapi.Message) error {
 	log.Printf("LatestLedgerProcessor: Processing message with %d consumers and %d processors",
 		len(p.consumers), len(p.processors))
+	start := time.Now()
+
+	if p.propagateLineage {
+		p.lineage = upstreamLineage(msg.Metadata)
+		defer func() { p.lineage = nil }()
+	}
 
 	ledgerCloseMeta, ok := msg.Payload.(xdr.LedgerCloseMeta)
 	if !ok {
 		return fmt.Errorf("expected xdr.LedgerCloseMeta, got %T", msg.Payload)
 	}
 
+	computeCtx, computeSpan := p.startSpan(ctx, "compute_metrics")
+	defer computeSpan.End()
+
 	// Create a transaction reader using the network passphrase.
 	txReader, err := ingest.NewLedgerTransactionReaderFromLedgerCloseMeta(
 		p.networkPassphrase,
@@ -121,9 +595,79 @@ func (p *LatestLedgerProcessor) Process(ctx context.Context, msg pluginapi.Messa
 		Hash:     ledger.Hash(ledgerCloseMeta),
 		BaseFee:  ledger.BaseFee(ledgerCloseMeta),
 		ClosedAt: ledger.ClosedAt(ledgerCloseMeta),
+
+		FeePool:    ledger.FeePool(ledgerCloseMeta),
+		TotalCoins: ledger.TotalCoins(ledgerCloseMeta),
+	}
+
+	p.closedAt = metrics.ClosedAt
+
+	if p.epochSeconds {
+		seconds := metrics.ClosedAt.Unix()
+		metrics.ClosedAtEpochSeconds = &seconds
+	}
+	if p.epochMillis {
+		millis := metrics.ClosedAt.UnixMilli()
+		metrics.ClosedAtEpochMillis = &millis
+	}
+
+	// Deltas are only meaningful against the immediately preceding ledger.
+	var previousHeader *ledgerHeaderValues
+	if p.previousHeader != nil && p.previousHeader.sequence+1 == metrics.Sequence {
+		previousHeader = p.previousHeader
+		feePoolDelta := metrics.FeePool - previousHeader.feePool
+		totalCoinsDelta := metrics.TotalCoins - previousHeader.totalCoins
+		metrics.FeePoolDelta = &feePoolDelta
+		metrics.TotalCoinsDelta = &totalCoinsDelta
+	}
+	p.previousHeader = &ledgerHeaderValues{
+		sequence:        metrics.Sequence,
+		closedAt:        metrics.ClosedAt,
+		feePool:         metrics.FeePool,
+		totalCoins:      metrics.TotalCoins,
+		protocolVersion: ledger.LedgerVersion(ledgerCloseMeta),
+		baseFee:         metrics.BaseFee,
+		baseReserve:     ledger.BaseReserve(ledgerCloseMeta),
+		maxTxSetSize:    ledger.MaxTxSetSize(ledgerCloseMeta),
+	}
+
+	metrics.SorobanInstructionHistogram = newHistogram(p.instructionBuckets)
+	if p.opFilter != nil {
+		metrics.Filtered = &FilteredOperationCounts{}
+	}
+	if p.watchlist != nil {
+		metrics.Watched = p.watchlist.newBreakdowns()
+	}
+
+	// Intermediate collections are reused across ledgers.
+	scratch := getLedgerScratch()
+	defer scratch.release()
+
+	// Per-operation fee samples for the fee_stats message.
+	feeSample := &scratch.feeSample
+	var clawbacks clawbackTally
+	var authExpirations authExpirationTally
+	var sequences sequenceTally
+	var largeBatchOperations int
+	var txRecords []LedgerTransactionRecord
+	var skips skipTally
+	var keyWrites ledgerKeyWrites
+	var assets ledgerAssets
+	if p.newAssets != nil || p.firstSeen != nil {
+		assets = scratch.assets
+	}
+	var contracts ledgerContracts
+	if p.firstSeen != nil {
+		contracts = scratch.contracts
+	}
+	var accounts ledgerAccounts
+	if p.activity != nil {
+		accounts = scratch.accounts
 	}
 
 	// Process each transaction. Skip transactions with "unknown tx hash" errors.
+	_, readSpan := p.startSpan(computeCtx, "read_transactions")
+	defer readSpan.End()
 	for {
 		tx, err := txReader.Read()
 		if err == io.EOF {
@@ -131,52 +675,158 @@ func (p *LatestLedgerProcessor) Process(ctx context.Context, msg pluginapi.Messa
 		}
 		if err != nil {
 			if strings.Contains(err.Error(), "unknown tx hash") {
-				log.Printf("Warning: transaction with unknown hash found in ledger %d", metrics.Sequence)
+				if !p.passphraseAlerted {
+					log.Printf("Warning: transaction with unknown hash found in ledger %d", metrics.Sequence)
+				}
 				// Still increment transaction count even for unknown transactions
 				metrics.TransactionCount++
-				metrics.FailedTxCount++
 				metrics.UnknownTxCount++
+				if p.skipRules.unparseable {
+					metrics.SkippedTxCount++
+					skips.skip(skipUnparseable)
+				} else {
+					metrics.FailedTxCount++
+				}
 				continue
 			}
 			return fmt.Errorf("error reading transaction: %v", err)
 		}
 
 		metrics.TransactionCount++
+		if reason := p.skipRules.check(&skips, tx); reason != "" {
+			metrics.SkippedTxCount++
+			skips.skip(reason)
+			continue
+		}
+
 		operationCount := len(tx.Envelope.Operations())
 		metrics.TxSetOperationCount += operationCount
-		metrics.TotalFeeCharged += int64(tx.Result.Result.FeeCharged)
+		metrics.OpsPerTx.add(operationCount)
+		metrics.BaseFeeMultiples.add(tx, metrics.BaseFee)
+		if operationCount > p.largeBatchOps {
+			metrics.LargeBatchTxCount++
+			largeBatchOperations += operationCount
+		}
+		feeCharged := int64(tx.Result.Result.FeeCharged)
+		metrics.TotalFeeCharged += feeCharged
+		addFeeAttribution(&metrics.FeeAttribution, tx, feeCharged)
 
+		metrics.SuccessfulOperationCount += successfulOperations(tx, p.opSuccessMode)
 		if tx.Result.Successful() {
 			metrics.SuccessfulTxCount++
-			metrics.SuccessfulOperationCount += operationCount
 		} else {
 			metrics.FailedTxCount++
 		}
 
+		if p.duplicates != nil {
+			scratch.txHashes = append(scratch.txHashes, tx.Result.TransactionHash.HexString())
+		}
+		if p.emitTransactions {
+			txRecords = append(txRecords, newLedgerTransactionRecord(&metrics, tx))
+		}
+
+		addSponsorshipMetrics(&metrics, tx)
+		clawbacks.add(tx)
+		sequences.add(tx)
+		addConfigChanges(&metrics.ConfigChanges, tx)
+		addManageDataMetrics(&metrics.ManageData, tx)
+		addMuxedAccountUsage(&metrics.MuxedAccountUsage, tx)
+		addMemoMetrics(&metrics.Memos, tx)
+
+		if metrics.Filtered != nil {
+			p.opFilter.count(metrics.Filtered, tx)
+		}
+		if p.watchlist != nil {
+			p.watchlist.add(metrics.Watched, tx)
+		}
+		if assets != nil {
+			assets.add(tx)
+		}
+		if contracts != nil {
+			contracts.add(tx)
+		}
+		if accounts != nil {
+			accounts.add(tx)
+		}
+
+		if p.emitFeeStats || p.feeSurge != nil {
+			feeSample.add(tx)
+		}
+
 		// Process Soroban metrics, if present.
-		if hasSorobanTransaction(tx) {
+		if !hasSorobanTransaction(tx) {
+			metrics.ClassicFees += feeCharged
+		} else {
+			inclusionFee, resourceFee := sorobanFeeSplit(tx, feeCharged)
+			metrics.SorobanInclusionFees += inclusionFee
+			metrics.SorobanResourceFees += resourceFee
+
 			metrics.SorobanTxCount++
 			sMetrics := getSorobanMetrics(tx)
 			metrics.TotalSorobanFees += sMetrics.resourceFee
 			metrics.TotalResourceInstructions += uint64(sMetrics.instructions)
+			observeHistogram(metrics.SorobanInstructionHistogram, uint64(sMetrics.instructions))
+			metrics.TotalResourceReadBytes += uint64(sMetrics.readBytes)
+			metrics.TotalResourceWriteBytes += uint64(sMetrics.writeBytes)
+			if tx.Result.Successful() {
+				metrics.SorobanByOutcome.Successful.add(sMetrics)
+			} else {
+				metrics.SorobanByOutcome.Failed.add(sMetrics)
+			}
+			addSorobanStateMetrics(&metrics.SorobanState, tx)
+			authExpirations.add(tx)
+			if p.hotKeys != nil {
+				keyWrites.add(tx)
+			}
 		}
 	}
 
+	readSpan.End()
+
+	metrics.Clawbacks = clawbacks.metrics()
+	metrics.SorobanAuthExpiration = authExpirations.metrics(metrics.Sequence)
+	metrics.Sequences = sequences.metrics()
+	if p.duplicates != nil {
+		duplicates := p.duplicates.count(metrics.Sequence, scratch.txHashes)
+		metrics.DuplicateTxCount = &duplicates
+	}
+	if p.newAssets != nil {
+		metrics.NewAssets = p.newAssets.detect(metrics.Sequence, assets)
+	}
+	if p.activity != nil {
+		p.activity.observe(metrics.Sequence, accounts)
+	}
+
+	if metrics.TxSetOperationCount > 0 {
+		metrics.LargeBatchOperationShare = float64(largeBatchOperations) / float64(metrics.TxSetOperationCount)
+	}
+	if metrics.SuccessfulOperationCount > 0 {
+		metrics.AvgFeePerOperation = float64(metrics.TotalFeeCharged) / float64(metrics.SuccessfulOperationCount)
+	}
+
+	if err := p.checkPassphrase(ctx, msg, ledgerCloseMeta, metrics); err != nil {
+		return err
+	}
+
+	// Compare Soroban resource totals against the network limits.
+	p.sorobanLimits.updateFromUpgrades(ledgerCloseMeta)
+	p.sorobanLimits.applyUtilization(&metrics)
+	metrics.WorkShare = estimateWorkShare(metrics, p.classicOpCost)
+	metrics.Consensus = consensusTiming(ledgerCloseMeta, metrics, previousHeader)
+
 	// Calculate transactions per second (operations per second in Stellar terms)
 	// Using successful operations for TPS calculation as it better represents actual throughput
+	// Default fallback - Stellar's target is ~5 second ledger close time
+	closeInterval := targetCloseSeconds
 	if !p.previousLedgerCloseTime.IsZero() {
 		// Calculate the time difference between the current and previous ledger
-		timeDiff := metrics.ClosedAt.Sub(p.previousLedgerCloseTime).Seconds()
-		if timeDiff > 0 {
-			metrics.TransactionsPerSecond = float64(metrics.SuccessfulOperationCount) / timeDiff
-		} else {
-			// Default fallback - Stellar's target is ~5 second ledger close time
-			metrics.TransactionsPerSecond = float64(metrics.SuccessfulOperationCount) / 5.0
+		if timeDiff := metrics.ClosedAt.Sub(p.previousLedgerCloseTime).Seconds(); timeDiff > 0 {
+			closeInterval = timeDiff
 		}
-	} else {
-		// For the first ledger processed, use a reasonable approximation
-		// Stellar's historical ledger close time is ~5 seconds
-		metrics.TransactionsPerSecond = float64(metrics.SuccessfulOperationCount) / 5.0
+	}
+	metrics.TransactionsPerSecond = float64(metrics.SuccessfulOperationCount) / closeInterval
+	if metrics.Filtered != nil {
+		metrics.Filtered.TransactionsPerSecond = float64(metrics.Filtered.SuccessfulOperationCount) / closeInterval
 	}
 
 	// Update the previous close time for next calculation
@@ -197,15 +847,22 @@ func (p *LatestLedgerProcessor) Process(ctx context.Context, msg pluginapi.Messa
 		successRate,
 	)
 
-	// Marshal metrics to JSON.
-	jsonBytes, err := json.Marshal(metrics)
-	if err != nil {
-		return fmt.Errorf("error marshaling latest ledger: %w", err)
+	computeSpan.End()
+
+	// Encode the metrics. Split output encodes its own payloads.
+	var payload interface{}
+	if !p.splitOutput {
+		_, encodeSpan := p.startSpan(ctx, "serialize")
+		payload, err = p.encodePayload(metrics)
+		endSpan(encodeSpan, err)
+		if err != nil {
+			return fmt.Errorf("error marshaling latest ledger: %w", err)
+		}
 	}
 
 	// Create forward message
 	forwardMsg := pluginapi.Message{
-		Payload:   jsonBytes,
+		Payload:   payload,
 		Timestamp: msg.Timestamp,
 		Metadata: map[string]interface{}{
 			"ledger_sequence": metrics.Sequence,
@@ -214,19 +871,85 @@ func (p *LatestLedgerProcessor) Process(ctx context.Context, msg pluginapi.Messa
 		},
 	}
 
-	// Forward to consumers
-	for i, consumer := range p.consumers {
-		log.Printf("LatestLedgerProcessor: Forwarding to consumer %d: %s", i, consumer.Name())
-		if err := consumer.Process(ctx, forwardMsg); err != nil {
-			log.Printf("Error in consumer %s: %v", consumer.Name(), err)
+	if reasons := skips.metadata(); reasons != "" {
+		forwardMsg.Metadata["skip_reasons"] = reasons
+	}
+	if err := p.attachRawXDR(forwardMsg.Metadata, ledgerCloseMeta); err != nil {
+		return err
+	}
+
+	if p.ledgerBlocks != nil {
+		if err := p.addToLedgerBlock(ctx, metrics.Clone(), msg.Timestamp); err != nil {
+			return err
+		}
+	} else if p.splitOutput {
+		if err := p.forwardSplitLedger(ctx, forwardMsg, metrics); err != nil {
+			return err
+		}
+	} else if p.jsonLines != nil {
+		p.addToJSONLines(ctx, payload.([]byte), metrics.Sequence, msg.Timestamp)
+	} else {
+		p.forward(ctx, forwardMsg)
+	}
+	p.storeSnapshot(metrics)
+	if p.backfill != nil {
+		p.backfill.add(metrics)
+	}
+	if p.telemetry != nil {
+		p.telemetry.recordLedger(metrics, time.Since(start))
+	}
+	if p.parquet != nil {
+		p.parquet.add(ctx, metrics.Clone())
+	}
+	if p.influx != nil {
+		p.influx.add(ctx, metrics)
+	}
+	if p.postgres != nil {
+		p.postgres.add(ctx, metrics)
+	}
+	if p.clickhouse != nil {
+		p.clickhouse.add(ctx, metrics)
+	}
+	if p.history != nil {
+		if err := p.history.add(metrics); err != nil {
+			log.Printf("Warning: storing ledger %d in the history store: %v", metrics.Sequence, err)
+		}
+	}
+	if p.objectStorage != nil {
+		p.addToObjectStorage(ctx, metrics, payload)
+	}
+
+	if p.emitTransactions {
+		if err := p.forwardTransactions(ctx, msg, txRecords); err != nil {
+			return err
+		}
+	}
+
+	if err := p.forwardLedgerUpgrades(ctx, msg, ledgerCloseMeta, metrics, previousHeader); err != nil {
+		return err
+	}
+
+	if p.firstSeen != nil {
+		if err := p.forwardFirstSeen(ctx, msg, metrics, contracts, assets); err != nil {
+			return err
+		}
+	}
+
+	if p.hotKeys != nil {
+		if err := p.forwardHotKeys(ctx, msg, metrics.Sequence, keyWrites); err != nil {
+			return err
 		}
 	}
 
-	// Forward to processors
-	for i, proc := range p.processors {
-		log.Printf("LatestLedgerProcessor: Forwarding to processor %d: %s", i, proc.Name())
-		if err := proc.Process(ctx, forwardMsg); err != nil {
-			log.Printf("Error in processor %s: %v", proc.Name(), err)
+	if p.feeSurge != nil {
+		if err := p.forwardFeeSurge(ctx, msg, metrics, *feeSample); err != nil {
+			return err
+		}
+	}
+
+	if p.emitFeeStats {
+		if err := p.forwardFeeStats(ctx, msg, metrics, *feeSample, ledger.MaxTxSetSize(ledgerCloseMeta)); err != nil {
+			return err
 		}
 	}
 
@@ -241,6 +964,31 @@ type sorobanMetrics struct {
 	writeBytes   uint32
 }
 
+// SorobanOutcomeTotals splits declared Soroban resources by whether the
+// transaction succeeded. Failed transactions still consumed their bid
+// resources but produced no state change.
+type SorobanOutcomeTotals struct {
+	Successful SorobanResourceTotals `json:"successful"`
+	Failed     SorobanResourceTotals `json:"failed"`
+}
+
+// SorobanResourceTotals holds declared Soroban resource totals.
+type SorobanResourceTotals struct {
+	TxCount      int    `json:"tx_count"`
+	ResourceFees int64  `json:"resource_fees"`
+	Instructions uint64 `json:"instructions"`
+	ReadBytes    uint64 `json:"read_bytes"`
+	WriteBytes   uint64 `json:"write_bytes"`
+}
+
+func (t *SorobanResourceTotals) add(m sorobanMetrics) {
+	t.TxCount++
+	t.ResourceFees += m.resourceFee
+	t.Instructions += uint64(m.instructions)
+	t.ReadBytes += uint64(m.readBytes)
+	t.WriteBytes += uint64(m.writeBytes)
+}
+
 func hasSorobanTransaction(tx ingest.LedgerTransaction) bool {
 	switch tx.Envelope.Type {
 	case xdr.EnvelopeTypeEnvelopeTypeTx:
@@ -272,6 +1020,22 @@ func getSorobanMetrics(tx ingest.LedgerTransaction) sorobanMetrics {
 	return sMetrics
 }
 
+// sorobanFeeSplit attributes the fee charged to a Soroban transaction to its
+// inclusion and resource components. The inclusion fee is derived from the
+// fee account's balance change during fee processing; the remainder is the
+// resource fee actually charged after refunds, so both parts always add up to
+// the charged fee.
+func sorobanFeeSplit(tx ingest.LedgerTransaction, feeCharged int64) (inclusionFee, resourceFee int64) {
+	inclusionFee, ok := tx.SorobanInclusionFeeCharged()
+	if !ok || inclusionFee < 0 {
+		inclusionFee = 0
+	}
+	if inclusionFee > feeCharged {
+		inclusionFee = feeCharged
+	}
+	return inclusionFee, feeCharged - inclusionFee
+}
+
 // Exported New function to allow dynamic loading.
 // When the plugin manager loads the shared object, it calls New() to obtain a new instance.
 func New() pluginapi.Plugin {
@@ -284,11 +1048,536 @@ func NewLatestLedgerProcessor(config map[string]interface{}) (*LatestLedgerProce
 	if !ok {
 		return nil, fmt.Errorf("missing network_passphrase in config")
 	}
-	return &LatestLedgerProcessor{
+
+	emitFeeStats, err := configBool(config, "emit_fee_stats", false)
+	if err != nil {
+		return nil, err
+	}
+	strictNumbers, err := configBool(config, "strict_json_numbers", false)
+	if err != nil {
+		return nil, err
+	}
+	if strictNumbers {
+		if err := checkExactNumbers(config, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	emitTransactions, err := configBool(config, "emit_transactions", false)
+	if err != nil {
+		return nil, err
+	}
+	feeStatsWindowSize, err := configInt(config, "fee_stats_window", defaultFeeStatsWindow)
+	if err != nil {
+		return nil, err
+	}
+	if feeStatsWindowSize < 1 {
+		return nil, fmt.Errorf("fee_stats_window must be at least 1, got %d", feeStatsWindowSize)
+	}
+
+	opFilter, err := newOperationFilterFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	watchlist, err := newWatchlistFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	keyCase, err := configString(config, "json_key_case", keyCaseSnake)
+	if err != nil {
+		return nil, err
+	}
+	if keyCase != keyCaseSnake && keyCase != keyCaseCamel {
+		return nil, fmt.Errorf("json_key_case must be %q or %q, got %q", keyCaseSnake, keyCaseCamel, keyCase)
+	}
+
+	fields, err := newFieldSelectionFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, err := configNamespace(config)
+	if err != nil {
+		return nil, err
+	}
+
+	flatKeys, err := configBool(config, "flat_keys", false)
+	if err != nil {
+		return nil, err
+	}
+
+	canonical, err := configBool(config, "canonical_json", false)
+	if err != nil {
+		return nil, err
+	}
+	floatDecimals, err := configInt(config, "canonical_float_decimals", -1)
+	if err != nil {
+		return nil, err
+	}
+	if _, set := config["canonical_float_decimals"]; set {
+		if !canonical {
+			return nil, fmt.Errorf("canonical_float_decimals requires canonical_json")
+		}
+		if floatDecimals < 0 || floatDecimals > 17 {
+			return nil, fmt.Errorf("canonical_float_decimals must be between 0 and 17, got %d", floatDecimals)
+		}
+	}
+
+	int64Strings, err := configBool(config, "int64_as_string", false)
+	if err != nil {
+		return nil, err
+	}
+
+	compressor, err := newPayloadCompressorFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sorobanLimits, err := newSorobanLimitsFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	classicOpCost, err := configInt(config, "classic_op_cost_instructions", defaultClassicOpCostInstructions)
+	if err != nil {
+		return nil, err
+	}
+	if classicOpCost < 0 {
+		return nil, fmt.Errorf("classic_op_cost_instructions must not be negative, got %d", classicOpCost)
+	}
+
+	opSuccessMode, err := configString(config, "operation_success_mode", opSuccessEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	if opSuccessMode, err = parseOperationSuccessMode(opSuccessMode); err != nil {
+		return nil, err
+	}
+
+	skipRules, err := newSkipRulesFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	instructionBuckets, err := newInstructionBucketsFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	statsWindow, err := configInt(config, "stats_window", defaultStatsWindow)
+	if err != nil {
+		return nil, err
+	}
+	if statsWindow < 1 {
+		return nil, fmt.Errorf("stats_window must be at least 1, got %d", statsWindow)
+	}
+
+	epochUnits, err := configStringSlice(config, "closed_at_epoch")
+	if err != nil {
+		return nil, err
+	}
+	var epochSeconds, epochMillis bool
+	for _, unit := range epochUnits {
+		switch unit {
+		case "seconds":
+			epochSeconds = true
+		case "milliseconds":
+			epochMillis = true
+		default:
+			return nil, fmt.Errorf("closed_at_epoch entries must be \"seconds\" or \"milliseconds\", got %q", unit)
+		}
+	}
+
+	largeBatchOps, err := configInt(config, "large_batch_operations", defaultLargeBatchOperations)
+	if err != nil {
+		return nil, err
+	}
+	if largeBatchOps < 1 {
+		return nil, fmt.Errorf("large_batch_operations must be at least 1, got %d", largeBatchOps)
+	}
+
+	propagateLineage, err := configBool(config, "propagate_upstream_metadata", true)
+	if err != nil {
+		return nil, err
+	}
+
+	rawXDR, err := configRawXDR(config)
+	if err != nil {
+		return nil, err
+	}
+
+	splitOutput, err := configLedgerOutput(config)
+	if err != nil {
+		return nil, err
+	}
+	if splitOutput && fields != nil {
+		return nil, fmt.Errorf("include_fields and exclude_fields cannot be combined with latest_ledger_output %q", ledgerOutputSplit)
+	}
+
+	forwardConcurrency, err := configInt(config, "forward_concurrency", defaultForwardConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	if forwardConcurrency < 1 {
+		return nil, fmt.Errorf("forward_concurrency must be at least 1, got %d", forwardConcurrency)
+	}
+
+	dispatchReport, err := configBool(config, "dispatch_report", false)
+	if err != nil {
+		return nil, err
+	}
+	var trace *dispatchTrace
+	if dispatchReport {
+		trace = &dispatchTrace{}
+	}
+
+	network, err := configString(config, "network_name", networkName(networkPassphrase))
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := newTopicRouterFromConfig(config, network)
+	if err != nil {
+		return nil, err
+	}
+
+	timeFormat, err := configTimeFormat(config)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadEncoding, err := configString(config, "payload_encoding", payloadEncodingJSON)
+	if err != nil {
+		return nil, err
+	}
+	var avro *avroEncoder
+	var csv *csvEncoder
+	var sql *sqlEncoder
+	switch payloadEncoding {
+	case payloadEncodingJSON, payloadEncodingCBOR, payloadEncodingStruct:
+	case payloadEncodingAvro:
+		avro = newAvroEncoder(keyCase, networkIDHex(networkPassphrase), network)
+	case payloadEncodingCSV:
+		if csv, err = newCSVEncoderFromConfig(config, keyCase, timeFormat, networkPassphrase, network); err != nil {
+			return nil, err
+		}
+	case payloadEncodingSQL:
+		if sql, err = newSQLEncoderFromConfig(config, keyCase, networkPassphrase, network); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("payload_encoding must be %q, %q, %q, %q, %q or %q, got %q",
+			payloadEncodingJSON, payloadEncodingAvro, payloadEncodingCSV, payloadEncodingCBOR, payloadEncodingSQL, payloadEncodingStruct, payloadEncoding)
+	}
+	if int64Strings && payloadEncoding != payloadEncodingJSON && payloadEncoding != payloadEncodingCBOR {
+		return nil, fmt.Errorf("int64_as_string requires payload_encoding %q or %q", payloadEncodingJSON, payloadEncodingCBOR)
+	}
+	registry, err := newSchemaRegistryFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if registry != nil {
+		if avro == nil {
+			return nil, fmt.Errorf("schema_registry requires payload_encoding %q", payloadEncodingAvro)
+		}
+		avro.registry = registry
+	}
+
+	cloudEvents, err := newCloudEventSettingsFromConfig(config, network)
+	if err != nil {
+		return nil, err
+	}
+
+	backfill, err := newBackfillTrackerFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	stateDir, err := configString(config, "state_dir", "")
+	if err != nil {
+		return nil, err
+	}
+	gate, err := newForwardGateFromConfig(config, stateDir)
+	if err != nil {
+		return nil, err
+	}
+	newAssets, err := newAssetDetectorFromConfig(config, stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates, err := newDuplicateTxDetectorFromConfig(config, stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	activity, err := newAccountActivityOracleFromConfig(config, stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	firstSeen, err := newFirstSeenTrackerFromConfig(config, stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	hotKeys, err := newHotKeyTrackerFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	feeSurge, err := newFeeSurgeDetectorFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := newArchiveConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	passphraseMismatchLedgers, err := configInt(config, "passphrase_mismatch_ledgers", defaultPassphraseMismatchLedgers)
+	if err != nil {
+		return nil, err
+	}
+	if passphraseMismatchLedgers < 1 {
+		return nil, fmt.Errorf("passphrase_mismatch_ledgers must be at least 1, got %d", passphraseMismatchLedgers)
+	}
+
+	parquet, err := newParquetBatchWriterFromConfig(config, keyCase, networkPassphrase, network)
+	if err != nil {
+		return nil, err
+	}
+	influx, err := newInfluxWriterFromConfig(config, network, namespace)
+	if err != nil {
+		return nil, err
+	}
+	postgres, err := newPostgresWriterFromConfig(config, networkPassphrase, network)
+	if err != nil {
+		return nil, err
+	}
+	clickhouse, err := newClickHouseWriterFromConfig(config, networkPassphrase, network)
+	if err != nil {
+		return nil, err
+	}
+	objectStorage, err := newObjectStorageWriterFromConfig(config, keyCase, networkPassphrase, network)
+	if err != nil {
+		return nil, err
+	}
+	if objectStorage != nil && objectStorage.format == objectFormatNDJSON && payloadEncoding != payloadEncodingJSON && payloadEncoding != payloadEncodingStruct {
+		return nil, fmt.Errorf("object_storage format %q requires payload_encoding %q or %q", objectFormatNDJSON, payloadEncodingJSON, payloadEncodingStruct)
+	}
+
+	ledgerBlocks, err := newLedgerBlockBuilderFromConfig(config, keyCase, networkPassphrase, network)
+	if err != nil {
+		return nil, err
+	}
+	jsonLines, err := newJSONLinesBatcherFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if jsonLines != nil && (payloadEncoding != payloadEncodingJSON || ledgerBlocks != nil) {
+		return nil, fmt.Errorf("json_lines requires payload_encoding %q and cannot be combined with ledger_blocks", payloadEncodingJSON)
+	}
+	fileSink, err := newFileSinkFromConfig(config, network)
+	if err != nil {
+		return nil, err
+	}
+	if fileSink != nil && (payloadEncoding != payloadEncodingJSON || compressor != nil || ledgerBlocks != nil) {
+		return nil, fmt.Errorf("file_sink requires payload_encoding %q and cannot be combined with payload_compression or ledger_blocks", payloadEncodingJSON)
+	}
+	if payloadEncoding == payloadEncodingStruct {
+		if sink := configuredSink(config); sink != "" {
+			return nil, fmt.Errorf("payload_encoding %q cannot be combined with built-in sinks such as %s", payloadEncodingStruct, sink)
+		}
+		if cloudEvents != nil || compressor != nil || ledgerBlocks != nil {
+			return nil, fmt.Errorf("payload_encoding %q cannot be combined with cloudevents, payload_compression or ledger_blocks", payloadEncodingStruct)
+		}
+	}
+	if splitOutput && (ledgerBlocks != nil || jsonLines != nil) {
+		return nil, fmt.Errorf("latest_ledger_output %q cannot be combined with ledger_blocks or json_lines", ledgerOutputSplit)
+	}
+	for _, sink := range []string{"sse", "http_api"} {
+		if config[sink] != nil && (payloadEncoding != payloadEncodingJSON || compressor != nil) {
+			return nil, fmt.Errorf("%s requires payload_encoding %q and cannot be combined with payload_compression", sink, payloadEncodingJSON)
+		}
+	}
+
+	scheduler, err := newSchedulerFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tracing, err := newLedgerTracingFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Built-in sinks open listeners and connections, so they are set up
+	// after the rest of the config is validated, and closed again if a
+	// later step fails.
+	var outputs []downstream
+	built := false
+	defer func() {
+		if !built {
+			closeOutputs(outputs)
+		}
+	}()
+	kafka, err := newKafkaProducerFromConfig(config, router != nil)
+	if err != nil {
+		return nil, err
+	}
+	if kafka != nil {
+		outputs = append(outputs, kafka)
+	}
+	nats, err := newNATSPublisherFromConfig(config, router != nil)
+	if err != nil {
+		return nil, err
+	}
+	if nats != nil {
+		outputs = append(outputs, nats)
+	}
+	mqtt, err := newMQTTPublisherFromConfig(config, router != nil)
+	if err != nil {
+		return nil, err
+	}
+	if mqtt != nil {
+		outputs = append(outputs, mqtt)
+	}
+	redis, err := newRedisCacheFromConfig(config, network, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if redis != nil {
+		outputs = append(outputs, redis)
+	}
+	webhooks, err := newWebhookTargetsFromConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		outputs = append(outputs, webhook)
+	}
+	webSocket, err := newWebSocketServerFromConfig(config, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if webSocket != nil {
+		outputs = append(outputs, webSocket)
+	}
+	sse, err := newSSEServerFromConfig(config, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if sse != nil {
+		outputs = append(outputs, sse)
+	}
+	grpcServer, err := newGRPCLedgerServerFromConfig(config, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if grpcServer != nil {
+		outputs = append(outputs, grpcServer)
+	}
+	httpAPI, err := newHTTPAPIServerFromConfig(config, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if httpAPI != nil {
+		outputs = append(outputs, httpAPI)
+	}
+
+	history, err := newHistoryStoreFromConfig(config, networkPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exporters may hold network resources, so they are set up last.
+	telemetry, err := newTelemetryFromConfig(config)
+	if err != nil {
+		if history != nil {
+			history.Close()
+		}
+		return nil, err
+	}
+
+	built = true
+	p := &LatestLedgerProcessor{
 		networkPassphrase: networkPassphrase,
 		consumers:         make([]pluginapi.Consumer, 0),
 		processors:        make([]pluginapi.Processor, 0),
-	}, nil
+		emitTransactions:  emitTransactions,
+		emitFeeStats:      emitFeeStats,
+		feeStats:          newFeeStatsWindow(feeStatsWindowSize),
+		opFilter:          opFilter,
+		watchlist:         watchlist,
+		keyCase:           keyCase,
+		fields:            fields,
+		flatKeys:          flatKeys,
+		namespace:         namespace,
+		router:            router,
+		canonicalJSON:     canonical,
+		floatDecimals:     floatDecimals,
+		int64Strings:      int64Strings,
+		timeFormat:        timeFormat,
+		networkID:         networkIDHex(networkPassphrase),
+		network:           network,
+		networkFields:     networkFieldsPrefix(networkPassphrase, network),
+		payloadEncoding:   payloadEncoding,
+		avro:              avro,
+		csv:               csv,
+		sql:               sql,
+		cloudEvents:       cloudEvents,
+		compressor:        compressor,
+		gate:              gate,
+		sorobanLimits:     sorobanLimits,
+		classicOpCost:     uint64(classicOpCost),
+
+		instructionBuckets: instructionBuckets,
+		epochSeconds:       epochSeconds,
+		epochMillis:        epochMillis,
+		largeBatchOps:      largeBatchOps,
+		opSuccessMode:      opSuccessMode,
+		skipRules:          skipRules,
+		snapshots:          &snapshotStore{retain: statsWindow},
+
+		passphraseMismatchLedgers: passphraseMismatchLedgers,
+
+		forwardConcurrency: forwardConcurrency,
+		dispatchTrace:      trace,
+		propagateLineage:   propagateLineage,
+		rawXDR:             rawXDR,
+		splitOutput:        splitOutput,
+		backfill:           backfill,
+		newAssets:          newAssets,
+		activity:           activity,
+		firstSeen:          firstSeen,
+		duplicates:         duplicates,
+		hotKeys:            hotKeys,
+		feeSurge:           feeSurge,
+		telemetry:          telemetry,
+		tracing:            tracing,
+		parquet:            parquet,
+		influx:             influx,
+		postgres:           postgres,
+		clickhouse:         clickhouse,
+		history:            history,
+		objectStorage:      objectStorage,
+		ledgerBlocks:       ledgerBlocks,
+		jsonLines:          jsonLines,
+		fileSink:           fileSink,
+		outputs:            outputs,
+		scheduler:          scheduler,
+
+		config:  config,
+		archive: archive,
+	}
+	if httpAPI != nil {
+		httpAPI.serve(p)
+	}
+	return p, nil
 }
 
 // Name returns the plugin's name following the naming convention.
@@ -306,6 +1595,84 @@ func (p *LatestLedgerProcessor) Type() pluginapi.PluginType {
 	return pluginapi.ProcessorPlugin
 }
 
+// Close forwards any partial ledger block or JSON Lines batch, writes any
+// partial Parquet batch or object storage object, retries points InfluxDB
+// has not accepted, writes buffered Postgres and ClickHouse rows, closes the
+// history store, the files of the file sink and the connections of built-in
+// sinks, and releases the resources held by telemetry exporters. Hosts should
+// call it when shutting the pipeline down.
+func (p *LatestLedgerProcessor) Close() error {
+	p.stopScheduler()
+	p.stopJSONLinesTimer()
+	var errs []error
+	if p.ledgerBlocks != nil {
+		if err := p.forwardLedgerBlock(context.Background(), time.Now()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if p.jsonLines != nil {
+		p.forwardJSONLines(context.Background(), time.Now())
+	}
+	if p.parquet != nil {
+		if err := p.parquet.flush(context.Background()); err != nil {
+			errs = append(errs, fmt.Errorf("parquet: %w", err))
+		}
+	}
+	if p.influx != nil {
+		if err := p.influx.flush(context.Background()); err != nil {
+			errs = append(errs, fmt.Errorf("influxdb: %w", err))
+		}
+	}
+	if p.postgres != nil {
+		if err := p.postgres.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("postgres: %w", err))
+		}
+	}
+	if p.clickhouse != nil {
+		if err := p.clickhouse.flush(context.Background()); err != nil {
+			errs = append(errs, fmt.Errorf("clickhouse: %w", err))
+		}
+	}
+	if p.objectStorage != nil {
+		if err := p.objectStorage.flush(context.Background()); err != nil {
+			errs = append(errs, fmt.Errorf("object_storage: %w", err))
+		}
+	}
+	if p.history != nil {
+		if err := p.history.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("history_store: %w", err))
+		}
+	}
+	if p.fileSink != nil {
+		if err := p.fileSink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("file_sink: %w", err))
+		}
+	}
+	for _, output := range p.outputs {
+		if closer, ok := output.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", output.Name(), err))
+			}
+		}
+	}
+	if p.telemetry != nil {
+		if err := p.telemetry.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeOutputs closes the built-in sinks that hold listeners or
+// connections, for a processor whose config was rejected.
+func closeOutputs(outputs []downstream) {
+	for _, output := range outputs {
+		if closer, ok := output.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
+
 // Initialize configures the processor using the provided config map.
 func (p *LatestLedgerProcessor) Initialize(config map[string]interface{}) error {
 	processor, err := NewLatestLedgerProcessor(config)
@@ -313,5 +1680,7 @@ func (p *LatestLedgerProcessor) Initialize(config map[string]interface{}) error
 		return err
 	}
 	*p = *processor
+	p.startScheduler()
+	p.startJSONLinesTimer()
 	return nil
 }
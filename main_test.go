@@ -0,0 +1,125 @@
+// main_test.go
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stellar/go/network"
+	"github.com/withObsrvr/pluginapi"
+)
+
+// recordingConsumer is a consumer that keeps the messages it receives.
+type recordingConsumer struct {
+	mu       sync.Mutex
+	messages []pluginapi.Message
+}
+
+func (c *recordingConsumer) Name() string                                   { return "recording" }
+func (c *recordingConsumer) Version() string                                { return "test" }
+func (c *recordingConsumer) Type() pluginapi.PluginType                     { return pluginapi.ConsumerPlugin }
+func (c *recordingConsumer) Initialize(config map[string]interface{}) error { return nil }
+func (c *recordingConsumer) Close() error                                   { return nil }
+
+func (c *recordingConsumer) Process(ctx context.Context, msg pluginapi.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, msg)
+	return nil
+}
+
+// reset forgets the messages received.
+func (c *recordingConsumer) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = nil
+}
+
+// sequences returns the ledger sequences of the messages received.
+func (c *recordingConsumer) sequences() []int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sequences := make([]int64, 0, len(c.messages))
+	for _, msg := range c.messages {
+		seq, _ := msg.Metadata["ledger_sequence"].(int64)
+		sequences = append(sequences, seq)
+	}
+	return sequences
+}
+
+// freeAddress returns a loopback address with a port nothing listens on.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestNewLatestLedgerProcessorReleasesListenersOnError(t *testing.T) {
+	sinks := []string{"websocket", "sse", "grpc", "http_api"}
+	tests := []struct {
+		name   string
+		config func(addresses map[string]string) map[string]interface{}
+	}{
+		{
+			name: "later setting invalid",
+			config: func(addresses map[string]string) map[string]interface{} {
+				return map[string]interface{}{"telemetry": "prometheus"}
+			},
+		},
+		{
+			name: "later sink fails to listen",
+			config: func(addresses map[string]string) map[string]interface{} {
+				return map[string]interface{}{"http_api": map[string]interface{}{"listen_address": "256.0.0.1:1"}}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addresses := make(map[string]string)
+			config := tt.config(addresses)
+			config["network_passphrase"] = network.PublicNetworkPassphrase
+			for _, sink := range sinks {
+				if _, set := config[sink]; !set {
+					addresses[sink] = freeAddress(t)
+					config[sink] = map[string]interface{}{"listen_address": addresses[sink]}
+				}
+			}
+
+			if _, err := NewLatestLedgerProcessor(config); err == nil {
+				t.Fatal("NewLatestLedgerProcessor succeeded, want an error")
+			}
+			for sink, address := range addresses {
+				listener, err := net.Listen("tcp", address)
+				if err != nil {
+					t.Errorf("%s listener still open: %v", sink, err)
+					continue
+				}
+				listener.Close()
+			}
+		})
+	}
+}
+
+func TestNewLatestLedgerProcessorValidatesBeforeListening(t *testing.T) {
+	address := freeAddress(t)
+	_, err := NewLatestLedgerProcessor(map[string]interface{}{
+		"network_passphrase": network.PublicNetworkPassphrase,
+		"payload_encoding":   payloadEncodingCBOR,
+		"websocket":          map[string]interface{}{"listen_address": address},
+		"sse":                map[string]interface{}{"listen_address": freeAddress(t)},
+	})
+	if err == nil {
+		t.Fatal("sse with CBOR payloads was accepted")
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatalf("websocket listener still open: %v", err)
+	}
+	listener.Close()
+}
@@ -0,0 +1,37 @@
+// managedata.go
+package main
+
+import (
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// ManageDataMetrics counts account data entry writes by ManageData
+// operations in successful transactions.
+type ManageDataMetrics struct {
+	OperationCount int `json:"operation_count"`
+	EntriesSet     int `json:"entries_set"`     // Operations creating or updating an entry
+	EntriesDeleted int `json:"entries_deleted"` // Operations deleting an entry (no value)
+	BytesWritten   int `json:"bytes_written"`   // Name plus value bytes of created or updated entries
+}
+
+// addManageDataMetrics records the ManageData operations of a successful
+// transaction.
+func addManageDataMetrics(m *ManageDataMetrics, tx ingest.LedgerTransaction) {
+	if !tx.Result.Successful() {
+		return
+	}
+	for _, op := range tx.Envelope.Operations() {
+		if op.Body.Type != xdr.OperationTypeManageData {
+			continue
+		}
+		manageData := op.Body.MustManageDataOp()
+		m.OperationCount++
+		if manageData.DataValue == nil {
+			m.EntriesDeleted++
+			continue
+		}
+		m.EntriesSet++
+		m.BytesWritten += len(manageData.DataName) + len(*manageData.DataValue)
+	}
+}
@@ -0,0 +1,46 @@
+// memos.go
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// maxMemoTextLength is the protocol limit of a text memo, in bytes.
+const maxMemoTextLength = 28
+
+// MemoMetrics counts the memos of the transactions in a ledger, which
+// exchanges rely on to attribute deposits. Fee-bump transactions count the
+// inner transaction's memo.
+type MemoMetrics struct {
+	TextCount          int `json:"text_count"`
+	TextMaxLengthCount int `json:"text_max_length_count"` // Text memos at the 28-byte limit, often truncated by the sending wallet
+	TextInvalidCount   int `json:"text_invalid_count"`    // Text memos that are not valid UTF-8
+	IDCount            int `json:"id_count"`
+	HashCount          int `json:"hash_count"`
+	ReturnCount        int `json:"return_count"`
+}
+
+// addMemoMetrics records the memo of a transaction, successful or not.
+func addMemoMetrics(m *MemoMetrics, tx ingest.LedgerTransaction) {
+	memo := tx.Envelope.Memo()
+	switch memo.Type {
+	case xdr.MemoTypeMemoText:
+		m.TextCount++
+		text := memo.MustText()
+		if len(text) >= maxMemoTextLength {
+			m.TextMaxLengthCount++
+		}
+		if !utf8.ValidString(text) {
+			m.TextInvalidCount++
+		}
+	case xdr.MemoTypeMemoId:
+		m.IDCount++
+	case xdr.MemoTypeMemoHash:
+		m.HashCount++
+	case xdr.MemoTypeMemoReturn:
+		m.ReturnCount++
+	}
+}
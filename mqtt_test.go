@@ -0,0 +1,163 @@
+// mqtt_test.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+func newTestMQTTPublisher(t *testing.T, addr string, qos int, retain bool) *mqttPublisher {
+	t.Helper()
+	m, err := newMQTTPublisherFromConfig(map[string]interface{}{
+		"mqtt": map[string]interface{}{
+			"url":             "mqtt://u:p@" + addr,
+			"topic":           "stellar/ledgers",
+			"qos":             qos,
+			"retain":          retain,
+			"client_id":       "c",
+			"timeout_seconds": 5,
+		},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// mqttTestConnect is the CONNECT packet of newTestMQTTPublisher.
+const mqttTestConnect = "1013" + // CONNECT, remaining length 19
+	"00044d515454" + "04" + // protocol name "MQTT", level 4
+	"c2" + // user name, password and clean session flags
+	"003c" + // keepalive 60 seconds
+	"000163" + "000175" + "000170" // client ID "c", user "u", password "p"
+
+// mqttTestTopic is the encoded topic name "stellar/ledgers".
+const mqttTestTopic = "000f" + "7374656c6c61722f6c656467657273"
+
+var mqttTestMessage = pluginapi.Message{
+	Payload:  []byte("{}"),
+	Metadata: map[string]interface{}{"data_type": "latest_ledger", "ledger_sequence": uint32(5)},
+}
+
+func TestMQTTRemainingLength(t *testing.T) {
+	// The boundaries of the remaining length table of MQTT 3.1.1 section
+	// 2.2.3.
+	tests := []struct {
+		length int
+		want   string
+	}{
+		{0, "00"},
+		{127, "7f"},
+		{128, "8001"},
+		{16383, "ff7f"},
+		{16384, "808001"},
+		{2097151, "ffff7f"},
+		{2097152, "80808001"},
+	}
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		m := &mqttPublisher{conn: client, reader: bufio.NewReader(client), timeout: 5 * time.Second}
+		body := make([]byte, tt.length)
+		go func() {
+			m.send(mqttPublish, body)
+			client.Close()
+		}()
+		packet, err := io.ReadAll(server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header := hex.EncodeToString(packet[:len(packet)-tt.length]); header != "30"+tt.want {
+			t.Errorf("length %d: fixed header %s, want 30%s", tt.length, header, tt.want)
+		}
+
+		m = &mqttPublisher{reader: bufio.NewReader(bytes.NewReader(packet))}
+		header, got, err := m.receive()
+		if err != nil || header != mqttPublish || len(got) != tt.length {
+			t.Errorf("length %d: receive = %#x, %d bytes, %v", tt.length, header, len(got), err)
+		}
+	}
+
+	m := &mqttPublisher{reader: bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01}))}
+	if _, _, err := m.receive(); err == nil || err.Error() != "malformed remaining length" {
+		t.Errorf("five-byte remaining length: receive error = %v", err)
+	}
+}
+
+func TestMQTTPublish(t *testing.T) {
+	tests := []struct {
+		name     string
+		qos      int
+		retain   bool
+		exchange []string
+	}{
+		{
+			name: "qos 0",
+			qos:  0,
+			exchange: []string{
+				"3013" + mqttTestTopic + "7b7d", "",
+			},
+		},
+		{
+			name:   "qos 1 retained",
+			qos:    1,
+			retain: true,
+			exchange: []string{
+				// PINGRESP and a PUBACK of another packet are skipped.
+				"3315" + mqttTestTopic + "0001" + "7b7d", "d000" + "40020007" + "40020001",
+			},
+		},
+		{
+			name: "qos 2",
+			qos:  2,
+			exchange: []string{
+				"3415" + mqttTestTopic + "0001" + "7b7d", "50020001", // PUBREC
+				"62020001", "70020001", // PUBREL and PUBCOMP
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exchange := append([]string{mqttTestConnect, "20020000"}, tt.exchange...)
+			addr, done := serveScript(t, hexWire, append(exchange, "e000", "")...)
+			m := newTestMQTTPublisher(t, addr, tt.qos, tt.retain)
+			if err := m.Process(context.Background(), mqttTestMessage); err != nil {
+				t.Fatal(err)
+			}
+			m.Close()
+			<-done
+		})
+	}
+}
+
+func TestMQTTConnectRefused(t *testing.T) {
+	tests := []struct {
+		connack string
+		want    string
+	}{
+		{"20020005", "broker refused connection: not authorized"},
+		{"20020009", "broker refused connection: return code 9"},
+		{"d000", "unexpected reply to CONNECT: packet type 13"},
+	}
+	for _, tt := range tests {
+		addr, done := serveScript(t, hexWire, mqttTestConnect, tt.connack)
+		m := newTestMQTTPublisher(t, addr, 1, false)
+		err := m.connect()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("CONNACK %s: connect = %v, want %q", tt.connack, err, tt.want)
+		}
+		if m.conn != nil {
+			t.Errorf("CONNACK %s: connection kept open", tt.connack)
+		}
+		<-done
+	}
+}
@@ -0,0 +1,72 @@
+// muxed.go
+package main
+
+import (
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// MuxedAccountUsage counts transactions and operations that use muxed
+// (M...) addresses as defined by SEP-23. All transactions in the ledger are
+// counted, whether or not they succeeded.
+type MuxedAccountUsage struct {
+	TxCount                   int `json:"tx_count"`                    // Transactions with a muxed transaction, fee, operation source or destination
+	OperationCount            int `json:"operation_count"`             // Operations with a muxed source or destination
+	SourceOperationCount      int `json:"source_operation_count"`      // Operations whose effective source is muxed
+	DestinationOperationCount int `json:"destination_operation_count"` // Operations whose destination is muxed
+}
+
+// addMuxedAccountUsage records the muxed address usage of a transaction.
+func addMuxedAccountUsage(m *MuxedAccountUsage, tx ingest.LedgerTransaction) {
+	txSource := tx.Envelope.SourceAccount()
+	usesMuxed := isMuxed(txSource)
+	if tx.Envelope.IsFeeBump() && isMuxed(tx.Envelope.FeeBumpAccount()) {
+		usesMuxed = true
+	}
+
+	for _, op := range tx.Envelope.Operations() {
+		source := txSource
+		if op.SourceAccount != nil {
+			source = *op.SourceAccount
+		}
+		muxedSource := isMuxed(source)
+		destination, ok := operationDestination(op)
+		muxedDestination := ok && isMuxed(destination)
+
+		if muxedSource {
+			m.SourceOperationCount++
+		}
+		if muxedDestination {
+			m.DestinationOperationCount++
+		}
+		if muxedSource || muxedDestination {
+			m.OperationCount++
+			usesMuxed = true
+		}
+	}
+
+	if usesMuxed {
+		m.TxCount++
+	}
+}
+
+// operationDestination returns the account an operation sends value to, for
+// the operation types whose destination may be a muxed account.
+func operationDestination(op xdr.Operation) (xdr.MuxedAccount, bool) {
+	body := op.Body
+	switch body.Type {
+	case xdr.OperationTypePayment:
+		return body.MustPaymentOp().Destination, true
+	case xdr.OperationTypePathPaymentStrictReceive:
+		return body.MustPathPaymentStrictReceiveOp().Destination, true
+	case xdr.OperationTypePathPaymentStrictSend:
+		return body.MustPathPaymentStrictSendOp().Destination, true
+	case xdr.OperationTypeAccountMerge:
+		return body.MustDestination(), true
+	}
+	return xdr.MuxedAccount{}, false
+}
+
+func isMuxed(account xdr.MuxedAccount) bool {
+	return account.Type == xdr.CryptoKeyTypeKeyTypeMuxedEd25519
+}
@@ -0,0 +1,25 @@
+// namespace.go
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// namespacePattern restricts namespaces to characters that are safe in
+// metric names, StatsD keys and data_type values.
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`)
+
+// configNamespace reads the namespace setting, a per-deployment prefix such
+// as "prod_eu." that keeps several deployments apart in shared
+// observability backends and topics.
+func configNamespace(config map[string]interface{}) (string, error) {
+	namespace, err := configString(config, "namespace", "")
+	if err != nil {
+		return "", err
+	}
+	if !namespacePattern.MatchString(namespace) {
+		return "", fmt.Errorf("namespace may only contain letters, digits, '_', '.' and '-', got %q", namespace)
+	}
+	return namespace, nil
+}
@@ -0,0 +1,144 @@
+// nats_test.go
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// natsTestMessage is published in every test, with the message ID
+// "abc:latest_ledger:5".
+var natsTestMessage = pluginapi.Message{
+	Payload:  []byte("{}"),
+	Metadata: map[string]interface{}{"network_id": "abc", "data_type": "latest_ledger", "ledger_sequence": uint32(5)},
+}
+
+// serveNATS accepts one connection, completes the handshake and leaves the
+// rest of the exchange to serve, which gets the subscribed inbox.
+func serveNATS(t *testing.T, serve func(conn net.Conn, r *bufio.Reader, inbox string)) *natsPublisher {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(conn)
+		io.WriteString(conn, "INFO {\"server_id\":\"test\",\"headers\":true,\"max_payload\":1048576}\r\n")
+
+		line, _ := r.ReadString('\n')
+		connect, ok := strings.CutPrefix(line, "CONNECT ")
+		var options map[string]interface{}
+		if !ok || json.Unmarshal([]byte(connect), &options) != nil {
+			t.Errorf("handshake starts with %q, want CONNECT {...}", line)
+			return
+		}
+		if options["headers"] != true || options["no_responders"] != true || options["verbose"] != false || options["user"] != "u" || options["pass"] != "p" {
+			t.Errorf("CONNECT options %v", options)
+		}
+		line, _ = r.ReadString('\n')
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "SUB" || !strings.HasPrefix(fields[1], "_INBOX.") || !strings.HasSuffix(fields[1], ".*") || fields[2] != "1" || !strings.HasSuffix(line, "\r\n") {
+			t.Errorf("subscription %q, want SUB _INBOX.<id>.* 1", line)
+			return
+		}
+		if line, _ := r.ReadString('\n'); line != "PING\r\n" {
+			t.Errorf("handshake ends with %q, want PING", line)
+			return
+		}
+		io.WriteString(conn, "PONG\r\n")
+		serve(conn, r, strings.TrimSuffix(fields[1], ".*"))
+	}()
+
+	n, err := newNATSPublisherFromConfig(map[string]interface{}{
+		"nats": map[string]interface{}{"url": "nats://u:p@" + listener.Addr().String(), "subject": "stellar.ledgers", "timeout_seconds": 5},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Close() })
+	return n
+}
+
+// readNATSPublish reads a published message and checks it byte for byte.
+func readNATSPublish(t *testing.T, r *bufio.Reader, inbox string) {
+	t.Helper()
+	want := "HPUB stellar.ledgers " + inbox + ".1 46 48\r\n" +
+		"NATS/1.0\r\nNats-Msg-Id: abc:latest_ledger:5\r\n\r\n" +
+		"{}\r\n"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("published %q, want %q", got, want)
+	}
+}
+
+func TestNATSPublishWaitsForAck(t *testing.T) {
+	n := serveNATS(t, func(conn net.Conn, r *bufio.Reader, inbox string) {
+		readNATSPublish(t, r, inbox)
+		// Server pings are answered, and acknowledgements of earlier
+		// attempts skipped, while waiting.
+		io.WriteString(conn, "PING\r\n")
+		if line, _ := r.ReadString('\n'); line != "PONG\r\n" {
+			t.Errorf("ping answered with %q, want PONG", line)
+		}
+		io.WriteString(conn, "MSG "+inbox+".0 1 2\r\n{}\r\n")
+		ack := `{"stream":"LEDGERS","seq":7}`
+		io.WriteString(conn, "MSG "+inbox+".1 1 28\r\n"+ack+"\r\n")
+	})
+	if err := n.Process(context.Background(), natsTestMessage); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNATSPublishRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func(inbox string) string
+		want  string
+	}{
+		{
+			name: "no responders",
+			reply: func(inbox string) string {
+				return "HMSG " + inbox + ".1 1 16 16\r\nNATS/1.0 503\r\n\r\n\r\n"
+			},
+			want: "no stream listens on subject stellar.ledgers",
+		},
+		{
+			name: "stream error",
+			reply: func(inbox string) string {
+				ack := `{"error":{"code":400,"description":"bad"}}`
+				return "MSG " + inbox + ".1 1 42\r\n" + ack + "\r\n"
+			},
+			want: "bad (400)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := serveNATS(t, func(conn net.Conn, r *bufio.Reader, inbox string) {
+				readNATSPublish(t, r, inbox)
+				io.WriteString(conn, tt.reply(inbox))
+			})
+			err := n.Process(context.Background(), natsTestMessage)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Process = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
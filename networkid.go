@@ -0,0 +1,58 @@
+// networkid.go
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/stellar/go/network"
+)
+
+// networkName returns the name of a known public network, or "custom" for
+// any other passphrase.
+func networkName(passphrase string) string {
+	for _, n := range knownNetworks {
+		if n.passphrase == passphrase {
+			return n.name
+		}
+	}
+	return "custom"
+}
+
+// networkFieldsPrefix returns the JSON members identifying the network and
+// the output schema version, followed by a comma, ready to be spliced into
+// the top-level object of every emitted payload. The network ID is the hex
+// SHA-256 hash of the passphrase, as used in transaction hashes.
+func networkFieldsPrefix(passphrase, name string) []byte {
+	idJSON, _ := json.Marshal(networkIDHex(passphrase))
+	nameJSON, _ := json.Marshal(name)
+
+	prefix := []byte(`"network_id":`)
+	prefix = append(prefix, idJSON...)
+	prefix = append(prefix, `,"network":`...)
+	prefix = append(prefix, nameJSON...)
+	prefix = append(prefix, `,"schema_version":"`+outputSchemaVersion+`"`...)
+	return append(prefix, ',')
+}
+
+// networkIDHex returns the hex network ID of a passphrase.
+func networkIDHex(passphrase string) string {
+	id := network.ID(passphrase)
+	return hex.EncodeToString(id[:])
+}
+
+// withNetworkFields adds the network identification members to the front of
+// a JSON object.
+func withNetworkFields(data, prefix []byte) []byte {
+	if len(prefix) == 0 || len(data) < 2 || data[0] != '{' {
+		return data
+	}
+	out := make([]byte, 0, len(data)+len(prefix))
+	out = append(out, '{')
+	if string(data) == "{}" {
+		out = append(out, prefix[:len(prefix)-1]...)
+	} else {
+		out = append(out, prefix...)
+	}
+	return append(out, data[1:]...)
+}
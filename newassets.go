@@ -0,0 +1,73 @@
+// newassets.go
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// newAssetDetector flags assets referenced by successful transactions that
+// were not seen within the retention window.
+type newAssetDetector struct {
+	seen *windowedSet
+}
+
+// newAssetDetectorFromConfig builds the detector when new_asset_window_ledgers
+// is set. It returns nil when detection is disabled.
+func newAssetDetectorFromConfig(config map[string]interface{}, stateDir string) (*newAssetDetector, error) {
+	window, err := configInt(config, "new_asset_window_ledgers", 0)
+	if err != nil {
+		return nil, err
+	}
+	if window < 0 {
+		return nil, fmt.Errorf("new_asset_window_ledgers must not be negative, got %d", window)
+	}
+	if window == 0 {
+		return nil, nil
+	}
+	seen, err := newWindowedSet(uint32(window), stateDir, "new_assets")
+	if err != nil {
+		return nil, err
+	}
+	return &newAssetDetector{seen: seen}, nil
+}
+
+// ledgerAssets collects the non-native assets referenced by the operations
+// of successful transactions in a ledger.
+type ledgerAssets map[string]bool
+
+func (a ledgerAssets) add(tx ingest.LedgerTransaction) {
+	if !tx.Result.Successful() {
+		return
+	}
+	for _, op := range tx.Envelope.Operations() {
+		for _, asset := range operationAssets(op) {
+			if asset.Type != xdr.AssetTypeAssetTypeNative {
+				a[asset.StringCanonical()] = true
+			}
+		}
+	}
+}
+
+// detect advances the window to seq and returns the ledger's assets that
+// were not seen within it, sorted. It returns nil until the window has been
+// observed in full, so a cold start does not flag every active asset.
+func (d *newAssetDetector) detect(seq uint32, assets ledgerAssets) []string {
+	d.seen.advance(seq)
+	newAssets := make(map[string]bool)
+	for asset := range assets {
+		if d.seen.observe(asset) {
+			newAssets[asset] = true
+		}
+	}
+	if err := d.seen.flush(); err != nil {
+		log.Printf("Warning: could not save new asset state: %v", err)
+	}
+	if !d.seen.warm() {
+		return nil
+	}
+	return sortedKeys(newAssets)
+}
@@ -0,0 +1,299 @@
+// objectstorage.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Formats and key layouts of the object_storage config block.
+const (
+	objectFormatNDJSON  = "ndjson"
+	objectFormatParquet = "parquet"
+	objectLayoutDate    = "date"
+	objectLayoutSeq     = "sequence"
+)
+
+// Defaults of the object_storage config block: roughly an hour of ledgers
+// per object.
+const (
+	defaultObjectBatchLedgers     = 720
+	defaultObjectBatchSeconds     = 3600
+	defaultObjectPartitionLedgers = 100000
+	defaultObjectMaxBuffered      = 17280
+)
+
+// objectStorageWriter buffers ledger records and flushes them as
+// compressed NDJSON or Parquet objects to a bucket or directory, under
+// keys partitioned by close date or sequence range, so the processor can
+// feed a data lake directly.
+type objectStorageWriter struct {
+	store            blobStore
+	format           string
+	layout           string
+	partitionLedgers uint32
+	compressor       *payloadCompressor // compresses NDJSON objects, nil for none
+	parquetCompress  string             // compression inside Parquet objects
+	maxLedgers       int
+	maxAge           time.Duration
+	rename           func(string) string
+	constants        []parquetConstant
+	maxBuffered      int
+
+	batches  []*objectBatch // pending objects, oldest first; the last one is still filling
+	buffered int            // ledgers across batches
+}
+
+// objectBatch holds the buffered ledgers of one object. A batch closed by a
+// ledger of the next partition stays separate until it is written, so a
+// failed upload never mixes partitions.
+type objectBatch struct {
+	partition string    // key prefix of the ledgers
+	started   time.Time // when the first ledger was added
+	records   []objectRecord
+}
+
+// objectRecord is a buffered ledger: its row for Parquet objects, its JSON
+// line for NDJSON ones.
+type objectRecord struct {
+	sequence uint32
+	row      LatestLedger
+	line     []byte
+}
+
+// newObjectStorageWriterFromConfig parses the optional object_storage
+// config block:
+//
+//	"object_storage": {
+//	  "path": "s3://bucket/stellar/latest_ledger",
+//	  "format": "ndjson",
+//	  "compression": "gzip",
+//	  "layout": "date",
+//	  "partition_ledgers": 100000,
+//	  "batch_ledgers": 720,
+//	  "batch_seconds": 3600,
+//	  "max_buffered_rows": 17280
+//	}
+//
+// The path may be a local directory, s3://bucket/prefix or gs://bucket/prefix.
+// It returns nil when no object storage output is configured.
+func newObjectStorageWriterFromConfig(config map[string]interface{}, keyCase string, networkPassphrase, network string) (*objectStorageWriter, error) {
+	raw, ok := config["object_storage"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("object_storage must be an object, got %T", raw)
+	}
+	dest, err := configString(block, "path", "")
+	if err != nil {
+		return nil, fmt.Errorf("object_storage: %w", err)
+	}
+	if dest == "" {
+		return nil, fmt.Errorf("object_storage: path is required")
+	}
+	format, err := configString(block, "format", objectFormatNDJSON)
+	if err != nil {
+		return nil, fmt.Errorf("object_storage: %w", err)
+	}
+	defaultCompression := compressionGzip
+	switch format {
+	case objectFormatNDJSON:
+	case objectFormatParquet:
+		defaultCompression = compressionZstd
+	default:
+		return nil, fmt.Errorf("object_storage: format must be %q or %q, got %q", objectFormatNDJSON, objectFormatParquet, format)
+	}
+	compression, err := configString(block, "compression", defaultCompression)
+	if err != nil {
+		return nil, fmt.Errorf("object_storage: %w", err)
+	}
+	layout, err := configString(block, "layout", objectLayoutDate)
+	if err != nil {
+		return nil, fmt.Errorf("object_storage: %w", err)
+	}
+	if layout != objectLayoutDate && layout != objectLayoutSeq {
+		return nil, fmt.Errorf("object_storage: layout must be %q or %q, got %q", objectLayoutDate, objectLayoutSeq, layout)
+	}
+	partitionLedgers, err := configInt(block, "partition_ledgers", defaultObjectPartitionLedgers)
+	if err != nil {
+		return nil, fmt.Errorf("object_storage: %w", err)
+	}
+	maxLedgers, err := configInt(block, "batch_ledgers", defaultObjectBatchLedgers)
+	if err != nil {
+		return nil, fmt.Errorf("object_storage: %w", err)
+	}
+	maxSeconds, err := configInt(block, "batch_seconds", defaultObjectBatchSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("object_storage: %w", err)
+	}
+	if partitionLedgers < 1 || maxLedgers < 1 || maxSeconds < 1 {
+		return nil, fmt.Errorf("object_storage: partition_ledgers, batch_ledgers and batch_seconds must be at least 1")
+	}
+	maxBuffered, err := configInt(block, "max_buffered_rows", defaultObjectMaxBuffered)
+	if err != nil {
+		return nil, fmt.Errorf("object_storage: %w", err)
+	}
+	if maxBuffered < maxLedgers {
+		return nil, fmt.Errorf("object_storage: max_buffered_rows must be at least batch_ledgers")
+	}
+
+	w := &objectStorageWriter{
+		format:           format,
+		layout:           layout,
+		partitionLedgers: uint32(partitionLedgers),
+		maxLedgers:       maxLedgers,
+		maxAge:           time.Duration(maxSeconds) * time.Second,
+		maxBuffered:      maxBuffered,
+		rename:           parquetRename(keyCase),
+		constants:        networkConstants(networkPassphrase, network),
+	}
+	if format == objectFormatParquet {
+		if compression != compressionNone && compression != compressionZstd {
+			return nil, fmt.Errorf("object_storage: compression of parquet objects must be %q or %q, got %q", compressionNone, compressionZstd, compression)
+		}
+		w.parquetCompress = compression
+	} else if w.compressor, err = newPayloadCompressor(compression); err != nil {
+		return nil, fmt.Errorf("object_storage: compression %w", err)
+	}
+	if w.store, err = newBlobStore(dest); err != nil {
+		return nil, fmt.Errorf("object_storage: %w", err)
+	}
+	return w, nil
+}
+
+// partitionOf returns the key prefix of a ledger: date=YYYY-MM-DD/hour=HH/
+// of its UTC close time, or the zero-padded sequence range of its
+// partition.
+func (w *objectStorageWriter) partitionOf(metrics LatestLedger) string {
+	if w.layout == objectLayoutSeq {
+		start := metrics.Sequence / w.partitionLedgers * w.partitionLedgers
+		end := uint64(start) + uint64(w.partitionLedgers) - 1
+		return fmt.Sprintf("ledgers=%010d-%010d/", start, end)
+	}
+	return metrics.ClosedAt.UTC().Format("date=2006-01-02/hour=15/")
+}
+
+// add buffers a ledger and writes the objects that are due. line is the
+// JSON record of the ledger, used for NDJSON objects. A ledger of another
+// partition closes the object of the previous one, which is written at once.
+// Objects that fail to write are kept and retried with the next ledger; when
+// more than max_buffered_rows ledgers are held, the oldest are dropped.
+func (w *objectStorageWriter) add(ctx context.Context, metrics LatestLedger, line []byte) {
+	partition := w.partitionOf(metrics)
+	var batch *objectBatch
+	if n := len(w.batches); n > 0 && w.batches[n-1].partition == partition {
+		batch = w.batches[n-1]
+	} else {
+		batch = &objectBatch{partition: partition, started: time.Now()}
+		w.batches = append(w.batches, batch)
+	}
+	record := objectRecord{sequence: metrics.Sequence}
+	if w.format == objectFormatParquet {
+		record.row = metrics.Clone()
+	} else {
+		record.line = append(append([]byte(nil), line...), '\n')
+	}
+	batch.records = append(batch.records, record)
+	w.buffered++
+	if dropped := w.buffered - w.maxBuffered; dropped > 0 {
+		log.Printf("Warning: object storage buffer full, dropping the %d oldest ledgers", dropped)
+		w.drop(dropped)
+	}
+	if err := w.write(ctx, false); err != nil {
+		log.Printf("Warning: writing object storage failed, %d ledgers buffered: %v", w.buffered, err)
+	}
+}
+
+// drop discards the n oldest buffered ledgers.
+func (w *objectStorageWriter) drop(n int) {
+	for n > 0 && len(w.batches) > 0 {
+		batch := w.batches[0]
+		if n < len(batch.records) {
+			batch.records = batch.records[n:]
+			w.buffered -= n
+			return
+		}
+		n -= len(batch.records)
+		w.buffered -= len(batch.records)
+		w.batches = w.batches[1:]
+	}
+}
+
+// flush writes all buffered ledgers.
+func (w *objectStorageWriter) flush(ctx context.Context) error {
+	return w.write(ctx, true)
+}
+
+// write writes the pending objects oldest first, stopping at the first that
+// fails. The last object, still filling, is only written when all is set or
+// once it holds batch_ledgers ledgers or is batch_seconds old.
+func (w *objectStorageWriter) write(ctx context.Context, all bool) error {
+	for len(w.batches) > 0 {
+		batch := w.batches[0]
+		if len(w.batches) == 1 && !all && len(batch.records) < w.maxLedgers && time.Since(batch.started) < w.maxAge {
+			return nil
+		}
+		if err := w.put(ctx, batch); err != nil {
+			return err
+		}
+		w.batches = w.batches[1:]
+		w.buffered -= len(batch.records)
+	}
+	return nil
+}
+
+// put writes the ledgers of a batch to an object named after their sequence
+// range under their partition.
+func (w *objectStorageWriter) put(ctx context.Context, batch *objectBatch) error {
+	first, last := batch.records[0].sequence, batch.records[len(batch.records)-1].sequence
+	name := fmt.Sprintf("%sledgers-%010d-%010d", batch.partition, first, last)
+	var data []byte
+	var err error
+	if w.format == objectFormatParquet {
+		name += ".parquet"
+		rows := make([]LatestLedger, len(batch.records))
+		for i, record := range batch.records {
+			rows[i] = record.row
+		}
+		data, err = encodeLedgerRows(rows, w.rename, w.constants, w.parquetCompress)
+	} else {
+		name += ".ndjson"
+		var lines bytes.Buffer
+		for _, record := range batch.records {
+			lines.Write(record.line)
+		}
+		data = lines.Bytes()
+		if w.compressor != nil {
+			data, err = w.compressor.compress(data)
+			name += map[string]string{compressionGzip: ".gz", compressionZstd: ".zst"}[w.compressor.algorithm]
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := w.store.put(ctx, name, data); err != nil {
+		return err
+	}
+	log.Printf("Object storage: wrote %s (%d ledgers, %d bytes)", name, len(batch.records), len(data))
+	return nil
+}
+
+// addToObjectStorage buffers a ledger for object storage. NDJSON records
+// are the latest_ledger JSON payloads, marshaled anew when the forwarded
+// payload is not JSON bytes, as with split output or struct payloads.
+func (p *LatestLedgerProcessor) addToObjectStorage(ctx context.Context, metrics LatestLedger, payload interface{}) {
+	line, _ := payload.([]byte)
+	if line == nil && p.objectStorage.format == objectFormatNDJSON {
+		var err error
+		if line, err = p.marshalPayload(metrics); err != nil {
+			log.Printf("Warning: encoding ledger %d for object storage failed: %v", metrics.Sequence, err)
+			return
+		}
+	}
+	p.objectStorage.add(ctx, metrics, line)
+}
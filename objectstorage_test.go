@@ -0,0 +1,90 @@
+// objectstorage_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyBlobStore records the objects written to it and fails while down.
+type flakyBlobStore struct {
+	down    bool
+	objects map[string]string
+}
+
+func (s *flakyBlobStore) put(ctx context.Context, name string, data []byte) error {
+	if s.down {
+		return errors.New("store down")
+	}
+	s.objects[name] = string(data)
+	return nil
+}
+
+func newTestObjectStorageWriter(t *testing.T, config map[string]interface{}) (*objectStorageWriter, *flakyBlobStore) {
+	config["path"] = t.TempDir()
+	config["compression"] = compressionNone
+	config["layout"] = objectLayoutSeq
+	w, err := newObjectStorageWriterFromConfig(map[string]interface{}{"object_storage": config}, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &flakyBlobStore{objects: map[string]string{}}
+	w.store = store
+	return w, store
+}
+
+func addTestObjectLedgers(w *objectStorageWriter, from, to uint32) {
+	for seq := from; seq <= to; seq++ {
+		w.add(context.Background(), LatestLedger{Sequence: seq, ClosedAt: time.Unix(1_700_000_000, 0)}, []byte(fmt.Sprint(seq)))
+	}
+}
+
+func TestObjectStorageKeepsFailedPartitionApart(t *testing.T) {
+	w, store := newTestObjectStorageWriter(t, map[string]interface{}{"partition_ledgers": 10, "batch_ledgers": 100})
+	addTestObjectLedgers(w, 7, 9)
+	store.down = true
+	addTestObjectLedgers(w, 10, 11) // closes 7-9, whose upload fails
+	store.down = false
+	addTestObjectLedgers(w, 12, 12) // retries 7-9
+	if err := w.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"ledgers=0000000000-0000000009/ledgers-0000000007-0000000009.ndjson": "7\n8\n9\n",
+		"ledgers=0000000010-0000000019/ledgers-0000000010-0000000012.ndjson": "10\n11\n12\n",
+	}
+	if fmt.Sprint(store.objects) != fmt.Sprint(want) {
+		t.Errorf("wrote %q, want %q", store.objects, want)
+	}
+	if w.buffered != 0 || len(w.batches) != 0 {
+		t.Errorf("%d ledgers in %d batches left after flush", w.buffered, len(w.batches))
+	}
+}
+
+func TestObjectStorageDropsOldestWhenFull(t *testing.T) {
+	w, store := newTestObjectStorageWriter(t, map[string]interface{}{"partition_ledgers": 3, "batch_ledgers": 2, "max_buffered_rows": 4})
+	store.down = true
+	addTestObjectLedgers(w, 0, 5)
+	store.down = false
+	if err := w.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"ledgers=0000000000-0000000002/ledgers-0000000002-0000000002.ndjson": "2\n",
+		"ledgers=0000000003-0000000005/ledgers-0000000003-0000000005.ndjson": "3\n4\n5\n",
+	}
+	if fmt.Sprint(store.objects) != fmt.Sprint(want) {
+		t.Errorf("wrote %q, want %q", store.objects, want)
+	}
+
+	_, err := newObjectStorageWriterFromConfig(map[string]interface{}{"object_storage": map[string]interface{}{
+		"path": t.TempDir(), "batch_ledgers": 10, "max_buffered_rows": 5,
+	}}, "", "", "")
+	if err == nil || !strings.Contains(err.Error(), "max_buffered_rows") {
+		t.Errorf("max_buffered_rows below batch_ledgers accepted: %v", err)
+	}
+}
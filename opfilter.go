@@ -0,0 +1,119 @@
+// opfilter.go
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// FilteredOperationCounts holds operation counts restricted to the operation
+// types selected by include_operation_types/exclude_operation_types.
+type FilteredOperationCounts struct {
+	TxSetOperationCount      int     `json:"tx_set_operation_count"`
+	SuccessfulOperationCount int     `json:"successful_operation_count"`
+	TransactionsPerSecond    float64 `json:"transactions_per_second"`
+}
+
+// operationFilter decides which operation types contribute to the filtered
+// counts.
+type operationFilter struct {
+	included map[xdr.OperationType]bool
+}
+
+// newOperationFilterFromConfig builds a filter from the include/exclude
+// lists. It returns nil when neither list is configured.
+func newOperationFilterFromConfig(config map[string]interface{}) (*operationFilter, error) {
+	include, err := configStringSlice(config, "include_operation_types")
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := configStringSlice(config, "exclude_operation_types")
+	if err != nil {
+		return nil, err
+	}
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+
+	f := &operationFilter{included: make(map[xdr.OperationType]bool)}
+	if len(include) == 0 {
+		for _, opType := range allOperationTypes() {
+			f.included[opType] = true
+		}
+	}
+	for _, name := range include {
+		opType, err := parseOperationType(name)
+		if err != nil {
+			return nil, fmt.Errorf("include_operation_types: %w", err)
+		}
+		f.included[opType] = true
+	}
+	for _, name := range exclude {
+		opType, err := parseOperationType(name)
+		if err != nil {
+			return nil, fmt.Errorf("exclude_operation_types: %w", err)
+		}
+		delete(f.included, opType)
+	}
+	return f, nil
+}
+
+// count adds the transaction's matching operations to counts.
+func (f *operationFilter) count(counts *FilteredOperationCounts, tx ingest.LedgerTransaction) {
+	matching := 0
+	for _, op := range tx.Envelope.Operations() {
+		if f.included[op.Body.Type] {
+			matching++
+		}
+	}
+	counts.TxSetOperationCount += matching
+	if tx.Result.Successful() {
+		counts.SuccessfulOperationCount += matching
+	}
+}
+
+// allOperationTypes returns every operation type known to the XDR package.
+func allOperationTypes() []xdr.OperationType {
+	var types []xdr.OperationType
+	for i := int32(0); xdr.OperationType(i).ValidEnum(i); i++ {
+		types = append(types, xdr.OperationType(i))
+	}
+	return types
+}
+
+// operationTypeName returns the Horizon-style name of an operation type,
+// e.g. "manage_sell_offer".
+func operationTypeName(opType xdr.OperationType) string {
+	name := strings.TrimPrefix(opType.String(), "OperationType")
+	var b strings.Builder
+	for i, r := range name {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// parseOperationType resolves an operation type name. Matching ignores case
+// and underscores, so "manage_sell_offer", "ManageSellOffer" and
+// "OperationTypeManageSellOffer" are all accepted.
+func parseOperationType(name string) (xdr.OperationType, error) {
+	normalize := func(s string) string {
+		s = strings.ToLower(strings.ReplaceAll(s, "_", ""))
+		return strings.TrimPrefix(s, "operationtype")
+	}
+	want := normalize(name)
+	for _, opType := range allOperationTypes() {
+		if normalize(operationTypeName(opType)) == want {
+			return opType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown operation type %q", name)
+}
@@ -0,0 +1,117 @@
+// opresults.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// Supported values for the operation_success_mode setting.
+const (
+	// opSuccessEnvelope counts every operation of a successful transaction.
+	opSuccessEnvelope = "envelope"
+	// opSuccessResults counts operations whose own result is a success,
+	// whatever the outcome of the transaction.
+	opSuccessResults = "results"
+)
+
+func parseOperationSuccessMode(mode string) (string, error) {
+	switch mode {
+	case opSuccessEnvelope, opSuccessResults:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("operation_success_mode must be %q or %q, got %q", opSuccessEnvelope, opSuccessResults, mode)
+	}
+}
+
+// successfulOperations returns the number of operations of a transaction
+// that count as successful in the given mode.
+func successfulOperations(tx ingest.LedgerTransaction, mode string) int {
+	if mode != opSuccessResults {
+		if tx.Result.Successful() {
+			return len(tx.Envelope.Operations())
+		}
+		return 0
+	}
+
+	results, ok := tx.Result.OperationResults()
+	if !ok {
+		// The transaction failed before its operations were applied.
+		return 0
+	}
+	count := 0
+	for _, result := range results {
+		if operationSucceeded(result) {
+			count++
+		}
+	}
+	return count
+}
+
+// operationSucceeded reports whether an operation result is the success
+// code of its operation type.
+func operationSucceeded(result xdr.OperationResult) bool {
+	if result.Code != xdr.OperationResultCodeOpInner || result.Tr == nil {
+		return false
+	}
+	tr := *result.Tr
+	switch tr.Type {
+	case xdr.OperationTypeCreateAccount:
+		return tr.MustCreateAccountResult().Code == xdr.CreateAccountResultCodeCreateAccountSuccess
+	case xdr.OperationTypePayment:
+		return tr.MustPaymentResult().Code == xdr.PaymentResultCodePaymentSuccess
+	case xdr.OperationTypePathPaymentStrictReceive:
+		return tr.MustPathPaymentStrictReceiveResult().Code == xdr.PathPaymentStrictReceiveResultCodePathPaymentStrictReceiveSuccess
+	case xdr.OperationTypeManageSellOffer:
+		return tr.MustManageSellOfferResult().Code == xdr.ManageSellOfferResultCodeManageSellOfferSuccess
+	case xdr.OperationTypeCreatePassiveSellOffer:
+		return tr.MustCreatePassiveSellOfferResult().Code == xdr.ManageSellOfferResultCodeManageSellOfferSuccess
+	case xdr.OperationTypeSetOptions:
+		return tr.MustSetOptionsResult().Code == xdr.SetOptionsResultCodeSetOptionsSuccess
+	case xdr.OperationTypeChangeTrust:
+		return tr.MustChangeTrustResult().Code == xdr.ChangeTrustResultCodeChangeTrustSuccess
+	case xdr.OperationTypeAllowTrust:
+		return tr.MustAllowTrustResult().Code == xdr.AllowTrustResultCodeAllowTrustSuccess
+	case xdr.OperationTypeAccountMerge:
+		return tr.MustAccountMergeResult().Code == xdr.AccountMergeResultCodeAccountMergeSuccess
+	case xdr.OperationTypeInflation:
+		return tr.MustInflationResult().Code == xdr.InflationResultCodeInflationSuccess
+	case xdr.OperationTypeManageData:
+		return tr.MustManageDataResult().Code == xdr.ManageDataResultCodeManageDataSuccess
+	case xdr.OperationTypeBumpSequence:
+		return tr.MustBumpSeqResult().Code == xdr.BumpSequenceResultCodeBumpSequenceSuccess
+	case xdr.OperationTypeManageBuyOffer:
+		return tr.MustManageBuyOfferResult().Code == xdr.ManageBuyOfferResultCodeManageBuyOfferSuccess
+	case xdr.OperationTypePathPaymentStrictSend:
+		return tr.MustPathPaymentStrictSendResult().Code == xdr.PathPaymentStrictSendResultCodePathPaymentStrictSendSuccess
+	case xdr.OperationTypeCreateClaimableBalance:
+		return tr.MustCreateClaimableBalanceResult().Code == xdr.CreateClaimableBalanceResultCodeCreateClaimableBalanceSuccess
+	case xdr.OperationTypeClaimClaimableBalance:
+		return tr.MustClaimClaimableBalanceResult().Code == xdr.ClaimClaimableBalanceResultCodeClaimClaimableBalanceSuccess
+	case xdr.OperationTypeBeginSponsoringFutureReserves:
+		return tr.MustBeginSponsoringFutureReservesResult().Code == xdr.BeginSponsoringFutureReservesResultCodeBeginSponsoringFutureReservesSuccess
+	case xdr.OperationTypeEndSponsoringFutureReserves:
+		return tr.MustEndSponsoringFutureReservesResult().Code == xdr.EndSponsoringFutureReservesResultCodeEndSponsoringFutureReservesSuccess
+	case xdr.OperationTypeRevokeSponsorship:
+		return tr.MustRevokeSponsorshipResult().Code == xdr.RevokeSponsorshipResultCodeRevokeSponsorshipSuccess
+	case xdr.OperationTypeClawback:
+		return tr.MustClawbackResult().Code == xdr.ClawbackResultCodeClawbackSuccess
+	case xdr.OperationTypeClawbackClaimableBalance:
+		return tr.MustClawbackClaimableBalanceResult().Code == xdr.ClawbackClaimableBalanceResultCodeClawbackClaimableBalanceSuccess
+	case xdr.OperationTypeSetTrustLineFlags:
+		return tr.MustSetTrustLineFlagsResult().Code == xdr.SetTrustLineFlagsResultCodeSetTrustLineFlagsSuccess
+	case xdr.OperationTypeLiquidityPoolDeposit:
+		return tr.MustLiquidityPoolDepositResult().Code == xdr.LiquidityPoolDepositResultCodeLiquidityPoolDepositSuccess
+	case xdr.OperationTypeLiquidityPoolWithdraw:
+		return tr.MustLiquidityPoolWithdrawResult().Code == xdr.LiquidityPoolWithdrawResultCodeLiquidityPoolWithdrawSuccess
+	case xdr.OperationTypeInvokeHostFunction:
+		return tr.MustInvokeHostFunctionResult().Code == xdr.InvokeHostFunctionResultCodeInvokeHostFunctionSuccess
+	case xdr.OperationTypeExtendFootprintTtl:
+		return tr.MustExtendFootprintTtlResult().Code == xdr.ExtendFootprintTtlResultCodeExtendFootprintTtlSuccess
+	case xdr.OperationTypeRestoreFootprint:
+		return tr.MustRestoreFootprintResult().Code == xdr.RestoreFootprintResultCodeRestoreFootprintSuccess
+	}
+	return false
+}
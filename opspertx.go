@@ -0,0 +1,25 @@
+// opspertx.go
+package main
+
+// OpsPerTxDistribution counts transactions by the number of operations they
+// carry, showing how much batching users do.
+type OpsPerTxDistribution struct {
+	One         int `json:"one"`
+	TwoToFive   int `json:"two_to_five"`
+	SixToTwenty int `json:"six_to_twenty"`
+	OverTwenty  int `json:"over_twenty"`
+}
+
+// add counts a transaction with the given number of operations.
+func (d *OpsPerTxDistribution) add(operationCount int) {
+	switch {
+	case operationCount <= 1:
+		d.One++
+	case operationCount <= 5:
+		d.TwoToFive++
+	case operationCount <= 20:
+		d.SixToTwenty++
+	default:
+		d.OverTwenty++
+	}
+}
@@ -0,0 +1,369 @@
+// otlp.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the OpenTelemetry environment variables read by the otlp
+// exporter.
+const (
+	defaultOTLPEndpoint       = "http://localhost:4318"
+	defaultOTLPTimeout        = 10 * time.Second
+	defaultOTLPExportInterval = 60 * time.Second
+)
+
+// otlpTelemetryExporter pushes telemetry to an OpenTelemetry collector with
+// OTLP/HTTP in its JSON encoding, on the collector's usual periodic export
+// schedule. Like an OpenTelemetry SDK reader, it exports the latest value
+// of each gauge and the cumulative sum of each counter; measurements are
+// only recorded in memory on the ledger path.
+type otlpTelemetryExporter struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+	resource map[string]string // from OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME
+	start    time.Time         // start of the cumulative sums
+
+	mu         sync.Mutex
+	attributes map[string]string // resource attributes of the telemetry config
+	series     map[string]*otlpSeries
+	order      []string // series keys in the order they were first seen
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// otlpSeries is a single metric stream.
+type otlpSeries struct {
+	name       string
+	kind       telemetryKind
+	attributes map[string]string
+	value      float64
+}
+
+// newOTLPTelemetryExporter configures the exporter from the standard
+// OpenTelemetry environment variables: OTEL_EXPORTER_OTLP_ENDPOINT and
+// OTEL_EXPORTER_OTLP_METRICS_ENDPOINT, the matching _HEADERS, _TIMEOUT and
+// _PROTOCOL variables, OTEL_METRIC_EXPORT_INTERVAL, OTEL_RESOURCE_ATTRIBUTES
+// and OTEL_SERVICE_NAME. Its config block takes no settings.
+func newOTLPTelemetryExporter(block map[string]interface{}) (telemetryExporter, error) {
+	if len(block) > 0 {
+		return nil, fmt.Errorf("settings are read from the OTEL_* environment variables, the block must be empty")
+	}
+
+	protocol := otlpEnv("PROTOCOL")
+	if protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("unsupported OTLP protocol %q, only http/json is supported", protocol)
+	}
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			base = defaultOTLPEndpoint
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/metrics"
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP metrics endpoint %q", endpoint)
+	}
+	headers, err := parseOTelList(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+	}
+	metricsHeaders, err := parseOTelList(os.Getenv("OTEL_EXPORTER_OTLP_METRICS_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_METRICS_HEADERS: %w", err)
+	}
+	for k, v := range metricsHeaders {
+		headers[k] = v
+	}
+	timeout, err := otelMillis(otlpEnv("TIMEOUT"), defaultOTLPTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("OTLP timeout: %w", err)
+	}
+	interval, err := otelMillis(os.Getenv("OTEL_METRIC_EXPORT_INTERVAL"), defaultOTLPExportInterval)
+	if err != nil {
+		return nil, fmt.Errorf("OTEL_METRIC_EXPORT_INTERVAL: %w", err)
+	}
+	resource, err := parseOTelList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		resource["service.name"] = name
+	}
+
+	e := &otlpTelemetryExporter{
+		client:   &http.Client{Timeout: timeout},
+		endpoint: endpoint,
+		headers:  headers,
+		resource: resource,
+		start:    time.Now(),
+		series:   make(map[string]*otlpSeries),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run(interval)
+	return e, nil
+}
+
+// otlpEnv returns the metrics specific variant of an OTLP exporter
+// variable, or else the general one.
+func otlpEnv(suffix string) string {
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_METRICS_" + suffix); v != "" {
+		return v
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_" + suffix)
+}
+
+// parseOTelList parses the comma separated key=value lists of the
+// OpenTelemetry environment variables, whose values are percent-encoded.
+func parseOTelList(s string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid entry %q, want key=value", item)
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %w", k, err)
+		}
+		values[k] = value
+	}
+	return values, nil
+}
+
+// otelMillis parses a duration given in milliseconds.
+func otelMillis(s string, fallback time.Duration) (time.Duration, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	ms, err := strconv.Atoi(s)
+	if err != nil || ms <= 0 {
+		return 0, fmt.Errorf("want a positive number of milliseconds, got %q", s)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Export records the values of a batch for the next periodic export.
+func (e *otlpTelemetryExporter) Export(batch telemetryBatch) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.attributes = batch.Attributes
+	for _, point := range batch.Points {
+		key := point.Name
+		if len(point.Attributes) > 0 {
+			attrs := make([]string, 0, len(point.Attributes))
+			for k, v := range point.Attributes {
+				attrs = append(attrs, k+"="+v)
+			}
+			sort.Strings(attrs)
+			key += "{" + strings.Join(attrs, ",") + "}"
+		}
+		s, ok := e.series[key]
+		if !ok {
+			s = &otlpSeries{name: point.Name, kind: point.Kind, attributes: point.Attributes}
+			e.series[key] = s
+			e.order = append(e.order, key)
+		}
+		if point.Kind == telemetryCounter {
+			s.value += point.Value
+		} else {
+			s.value = point.Value
+		}
+	}
+	return nil
+}
+
+// run exports the recorded values every interval until Close.
+func (e *otlpTelemetryExporter) run(interval time.Duration) {
+	defer close(e.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.push(); err != nil {
+				log.Printf("Warning: telemetry exporter otlp failed: %v", err)
+			}
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// push sends the current values to the collector.
+func (e *otlpTelemetryExporter) push() error {
+	body, err := e.request(time.Now())
+	if err != nil || body == nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// otlpKeyValue and the types below mirror the OTLP JSON encoding of an
+// ExportMetricsServiceRequest, limited to the fields the exporter sets.
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          float64        `json:"asDouble"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const otlpCumulative = 2
+
+// request returns the JSON body of an export, or nil before the first
+// ledger.
+func (e *otlpTelemetryExporter) request(now time.Time) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.order) == 0 {
+		return nil, nil
+	}
+
+	resource := make(map[string]string, len(e.resource)+len(e.attributes))
+	for k, v := range e.resource {
+		resource[k] = v
+	}
+	for k, v := range e.attributes {
+		resource[k] = v
+	}
+
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+	start := strconv.FormatInt(e.start.UnixNano(), 10)
+	metrics := make([]otlpMetric, 0, len(e.order))
+	byName := make(map[string]int)
+	for _, key := range e.order {
+		s := e.series[key]
+		point := otlpDataPoint{Attributes: otlpAttributes(s.attributes), TimeUnixNano: timestamp, AsDouble: s.value}
+
+		i, ok := byName[s.name]
+		if !ok {
+			i = len(metrics)
+			byName[s.name] = i
+			m := otlpMetric{Name: s.name}
+			if s.kind == telemetryTiming {
+				m.Unit = "s"
+			}
+			if s.kind == telemetryCounter {
+				m.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			} else {
+				m.Gauge = &otlpGauge{}
+			}
+			metrics = append(metrics, m)
+		}
+		if m := &metrics[i]; m.Sum != nil {
+			point.StartTimeUnixNano = start
+			m.Sum.DataPoints = append(m.Sum.DataPoints, point)
+		} else {
+			m.Gauge.DataPoints = append(m.Gauge.DataPoints, point)
+		}
+	}
+
+	type scopeMetrics struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	type resourceMetrics struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+	}
+	var rm resourceMetrics
+	rm.Resource.Attributes = otlpAttributes(resource)
+	var sm scopeMetrics
+	sm.Scope.Name = instrumentationScope
+	sm.Metrics = metrics
+	rm.ScopeMetrics = []scopeMetrics{sm}
+	return json.Marshal(map[string]interface{}{"resourceMetrics": []resourceMetrics{rm}})
+}
+
+// otlpAttributes converts attributes to OTLP key-values, sorted by key.
+func otlpAttributes(attrs map[string]string) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]otlpKeyValue, len(keys))
+	for i, k := range keys {
+		kvs[i].Key = k
+		kvs[i].Value.StringValue = attrs[k]
+	}
+	return kvs
+}
+
+// Close stops the periodic export and pushes the final values.
+func (e *otlpTelemetryExporter) Close() error {
+	close(e.stop)
+	<-e.done
+	return e.push()
+}
@@ -0,0 +1,425 @@
+// parquet.go
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Parquet format constants, as defined in parquet.thrift.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetUncompressed = 0
+	parquetZstd         = 6
+
+	parquetDataPage = 0
+)
+
+// parquetColumn is a flat column of a Parquet file being built in memory.
+// Nested structs are flattened into columns named parent_child, pointers
+// become optional columns, and slices and maps are stored as JSON strings.
+type parquetColumn struct {
+	name      string
+	physical  int32
+	converted int32 // -1 when the column has no converted type
+	optional  bool
+
+	rows    int
+	present []bool // definition levels, for optional columns
+	values  []byte // PLAIN encoded non-null values
+	bools   []bool // non-null values of boolean columns, bit-packed on write
+}
+
+// parquetConstant is a string column with the same value in every row.
+type parquetConstant struct {
+	name, value string
+}
+
+// parquetTable accumulates rows of a struct type as Parquet columns.
+type parquetTable struct {
+	columns   []*parquetColumn
+	constants []parquetConstant   // values of the leading columns
+	rename    func(string) string // applied to column names and JSON keys of slice and map columns
+}
+
+// newParquetTable derives the columns of a struct type, preceded by the
+// given constant columns. Column names follow the json tags, passed through
+// rename.
+func newParquetTable(t reflect.Type, rename func(string) string, constants ...parquetConstant) (*parquetTable, error) {
+	table := &parquetTable{constants: constants, rename: rename}
+	for _, constant := range constants {
+		if err := table.addColumn(reflect.TypeOf(""), constant.name, false); err != nil {
+			return nil, err
+		}
+	}
+	if err := table.addColumns(t, "", false); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+func (t *parquetTable) addColumns(typ reflect.Type, prefix string, optional bool) error {
+	for _, f := range payloadFields(typ) {
+		field := typ.Field(f.index)
+		if err := t.addColumn(field.Type, prefix+f.name, optional); err != nil {
+			return fmt.Errorf("parquet: %s: %w", prefix+f.name, err)
+		}
+	}
+	return nil
+}
+
+func (t *parquetTable) addColumn(typ reflect.Type, name string, optional bool) error {
+	column := &parquetColumn{name: t.rename(name), converted: -1, optional: optional}
+	switch {
+	case typ == timeType:
+		column.physical, column.converted = parquetInt64, parquetTimestampMicros
+	case typ.Kind() == reflect.Ptr:
+		if typ.Elem().Kind() == reflect.Struct && typ.Elem() != timeType {
+			return t.addColumns(typ.Elem(), name+"_", true)
+		}
+		return t.addColumn(typ.Elem(), name, true)
+	case typ.Kind() == reflect.Struct:
+		return t.addColumns(typ, name+"_", optional)
+	case typ.Kind() == reflect.Bool:
+		column.physical = parquetBoolean
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		column.physical = parquetInt64
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		column.physical = parquetDouble
+	case typ.Kind() == reflect.String:
+		column.physical, column.converted = parquetByteArray, parquetUTF8
+	case typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map:
+		column.physical, column.converted = parquetByteArray, parquetUTF8
+		column.optional = true
+	default:
+		return fmt.Errorf("unsupported type %s", typ)
+	}
+	t.columns = append(t.columns, column)
+	return nil
+}
+
+// append adds a row. v must be of the type the table was created for.
+func (t *parquetTable) append(v interface{}) error {
+	for i, constant := range t.constants {
+		t.columns[i].rows++
+		t.columns[i].appendBytes([]byte(constant.value))
+	}
+	next := len(t.constants)
+	return t.appendValue(reflect.ValueOf(v), true, &next)
+}
+
+// appendValue walks v in the same order as addColumns, feeding each leaf
+// to the next column. Leaves under a nil pointer are appended as nulls.
+func (t *parquetTable) appendValue(v reflect.Value, present bool, next *int) error {
+	typ := v.Type()
+	switch {
+	case typ == timeType:
+	case typ.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return t.appendValue(reflect.Zero(typ.Elem()), false, next)
+		}
+		return t.appendValue(v.Elem(), present, next)
+	case typ.Kind() == reflect.Struct:
+		for _, f := range payloadFields(typ) {
+			if err := t.appendValue(v.Field(f.index), present, next); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	column := t.columns[*next]
+	*next++
+	column.rows++
+	if (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map) && v.IsNil() {
+		present = false
+	}
+	if column.optional {
+		column.present = append(column.present, present)
+	}
+	if !present {
+		return nil
+	}
+
+	switch {
+	case typ == timeType:
+		column.appendInt64(v.Interface().(time.Time).UnixMicro())
+	case typ.Kind() == reflect.Bool:
+		column.bools = append(column.bools, v.Bool())
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Int64:
+		column.appendInt64(v.Int())
+	case typ.Kind() >= reflect.Uint && typ.Kind() <= reflect.Uint64:
+		u := v.Uint()
+		if u > math.MaxInt64 {
+			return fmt.Errorf("parquet: %s: %d overflows int64", column.name, u)
+		}
+		column.appendInt64(int64(u))
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		column.values = binary.LittleEndian.AppendUint64(column.values, math.Float64bits(v.Float()))
+	case typ.Kind() == reflect.String:
+		column.appendBytes([]byte(v.String()))
+	default:
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return fmt.Errorf("parquet: %s: %w", column.name, err)
+		}
+		if data, err = rewriteJSONKeys(data, t.rename); err != nil {
+			return fmt.Errorf("parquet: %s: %w", column.name, err)
+		}
+		column.appendBytes(data)
+	}
+	return nil
+}
+
+func (c *parquetColumn) appendInt64(n int64) {
+	c.values = binary.LittleEndian.AppendUint64(c.values, uint64(n))
+}
+
+func (c *parquetColumn) appendBytes(b []byte) {
+	c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(b)))
+	c.values = append(c.values, b...)
+}
+
+// pageData returns the uncompressed data page: definition levels for
+// optional columns, followed by the PLAIN encoded values.
+func (c *parquetColumn) pageData() []byte {
+	var page []byte
+	if c.optional {
+		levels := appendBitPackedRun(nil, c.present)
+		page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+		page = append(page, levels...)
+	}
+	if c.physical == parquetBoolean {
+		return append(page, packBits(c.bools)...)
+	}
+	return append(page, c.values...)
+}
+
+// appendBitPackedRun appends bit width 1 values as a single bit-packed run
+// of the RLE/bit-packing hybrid encoding.
+func appendBitPackedRun(buf []byte, bits []bool) []byte {
+	groups := (len(bits) + 7) / 8
+	buf = binary.AppendUvarint(buf, uint64(groups)<<1|1)
+	return append(buf, packBits(bits)...)
+}
+
+// packBits packs booleans LSB first.
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// encode writes the table as a Parquet file with a single row group.
+func (t *parquetTable) encode(compression string) ([]byte, error) {
+	codec := int32(parquetUncompressed)
+	var encoder *zstd.Encoder
+	if compression == compressionZstd {
+		codec = parquetZstd
+		var err error
+		if encoder, err = zstd.NewWriter(nil); err != nil {
+			return nil, err
+		}
+		defer encoder.Close()
+	}
+
+	rows := 0
+	if len(t.columns) > 0 {
+		rows = t.columns[0].rows
+	}
+
+	out := []byte("PAR1")
+	type chunk struct {
+		offset                   int64
+		uncompressed, compressed int64
+	}
+	chunks := make([]chunk, len(t.columns))
+	var totalSize int64
+	for i, column := range t.columns {
+		page := column.pageData()
+		compressed := page
+		if encoder != nil {
+			compressed = encoder.EncodeAll(page, nil)
+		}
+
+		var header thriftWriter
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(compressed)))
+		header.structField(5)
+		header.i32(1, int32(rows))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.structEnd()
+		header.structEnd()
+
+		chunks[i] = chunk{
+			offset:       int64(len(out)),
+			uncompressed: int64(len(header.buf) + len(page)),
+			compressed:   int64(len(header.buf) + len(compressed)),
+		}
+		totalSize += chunks[i].uncompressed
+		out = append(out, header.buf...)
+		out = append(out, compressed...)
+	}
+
+	var footer thriftWriter
+	footer.i32(1, 1)
+	footer.listField(2, thriftStruct, len(t.columns)+1)
+	footer.structBegin()
+	footer.binary(4, "schema")
+	footer.i32(5, int32(len(t.columns)))
+	footer.structEnd()
+	for _, column := range t.columns {
+		footer.structBegin()
+		footer.i32(1, column.physical)
+		repetition := int32(parquetRequired)
+		if column.optional {
+			repetition = parquetOptional
+		}
+		footer.i32(3, repetition)
+		footer.binary(4, column.name)
+		if column.converted >= 0 {
+			footer.i32(6, column.converted)
+		}
+		footer.structEnd()
+	}
+	footer.i64(3, int64(rows))
+	footer.listField(4, thriftStruct, 1)
+	footer.structBegin()
+	footer.listField(1, thriftStruct, len(t.columns))
+	for i, column := range t.columns {
+		footer.structBegin()
+		footer.i64(2, chunks[i].offset)
+		footer.structField(3)
+		footer.i32(1, column.physical)
+		footer.listField(2, thriftI32, 2)
+		footer.listI32(parquetPlain)
+		footer.listI32(parquetRLE)
+		footer.listField(3, thriftBinary, 1)
+		footer.listBinary(column.name)
+		footer.i32(4, codec)
+		footer.i64(5, int64(rows))
+		footer.i64(6, chunks[i].uncompressed)
+		footer.i64(7, chunks[i].compressed)
+		footer.i64(9, chunks[i].offset)
+		footer.structEnd()
+		footer.structEnd()
+	}
+	footer.i64(2, totalSize)
+	footer.i64(3, int64(rows))
+	footer.structEnd()
+	footer.binary(6, "latest-ledger-processor")
+	footer.structEnd()
+
+	out = append(out, footer.buf...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(footer.buf)))
+	return append(out, "PAR1"...), nil
+}
+
+// Thrift compact protocol type identifiers.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes the subset of the Thrift compact protocol needed for
+// Parquet page headers and file metadata. The writer starts inside the
+// top-level struct; structEnd closes it.
+type thriftWriter struct {
+	buf       []byte
+	lastField int16
+	stack     []int16
+}
+
+func (w *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - w.lastField; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.buf = binary.AppendVarint(w.buf, int64(id))
+	}
+	w.lastField = id
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.fieldHeader(id, thriftI32)
+	w.buf = binary.AppendVarint(w.buf, int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.fieldHeader(id, thriftI64)
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.fieldHeader(id, thriftBinary)
+	w.listBinary(s)
+}
+
+// structField starts a struct-typed field; close it with structEnd.
+func (w *thriftWriter) structField(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.structBegin()
+}
+
+// structBegin starts a struct list element; close it with structEnd.
+func (w *thriftWriter) structBegin() {
+	w.stack = append(w.stack, w.lastField)
+	w.lastField = 0
+}
+
+func (w *thriftWriter) structEnd() {
+	w.buf = append(w.buf, 0)
+	if n := len(w.stack); n > 0 {
+		w.lastField = w.stack[n-1]
+		w.stack = w.stack[:n-1]
+	}
+}
+
+// listField starts a list-typed field of size elements, which must follow.
+func (w *thriftWriter) listField(id int16, elemType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf = append(w.buf, byte(size)<<4|elemType)
+	} else {
+		w.buf = append(w.buf, 0xf0|elemType)
+		w.buf = binary.AppendUvarint(w.buf, uint64(size))
+	}
+}
+
+func (w *thriftWriter) listI32(v int32) {
+	w.buf = binary.AppendVarint(w.buf, int64(v))
+}
+
+func (w *thriftWriter) listBinary(s string) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
@@ -0,0 +1,327 @@
+// parquet_test.go
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// thriftReader decodes the Thrift compact protocol into generic values:
+// integers as int64, binaries as strings, lists as []interface{} and
+// structs as maps from field id to value.
+type thriftReader struct {
+	t   *testing.T
+	buf []byte
+}
+
+func (r *thriftReader) byte() byte {
+	if len(r.buf) == 0 {
+		r.t.Fatal("thrift: unexpected end of data")
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.t.Fatal("thrift: bad varint")
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.t.Fatal("thrift: bad varint")
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := r.uvarint()
+		if uint64(len(r.buf)) < n {
+			r.t.Fatal("thrift: binary overruns data")
+		}
+		s := string(r.buf[:n])
+		r.buf = r.buf[n:]
+		return s
+	case thriftList:
+		header := r.byte()
+		size := uint64(header >> 4)
+		if size == 15 {
+			size = r.uvarint()
+		}
+		list := []interface{}{}
+		for i := uint64(0); i < size; i++ {
+			list = append(list, r.value(header&0x0f))
+		}
+		return list
+	case thriftStruct:
+		fields := map[int16]interface{}{}
+		var id int16
+		for {
+			header := r.byte()
+			if header == 0 {
+				return fields
+			}
+			if delta := int16(header >> 4); delta != 0 {
+				id += delta
+			} else {
+				id = int16(r.varint())
+			}
+			fields[id] = r.value(header & 0x0f)
+		}
+	}
+	r.t.Fatalf("thrift: unexpected type %d", typ)
+	return nil
+}
+
+func thriftField(t *testing.T, v interface{}, path ...interface{}) interface{} {
+	t.Helper()
+	for _, step := range path {
+		switch step := step.(type) {
+		case int16:
+			v = v.(map[int16]interface{})[step]
+		case int:
+			v = v.([]interface{})[step]
+		}
+		if v == nil {
+			t.Fatalf("thrift: no value at %v", path)
+		}
+	}
+	return v
+}
+
+type parquetTestRow struct {
+	Sequence uint32    `json:"sequence"`
+	Hash     string    `json:"hash"`
+	Closed   bool      `json:"closed"`
+	Fee      *int64    `json:"fee,omitempty"`
+	Ratio    float64   `json:"ratio"`
+	ClosedAt time.Time `json:"closed_at"`
+	Tags     []string  `json:"tags"`
+}
+
+func TestParquetTableRoundTrip(t *testing.T) {
+	fee := int64(100)
+	closedAt := time.Unix(1_700_000_000, 0)
+	rows := []parquetTestRow{
+		{Sequence: 7, Hash: "aa", Closed: true, Fee: &fee, Ratio: 0.5, ClosedAt: closedAt, Tags: []string{"x"}},
+		{Sequence: 8, Ratio: 1.25, ClosedAt: closedAt.Add(5 * time.Second)},
+	}
+	wantSchema := []string{
+		"network BYTE_ARRAY 0 UTF8",
+		"sequence INT64 0",
+		"hash BYTE_ARRAY 0 UTF8",
+		"closed BOOLEAN 0",
+		"fee INT64 1",
+		"ratio DOUBLE 0",
+		"closed_at INT64 0 TIMESTAMP_MICROS",
+		"tags BYTE_ARRAY 1 UTF8",
+	}
+	wantValues := [][]interface{}{
+		{"testnet", "testnet"},
+		{int64(7), int64(8)},
+		{"aa", ""},
+		{true, false},
+		{int64(100), nil},
+		{0.5, 1.25},
+		{closedAt.UnixMicro(), closedAt.Add(5 * time.Second).UnixMicro()},
+		{`["x"]`, nil},
+	}
+	physicalNames := map[int64]string{parquetBoolean: "BOOLEAN", parquetInt64: "INT64", parquetDouble: "DOUBLE", parquetByteArray: "BYTE_ARRAY"}
+	convertedNames := map[int64]string{parquetUTF8: " UTF8", parquetTimestampMicros: " TIMESTAMP_MICROS"}
+
+	for _, compression := range []string{compressionNone, compressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			table, err := newParquetTable(reflect.TypeOf(parquetTestRow{}), func(s string) string { return s }, parquetConstant{"network", "testnet"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range rows {
+				if err := table.append(row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			data, err := table.encode(compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			n := len(data)
+			if string(data[:4]) != "PAR1" || string(data[n-4:]) != "PAR1" {
+				t.Fatalf("file starts with %q and ends with %q, want the PAR1 magic", data[:4], data[n-4:])
+			}
+			footerLen := int(binary.LittleEndian.Uint32(data[n-8 : n-4]))
+			if footerLen <= 0 || footerLen > n-12 {
+				t.Fatalf("footer length %d of a %d-byte file", footerLen, n)
+			}
+			r := &thriftReader{t: t, buf: data[n-8-footerLen : n-8]}
+			meta := r.value(thriftStruct)
+			if len(r.buf) != 0 {
+				t.Errorf("%d bytes left after the footer", len(r.buf))
+			}
+			if v := thriftField(t, meta, int16(1)); v != int64(1) {
+				t.Errorf("version %v, want 1", v)
+			}
+			if v := thriftField(t, meta, int16(3)); v != int64(2) {
+				t.Errorf("num_rows %v, want 2", v)
+			}
+
+			schema := thriftField(t, meta, int16(2)).([]interface{})
+			if v := thriftField(t, schema, 0, int16(4)); v != "schema" {
+				t.Errorf("root schema element named %v", v)
+			}
+			if v := thriftField(t, schema, 0, int16(5)); v != int64(len(wantSchema)) {
+				t.Errorf("root has %v children, want %d", v, len(wantSchema))
+			}
+			var gotSchema []string
+			for _, element := range schema[1:] {
+				fields := element.(map[int16]interface{})
+				s := fmt.Sprintf("%s %s %d", fields[4], physicalNames[fields[1].(int64)], fields[3])
+				if converted, ok := fields[6]; ok {
+					s += convertedNames[converted.(int64)]
+				}
+				gotSchema = append(gotSchema, s)
+			}
+			if fmt.Sprint(gotSchema) != fmt.Sprint(wantSchema) {
+				t.Errorf("schema %q, want %q", gotSchema, wantSchema)
+			}
+
+			rowGroups := thriftField(t, meta, int16(4)).([]interface{})
+			if len(rowGroups) != 1 || thriftField(t, rowGroups, 0, int16(3)) != int64(2) {
+				t.Fatalf("row groups %v, want one of 2 rows", rowGroups)
+			}
+			chunks := thriftField(t, rowGroups, 0, int16(1)).([]interface{})
+			if len(chunks) != len(wantSchema) {
+				t.Fatalf("%d column chunks, want %d", len(chunks), len(wantSchema))
+			}
+			for i, chunk := range chunks {
+				column := thriftField(t, chunk, int16(3))
+				element := thriftField(t, schema, i+1).(map[int16]interface{})
+				if path := fmt.Sprint(thriftField(t, column, int16(3))); path != fmt.Sprintf("[%s]", element[4]) {
+					t.Errorf("chunk %d has path %s, want [%s]", i, path, element[4])
+				}
+				offset := thriftField(t, column, int16(9)).(int64)
+				if thriftField(t, chunk, int16(2)) != offset {
+					t.Errorf("chunk %d: file_offset differs from data_page_offset %d", i, offset)
+				}
+				if v := thriftField(t, column, int16(5)); v != int64(2) {
+					t.Errorf("chunk %d has %v values, want 2", i, v)
+				}
+				got := readParquetPage(t, data[offset:], element, compression)
+				if fmt.Sprint(got) != fmt.Sprint(wantValues[i]) {
+					t.Errorf("column %d holds %v, want %v", i, got, wantValues[i])
+				}
+			}
+		})
+	}
+}
+
+// readParquetPage decodes the data page at the start of data, returning
+// the value of each row, nil for nulls.
+func readParquetPage(t *testing.T, data []byte, element map[int16]interface{}, compression string) []interface{} {
+	r := &thriftReader{t: t, buf: data}
+	header := r.value(thriftStruct)
+	rows := int(thriftField(t, header, int16(5), int16(1)).(int64))
+	size := int(thriftField(t, header, int16(3)).(int64))
+	page := r.buf[:size]
+	if compression == compressionZstd {
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer decoder.Close()
+		if page, err = decoder.DecodeAll(page, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := int(thriftField(t, header, int16(2)).(int64)); len(page) != want {
+		t.Fatalf("page of %d bytes, header says %d", len(page), want)
+	}
+
+	present := make([]bool, rows)
+	for i := range present {
+		present[i] = true
+	}
+	if element[3] == int64(parquetOptional) {
+		n := binary.LittleEndian.Uint32(page)
+		levels := &thriftReader{t: t, buf: page[4 : 4+n]}
+		if run := levels.uvarint(); run != uint64((rows+7)/8)<<1|1 {
+			t.Fatalf("definition levels run header %d", run)
+		}
+		for i := range present {
+			present[i] = levels.buf[i/8]&(1<<(i%8)) != 0
+		}
+		page = page[4+n:]
+	}
+	values := make([]interface{}, rows)
+	bit := 0
+	for i := range values {
+		if !present[i] {
+			continue
+		}
+		switch element[1] {
+		case int64(parquetBoolean):
+			values[i] = page[bit/8]&(1<<(bit%8)) != 0
+			bit++
+		case int64(parquetInt64):
+			values[i] = int64(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case int64(parquetDouble):
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(page))
+			page = page[8:]
+		case int64(parquetByteArray):
+			n := binary.LittleEndian.Uint32(page)
+			values[i] = string(page[4 : 4+n])
+			page = page[4+n:]
+		}
+	}
+	return values
+}
+
+func TestParquetBatchWriterDropsOldestWhenFull(t *testing.T) {
+	w, err := newParquetBatchWriterFromConfig(map[string]interface{}{"parquet": map[string]interface{}{
+		"path": t.TempDir(), "batch_ledgers": 2, "max_buffered_rows": 3,
+	}}, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &flakyBlobStore{down: true, objects: map[string]string{}}
+	w.store = store
+	for seq := uint32(1); seq <= 5; seq++ {
+		w.add(context.Background(), LatestLedger{Sequence: seq})
+	}
+	if len(w.rows) != 3 || w.rows[0].Sequence != 3 {
+		t.Errorf("buffered %d rows from %d, want 3 from ledger 3", len(w.rows), w.rows[0].Sequence)
+	}
+	store.down = false
+	if err := w.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.objects["ledgers-0000000003-0000000005.parquet"]; !ok || len(store.objects) != 1 {
+		t.Errorf("wrote %v", reflect.ValueOf(store.objects).MapKeys())
+	}
+
+	_, err = newParquetBatchWriterFromConfig(map[string]interface{}{"parquet": map[string]interface{}{
+		"path": t.TempDir(), "batch_ledgers": 10, "max_buffered_rows": 5,
+	}}, "", "", "")
+	if err == nil {
+		t.Error("max_buffered_rows below batch_ledgers accepted")
+	}
+}
@@ -0,0 +1,180 @@
+// parquetbatch.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+)
+
+// Defaults of the parquet config block: roughly an hour of ledgers per file.
+const (
+	defaultParquetBatchLedgers = 720
+	defaultParquetBatchSeconds = 3600
+	defaultParquetMaxBuffered  = 17280
+)
+
+// Supported values for the parquet compression setting.
+const (
+	compressionNone = "none"
+	compressionZstd = "zstd"
+)
+
+// parquetBatchWriter accumulates ledger metrics and writes them as Parquet
+// files, one row per ledger, once a batch is full or old enough.
+type parquetBatchWriter struct {
+	store       blobStore
+	maxLedgers  int
+	maxAge      time.Duration
+	maxBuffered int
+	compression string
+	rename      func(string) string
+	constants   []parquetConstant
+
+	rows    []LatestLedger
+	started time.Time // when the first buffered row was added
+}
+
+// newParquetBatchWriterFromConfig parses the optional parquet config block:
+//
+//	"parquet": {
+//	  "path": "s3://bucket/latest-ledger",
+//	  "batch_ledgers": 720,
+//	  "batch_seconds": 3600,
+//	  "max_buffered_rows": 17280,
+//	  "compression": "zstd"
+//	}
+//
+// The path may be a local directory, s3://bucket/prefix or gs://bucket/prefix.
+// It returns nil when no Parquet output is configured.
+func newParquetBatchWriterFromConfig(config map[string]interface{}, keyCase string, networkPassphrase, network string) (*parquetBatchWriter, error) {
+	raw, ok := config["parquet"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parquet must be an object, got %T", raw)
+	}
+	dest, err := configString(block, "path", "")
+	if err != nil {
+		return nil, fmt.Errorf("parquet: %w", err)
+	}
+	if dest == "" {
+		return nil, fmt.Errorf("parquet: path is required")
+	}
+	maxLedgers, err := configInt(block, "batch_ledgers", defaultParquetBatchLedgers)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: %w", err)
+	}
+	maxSeconds, err := configInt(block, "batch_seconds", defaultParquetBatchSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: %w", err)
+	}
+	if maxLedgers < 1 || maxSeconds < 1 {
+		return nil, fmt.Errorf("parquet: batch_ledgers and batch_seconds must be at least 1")
+	}
+	maxBuffered, err := configInt(block, "max_buffered_rows", defaultParquetMaxBuffered)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: %w", err)
+	}
+	if maxBuffered < maxLedgers {
+		return nil, fmt.Errorf("parquet: max_buffered_rows must be at least batch_ledgers")
+	}
+	compression, err := configString(block, "compression", compressionZstd)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: %w", err)
+	}
+	if compression != compressionNone && compression != compressionZstd {
+		return nil, fmt.Errorf("parquet: compression must be %q or %q, got %q", compressionNone, compressionZstd, compression)
+	}
+	store, err := newBlobStore(dest)
+	if err != nil {
+		return nil, fmt.Errorf("parquet: %w", err)
+	}
+	return &parquetBatchWriter{
+		store:       store,
+		maxLedgers:  maxLedgers,
+		maxAge:      time.Duration(maxSeconds) * time.Second,
+		maxBuffered: maxBuffered,
+		compression: compression,
+		rename:      parquetRename(keyCase),
+		constants:   networkConstants(networkPassphrase, network),
+	}, nil
+}
+
+// parquetRename returns the column naming for a json_key_case setting.
+func parquetRename(keyCase string) func(string) string {
+	if keyCase == keyCaseCamel {
+		return snakeToCamel
+	}
+	return func(s string) string { return s }
+}
+
+// networkConstants returns the network_id, network and schema_version
+// columns added to every Parquet row.
+func networkConstants(networkPassphrase, network string) []parquetConstant {
+	return []parquetConstant{
+		{"network_id", networkIDHex(networkPassphrase)},
+		{"network", network},
+		{"schema_version", outputSchemaVersion},
+	}
+}
+
+// encodeLedgerRows encodes ledger metrics as a Parquet file, one row per
+// ledger.
+func encodeLedgerRows(rows []LatestLedger, rename func(string) string, constants []parquetConstant, compression string) ([]byte, error) {
+	table, err := newParquetTable(reflect.TypeOf(LatestLedger{}), rename, constants...)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if err := table.append(row); err != nil {
+			return nil, err
+		}
+	}
+	return table.encode(compression)
+}
+
+// add buffers a ledger and writes the batch once it is due. A batch that
+// fails to write is kept, up to max_buffered_rows rows, and retried with
+// the next ledger.
+func (w *parquetBatchWriter) add(ctx context.Context, metrics LatestLedger) {
+	if len(w.rows) == 0 {
+		w.started = time.Now()
+	}
+	w.rows = append(w.rows, metrics)
+	if dropped := len(w.rows) - w.maxBuffered; dropped > 0 {
+		log.Printf("Warning: Parquet buffer full, dropping the %d oldest rows", dropped)
+		w.rows = w.rows[dropped:]
+	}
+	if len(w.rows) < w.maxLedgers && time.Since(w.started) < w.maxAge {
+		return
+	}
+	if err := w.flush(ctx); err != nil {
+		log.Printf("Warning: writing Parquet batch of %d ledgers failed: %v", len(w.rows), err)
+	}
+}
+
+// flush writes the buffered ledgers, if any, to a file named after their
+// sequence range.
+func (w *parquetBatchWriter) flush(ctx context.Context) error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	data, err := encodeLedgerRows(w.rows, w.rename, w.constants, w.compression)
+	if err != nil {
+		return err
+	}
+
+	first, last := w.rows[0].Sequence, w.rows[len(w.rows)-1].Sequence
+	name := fmt.Sprintf("ledgers-%010d-%010d.parquet", first, last)
+	if err := w.store.put(ctx, name, data); err != nil {
+		return err
+	}
+	log.Printf("Parquet: wrote %s (%d ledgers, %d bytes)", name, len(w.rows), len(data))
+	w.rows = w.rows[:0]
+	return nil
+}
@@ -0,0 +1,100 @@
+// participants.go
+package main
+
+import (
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// operationAccounts returns the G... addresses an operation touches: its
+// effective source account and the counterparty of operations that move
+// value or change another account. Muxed accounts resolve to their
+// underlying account. The result may contain duplicates.
+func operationAccounts(tx ingest.LedgerTransaction, op xdr.Operation) []string {
+	source := tx.Envelope.SourceAccount()
+	if op.SourceAccount != nil {
+		source = *op.SourceAccount
+	}
+	accounts := []string{muxedAccountID(source)}
+
+	body := op.Body
+	switch body.Type {
+	case xdr.OperationTypeCreateAccount:
+		accounts = append(accounts, body.MustCreateAccountOp().Destination.Address())
+	case xdr.OperationTypePayment:
+		accounts = append(accounts, muxedAccountID(body.MustPaymentOp().Destination))
+	case xdr.OperationTypePathPaymentStrictReceive:
+		accounts = append(accounts, muxedAccountID(body.MustPathPaymentStrictReceiveOp().Destination))
+	case xdr.OperationTypePathPaymentStrictSend:
+		accounts = append(accounts, muxedAccountID(body.MustPathPaymentStrictSendOp().Destination))
+	case xdr.OperationTypeAccountMerge:
+		accounts = append(accounts, muxedAccountID(body.MustDestination()))
+	case xdr.OperationTypeClawback:
+		accounts = append(accounts, muxedAccountID(body.MustClawbackOp().From))
+	case xdr.OperationTypeSetTrustLineFlags:
+		accounts = append(accounts, body.MustSetTrustLineFlagsOp().Trustor.Address())
+	}
+	return accounts
+}
+
+// operationAssets returns the assets an operation references. Liquidity pool
+// shares are not included. The result may contain duplicates.
+func operationAssets(op xdr.Operation) []xdr.Asset {
+	body := op.Body
+	switch body.Type {
+	case xdr.OperationTypePayment:
+		return []xdr.Asset{body.MustPaymentOp().Asset}
+	case xdr.OperationTypePathPaymentStrictReceive:
+		pp := body.MustPathPaymentStrictReceiveOp()
+		return append([]xdr.Asset{pp.SendAsset, pp.DestAsset}, pp.Path...)
+	case xdr.OperationTypePathPaymentStrictSend:
+		pp := body.MustPathPaymentStrictSendOp()
+		return append([]xdr.Asset{pp.SendAsset, pp.DestAsset}, pp.Path...)
+	case xdr.OperationTypeManageSellOffer:
+		offer := body.MustManageSellOfferOp()
+		return []xdr.Asset{offer.Selling, offer.Buying}
+	case xdr.OperationTypeManageBuyOffer:
+		offer := body.MustManageBuyOfferOp()
+		return []xdr.Asset{offer.Selling, offer.Buying}
+	case xdr.OperationTypeCreatePassiveSellOffer:
+		offer := body.MustCreatePassiveSellOfferOp()
+		return []xdr.Asset{offer.Selling, offer.Buying}
+	case xdr.OperationTypeChangeTrust:
+		line := body.MustChangeTrustOp().Line
+		if line.Type == xdr.AssetTypeAssetTypePoolShare {
+			return nil
+		}
+		return []xdr.Asset{line.ToAsset()}
+	case xdr.OperationTypeCreateClaimableBalance:
+		return []xdr.Asset{body.MustCreateClaimableBalanceOp().Asset}
+	case xdr.OperationTypeClawback:
+		return []xdr.Asset{body.MustClawbackOp().Asset}
+	case xdr.OperationTypeSetTrustLineFlags:
+		return []xdr.Asset{body.MustSetTrustLineFlagsOp().Asset}
+	}
+	return nil
+}
+
+// operationContract returns the C... address of the contract an
+// InvokeHostFunction operation invokes, if any.
+func operationContract(op xdr.Operation) (string, bool) {
+	if op.Body.Type != xdr.OperationTypeInvokeHostFunction {
+		return "", false
+	}
+	fn := op.Body.MustInvokeHostFunctionOp().HostFunction
+	if fn.Type != xdr.HostFunctionTypeHostFunctionTypeInvokeContract {
+		return "", false
+	}
+	address, err := fn.MustInvokeContract().ContractAddress.String()
+	if err != nil {
+		return "", false
+	}
+	return address, true
+}
+
+// muxedAccountID returns the G... address underlying a possibly muxed
+// account.
+func muxedAccountID(account xdr.MuxedAccount) string {
+	accountID := account.ToAccountId()
+	return accountID.Address()
+}
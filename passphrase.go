@@ -0,0 +1,118 @@
+// passphrase.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+	"github.com/withObsrvr/pluginapi"
+)
+
+// defaultPassphraseMismatchLedgers is the number of consecutive ledgers in
+// which every transaction hash fails to match before the configured network
+// passphrase is reported as wrong.
+const defaultPassphraseMismatchLedgers = 3
+
+// knownNetworks lists the public networks a mismatched passphrase is checked
+// against.
+var knownNetworks = []struct {
+	name       string
+	passphrase string
+}{
+	{"pubnet", network.PublicNetworkPassphrase},
+	{"testnet", network.TestNetworkPassphrase},
+	{"futurenet", network.FutureNetworkPassphrase},
+}
+
+// ConfigAlert is emitted when the processor detects a configuration problem.
+type ConfigAlert struct {
+	Alert                string `json:"alert"`
+	Message              string `json:"message"`
+	LedgerSequence       uint32 `json:"ledger_sequence"`
+	ConsecutiveLedgers   int    `json:"consecutive_ledgers"`
+	ConfiguredPassphrase string `json:"configured_passphrase"`
+	LikelyNetwork        string `json:"likely_network,omitempty"`
+	LikelyPassphrase     string `json:"likely_passphrase,omitempty"`
+}
+
+// checkPassphrase tracks ledgers in which no transaction hash matched. Once
+// the streak reaches the configured threshold, a single config_alert message
+// naming the likely correct network is emitted. The alert re-arms as soon as
+// a ledger decodes cleanly again.
+func (p *LatestLedgerProcessor) checkPassphrase(ctx context.Context, msg pluginapi.Message, lcm xdr.LedgerCloseMeta, metrics LatestLedger) error {
+	if metrics.TransactionCount == 0 {
+		return nil
+	}
+	if metrics.UnknownTxCount < metrics.TransactionCount {
+		if p.passphraseAlerted {
+			log.Printf("LatestLedgerProcessor: transaction hashes match again in ledger %d, network passphrase mismatch resolved", metrics.Sequence)
+		}
+		p.unknownHashStreak = 0
+		p.passphraseAlerted = false
+		return nil
+	}
+
+	p.unknownHashStreak++
+	if p.passphraseAlerted || p.unknownHashStreak < p.passphraseMismatchLedgers {
+		return nil
+	}
+	p.passphraseAlerted = true
+
+	alert := ConfigAlert{
+		Alert:                "network_passphrase_mismatch",
+		LedgerSequence:       metrics.Sequence,
+		ConsecutiveLedgers:   p.unknownHashStreak,
+		ConfiguredPassphrase: p.networkPassphrase,
+	}
+	if name, passphrase, ok := detectNetwork(lcm); ok {
+		alert.LikelyNetwork = name
+		alert.LikelyPassphrase = passphrase
+		alert.Message = fmt.Sprintf("no transaction hash matched for %d consecutive ledgers; network_passphrase is %q but the ledgers appear to be from %s (%q)",
+			p.unknownHashStreak, p.networkPassphrase, name, passphrase)
+	} else {
+		alert.Message = fmt.Sprintf("no transaction hash matched for %d consecutive ledgers; network_passphrase %q is likely wrong",
+			p.unknownHashStreak, p.networkPassphrase)
+	}
+	log.Printf("CONFIGURATION ALERT: %s (further unknown tx hash warnings suppressed)", alert.Message)
+
+	payload, err := p.encodePayload(alert)
+	if err != nil {
+		return fmt.Errorf("error marshaling config alert: %w", err)
+	}
+	p.forward(ctx, pluginapi.Message{
+		Payload:   payload,
+		Timestamp: msg.Timestamp,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": metrics.Sequence,
+			"source":          "latest-ledger-processor",
+			"data_type":       "config_alert",
+		},
+	})
+	return nil
+}
+
+// detectNetwork finds the known network whose passphrase produces the hash
+// recorded in the ledger's results for one of its transactions.
+func detectNetwork(lcm xdr.LedgerCloseMeta) (string, string, bool) {
+	resultHashes := make(map[xdr.Hash]bool)
+	for i := 0; i < lcm.CountTransactions(); i++ {
+		resultHashes[lcm.TransactionHash(i)] = true
+	}
+	envelopes := lcm.TransactionEnvelopes()
+	if len(envelopes) == 0 {
+		return "", "", false
+	}
+	for _, n := range knownNetworks {
+		hash, err := network.HashTransactionInEnvelope(envelopes[0], n.passphrase)
+		if err != nil {
+			continue
+		}
+		if resultHashes[hash] {
+			return n.name, n.passphrase, true
+		}
+	}
+	return "", "", false
+}
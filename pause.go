@@ -0,0 +1,296 @@
+// pause.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// pausedMessagesFile is the write-ahead log of messages held while paused,
+// kept in state_dir.
+const pausedMessagesFile = "paused_messages.jsonl"
+
+// defaultMaxHeld is the default number of messages held while paused.
+const defaultMaxHeld = 100000
+
+// Supported values for the held_overflow setting.
+const (
+	heldOverflowDropOldest = "drop_oldest"
+	heldOverflowDropNewest = "drop_newest"
+)
+
+// forwardGate holds back forwarded messages while the processor is paused
+// for downstream maintenance. Held messages are kept in order and, when a
+// state directory is configured, appended to a write-ahead log so they
+// survive a restart. At most maxHeld messages are held; beyond that, the
+// overflow policy drops the oldest held message or the new one.
+type forwardGate struct {
+	// processing is held while a message is processed or the buffer is
+	// drained, so that draining never interleaves with new messages.
+	processing sync.Mutex
+
+	maxHeld  int
+	overflow string
+
+	mu       sync.Mutex
+	paused   bool
+	held     []pluginapi.Message
+	dropped  int    // messages dropped since the gate was paused
+	walPath  string // empty when held messages are only kept in memory
+	walLines int    // entries in the write-ahead log, dropped ones included
+}
+
+// walRecord is a held message as stored in the write-ahead log.
+type walRecord struct {
+	Payload   []byte                 `json:"payload"`
+	Timestamp time.Time              `json:"timestamp"`
+	Metadata  map[string]interface{} `json:"metadata"`
+}
+
+// newForwardGateFromConfig returns a gate for the processor, holding up to
+// max_held messages with the held_overflow policy. Messages left in the
+// write-ahead log in stateDir by a previous run are loaded and the gate
+// starts paused, so they are delivered, in order, by the next Resume.
+func newForwardGateFromConfig(config map[string]interface{}, stateDir string) (*forwardGate, error) {
+	maxHeld, err := configInt(config, "max_held", defaultMaxHeld)
+	if err != nil {
+		return nil, err
+	}
+	if maxHeld < 1 {
+		return nil, fmt.Errorf("max_held must be at least 1, got %d", maxHeld)
+	}
+	overflow, err := configString(config, "held_overflow", heldOverflowDropOldest)
+	if err != nil {
+		return nil, err
+	}
+	if overflow != heldOverflowDropOldest && overflow != heldOverflowDropNewest {
+		return nil, fmt.Errorf("held_overflow must be %q or %q, got %q", heldOverflowDropOldest, heldOverflowDropNewest, overflow)
+	}
+	g := &forwardGate{maxHeld: maxHeld, overflow: overflow}
+	if stateDir == "" {
+		return g, nil
+	}
+	g.walPath = filepath.Join(stateDir, pausedMessagesFile)
+
+	data, err := os.ReadFile(g.walPath)
+	if os.IsNotExist(err) {
+		return g, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", g.walPath, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.UseNumber()
+		var record walRecord
+		if err := dec.Decode(&record); err != nil {
+			// A torn last line from a crash mid-append loses only that message.
+			log.Printf("Warning: skipping unreadable entry in %s: %v", g.walPath, err)
+			continue
+		}
+		for k, v := range record.Metadata {
+			record.Metadata[k] = walMetadataValue(v)
+		}
+		g.held = append(g.held, pluginapi.Message{
+			Payload:   record.Payload,
+			Timestamp: record.Timestamp,
+			Metadata:  record.Metadata,
+		})
+		g.walLines++
+	}
+	if len(g.held) == 0 {
+		return g, nil
+	}
+	g.paused = true
+	if excess := len(g.held) - g.maxHeld; excess > 0 {
+		if g.overflow == heldOverflowDropOldest {
+			g.held = g.held[excess:]
+		} else {
+			g.held = g.held[:g.maxHeld]
+		}
+		g.dropped = excess
+		log.Printf("Warning: %s holds more than max_held messages; dropped %d with held_overflow %q", g.walPath, excess, g.overflow)
+	}
+	if g.walLines > len(g.held) {
+		if err := g.rewriteWAL(); err != nil {
+			return nil, fmt.Errorf("error rewriting %s: %w", g.walPath, err)
+		}
+	}
+	log.Printf("Warning: FORWARDING IS PAUSED: %d messages held by a previous run were loaded from %s. "+
+		"No message is forwarded until Resume is called, e.g. with the resume GraphQL mutation or POST /resume in serve; "+
+		"new messages are held, up to max_held (%d). Remove the file before starting to discard them instead.",
+		len(g.held), g.walPath, g.maxHeld)
+	return g, nil
+}
+
+// walMetadataValue restores the integer and float metadata values that JSON
+// decoding turned into json.Number.
+func walMetadataValue(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// hold keeps msg back if the gate is paused. It returns the dispatch
+// outcome of msg, dispatchHeld or, when the gate is full and drops new
+// messages, dispatchDropped, or "" when msg is to be sent.
+func (g *forwardGate) hold(msg pluginapi.Message) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return ""
+	}
+	if len(g.held) >= g.maxHeld {
+		if g.dropped == 0 {
+			log.Printf("Warning: %d messages held while paused, the max_held limit; dropping messages with held_overflow %q until resumed", len(g.held), g.overflow)
+		}
+		g.dropped++
+		if g.overflow == heldOverflowDropNewest {
+			return dispatchDropped
+		}
+		g.held = append(g.held[1:], msg)
+	} else {
+		g.held = append(g.held, msg)
+	}
+	if err := g.appendWAL(msg); err != nil {
+		log.Printf("Warning: writing held message to %s failed, it is only kept in memory: %v", g.walPath, err)
+	}
+	// Dropped messages stay in the log until it is compacted, which
+	// happens once it has twice as many entries as the gate holds.
+	if g.walLines >= 2*g.maxHeld {
+		if err := g.rewriteWAL(); err != nil {
+			log.Printf("Warning: compacting %s failed: %v", g.walPath, err)
+		}
+	}
+	return dispatchHeld
+}
+
+func (g *forwardGate) appendWAL(msg pluginapi.Message) error {
+	if g.walPath == "" {
+		return nil
+	}
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("unsupported payload type %T", msg.Payload)
+	}
+	line, err := json.Marshal(walRecord{Payload: payload, Timestamp: msg.Timestamp, Metadata: msg.Metadata})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(g.walPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	g.walLines++
+	return f.Close()
+}
+
+// rewriteWAL replaces the write-ahead log with the held messages.
+func (g *forwardGate) rewriteWAL() error {
+	if g.walPath == "" {
+		return nil
+	}
+	if err := os.Remove(g.walPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	g.walLines = 0
+	for _, msg := range g.held {
+		if err := g.appendWAL(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pause stops forwarding. Ledgers are still processed, but their messages
+// are held, in order, until Resume is called.
+func (p *LatestLedgerProcessor) Pause() {
+	if p.gate == nil {
+		return
+	}
+	p.gate.mu.Lock()
+	defer p.gate.mu.Unlock()
+	if !p.gate.paused {
+		log.Printf("LatestLedgerProcessor: Paused forwarding")
+	}
+	p.gate.paused = true
+}
+
+// Resume delivers the held messages in order and resumes forwarding. It
+// waits for the ledger being processed, if any. If ctx is cancelled while
+// draining, the undelivered messages stay held and the processor stays
+// paused.
+func (p *LatestLedgerProcessor) Resume(ctx context.Context) error {
+	if p.gate == nil {
+		return nil
+	}
+	p.gate.processing.Lock()
+	defer p.gate.processing.Unlock()
+
+	p.gate.mu.Lock()
+	held, dropped := p.gate.held, p.gate.dropped
+	p.gate.held = nil
+	p.gate.mu.Unlock()
+
+	for i, msg := range held {
+		if err := ctx.Err(); err != nil {
+			p.gate.mu.Lock()
+			defer p.gate.mu.Unlock()
+			p.gate.held = append(held[i:], p.gate.held...)
+			if err := p.gate.rewriteWAL(); err != nil {
+				log.Printf("Warning: rewriting %s failed: %v", p.gate.walPath, err)
+			}
+			return fmt.Errorf("resume interrupted with %d messages held: %w", len(p.gate.held), err)
+		}
+		p.send(ctx, msg)
+	}
+
+	p.gate.mu.Lock()
+	defer p.gate.mu.Unlock()
+	p.gate.paused = false
+	p.gate.dropped = 0
+	if p.gate.walPath != "" {
+		if err := os.Remove(p.gate.walPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %w", p.gate.walPath, err)
+		}
+		p.gate.walLines = 0
+	}
+	if dropped > 0 {
+		log.Printf("Warning: Resumed forwarding after delivering %d held messages; %d messages were dropped while paused", len(held), dropped)
+		return nil
+	}
+	log.Printf("LatestLedgerProcessor: Resumed forwarding after delivering %d held messages", len(held))
+	return nil
+}
+
+// Paused reports whether forwarding is paused.
+func (p *LatestLedgerProcessor) Paused() bool {
+	if p.gate == nil {
+		return false
+	}
+	p.gate.mu.Lock()
+	defer p.gate.mu.Unlock()
+	return p.gate.paused
+}
@@ -0,0 +1,135 @@
+// pause_test.go
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// heldSequences returns the ledger sequences of the held messages.
+func heldSequences(g *forwardGate) []int64 {
+	sequences := make([]int64, 0, len(g.held))
+	for _, msg := range g.held {
+		sequences = append(sequences, msg.Metadata["ledger_sequence"].(int64))
+	}
+	return sequences
+}
+
+func heldMessage(seq int64) pluginapi.Message {
+	return pluginapi.Message{
+		Payload:  []byte(`{}`),
+		Metadata: map[string]interface{}{"data_type": "latest_ledger", "ledger_sequence": seq},
+	}
+}
+
+func TestForwardGateOverflow(t *testing.T) {
+	tests := []struct {
+		overflow string
+		want     []int64
+		outcome  string // of the last message
+	}{
+		{heldOverflowDropOldest, []int64{3, 4, 5}, dispatchHeld},
+		{heldOverflowDropNewest, []int64{1, 2, 3}, dispatchDropped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overflow, func(t *testing.T) {
+			dir := t.TempDir()
+			config := map[string]interface{}{"max_held": 3, "held_overflow": tt.overflow}
+			g, err := newForwardGateFromConfig(config, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g.paused = true
+			var outcome string
+			for seq := int64(1); seq <= 5; seq++ {
+				outcome = g.hold(heldMessage(seq))
+			}
+			if got := heldSequences(g); !equalInt64s(got, tt.want) {
+				t.Errorf("held %v, want %v", got, tt.want)
+			}
+			if outcome != tt.outcome {
+				t.Errorf("outcome of the last message = %q, want %q", outcome, tt.outcome)
+			}
+			if g.dropped != 2 {
+				t.Errorf("dropped = %d, want 2", g.dropped)
+			}
+
+			// A restart loads the same messages from the write-ahead log,
+			// which compaction keeps within twice the limit.
+			data, err := os.ReadFile(filepath.Join(dir, pausedMessagesFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := strings.Count(string(data), "\n"); lines >= 2*3 {
+				t.Errorf("write-ahead log has %d entries, want fewer than %d", lines, 2*3)
+			}
+			restarted, err := newForwardGateFromConfig(config, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !restarted.paused {
+				t.Error("gate with held messages did not start paused")
+			}
+			if got := heldSequences(restarted); !equalInt64s(got, tt.want) {
+				t.Errorf("held after restart %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumeDeliversHeldMessagesInOrder(t *testing.T) {
+	dir := t.TempDir()
+	gate, err := newForwardGateFromConfig(map[string]interface{}{"max_held": 2}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &recordingConsumer{}
+	p := &LatestLedgerProcessor{gate: gate, consumers: []pluginapi.Consumer{recorder}, forwardConcurrency: 1}
+	p.Pause()
+	for seq := int64(1); seq <= 3; seq++ {
+		p.forward(context.Background(), heldMessage(seq))
+	}
+	if len(recorder.sequences()) != 0 {
+		t.Fatalf("messages forwarded while paused: %v", recorder.sequences())
+	}
+	if err := p.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := recorder.sequences(), []int64{2, 3}; !equalInt64s(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, pausedMessagesFile)); !os.IsNotExist(err) {
+		t.Errorf("write-ahead log left after resume: %v", err)
+	}
+	if p.Paused() {
+		t.Error("still paused after resume")
+	}
+}
+
+func TestForwardGateConfig(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{"max_held": 0},
+		{"held_overflow": "block"},
+	} {
+		if _, err := newForwardGateFromConfig(config, ""); err == nil {
+			t.Errorf("config %v accepted", config)
+		}
+	}
+}
+
+func equalInt64s(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
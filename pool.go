@@ -0,0 +1,124 @@
+// pool.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+)
+
+// maxPooledBufferBytes caps the buffers returned to the pools, so a single
+// unusually large ledger does not pin its memory for the life of the process.
+const maxPooledBufferBytes = 1 << 20
+
+// jsonBufferPool holds the buffers JSON payloads are encoded into before
+// they are copied into the payload that leaves the processor. Pools are
+// shared by every processor in the process, so deployments following
+// several networks reuse the same buffers.
+var jsonBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := new(jsonBuffer)
+		b.enc = json.NewEncoder(&b.buf)
+		return b
+	},
+}
+
+// jsonBuffer is a pooled buffer with an encoder writing into it.
+type jsonBuffer struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+// marshalJSONPayload encodes v as JSON, as selected by opts, and splices
+// prefix into its top-level
+// object as withNetworkFields does. The encoding is staged in a pooled
+// buffer, so the returned payload is the only allocation that outlives the
+// call, and it never shares memory with the pool.
+func marshalJSONPayload(v interface{}, opts jsonOptions, prefix []byte) ([]byte, error) {
+	pooled := jsonBufferPool.Get().(*jsonBuffer)
+	defer func() {
+		if pooled.buf.Cap() <= maxPooledBufferBytes {
+			jsonBufferPool.Put(pooled)
+		}
+	}()
+
+	buf := &pooled.buf
+	buf.Reset()
+	if opts.custom() {
+		data, err := opts.appendJSON(buf.AvailableBuffer(), reflect.ValueOf(v))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	} else {
+		// Encode escapes HTML like json.Marshal, but appends a newline.
+		if err := pooled.enc.Encode(v); err != nil {
+			return nil, err
+		}
+		buf.Truncate(buf.Len() - 1)
+	}
+
+	data := buf.Bytes()
+	if len(prefix) == 0 || len(data) < 2 || data[0] != '{' {
+		return bytes.Clone(data), nil
+	}
+	return withNetworkFields(data, prefix), nil
+}
+
+// ledgerScratch holds the intermediate collections built while processing
+// a ledger. They are reset and reused across ledgers instead of being
+// reallocated, which keeps their grown capacity for the next ledger.
+type ledgerScratch struct {
+	feeSample ledgerFeeSample
+	txHashes  []string
+	assets    ledgerAssets
+	contracts ledgerContracts
+	accounts  ledgerAccounts
+}
+
+var ledgerScratchPool = sync.Pool{
+	New: func() interface{} {
+		return &ledgerScratch{
+			assets:    make(ledgerAssets),
+			contracts: make(ledgerContracts),
+			accounts:  make(ledgerAccounts),
+		}
+	},
+}
+
+// getLedgerScratch returns empty scratch collections for a ledger. The
+// caller owns them until release, and nothing built from them may keep a
+// reference past that point.
+func getLedgerScratch() *ledgerScratch {
+	return ledgerScratchPool.Get().(*ledgerScratch)
+}
+
+// release empties the collections and returns them to the pool.
+func (s *ledgerScratch) release() {
+	s.feeSample.feeCharged = s.feeSample.feeCharged[:0]
+	s.feeSample.maxFee = s.feeSample.maxFee[:0]
+	clear(s.txHashes)
+	s.txHashes = s.txHashes[:0]
+	clear(s.assets)
+	clear(s.contracts)
+	clear(s.accounts)
+	ledgerScratchPool.Put(s)
+}
+
+// int64SlicePool holds the slices fee distributions are gathered into.
+var int64SlicePool = sync.Pool{
+	New: func() interface{} { return new([]int64) },
+}
+
+func getInt64Slice() *[]int64 {
+	s := int64SlicePool.Get().(*[]int64)
+	*s = (*s)[:0]
+	return s
+}
+
+func putInt64Slice(s *[]int64) {
+	if cap(*s)*8 <= maxPooledBufferBytes {
+		int64SlicePool.Put(s)
+	}
+}
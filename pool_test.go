@@ -0,0 +1,214 @@
+// pool_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+	"github.com/withObsrvr/pluginapi"
+)
+
+// testLedger returns a ledger closing closeTime seconds after the epoch
+// with txCount successful single-payment transactions, each bidding a
+// different fee so that fee distributions are gathered.
+func testLedger(t testing.TB, passphrase string, seq uint32, closeTime int64, txCount int) xdr.LedgerCloseMeta {
+	t.Helper()
+	source := xdr.MustMuxedAddress(keypair.MustRandom().Address())
+	destination := xdr.MustMuxedAddress(keypair.MustRandom().Address())
+	lcm := xdr.LedgerCloseMeta{V: 0, V0: &xdr.LedgerCloseMetaV0{
+		LedgerHeader: xdr.LedgerHeaderHistoryEntry{Header: xdr.LedgerHeader{
+			LedgerVersion: 21,
+			LedgerSeq:     xdr.Uint32(seq),
+			ScpValue:      xdr.StellarValue{CloseTime: xdr.TimePoint(closeTime)},
+			TotalCoins:    1_000_000_000_000,
+			BaseFee:       100,
+			BaseReserve:   5_000_000,
+		}},
+	}}
+	for i := 0; i < txCount; i++ {
+		envelope := xdr.TransactionEnvelope{
+			Type: xdr.EnvelopeTypeEnvelopeTypeTx,
+			V1: &xdr.TransactionV1Envelope{Tx: xdr.Transaction{
+				SourceAccount: source,
+				Fee:           xdr.Uint32(100 + i),
+				SeqNum:        xdr.SequenceNumber(int64(seq)<<32 + int64(i)),
+				Cond:          xdr.Preconditions{Type: xdr.PreconditionTypePrecondNone},
+				Operations: []xdr.Operation{{Body: xdr.OperationBody{
+					Type:      xdr.OperationTypePayment,
+					PaymentOp: &xdr.PaymentOp{Destination: destination, Asset: xdr.MustNewNativeAsset(), Amount: 10_000_000},
+				}}},
+			}},
+		}
+		hash, err := network.HashTransactionInEnvelope(envelope, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lcm.V0.TxSet.Txs = append(lcm.V0.TxSet.Txs, envelope)
+		lcm.V0.TxProcessing = append(lcm.V0.TxProcessing, xdr.TransactionResultMeta{
+			Result: xdr.TransactionResultPair{
+				TransactionHash: hash,
+				Result: xdr.TransactionResult{
+					FeeCharged: 100,
+					Result: xdr.TransactionResultResult{
+						Code: xdr.TransactionResultCodeTxSuccess,
+						Results: &[]xdr.OperationResult{{
+							Code: xdr.OperationResultCodeOpInner,
+							Tr: &xdr.OperationResultTr{
+								Type:          xdr.OperationTypePayment,
+								PaymentResult: &xdr.PaymentResult{Code: xdr.PaymentResultCodePaymentSuccess},
+							},
+						}},
+					},
+				},
+			},
+			TxApplyProcessing: xdr.TransactionMeta{V: 2, V2: &xdr.TransactionMetaV2{Operations: make([]xdr.OperationMeta, 1)}},
+		})
+	}
+	return lcm
+}
+
+// newTestProcessor returns a processor emitting fee stats, so every pooled
+// path is used, delivering to a recording consumer.
+func newTestProcessor(t testing.TB, passphrase string) (*LatestLedgerProcessor, *recordingConsumer) {
+	t.Helper()
+	p, err := NewLatestLedgerProcessor(map[string]interface{}{
+		"network_passphrase": passphrase,
+		"emit_fee_stats":     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &recordingConsumer{}
+	p.RegisterConsumer(recorder)
+	return p, recorder
+}
+
+// The constructors of the pools, kept to replace the pools with empty ones.
+var (
+	jsonBufferNew    = jsonBufferPool.New
+	ledgerScratchNew = ledgerScratchPool.New
+	int64SliceNew    = int64SlicePool.New
+)
+
+// emptyPools replaces the pools with empty ones, so the values handed out
+// next are newly allocated, as if there were no pooling.
+func emptyPools() {
+	jsonBufferPool = sync.Pool{New: jsonBufferNew}
+	ledgerScratchPool = sync.Pool{New: ledgerScratchNew}
+	int64SlicePool = sync.Pool{New: int64SliceNew}
+}
+
+func BenchmarkProcessLedger(b *testing.B) {
+	passphrase := network.PublicNetworkPassphrase
+	ledgers := make([]xdr.LedgerCloseMeta, 64)
+	for i := range ledgers {
+		ledgers[i] = testLedger(b, passphrase, uint32(1000+i), int64(5*i), 200)
+	}
+	run := func(b *testing.B, pooled bool) {
+		p, recorder := newTestProcessor(b, passphrase)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if !pooled {
+				emptyPools()
+			}
+			if err := p.Process(context.Background(), pluginapi.Message{Payload: ledgers[i%len(ledgers)]}); err != nil {
+				b.Fatal(err)
+			}
+			if i%len(ledgers) == len(ledgers)-1 {
+				recorder.reset()
+			}
+		}
+	}
+	b.Run("pooled", func(b *testing.B) { run(b, true) })
+	b.Run("unpooled", func(b *testing.B) {
+		defer emptyPools()
+		run(b, false)
+	})
+}
+
+// TestProcessConcurrentPooling processes ledgers of several networks at
+// once, and concurrently on one processor, so that pooled scratch
+// collections and fee slices are handed between goroutines. Run it with
+// -race; any sharing shows up as a race or as metrics of another ledger.
+func TestProcessConcurrentPooling(t *testing.T) {
+	passphrases := []string{network.PublicNetworkPassphrase, network.TestNetworkPassphrase, "Custom Network ; 2026"}
+	const ledgersPerNetwork = 20
+
+	var wg sync.WaitGroup
+	for n, passphrase := range passphrases {
+		p, recorder := newTestProcessor(t, passphrase)
+		ledgers := make([]xdr.LedgerCloseMeta, ledgersPerNetwork)
+		for i := range ledgers {
+			// Transaction counts differ between ledgers and networks, so a
+			// scratch collection leaking between them changes the counts.
+			ledgers[i] = testLedger(t, passphrase, uint32(100+i), int64(5*i), 1+n*7+i%5)
+		}
+		// Two goroutines share each processor; Process serializes them.
+		for g := 0; g < 2; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := g; i < len(ledgers); i += 2 {
+					if err := p.Process(context.Background(), pluginapi.Message{Payload: ledgers[i]}); err != nil {
+						t.Error(err)
+					}
+				}
+			}(g)
+		}
+		t.Cleanup(func() {
+			checkConcurrentOutput(t, passphrase, recorder, ledgers)
+		})
+	}
+	wg.Wait()
+}
+
+// checkConcurrentOutput checks that every latest_ledger and fee_stats
+// message carries the transaction count and fees of its own ledger.
+func checkConcurrentOutput(t *testing.T, passphrase string, recorder *recordingConsumer, ledgers []xdr.LedgerCloseMeta) {
+	t.Helper()
+	want := make(map[uint32]int, len(ledgers))
+	for _, lcm := range ledgers {
+		want[uint32(lcm.V0.LedgerHeader.Header.LedgerSeq)] = len(lcm.V0.TxSet.Txs)
+	}
+	seen := make(map[string]int)
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, msg := range recorder.messages {
+		dataType := fmt.Sprint(msg.Metadata["data_type"])
+		switch dataType {
+		case "latest_ledger":
+			var ledger struct {
+				Sequence         uint32 `json:"sequence"`
+				TransactionCount int    `json:"transaction_count"`
+			}
+			if err := json.Unmarshal(msg.Payload.([]byte), &ledger); err != nil {
+				t.Fatal(err)
+			}
+			if ledger.TransactionCount != want[ledger.Sequence] {
+				t.Errorf("%s ledger %d: transaction_count %d, want %d", passphrase, ledger.Sequence, ledger.TransactionCount, want[ledger.Sequence])
+			}
+		case "fee_stats":
+			var stats struct {
+				LastLedger string `json:"last_ledger"`
+			}
+			if err := json.Unmarshal(msg.Payload.([]byte), &stats); err != nil {
+				t.Fatal(err)
+			}
+			var seq uint32
+			if _, err := fmt.Sscan(stats.LastLedger, &seq); err != nil || want[seq] == 0 {
+				t.Errorf("%s: fee_stats of unknown ledger %q", passphrase, stats.LastLedger)
+			}
+		}
+		seen[dataType]++
+	}
+	if seen["latest_ledger"] != len(ledgers) || seen["fee_stats"] != len(ledgers) {
+		t.Errorf("%s: %d latest_ledger and %d fee_stats messages, want %d of each", passphrase, seen["latest_ledger"], seen["fee_stats"], len(ledgers))
+	}
+}
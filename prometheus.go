@@ -0,0 +1,185 @@
+// prometheus.go
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Defaults of the telemetry prometheus block.
+const (
+	defaultPrometheusListenAddress = ":9464"
+	defaultPrometheusPath          = "/metrics"
+)
+
+// prometheusTelemetryExporter serves the latest telemetry values on an HTTP
+// endpoint for Prometheus to scrape. Gauges keep the value of the most
+// recent ledger; counters accumulate the exported deltas.
+type prometheusTelemetryExporter struct {
+	server   *http.Server
+	registry *prometheus.Registry
+
+	mu     sync.Mutex
+	series map[string]*prometheusSeries // by name and labels
+}
+
+// prometheusSeries is a single time series.
+type prometheusSeries struct {
+	name   string
+	kind   telemetryKind
+	labels []string // sorted label names
+	values []string // label values, in the order of labels
+	value  float64
+}
+
+// newPrometheusTelemetryExporter parses the telemetry prometheus block:
+//
+//	"prometheus": {"listen_address": ":9464", "path": "/metrics"}
+//
+// The listener is opened here, so an address in use fails the config
+// rather than the first scrape.
+func newPrometheusTelemetryExporter(block map[string]interface{}) (telemetryExporter, error) {
+	address, err := configString(block, "listen_address", defaultPrometheusListenAddress)
+	if err != nil {
+		return nil, err
+	}
+	path, err := configString(block, "path", defaultPrometheusPath)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("path must start with /, got %q", path)
+	}
+
+	e := &prometheusTelemetryExporter{
+		registry: prometheus.NewRegistry(),
+		series:   make(map[string]*prometheusSeries),
+	}
+	if err := e.registry.Register(e); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, e.serveMetrics)
+	e.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := e.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Warning: prometheus exporter stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving Prometheus metrics on %s%s", listener.Addr(), path)
+	return e, nil
+}
+
+// Export records the values of a batch. Resource attributes and point
+// attributes become labels.
+func (e *prometheusTelemetryExporter) Export(batch telemetryBatch) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, point := range batch.Points {
+		labels := make(map[string]string, len(batch.Attributes)+len(point.Attributes))
+		for k, v := range batch.Attributes {
+			labels[prometheusName(k)] = v
+		}
+		for k, v := range point.Attributes {
+			labels[prometheusName(k)] = v
+		}
+		name := prometheusName(point.Name)
+		if point.Kind == telemetryCounter {
+			name += "_total"
+		}
+
+		s := &prometheusSeries{name: name, kind: point.Kind}
+		for k := range labels {
+			s.labels = append(s.labels, k)
+		}
+		sort.Strings(s.labels)
+		key := name
+		for _, k := range s.labels {
+			s.values = append(s.values, labels[k])
+			key += "\x00" + k + "=" + labels[k]
+		}
+
+		if existing, ok := e.series[key]; ok {
+			s = existing
+		} else {
+			e.series[key] = s
+		}
+		if point.Kind == telemetryCounter {
+			s.value += point.Value
+		} else {
+			s.value = point.Value
+		}
+	}
+	return nil
+}
+
+// Describe sends no descriptors, which makes the exporter an unchecked
+// collector: the metrics it exports are only known once ledgers arrive.
+func (e *prometheusTelemetryExporter) Describe(chan<- *prometheus.Desc) {}
+
+// Collect sends the current value of every series.
+func (e *prometheusTelemetryExporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range e.series {
+		valueType := prometheus.GaugeValue
+		if s.kind == telemetryCounter {
+			valueType = prometheus.CounterValue
+		}
+		desc := prometheus.NewDesc(s.name, "Latest ledger processor metric "+s.name+".", s.labels, nil)
+		metric, err := prometheus.NewConstMetric(desc, valueType, s.value, s.values...)
+		if err != nil {
+			log.Printf("Warning: skipping prometheus metric %s: %v", s.name, err)
+			continue
+		}
+		ch <- metric
+	}
+}
+
+// serveMetrics writes the gathered metrics in the text exposition format.
+func (e *prometheusTelemetryExporter) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	families, err := e.registry.Gather()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	format := expfmt.NewFormat(expfmt.TypeTextPlain)
+	w.Header().Set("Content-Type", string(format))
+	enc := expfmt.NewEncoder(w, format)
+	for _, family := range families {
+		if err := enc.Encode(family); err != nil {
+			log.Printf("Warning: error writing prometheus metrics: %v", err)
+			return
+		}
+	}
+}
+
+func (e *prometheusTelemetryExporter) Close() error {
+	return e.server.Close()
+}
+
+// prometheusName replaces the characters Prometheus does not allow in
+// metric and label names, such as the dots of namespaces and of OpenTelemetry
+// attribute names, with underscores.
+func prometheusName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= '0' && c <= '9' && i > 0) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,228 @@
+// rawderived.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Supported values of the latest_ledger_output setting.
+const (
+	ledgerOutputCombined = "combined"
+	ledgerOutputSplit    = "split"
+)
+
+// LatestLedgerRaw holds the ledger metrics read straight from the ledger's
+// XDR: header values, counts, fee totals and distributions. It is emitted
+// as latest_ledger_raw when latest_ledger_output is split.
+type LatestLedgerRaw struct {
+	Sequence                 uint32    `json:"sequence"`
+	Hash                     string    `json:"hash"`
+	ClosedAt                 time.Time `json:"closed_at"`
+	ClosedAtEpochSeconds     *int64    `json:"closed_at_epoch_seconds,omitempty"`
+	ClosedAtEpochMillis      *int64    `json:"closed_at_epoch_ms,omitempty"`
+	BaseFee                  uint32    `json:"base_fee"`
+	TransactionCount         int       `json:"transaction_count"`
+	TxSetOperationCount      int       `json:"tx_set_operation_count"`
+	SuccessfulOperationCount int       `json:"successful_operation_count"`
+	SuccessfulTxCount        int       `json:"successful_tx_count"`
+	FailedTxCount            int       `json:"failed_tx_count"`
+	SkippedTxCount           int       `json:"skipped_tx_count"`
+	UnknownTxCount           int       `json:"unknown_tx_count"`
+	TotalFeeCharged          int64     `json:"total_fee_charged"`
+	ClassicFees              int64     `json:"classic_fees"`
+	SorobanInclusionFees     int64     `json:"soroban_inclusion_fees"`
+	SorobanResourceFees      int64     `json:"soroban_resource_fees"`
+	FeePool                  int64     `json:"fee_pool"`
+	TotalCoins               int64     `json:"total_coins"`
+	LargeBatchTxCount        int       `json:"large_batch_tx_count"`
+
+	OpsPerTx         OpsPerTxDistribution        `json:"ops_per_tx"`
+	BaseFeeMultiples BaseFeeMultipleDistribution `json:"base_fee_multiples"`
+	FeeAttribution   FeeAttribution              `json:"fee_attribution"`
+
+	SorobanTxCount              int                    `json:"soroban_tx_count"`
+	TotalSorobanFees            int64                  `json:"total_soroban_fees"`
+	TotalResourceInstructions   uint64                 `json:"total_resource_instructions"`
+	TotalResourceReadBytes      uint64                 `json:"total_resource_read_bytes"`
+	TotalResourceWriteBytes     uint64                 `json:"total_resource_write_bytes"`
+	SorobanInstructionHistogram []HistogramBucket      `json:"soroban_instruction_histogram"`
+	SorobanByOutcome            SorobanOutcomeTotals   `json:"soroban_by_outcome"`
+	SorobanState                SorobanState           `json:"soroban_state"`
+	SorobanAuthExpiration       *SorobanAuthExpiration `json:"soroban_auth_expiration,omitempty"`
+
+	SponsoredReservesCreated int               `json:"sponsored_reserves_created"`
+	SponsoredReservesRemoved int               `json:"sponsored_reserves_removed"`
+	ConfigChanges            ConfigChanges     `json:"config_changes"`
+	ManageData               ManageDataMetrics `json:"manage_data"`
+	Sequences                SequenceMetrics   `json:"sequences"`
+	MuxedAccountUsage        MuxedAccountUsage `json:"muxed_account_usage"`
+	Memos                    MemoMetrics       `json:"memos"`
+	Clawbacks                *ClawbackMetrics  `json:"clawbacks,omitempty"`
+	Watched                  []WatchBreakdown  `json:"watched,omitempty"`
+
+	// Filtered operation counts, set when an operation filter is configured
+	Filtered *FilteredOperationTotals `json:"filtered,omitempty"`
+}
+
+// FilteredOperationTotals are the operation counts of FilteredOperationCounts.
+type FilteredOperationTotals struct {
+	TxSetOperationCount      int `json:"tx_set_operation_count"`
+	SuccessfulOperationCount int `json:"successful_operation_count"`
+}
+
+// LatestLedgerDerived holds the metrics the processor computes from the raw
+// ones, earlier ledgers or network limits: rates, ratios, deltas,
+// utilization and windowed detections. It is emitted as
+// latest_ledger_derived when latest_ledger_output is split, and shares the
+// sequence, hash and close time of its latest_ledger_raw message.
+type LatestLedgerDerived struct {
+	Sequence uint32    `json:"sequence"`
+	Hash     string    `json:"hash"`
+	ClosedAt time.Time `json:"closed_at"`
+
+	TransactionsPerSecond         float64  `json:"transactions_per_second"`
+	FilteredTransactionsPerSecond *float64 `json:"filtered_transactions_per_second,omitempty"`
+	AvgFeePerOperation            float64  `json:"avg_fee_per_operation"`
+	LargeBatchOperationShare      float64  `json:"large_batch_operation_share"`
+
+	FeePoolDelta    *int64           `json:"fee_pool_delta,omitempty"`
+	TotalCoinsDelta *int64           `json:"total_coins_delta,omitempty"`
+	Consensus       *ConsensusTiming `json:"consensus,omitempty"`
+
+	SorobanInstructionUtilization *float64   `json:"soroban_instruction_utilization,omitempty"`
+	SorobanReadBytesUtilization   *float64   `json:"soroban_read_bytes_utilization,omitempty"`
+	SorobanWriteBytesUtilization  *float64   `json:"soroban_write_bytes_utilization,omitempty"`
+	SorobanTxCountUtilization     *float64   `json:"soroban_tx_count_utilization,omitempty"`
+	WorkShare                     *WorkShare `json:"work_share,omitempty"`
+
+	NewAssets        []string `json:"new_assets,omitempty"`
+	DuplicateTxCount *int     `json:"duplicate_tx_count,omitempty"`
+}
+
+// configLedgerOutput parses the latest_ledger_output setting, which selects
+// whether ledger metrics are emitted as one latest_ledger message or split
+// into latest_ledger_raw and latest_ledger_derived messages.
+func configLedgerOutput(config map[string]interface{}) (bool, error) {
+	output, err := configString(config, "latest_ledger_output", ledgerOutputCombined)
+	if err != nil {
+		return false, err
+	}
+	switch output {
+	case ledgerOutputCombined:
+		return false, nil
+	case ledgerOutputSplit:
+		return true, nil
+	}
+	return false, fmt.Errorf("latest_ledger_output must be %q or %q, got %q", ledgerOutputCombined, ledgerOutputSplit, output)
+}
+
+// splitLedgerMetrics divides ledger metrics into their raw and derived
+// parts. The parts share no memory with metrics.
+func splitLedgerMetrics(metrics LatestLedger) (LatestLedgerRaw, LatestLedgerDerived) {
+	m := metrics.Clone()
+	raw := LatestLedgerRaw{
+		Sequence:                    m.Sequence,
+		Hash:                        m.Hash,
+		ClosedAt:                    m.ClosedAt,
+		ClosedAtEpochSeconds:        m.ClosedAtEpochSeconds,
+		ClosedAtEpochMillis:         m.ClosedAtEpochMillis,
+		BaseFee:                     m.BaseFee,
+		TransactionCount:            m.TransactionCount,
+		TxSetOperationCount:         m.TxSetOperationCount,
+		SuccessfulOperationCount:    m.SuccessfulOperationCount,
+		SuccessfulTxCount:           m.SuccessfulTxCount,
+		FailedTxCount:               m.FailedTxCount,
+		SkippedTxCount:              m.SkippedTxCount,
+		UnknownTxCount:              m.UnknownTxCount,
+		TotalFeeCharged:             m.TotalFeeCharged,
+		ClassicFees:                 m.ClassicFees,
+		SorobanInclusionFees:        m.SorobanInclusionFees,
+		SorobanResourceFees:         m.SorobanResourceFees,
+		FeePool:                     m.FeePool,
+		TotalCoins:                  m.TotalCoins,
+		LargeBatchTxCount:           m.LargeBatchTxCount,
+		OpsPerTx:                    m.OpsPerTx,
+		BaseFeeMultiples:            m.BaseFeeMultiples,
+		FeeAttribution:              m.FeeAttribution,
+		SorobanTxCount:              m.SorobanTxCount,
+		TotalSorobanFees:            m.TotalSorobanFees,
+		TotalResourceInstructions:   m.TotalResourceInstructions,
+		TotalResourceReadBytes:      m.TotalResourceReadBytes,
+		TotalResourceWriteBytes:     m.TotalResourceWriteBytes,
+		SorobanInstructionHistogram: m.SorobanInstructionHistogram,
+		SorobanByOutcome:            m.SorobanByOutcome,
+		SorobanState:                m.SorobanState,
+		SorobanAuthExpiration:       m.SorobanAuthExpiration,
+		SponsoredReservesCreated:    m.SponsoredReservesCreated,
+		SponsoredReservesRemoved:    m.SponsoredReservesRemoved,
+		ConfigChanges:               m.ConfigChanges,
+		ManageData:                  m.ManageData,
+		Sequences:                   m.Sequences,
+		MuxedAccountUsage:           m.MuxedAccountUsage,
+		Memos:                       m.Memos,
+		Clawbacks:                   m.Clawbacks,
+		Watched:                     m.Watched,
+	}
+	derived := LatestLedgerDerived{
+		Sequence:                      m.Sequence,
+		Hash:                          m.Hash,
+		ClosedAt:                      m.ClosedAt,
+		TransactionsPerSecond:         m.TransactionsPerSecond,
+		AvgFeePerOperation:            m.AvgFeePerOperation,
+		LargeBatchOperationShare:      m.LargeBatchOperationShare,
+		FeePoolDelta:                  m.FeePoolDelta,
+		TotalCoinsDelta:               m.TotalCoinsDelta,
+		Consensus:                     m.Consensus,
+		SorobanInstructionUtilization: m.SorobanInstructionUtilization,
+		SorobanReadBytesUtilization:   m.SorobanReadBytesUtilization,
+		SorobanWriteBytesUtilization:  m.SorobanWriteBytesUtilization,
+		SorobanTxCountUtilization:     m.SorobanTxCountUtilization,
+		WorkShare:                     m.WorkShare,
+		NewAssets:                     m.NewAssets,
+		DuplicateTxCount:              m.DuplicateTxCount,
+	}
+	if m.Filtered != nil {
+		raw.Filtered = &FilteredOperationTotals{
+			TxSetOperationCount:      m.Filtered.TxSetOperationCount,
+			SuccessfulOperationCount: m.Filtered.SuccessfulOperationCount,
+		}
+		tps := m.Filtered.TransactionsPerSecond
+		derived.FilteredTransactionsPerSecond = &tps
+	}
+	return raw, derived
+}
+
+// forwardSplitLedger emits the metrics of a ledger as a latest_ledger_raw
+// message followed by a latest_ledger_derived message. The raw message
+// carries the metadata of the latest_ledger message it replaces, such as
+// skip reasons and raw XDR.
+func (p *LatestLedgerProcessor) forwardSplitLedger(ctx context.Context, ledgerMsg pluginapi.Message, metrics LatestLedger) error {
+	raw, derived := splitLedgerMetrics(metrics)
+
+	rawPayload, err := p.encodePayload(raw)
+	if err != nil {
+		return fmt.Errorf("error marshaling raw ledger metrics: %w", err)
+	}
+	derivedPayload, err := p.encodePayload(derived)
+	if err != nil {
+		return fmt.Errorf("error marshaling derived ledger metrics: %w", err)
+	}
+
+	ledgerMsg.Payload = rawPayload
+	ledgerMsg.Metadata["data_type"] = "latest_ledger_raw"
+	p.forward(ctx, ledgerMsg)
+	p.forward(ctx, pluginapi.Message{
+		Payload:   derivedPayload,
+		Timestamp: ledgerMsg.Timestamp,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": metrics.Sequence,
+			"source":          "latest-ledger-processor",
+			"data_type":       "latest_ledger_derived",
+		},
+	})
+	return nil
+}
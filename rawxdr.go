@@ -0,0 +1,50 @@
+// rawxdr.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/xdr"
+)
+
+// Supported values of the attach_raw_xdr setting.
+const (
+	rawXDRNone   = "none"
+	rawXDRHeader = "header"
+	rawXDRLedger = "ledger"
+)
+
+// configRawXDR parses the attach_raw_xdr setting, which selects the raw XDR
+// attached to the metadata of latest_ledger messages.
+func configRawXDR(config map[string]interface{}) (string, error) {
+	mode, err := configString(config, "attach_raw_xdr", rawXDRNone)
+	if err != nil {
+		return "", err
+	}
+	switch mode {
+	case rawXDRNone, rawXDRHeader, rawXDRLedger:
+		return mode, nil
+	}
+	return "", fmt.Errorf("attach_raw_xdr must be %q, %q or %q, got %q", rawXDRNone, rawXDRHeader, rawXDRLedger, mode)
+}
+
+// attachRawXDR adds the base64 XDR of the ledger, or of its header, to
+// message metadata, for downstream processors that decode raw ledgers
+// themselves.
+func (p *LatestLedgerProcessor) attachRawXDR(metadata map[string]interface{}, lcm xdr.LedgerCloseMeta) error {
+	switch p.rawXDR {
+	case rawXDRHeader:
+		header, err := xdr.MarshalBase64(lcm.LedgerHeaderHistoryEntry())
+		if err != nil {
+			return fmt.Errorf("error encoding ledger header: %w", err)
+		}
+		metadata["ledger_header_xdr"] = header
+	case rawXDRLedger:
+		meta, err := xdr.MarshalBase64(lcm)
+		if err != nil {
+			return fmt.Errorf("error encoding ledger close meta: %w", err)
+		}
+		metadata["ledger_close_meta_xdr"] = meta
+	}
+	return nil
+}
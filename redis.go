@@ -0,0 +1,299 @@
+// redis.go
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Defaults of the redis config block.
+const (
+	defaultRedisURL            = "redis://127.0.0.1:6379"
+	defaultRedisTimeoutSeconds = 10
+)
+
+// redisCache keeps the payload of the most recent ledger in a Redis key,
+// and optionally publishes it to a channel, so APIs can serve current
+// network stats with a single GET. It is dispatched to like a registered
+// consumer and ignores messages other than latest_ledger.
+type redisCache struct {
+	addr     string
+	tls      bool
+	username string
+	password string
+	db       int
+	key      string
+	channel  string // "" when nothing is published
+	ttl      int    // key expiry in seconds, 0 for none
+	dataType string // data_type of the messages cached
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	latest uint64 // highest ledger sequence written
+}
+
+// newRedisCacheFromConfig parses the optional redis config block:
+//
+//	"redis": {
+//	  "url": "redis://:password@127.0.0.1:6379/0",
+//	  "key": "latest_ledger:pubnet",
+//	  "channel": "latest_ledger",
+//	  "ttl_seconds": 0,
+//	  "timeout_seconds": 10
+//	}
+//
+// The key defaults to the data_type followed by the network name. It
+// returns nil when no Redis output is configured.
+func newRedisCacheFromConfig(config map[string]interface{}, network, namespace string) (*redisCache, error) {
+	raw, ok := config["redis"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis must be an object, got %T", raw)
+	}
+	rawURL, err := configString(block, "url", defaultRedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Hostname() == "" {
+		return nil, fmt.Errorf("redis: invalid url %q, want redis://host:port/db", rawURL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	db := 0
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if db, err = strconv.Atoi(path); err != nil || db < 0 {
+			return nil, fmt.Errorf("redis: invalid database %q in url", path)
+		}
+	}
+
+	dataType := namespace + "latest_ledger"
+	defaultKey := dataType
+	if network != "" {
+		defaultKey += ":" + network
+	}
+	key, err := configString(block, "key", defaultKey)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("redis: key must not be empty")
+	}
+	channel, err := configString(block, "channel", "")
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	ttl, err := configInt(block, "ttl_seconds", 0)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("redis: ttl_seconds must not be negative")
+	}
+	timeoutSeconds, err := configInt(block, "timeout_seconds", defaultRedisTimeoutSeconds)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	if timeoutSeconds < 1 {
+		return nil, fmt.Errorf("redis: timeout_seconds must be at least 1")
+	}
+	password, _ := u.User.Password()
+	return &redisCache{
+		addr:     addr,
+		tls:      u.Scheme == "rediss",
+		username: u.User.Username(),
+		password: password,
+		db:       db,
+		key:      key,
+		channel:  channel,
+		ttl:      ttl,
+		dataType: dataType,
+		timeout:  time.Duration(timeoutSeconds) * time.Second,
+	}, nil
+}
+
+// Name identifies the cache in logs and dispatch reports.
+func (r *redisCache) Name() string {
+	return "redis"
+}
+
+// Process stores the payload of a latest_ledger message under the key and
+// publishes it to the channel. Messages of an older ledger than the one
+// stored, such as reprocessed corrections, are skipped so the key always
+// holds the most recent ledger.
+func (r *redisCache) Process(ctx context.Context, msg pluginapi.Message) error {
+	if msg.Metadata["data_type"] != r.dataType {
+		return nil
+	}
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("unsupported payload type %T", msg.Payload)
+	}
+	seq, _ := strconv.ParseUint(fmt.Sprint(msg.Metadata["ledger_sequence"]), 10, 64)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if seq < r.latest {
+		return nil
+	}
+	set := []string{"SET", r.key, string(payload)}
+	if r.ttl > 0 {
+		set = append(set, "EX", strconv.Itoa(r.ttl))
+	}
+	commands := [][]string{set}
+	if r.channel != "" {
+		commands = append(commands, []string{"PUBLISH", r.channel, string(payload)})
+	}
+	// A broken connection is retried once on a new one; error replies
+	// are not.
+	var replyErr redisError
+	err := r.do(commands...)
+	if err != nil && !errors.As(err, &replyErr) {
+		r.disconnect()
+		err = r.do(commands...)
+		if err != nil && !errors.As(err, &replyErr) {
+			r.disconnect()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	r.latest = seq
+	return nil
+}
+
+// do sends the commands in one pipeline, connecting first if needed, and
+// reads their replies.
+func (r *redisCache) do(commands ...[]string) error {
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return err
+		}
+	}
+	return r.roundTrip(commands...)
+}
+
+// connect opens a connection, authenticates and selects the database.
+func (r *redisCache) connect() error {
+	dialer := &net.Dialer{Timeout: r.timeout}
+	var conn net.Conn
+	var err error
+	if r.tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.addr, nil)
+	} else {
+		conn, err = dialer.Dial("tcp", r.addr)
+	}
+	if err != nil {
+		return err
+	}
+	r.conn, r.reader = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	switch {
+	case r.username != "" && r.password != "":
+		setup = append(setup, []string{"AUTH", r.username, r.password})
+	case r.password != "":
+		setup = append(setup, []string{"AUTH", r.password})
+	}
+	if r.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(r.db)})
+	}
+	if len(setup) > 0 {
+		if err := r.roundTrip(setup...); err != nil {
+			r.disconnect()
+			return err
+		}
+	}
+	return nil
+}
+
+// roundTrip writes the commands as RESP arrays of bulk strings and reads
+// one reply per command, returning the first error reply.
+func (r *redisCache) roundTrip(commands ...[]string) error {
+	if err := r.conn.SetDeadline(time.Now().Add(r.timeout)); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(r.conn)
+	for _, args := range commands {
+		fmt.Fprintf(w, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	var replyErr error
+	for _, args := range commands {
+		if err := r.readReply(); err != nil {
+			if _, ok := err.(redisError); !ok {
+				return err
+			}
+			if replyErr == nil {
+				replyErr = fmt.Errorf("%s: %w", args[0], err)
+			}
+		}
+	}
+	return replyErr
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// readReply reads a reply, which for the commands sent is a simple string,
+// an error or an integer.
+func (r *redisCache) readReply() error {
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return fmt.Errorf("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return redisError(line[1:])
+	default:
+		return fmt.Errorf("unexpected reply %q", line)
+	}
+}
+
+func (r *redisCache) disconnect() {
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn, r.reader = nil, nil
+	}
+}
+
+// Close closes the connection.
+func (r *redisCache) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.disconnect()
+	return nil
+}
@@ -0,0 +1,81 @@
+// redis_test.go
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+func redisTestMessage(seq uint32, payload string) pluginapi.Message {
+	return pluginapi.Message{
+		Payload:  []byte(payload),
+		Metadata: map[string]interface{}{"data_type": "latest_ledger", "ledger_sequence": seq},
+	}
+}
+
+func TestRedisCacheCommands(t *testing.T) {
+	addr, done := serveScript(t, textWire,
+		"*3\r\n$4\r\nAUTH\r\n$1\r\nu\r\n$1\r\np\r\n"+
+			"*2\r\n$6\r\nSELECT\r\n$1\r\n2\r\n",
+		"+OK\r\n+OK\r\n",
+		"*5\r\n$3\r\nSET\r\n$6\r\nlatest\r\n$9\r\n{\"seq\":6}\r\n$2\r\nEX\r\n$2\r\n60\r\n"+
+			"*3\r\n$7\r\nPUBLISH\r\n$6\r\nledger\r\n$9\r\n{\"seq\":6}\r\n",
+		"+OK\r\n:1\r\n",
+	)
+	r, err := newRedisCacheFromConfig(map[string]interface{}{
+		"redis": map[string]interface{}{
+			"url":         "redis://u:p@" + addr + "/2",
+			"key":         "latest",
+			"channel":     "ledger",
+			"ttl_seconds": 60,
+		},
+	}, "pubnet", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.Process(context.Background(), redisTestMessage(6, `{"seq":6}`)); err != nil {
+		t.Fatal(err)
+	}
+	// An older ledger, such as a correction, and other messages are not
+	// written.
+	if err := r.Process(context.Background(), redisTestMessage(5, `{"seq":5}`)); err != nil {
+		t.Fatal(err)
+	}
+	other := redisTestMessage(7, `{}`)
+	other.Metadata["data_type"] = "fee_stats"
+	if err := r.Process(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	<-done
+}
+
+func TestRedisCacheErrorReply(t *testing.T) {
+	addr, done := serveScript(t, textWire,
+		"*3\r\n$3\r\nSET\r\n$20\r\nlatest_ledger:pubnet\r\n$2\r\n{}\r\n",
+		"-OOM command not allowed\r\n",
+	)
+	r, err := newRedisCacheFromConfig(map[string]interface{}{
+		"redis": map[string]interface{}{"url": "redis://" + addr},
+	}, "pubnet", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Error replies are returned without retrying on a new connection.
+	err = r.Process(context.Background(), redisTestMessage(6, `{}`))
+	if err == nil || !strings.Contains(err.Error(), "SET: OOM command not allowed") {
+		t.Errorf("Process = %v, want the error reply", err)
+	}
+	if r.latest != 0 {
+		t.Errorf("latest = %d after a failed write, want 0", r.latest)
+	}
+	r.Close()
+	<-done
+}
@@ -0,0 +1,108 @@
+// reprocess.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// ReprocessSequence recomputes the metrics of a single ledger from the
+// configured archive and re-emits them to all downstream consumers and
+// processors with the "correction" metadata flag set. It lets data-quality
+// teams fix individual bad rows without a full backfill.
+//
+// Reprocessing is idempotent and leaves the live processor state untouched:
+// the ledger is recomputed by a fresh processor built from the same config,
+// primed with the preceding ledger so that TPS and header deltas match what
+// the live pipeline would have produced.
+func (p *LatestLedgerProcessor) ReprocessSequence(ctx context.Context, seq uint32) error {
+	if p.archive == nil {
+		return fmt.Errorf("cannot reprocess ledger %d: no archive configured", seq)
+	}
+	if seq < 2 {
+		return fmt.Errorf("cannot reprocess ledger %d: sequence must be at least 2", seq)
+	}
+
+	source, err := p.archive.open(ctx)
+	if err != nil {
+		return fmt.Errorf("error opening archive: %w", err)
+	}
+	defer source.Close()
+
+	if err := source.PrepareRange(ctx, seq-1, seq); err != nil {
+		return fmt.Errorf("error preparing ledgers %d-%d: %w", seq-1, seq, err)
+	}
+	previous, err := source.GetLedger(ctx, seq-1)
+	if err != nil {
+		return fmt.Errorf("error getting ledger %d: %w", seq-1, err)
+	}
+	current, err := source.GetLedger(ctx, seq)
+	if err != nil {
+		return fmt.Errorf("error getting ledger %d: %w", seq, err)
+	}
+
+	// The replay processor shares the live processor's config, except for
+	// telemetry, since corrections are not live measurements, the Parquet
+	// output, which corrections are not appended to, and the state
+	// directory, file sink, InfluxDB, Postgres, ClickHouse and object storage
+	// writers, history store and built-in sinks, which belong to the live
+	// processor and are shared below rather than opened again.
+	replayConfig := make(map[string]interface{}, len(p.config))
+	for k, v := range p.config {
+		if k != "telemetry" && k != "parquet" && k != "state_dir" && k != "file_sink" && k != "influxdb" && k != "postgres" && k != "clickhouse" && k != "object_storage" && k != "history_store" && !builtinSinkSettings[k] {
+			replayConfig[k] = v
+		}
+	}
+	replay, err := NewLatestLedgerProcessor(replayConfig)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// What is shared stays open for the live processor; Close releases
+		// only what the replay processor opened itself.
+		replay.fileSink, replay.outputs = nil, nil
+		replay.influx, replay.postgres, replay.clickhouse = nil, nil, nil
+		replay.history = nil
+		if err := replay.Close(); err != nil {
+			log.Printf("Warning: closing the replay processor of ledger %d: %v", seq, err)
+		}
+	}()
+	replay.correction = true
+	replay.backfill = nil
+	// Windowed state belongs to the live stream and cannot be rebuilt for a
+	// single past ledger.
+	replay.newAssets = nil
+	replay.duplicates = nil
+	replay.hotKeys = nil
+	replay.feeSurge = nil
+	replay.activity = nil
+	replay.firstSeen = nil
+	// Corrections are emitted as single latest_ledger messages rather than
+	// blocks or batches.
+	replay.ledgerBlocks = nil
+	replay.jsonLines = nil
+
+	// Prime the replay processor with the previous ledger without emitting it.
+	if err := replay.Process(ctx, pluginapi.Message{Payload: previous}); err != nil {
+		return fmt.Errorf("error priming with ledger %d: %w", seq-1, err)
+	}
+
+	log.Printf("LatestLedgerProcessor: Reprocessing ledger %d as a correction", seq)
+	replay.consumers = p.consumers
+	replay.processors = p.processors
+	replay.fileSink = p.fileSink
+	replay.outputs = p.outputs
+	// The corrected point replaces the original, which has the same series
+	// and timestamp.
+	replay.influx = p.influx
+	// Corrected rows replace the originals, keyed by their sequence.
+	replay.postgres = p.postgres
+	replay.clickhouse = p.clickhouse
+	replay.history = p.history
+	// Corrections are held like live messages while forwarding is paused.
+	replay.gate = p.gate
+	return replay.Process(ctx, pluginapi.Message{Payload: current})
+}
@@ -0,0 +1,78 @@
+// routing.go
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultTopicTemplate routes every message to a topic named after its
+// data_type.
+const defaultTopicTemplate = "{data_type}"
+
+// batchDataTypes are the data types of batched messages, whose payloads
+// are not one of the payloadTypes.
+var batchDataTypes = map[string]bool{
+	"ledger_block":        true,
+	"latest_ledger_batch": true,
+}
+
+// topicRouter derives the topic, or routing key, of forwarded messages
+// from their data_type, so generic Kafka, NATS or AMQP consumers can route
+// messages without knowing their types.
+type topicRouter struct {
+	template string
+	network  string
+	topics   map[string]string // per data_type overrides of the template
+}
+
+// newTopicRouterFromConfig parses the optional routing config block:
+//
+//	"routing": {
+//	  "template": "stellar.{network}.{data_type}",
+//	  "topics": {"ledger_transaction": "stellar.transactions"}
+//	}
+//
+// It returns nil when no routing metadata is added.
+func newTopicRouterFromConfig(config map[string]interface{}, network string) (*topicRouter, error) {
+	raw, ok := config["routing"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("routing must be an object, got %T", raw)
+	}
+	template, err := configString(block, "template", defaultTopicTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("routing: %w", err)
+	}
+	if template == "" {
+		return nil, fmt.Errorf("routing: template must not be empty")
+	}
+	topics, err := configStringMap(block, "topics")
+	if err != nil {
+		return nil, fmt.Errorf("routing: %w", err)
+	}
+	for dataType, topic := range topics {
+		if _, ok := payloadTypes[dataType]; !ok && !batchDataTypes[dataType] {
+			return nil, fmt.Errorf("routing: unknown data type %q in topics", dataType)
+		}
+		if topic == "" {
+			return nil, fmt.Errorf("routing: topic of %s must not be empty", dataType)
+		}
+	}
+	return &topicRouter{template: template, network: network, topics: topics}, nil
+}
+
+// topic returns the topic of a message. dataType is the message's own
+// data type; namespaced is its data_type as forwarded, with any namespace.
+func (r *topicRouter) topic(dataType, namespaced string) string {
+	if topic, ok := r.topics[dataType]; ok {
+		return topic
+	}
+	return strings.NewReplacer(
+		"{network}", r.network,
+		"{data_type}", namespaced,
+	).Replace(r.template)
+}
@@ -0,0 +1,169 @@
+// rpcsource.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/stellar/go/xdr"
+)
+
+const (
+	// rpcPageSize is the number of ledgers requested per getLedgers call.
+	rpcPageSize = 100
+	// rpcPollInterval is how long the source waits before asking again for
+	// a ledger that has not closed yet.
+	rpcPollInterval = time.Second
+	// rpcRequestTimeout bounds a single JSON-RPC call; pages of ledger
+	// metadata can be several megabytes.
+	rpcRequestTimeout = 60 * time.Second
+)
+
+// rpcSource reads ledgers from the getLedgers method of a stellar-rpc
+// server. Ledgers are fetched a page at a time, and a ledger that has not
+// closed yet is waited for, so an unbounded range follows the network. RPC
+// servers only keep a retention window of recent ledgers; older ones must
+// come from a ledger export archive.
+type rpcSource struct {
+	url    string
+	client *http.Client
+	to     uint32 // last ledger of the prepared range; 0 when unbounded
+	latest uint32 // latest ledger of the server at the last call
+
+	first uint32                // sequence of page[0]
+	page  []xdr.LedgerCloseMeta // fetched ledgers
+}
+
+func newRPCSource(url string) *rpcSource {
+	return &rpcSource{url: url, client: &http.Client{Timeout: rpcRequestTimeout}}
+}
+
+func (s *rpcSource) PrepareRange(ctx context.Context, from, to uint32) error {
+	s.to = to
+	return nil
+}
+
+func (s *rpcSource) GetLedger(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error) {
+	if sequence >= s.first && int(sequence-s.first) < len(s.page) {
+		return s.page[sequence-s.first], nil
+	}
+	for sequence > s.latest {
+		var latest struct {
+			Sequence uint32 `json:"sequence"`
+		}
+		if err := s.call(ctx, "getLatestLedger", nil, &latest); err != nil {
+			return xdr.LedgerCloseMeta{}, err
+		}
+		if s.latest = latest.Sequence; sequence <= s.latest {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return xdr.LedgerCloseMeta{}, ctx.Err()
+		case <-time.After(rpcPollInterval):
+		}
+	}
+
+	limit := uint32(rpcPageSize)
+	if s.to != 0 && s.to >= sequence && s.to-sequence+1 < limit {
+		limit = s.to - sequence + 1
+	}
+	params := map[string]interface{}{
+		"startLedger": sequence,
+		"pagination":  map[string]interface{}{"limit": limit},
+	}
+	var result struct {
+		Ledgers []struct {
+			Sequence    uint32 `json:"sequence"`
+			MetadataXDR string `json:"metadataXdr"`
+		} `json:"ledgers"`
+		LatestLedger uint32 `json:"latestLedger"`
+	}
+	if err := s.call(ctx, "getLedgers", params, &result); err != nil {
+		return xdr.LedgerCloseMeta{}, err
+	}
+	s.latest = result.LatestLedger
+	page := make([]xdr.LedgerCloseMeta, len(result.Ledgers))
+	for i, ledger := range result.Ledgers {
+		if ledger.Sequence != sequence+uint32(i) {
+			return xdr.LedgerCloseMeta{}, fmt.Errorf("getLedgers returned ledger %d, want %d", ledger.Sequence, sequence+uint32(i))
+		}
+		if err := xdr.SafeUnmarshalBase64(ledger.MetadataXDR, &page[i]); err != nil {
+			return xdr.LedgerCloseMeta{}, fmt.Errorf("error decoding ledger %d: %w", ledger.Sequence, err)
+		}
+	}
+	if len(page) == 0 {
+		return xdr.LedgerCloseMeta{}, fmt.Errorf("getLedgers returned no ledgers from %d", sequence)
+	}
+	s.first, s.page = sequence, page
+	return page[0], nil
+}
+
+func (s *rpcSource) Close() error {
+	s.page = nil
+	return nil
+}
+
+// health returns the oldest and latest ledgers the server holds.
+func (s *rpcSource) health(ctx context.Context) (oldest, latest uint32, err error) {
+	var result struct {
+		Status       string `json:"status"`
+		OldestLedger uint32 `json:"oldestLedger"`
+		LatestLedger uint32 `json:"latestLedger"`
+	}
+	if err := s.call(ctx, "getHealth", nil, &result); err != nil {
+		return 0, 0, err
+	}
+	if result.Status != "healthy" {
+		return 0, 0, fmt.Errorf("server status is %q", result.Status)
+	}
+	return result.OldestLedger, result.LatestLedger, nil
+}
+
+// call makes a JSON-RPC 2.0 request and decodes its result into result.
+func (s *rpcSource) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	request := map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method}
+	if params != nil {
+		request["params"] = params
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s: %s", method, resp.Status, bytes.TrimSpace(msg))
+	}
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("%s: error decoding response: %w", method, err)
+	}
+	if response.Error != nil {
+		return fmt.Errorf("%s: %s (%d)", method, response.Error.Message, response.Error.Code)
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("%s: error decoding result: %w", method, err)
+	}
+	return nil
+}
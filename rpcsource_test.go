@@ -0,0 +1,138 @@
+// rpcsource_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+)
+
+// fakeRPC serves getLatestLedger, getLedgers and getHealth over the ledgers
+// from oldest to latest. Each getLatestLedger call closes one more ledger,
+// up to last.
+type fakeRPC struct {
+	t      *testing.T
+	mu     sync.Mutex
+	oldest uint32
+	latest uint32
+	last   uint32
+	limits []int // limit of each getLedgers call
+}
+
+func (f *fakeRPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		Params  struct {
+			StartLedger uint32 `json:"startLedger"`
+			Pagination  struct {
+				Limit int `json:"limit"`
+			} `json:"pagination"`
+		} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.JSONRPC != "2.0" || r.Header.Get("Content-Type") != "application/json" {
+		f.t.Errorf("bad request %+v: %v", req, err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var result interface{}
+	switch req.Method {
+	case "getLatestLedger":
+		if f.latest < f.last {
+			f.latest++
+		}
+		result = map[string]interface{}{"id": "x", "protocolVersion": 22, "sequence": f.latest}
+	case "getHealth":
+		result = map[string]interface{}{"status": "healthy", "oldestLedger": f.oldest, "latestLedger": f.latest}
+	case "getLedgers":
+		start := req.Params.StartLedger
+		if start < f.oldest || start > f.latest {
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"start ledger must be between the oldest ledger: %d and the latest ledger: %d"}}`, f.oldest, f.latest)
+			return
+		}
+		f.limits = append(f.limits, req.Params.Pagination.Limit)
+		var ledgers []map[string]interface{}
+		for seq := start; seq <= f.latest && len(ledgers) < req.Params.Pagination.Limit; seq++ {
+			meta, err := xdr.MarshalBase64(testLedger(f.t, network.TestNetworkPassphrase, seq, 1_700_000_000+int64(seq)*5, 1))
+			if err != nil {
+				f.t.Fatal(err)
+			}
+			ledgers = append(ledgers, map[string]interface{}{"sequence": seq, "metadataXdr": meta})
+		}
+		result = map[string]interface{}{"ledgers": ledgers, "latestLedger": f.latest, "oldestLedger": f.oldest}
+	default:
+		f.t.Errorf("unexpected method %q", req.Method)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": result})
+}
+
+func TestRPCSourcePagesAndWaitsForNewLedgers(t *testing.T) {
+	rpc := &fakeRPC{t: t, oldest: 10, latest: 12, last: 14}
+	server := httptest.NewServer(rpc)
+	defer server.Close()
+
+	s := newRPCSource(server.URL)
+	defer s.Close()
+	if err := s.PrepareRange(context.Background(), 11, 14); err != nil {
+		t.Fatal(err)
+	}
+	for seq := uint32(11); seq <= 14; seq++ {
+		lcm, err := s.GetLedger(context.Background(), seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lcm.LedgerSequence() != seq {
+			t.Errorf("GetLedger(%d) returned ledger %d", seq, lcm.LedgerSequence())
+		}
+	}
+	// 11 to 13 come in one page, requested up to the end of the range; 14
+	// is waited for and fetched once it closes.
+	if fmt.Sprint(rpc.limits) != "[4 1]" {
+		t.Errorf("getLedgers limits %v, want [4 1]", rpc.limits)
+	}
+
+	// Ledgers outside the retention window are errors.
+	s = newRPCSource(server.URL)
+	if _, err := s.GetLedger(context.Background(), 5); err == nil || !strings.Contains(err.Error(), "between the oldest ledger: 10") {
+		t.Errorf("GetLedger(5) = %v, want the RPC error", err)
+	}
+}
+
+func TestRPCSourceCancelledWhileWaiting(t *testing.T) {
+	rpc := &fakeRPC{t: t, oldest: 10, latest: 12, last: 12}
+	server := httptest.NewServer(rpc)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := newRPCSource(server.URL).GetLedger(ctx, 13); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetLedger of an unclosed ledger = %v, want the context error", err)
+	}
+}
+
+func TestRPCArchiveProbe(t *testing.T) {
+	rpc := &fakeRPC{t: t, oldest: 10, latest: 12, last: 12}
+	server := httptest.NewServer(rpc)
+	defer server.Close()
+
+	archive, err := parseArchiveBlock(map[string]interface{}{"type": "RPC", "url": server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.probe(context.Background(), 11); err != nil {
+		t.Errorf("probe(11) = %v", err)
+	}
+	if err := archive.probe(context.Background(), 9); err == nil {
+		t.Error("probe accepted a ledger outside the retention window")
+	}
+}
@@ -0,0 +1,236 @@
+// scheduler.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Kinds of scheduled reports.
+const (
+	reportSummary = "summary"
+	reportHealth  = "health"
+)
+
+// ScheduledReport is emitted at the times of a configured schedule,
+// independent of ledger arrival, so reports built from it line up on wall
+// clock boundaries.
+type ScheduledReport struct {
+	Schedule    string    `json:"schedule"`
+	Report      string    `json:"report"`       // summary or health
+	ScheduledAt time.Time `json:"scheduled_at"` // the schedule time, not when the report was built
+
+	LatestSequence *uint32    `json:"latest_sequence,omitempty"`  // omitted before the first ledger
+	LatestClosedAt *time.Time `json:"latest_closed_at,omitempty"` // omitted before the first ledger
+
+	// Summary reports: aggregates over the last last_n processed ledgers
+	// (omitted without processed ledgers)
+	Stats *LedgerStats `json:"stats,omitempty"`
+
+	// Health reports
+	SecondsSinceLatestClose *float64 `json:"seconds_since_latest_close,omitempty"` // omitted before the first ledger
+	Paused                  *bool    `json:"paused,omitempty"`
+}
+
+// scheduledJob is one entry of the schedules config.
+type scheduledJob struct {
+	name     string
+	report   string
+	schedule *cronSchedule
+	lastN    int
+}
+
+// scheduler runs the configured jobs in the background once the processor
+// is initialized.
+type scheduler struct {
+	jobs     []scheduledJob
+	location *time.Location
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// newSchedulerFromConfig parses the optional schedules config list:
+//
+//	"schedules": [
+//	  {"name": "hourly-summary", "cron": "0 * * * *", "report": "summary", "last_n": 720},
+//	  {"name": "health", "cron": "*/5 * * * *", "report": "health"}
+//	]
+//
+// Cron expressions are evaluated in UTC unless schedule_timezone names an
+// IANA time zone. It returns nil when no schedules are configured.
+func newSchedulerFromConfig(config map[string]interface{}) (*scheduler, error) {
+	raw, ok := config["schedules"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	entries, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schedules must be a list, got %T", raw)
+	}
+	timezone, err := configString(config, "schedule_timezone", "UTC")
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("schedule_timezone: %w", err)
+	}
+
+	s := &scheduler{location: location}
+	names := make(map[string]bool)
+	for i, entry := range entries {
+		block, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("schedules[%d] must be an object, got %T", i, entry)
+		}
+		job, err := parseScheduledJob(block)
+		if err != nil {
+			return nil, fmt.Errorf("schedules[%d]: %w", i, err)
+		}
+		if names[job.name] {
+			return nil, fmt.Errorf("schedules[%d]: duplicate name %q", i, job.name)
+		}
+		names[job.name] = true
+		s.jobs = append(s.jobs, job)
+	}
+	if len(s.jobs) == 0 {
+		return nil, nil
+	}
+	return s, nil
+}
+
+func parseScheduledJob(block map[string]interface{}) (scheduledJob, error) {
+	var job scheduledJob
+	expr, err := configString(block, "cron", "")
+	if err != nil {
+		return job, err
+	}
+	if expr == "" {
+		return job, fmt.Errorf("cron is required")
+	}
+	if job.schedule, err = parseCron(expr); err != nil {
+		return job, err
+	}
+	if job.name, err = configString(block, "name", expr); err != nil {
+		return job, err
+	}
+	if job.report, err = configString(block, "report", reportSummary); err != nil {
+		return job, err
+	}
+	if job.report != reportSummary && job.report != reportHealth {
+		return job, fmt.Errorf("report must be %q or %q, got %q", reportSummary, reportHealth, job.report)
+	}
+	// By default, summaries cover every ledger retained for the stats query.
+	if job.lastN, err = configInt(block, "last_n", math.MaxInt32); err != nil {
+		return job, err
+	}
+	if job.lastN < 1 {
+		return job, fmt.Errorf("last_n must be at least 1, got %d", job.lastN)
+	}
+	return job, nil
+}
+
+// startScheduler starts the background scheduler, if configured. It is
+// called once the processor has its final address, since scheduled reports
+// are forwarded to the consumers registered on it.
+func (p *LatestLedgerProcessor) startScheduler() {
+	s := p.scheduler
+	if s == nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		for {
+			now := time.Now().In(s.location)
+			var due time.Time
+			for _, job := range s.jobs {
+				if next := job.schedule.next(now); !next.IsZero() && (due.IsZero() || next.Before(due)) {
+					due = next
+				}
+			}
+			if due.IsZero() {
+				return
+			}
+			timer := time.NewTimer(time.Until(due))
+			select {
+			case <-s.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			for _, job := range s.jobs {
+				if job.schedule.next(due.Add(-time.Minute)).Equal(due) {
+					p.emitScheduledReport(job, due)
+				}
+			}
+		}
+	}()
+}
+
+// stopScheduler stops the background scheduler and waits for a report
+// being emitted.
+func (p *LatestLedgerProcessor) stopScheduler() {
+	if p.scheduler == nil || p.scheduler.stop == nil {
+		return
+	}
+	close(p.scheduler.stop)
+	<-p.scheduler.done
+	p.scheduler.stop = nil
+}
+
+// emitScheduledReport forwards the report of a job for the schedule time
+// at. Ledger processing is held off meanwhile, so downstream plugins never
+// receive messages concurrently.
+func (p *LatestLedgerProcessor) emitScheduledReport(job scheduledJob, at time.Time) {
+	p.gate.processing.Lock()
+	defer p.gate.processing.Unlock()
+
+	report := ScheduledReport{
+		Schedule:    job.name,
+		Report:      job.report,
+		ScheduledAt: at.UTC(),
+	}
+	latest, ok := p.LatestSnapshot()
+	if ok {
+		report.LatestSequence = &latest.Sequence
+		closedAt := latest.ClosedAt
+		report.LatestClosedAt = &closedAt
+	}
+	switch job.report {
+	case reportSummary:
+		if stats, ok := p.Stats(job.lastN); ok {
+			report.Stats = &stats
+		}
+	case reportHealth:
+		if ok {
+			since := at.Sub(latest.ClosedAt).Seconds()
+			report.SecondsSinceLatestClose = &since
+		}
+		paused := p.Paused()
+		report.Paused = &paused
+	}
+
+	payload, err := p.encodePayload(report)
+	if err != nil {
+		log.Printf("Warning: marshaling scheduled report %s failed: %v", job.name, err)
+		return
+	}
+	p.forward(context.Background(), pluginapi.Message{
+		Payload:   payload,
+		Timestamp: at,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": latest.Sequence,
+			"source":          "latest-ledger-processor",
+			"data_type":       "scheduled_report",
+			"schedule":        job.name,
+			"scheduled_at":    at.UTC().Format(time.RFC3339),
+		},
+	})
+}
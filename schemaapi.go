@@ -9,3 +9,17 @@ type SchemaProvider interface {
 	// GetQueryDefinitions returns GraphQL query definitions for this plugin
 	GetQueryDefinitions() string
 }
+
+// MutationProvider is implemented by plugins that also provide GraphQL
+// mutations
+type MutationProvider interface {
+	// GetMutationDefinitions returns GraphQL mutation definitions for this plugin
+	GetMutationDefinitions() string
+}
+
+// OutputSchemaProvider is implemented by plugins that describe their output
+// payloads with a JSON Schema document
+type OutputSchemaProvider interface {
+	// GetOutputSchema returns the JSON Schema of the plugin's output payloads
+	GetOutputSchema() string
+}
@@ -0,0 +1,129 @@
+// schemaregistry.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaRegistryTimeout bounds each request to the schema registry.
+const schemaRegistryTimeout = 10 * time.Second
+
+// schemaRegistryMagic starts every payload in the Confluent wire format,
+// followed by the 4-byte big-endian schema ID.
+const schemaRegistryMagic = 0
+
+// schemaRegistry registers the Avro schemas of emitted payloads in a
+// Confluent-compatible Schema Registry. Subjects follow the
+// RecordNameStrategy: the fully qualified record name, such as
+// io.withobsrvr.latestledger.LatestLedger, so every data_type has its own
+// subject regardless of the topic it is written to.
+type schemaRegistry struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+
+	mu  sync.Mutex
+	ids map[string]uint32 // schema ID per subject
+}
+
+// newSchemaRegistryFromConfig parses the optional schema_registry config
+// block:
+//
+//	"schema_registry": {"url": "https://registry:8081", "username": "key", "password": "secret"}
+//
+// The credentials are optional. It returns nil when no registry is
+// configured.
+func newSchemaRegistryFromConfig(config map[string]interface{}) (*schemaRegistry, error) {
+	raw, ok := config["schema_registry"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema_registry must be an object, got %T", raw)
+	}
+	registryURL, err := configString(block, "url", "")
+	if err != nil {
+		return nil, fmt.Errorf("schema_registry: %w", err)
+	}
+	if registryURL == "" {
+		return nil, fmt.Errorf("schema_registry: url is required")
+	}
+	username, err := configString(block, "username", "")
+	if err != nil {
+		return nil, fmt.Errorf("schema_registry: %w", err)
+	}
+	password, err := configString(block, "password", "")
+	if err != nil {
+		return nil, fmt.Errorf("schema_registry: %w", err)
+	}
+	return &schemaRegistry{
+		url:      strings.TrimRight(registryURL, "/"),
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: schemaRegistryTimeout},
+		ids:      make(map[string]uint32),
+	}, nil
+}
+
+// schemaID returns the ID of schema under subject, registering it on first
+// use. Registering a schema that is already registered returns its existing
+// ID, so restarts and replicas agree on IDs.
+func (r *schemaRegistry) schemaID(subject, schema string) (uint32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id, ok := r.ids[subject]; ok {
+		return id, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.url+"/subjects/"+url.PathEscape(subject)+"/versions", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("schema registry: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, fmt.Errorf("schema registry: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("schema registry: registering %s: %s: %s", subject, resp.Status, strings.TrimSpace(string(data)))
+	}
+	var registered struct {
+		ID uint32 `json:"id"`
+	}
+	if err := json.Unmarshal(data, &registered); err != nil {
+		return 0, fmt.Errorf("schema registry: decoding response: %w", err)
+	}
+	r.ids[subject] = registered.ID
+	return registered.ID, nil
+}
+
+// frameSchemaPayload prefixes an Avro datum with the wire format header.
+func frameSchemaPayload(id uint32, datum []byte) []byte {
+	buf := make([]byte, 5, 5+len(datum))
+	buf[0] = schemaRegistryMagic
+	binary.BigEndian.PutUint32(buf[1:], id)
+	return append(buf, datum...)
+}
@@ -0,0 +1,196 @@
+// schemaversion.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+)
+
+// outputSchemaVersion is the version of the emitted payloads, written to
+// every payload as schema_version and to the message metadata. It is
+// major.minor:
+//
+//   - a minor version only adds fields, or new message types;
+//   - anything else (removing or renaming a field, changing its type or
+//     meaning, or making a field optional) requires a new major version.
+//
+// Consumers that ignore unknown fields can therefore accept every payload
+// with a known major version.
+const outputSchemaVersion = "1.0"
+
+// jsonSchemaDialect is the JSON Schema draft of the output schemas.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// GetOutputSchema returns a JSON Schema document describing the
+// latest_ledger JSON payloads emitted with the processor's config.
+func (p *LatestLedgerProcessor) GetOutputSchema() string {
+	schema, err := p.OutputSchema("latest_ledger")
+	if err != nil {
+		log.Printf("Warning: generating the output schema failed: %v", err)
+		return ""
+	}
+	return schema
+}
+
+// OutputSchema returns a JSON Schema document describing the JSON payloads
+// of the given data_type. It follows the processor's key casing, field
+// selection and int64_as_string settings. Objects allow additional
+// properties, so a document for one minor version also validates payloads
+// of later minor versions.
+func (p *LatestLedgerProcessor) OutputSchema(dataType string) (string, error) {
+	t, ok := payloadTypes[dataType]
+	if !ok {
+		return "", fmt.Errorf("unknown data type %q", dataType)
+	}
+	g := &jsonSchemaGenerator{keyCase: p.keyCase, int64Strings: p.int64Strings, timeFormat: p.timeFormat, defs: make(map[string]interface{})}
+
+	properties := map[string]interface{}{
+		g.fieldName("network_id"):     map[string]interface{}{"type": "string"},
+		"network":                     map[string]interface{}{"type": "string"},
+		g.fieldName("schema_version"): map[string]interface{}{"type": "string", "const": outputSchemaVersion},
+	}
+	required := []string{g.fieldName("network_id"), "network", g.fieldName("schema_version")}
+	var keep map[string]bool
+	if dataType == "latest_ledger" && p.fields != nil {
+		keep = p.fields.keep
+	}
+	if err := g.addProperties(t, keep, properties, &required); err != nil {
+		return "", err
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              jsonSchemaDialect,
+		"$id":                  "urn:" + avroNamespace + ":" + dataType + ":" + outputSchemaVersion,
+		"title":                t.Name(),
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": true,
+	}
+	if len(g.defs) > 0 {
+		schema["$defs"] = g.defs
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// jsonSchemaGenerator derives JSON Schema definitions from payload types.
+// Nested structs are defined once in $defs and referenced by name.
+type jsonSchemaGenerator struct {
+	keyCase      string
+	int64Strings bool
+	timeFormat   string
+	defs         map[string]interface{}
+}
+
+func (g *jsonSchemaGenerator) fieldName(name string) string {
+	if g.keyCase == keyCaseCamel {
+		return snakeToCamel(name)
+	}
+	return name
+}
+
+// addProperties adds the fields of a struct to properties, and those
+// without omitempty to required. A non-nil keep limits the fields.
+func (g *jsonSchemaGenerator) addProperties(t reflect.Type, keep map[string]bool, properties map[string]interface{}, required *[]string) error {
+	for _, f := range payloadFields(t) {
+		if keep != nil && !keep[f.name] {
+			continue
+		}
+		field := t.Field(f.index)
+		schema, err := g.typeSchema(field.Type)
+		if err != nil {
+			return fmt.Errorf("json schema: %s.%s: %w", t.Name(), f.name, err)
+		}
+		name := g.fieldName(f.name)
+		properties[name] = schema
+		if !omitEmpty(field) {
+			*required = append(*required, name)
+		}
+	}
+	return nil
+}
+
+func (g *jsonSchemaGenerator) typeSchema(t reflect.Type) (map[string]interface{}, error) {
+	if t == timeType {
+		if g.timeFormat == timeFormatUnixSeconds || g.timeFormat == timeFormatUnixMillis {
+			return map[string]interface{}{"type": "integer"}, nil
+		}
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int64, reflect.Uint64:
+		if g.int64Strings {
+			pattern := "^-?[0-9]+$"
+			if t.Kind() == reflect.Uint64 {
+				pattern = "^[0-9]+$"
+			}
+			return map[string]interface{}{"type": "string", "pattern": pattern}, nil
+		}
+		if t.Kind() == reflect.Uint64 {
+			return map[string]interface{}{"type": "integer", "minimum": 0}, nil
+		}
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "minimum": 0}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	case reflect.Ptr:
+		elem, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"anyOf": []interface{}{elem, map[string]interface{}{"type": "null"}}}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": []string{"string", "null"}, "contentEncoding": "base64"}, nil
+		}
+		items, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": values}, nil
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+		if _, defined := g.defs[t.Name()]; defined {
+			return ref, nil
+		}
+		// Reserve the name first, so recursive types refer to themselves.
+		g.defs[t.Name()] = nil
+		properties := map[string]interface{}{}
+		required := []string{}
+		if err := g.addProperties(t, nil, properties, &required); err != nil {
+			return nil, err
+		}
+		g.defs[t.Name()] = map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": true,
+		}
+		return ref, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
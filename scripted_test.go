@@ -0,0 +1,80 @@
+// scripted_test.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// wireCodec converts the requests and replies of a scripted exchange to
+// the bytes on the wire, and formats wire bytes in failure messages.
+type wireCodec struct {
+	decode func(string) ([]byte, error)
+	format func([]byte) string
+}
+
+var (
+	// textWire scripts text protocols such as RESP literally.
+	textWire = wireCodec{
+		decode: func(s string) ([]byte, error) { return []byte(s), nil },
+		format: func(b []byte) string { return fmt.Sprintf("%q", b) },
+	}
+	// hexWire scripts binary protocols such as MQTT in hex.
+	hexWire = wireCodec{decode: hex.DecodeString, format: hex.EncodeToString}
+)
+
+// serveScript accepts one connection and answers each expected request,
+// compared byte for byte, with its reply, both given in the codec's
+// notation. It returns the server address and a channel closed once the
+// exchange is over; sending anything more is an error.
+func serveScript(t *testing.T, codec wireCodec, exchange ...string) (string, <-chan struct{}) {
+	t.Helper()
+	wire := make([][]byte, len(exchange))
+	for i, s := range exchange {
+		var err error
+		if wire[i], err = codec.decode(s); err != nil {
+			t.Fatalf("script entry %q: %v", s, err)
+		}
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(conn)
+		for i := 0; i+1 < len(wire); i += 2 {
+			got := make([]byte, len(wire[i]))
+			if _, err := io.ReadFull(r, got); err != nil {
+				t.Errorf("reading request %s: %v", exchange[i], err)
+				return
+			}
+			if !bytes.Equal(got, wire[i]) {
+				t.Errorf("request %s, want %s", codec.format(got), codec.format(wire[i]))
+				return
+			}
+			conn.Write(wire[i+1])
+		}
+		// Nothing more is sent.
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		if extra, _ := r.Peek(1); len(extra) > 0 {
+			extra, _ = r.Peek(r.Buffered())
+			t.Errorf("unexpected request starting %s", codec.format(extra))
+		}
+	}()
+	return listener.Addr().String(), done
+}
@@ -0,0 +1,56 @@
+// sequence.go
+package main
+
+import (
+	"sort"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// SequenceMetrics counts sequence number manipulation, which is typical of
+// channel accounts and of clients recovering from stuck sequence numbers.
+type SequenceMetrics struct {
+	BumpSequenceCount   int `json:"bump_sequence_count"`    // BumpSequence operations in successful transactions
+	SequenceJumpTxCount int `json:"sequence_jump_tx_count"` // Transactions whose sequence number is not contiguous with the same account's previous transaction in the ledger
+}
+
+// sequenceTally accumulates sequence numbers per source account while a
+// ledger is processed.
+type sequenceTally struct {
+	bumps int
+	seqs  map[string][]int64
+}
+
+// add records the sequence number of a transaction and its BumpSequence
+// operations. Fee-bump transactions use the inner transaction's source.
+func (t *sequenceTally) add(tx ingest.LedgerTransaction) {
+	if t.seqs == nil {
+		t.seqs = make(map[string][]int64)
+	}
+	account := muxedAccountID(tx.Envelope.SourceAccount())
+	t.seqs[account] = append(t.seqs[account], tx.Envelope.SeqNum())
+
+	if !tx.Result.Successful() {
+		return
+	}
+	for _, op := range tx.Envelope.Operations() {
+		if op.Body.Type == xdr.OperationTypeBumpSequence {
+			t.bumps++
+		}
+	}
+}
+
+// metrics returns the tallied counts.
+func (t *sequenceTally) metrics() SequenceMetrics {
+	m := SequenceMetrics{BumpSequenceCount: t.bumps}
+	for _, seqs := range t.seqs {
+		sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] != seqs[i-1]+1 {
+				m.SequenceJumpTxCount++
+			}
+		}
+	}
+	return m
+}
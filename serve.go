@@ -0,0 +1,364 @@
+// serve.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// defaultServeRetain is the number of ledger records the serve command keeps
+// in memory for /ledgers lookups.
+const defaultServeRetain = 1000
+
+// ledgerStore is an in-memory consumer retaining the most recent
+// latest_ledger payloads by sequence.
+type ledgerStore struct {
+	mu       sync.RWMutex
+	retain   int
+	dataType string // data_type of the messages retained
+	payloads map[uint32][]byte
+	order    []uint32 // sequences in arrival order, oldest first
+}
+
+func newLedgerStore(retain int, dataType string) *ledgerStore {
+	return &ledgerStore{retain: retain, dataType: dataType, payloads: make(map[uint32][]byte)}
+}
+
+func (s *ledgerStore) Name() string                                   { return "serve-ledger-store" }
+func (s *ledgerStore) Version() string                                { return "1.0.0" }
+func (s *ledgerStore) Type() pluginapi.PluginType                     { return pluginapi.ConsumerPlugin }
+func (s *ledgerStore) Initialize(config map[string]interface{}) error { return nil }
+func (s *ledgerStore) Close() error                                   { return nil }
+
+func (s *ledgerStore) Process(ctx context.Context, msg pluginapi.Message) error {
+	if msg.Metadata["data_type"] != s.dataType {
+		return nil
+	}
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("unexpected payload type %T", msg.Payload)
+	}
+	seq, ok := msg.Metadata["ledger_sequence"].(uint32)
+	if !ok {
+		return fmt.Errorf("missing ledger_sequence metadata")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.payloads[seq]; !exists {
+		s.order = append(s.order, seq)
+	}
+	s.payloads[seq] = payload
+	for len(s.order) > s.retain {
+		delete(s.payloads, s.order[0])
+		s.order = s.order[1:]
+	}
+	return nil
+}
+
+// get returns the payload of a retained ledger.
+func (s *ledgerStore) get(seq uint32) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	payload, ok := s.payloads[seq]
+	return payload, ok
+}
+
+// latest returns the payload of the most recently stored ledger.
+func (s *ledgerStore) latest() ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.order) == 0 {
+		return nil, false
+	}
+	return s.payloads[s.order[len(s.order)-1]], true
+}
+
+// between returns the records of the retained ledgers from from to to,
+// inclusive, in sequence order, at most limit of them.
+func (s *ledgerStore) between(from, to uint32, limit int) []ledgerRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var seqs []uint32
+	for _, seq := range s.order {
+		if seq >= from && seq <= to {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	if len(seqs) > limit {
+		seqs = seqs[:limit]
+	}
+	records := make([]ledgerRecord, len(seqs))
+	for i, seq := range seqs {
+		records[i] = ledgerRecord{sequence: seq, payload: s.payloads[seq]}
+	}
+	return records
+}
+
+// runServe implements the serve command: it runs the processor over ledgers
+// read directly from a stellar-rpc server or an archive and serves the
+// results over HTTP and WebSocket, without a Flow host.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	passphrase := fs.String("network-passphrase", "", "network passphrase of the ledgers (required)")
+	configPath := fs.String("config", "", "optional JSON file with processor config")
+	fixtures := fs.String("fixtures", "", "directory of <sequence>.xdr LedgerCloseMeta fixtures")
+	rpcURL := fs.String("rpc-url", "", "stellar-rpc server to read ledgers from with getLedgers")
+	datastoreType := fs.String("datastore-type", "GCS", "ledger export data store type")
+	datastorePath := fs.String("datastore-path", "", "ledger export bucket path (used when neither -fixtures nor -rpc-url is set)")
+	ledgersPerFile := fs.Uint("ledgers-per-file", 1, "ledgers per file in the data store")
+	filesPerPartition := fs.Uint("files-per-partition", 64000, "files per partition in the data store")
+	var fallbackPaths []string
+	fs.Func("fallback-datastore-path", "bucket path of a fallback data store with the same layout, tried in order when the preceding ones fail (repeatable)", func(path string) error {
+		fallbackPaths = append(fallbackPaths, path)
+		return nil
+	})
+	from := fs.Uint("from", 0, "first ledger sequence (required)")
+	to := fs.Uint("to", 0, "last ledger sequence; 0 follows the data store as new ledgers are exported")
+	listen := fs.String("listen", ":8080", "HTTP listen address")
+	retain := fs.Int("retain", defaultServeRetain, "number of ledger records kept in memory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *passphrase == "" || *from == 0 || (*to != 0 && *to < *from) {
+		return fmt.Errorf("-network-passphrase and -from are required, and -to must not be before -from")
+	}
+	if *retain < 1 {
+		return fmt.Errorf("-retain must be at least 1")
+	}
+
+	archive := &archiveConfig{
+		sourceType:        *datastoreType,
+		path:              *datastorePath,
+		ledgersPerFile:    uint32(*ledgersPerFile),
+		filesPerPartition: uint32(*filesPerPartition),
+	}
+	switch {
+	case *fixtures != "" && *rpcURL != "":
+		return fmt.Errorf("-fixtures and -rpc-url cannot be combined")
+	case *fixtures != "":
+		if *to == 0 {
+			return fmt.Errorf("-to is required with -fixtures")
+		}
+		archive = &archiveConfig{sourceType: "fixtures", path: *fixtures}
+	case *rpcURL != "":
+		archive = &archiveConfig{sourceType: "RPC", path: *rpcURL}
+	case *datastorePath == "":
+		return fmt.Errorf("one of -fixtures, -rpc-url or -datastore-path is required")
+	}
+	for _, path := range fallbackPaths {
+		if *fixtures != "" {
+			return fmt.Errorf("-fallback-datastore-path cannot be used with -fixtures")
+		}
+		archive.fallbacks = append(archive.fallbacks, &archiveConfig{
+			sourceType:        *datastoreType,
+			path:              path,
+			ledgersPerFile:    uint32(*ledgersPerFile),
+			filesPerPartition: uint32(*filesPerPartition),
+		})
+	}
+
+	config := map[string]interface{}{}
+	if *configPath != "" {
+		var err error
+		if config, err = loadConfigFile(*configPath); err != nil {
+			return err
+		}
+	}
+	config["network_passphrase"] = *passphrase
+	// The HTTP API always serves plain JSON records.
+	config["payload_encoding"] = payloadEncodingJSON
+	delete(config, "cloudevents")
+	delete(config, "ledger_blocks")
+	delete(config, "json_lines")
+	delete(config, "latest_ledger_output")
+	delete(config, "file_sink")
+	for k := range builtinSinkSettings {
+		delete(config, k)
+	}
+	delete(config, "payload_compression")
+	delete(config, "schema_registry")
+	delete(config, "namespace")
+
+	processor, err := NewLatestLedgerProcessor(config)
+	if err != nil {
+		return err
+	}
+	defer processor.Close()
+	store := newLedgerStore(*retain, "latest_ledger")
+	processor.RegisterConsumer(store)
+	// The WebSocket server is mounted on the HTTP listener instead of one
+	// of its own, and is closed with the processor's built-in sinks.
+	ws := newWebSocketServer(defaultWebSocketMaxClients, "latest_ledger", nil)
+	processor.outputs = append(processor.outputs, ws)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	source, err := archive.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	if err := source.PrepareRange(ctx, uint32(*from), uint32(*to)); err != nil {
+		return fmt.Errorf("error preparing range: %w", err)
+	}
+
+	server := &http.Server{Addr: *listen, Handler: newServeMux(processor, store, ws)}
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("serve: listening on %s", *listen)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	ingestCtx, cancelIngest := context.WithCancel(ctx)
+	defer cancelIngest()
+	ingestErr := make(chan error, 1)
+	go func() {
+		ingestErr <- ingestRange(ingestCtx, source, processor, uint32(*from), uint32(*to))
+	}()
+
+	ingesting := true
+	select {
+	case err = <-serverErr:
+	case err = <-ingestErr:
+		ingesting = false
+		if err == nil {
+			log.Printf("serve: finished ledgers %d-%d, still serving until interrupted", *from, *to)
+			select {
+			case err = <-serverErr:
+			case <-ctx.Done():
+			}
+		}
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil && err == nil {
+		err = shutdownErr
+	}
+	// The deferred closes of the source and processor must not run while a
+	// ledger is still being read or processed.
+	cancelIngest()
+	if ingesting {
+		if ingestErr := <-ingestErr; ingestErr != nil && err == nil {
+			err = ingestErr
+		}
+	}
+	if errors.Is(err, http.ErrServerClosed) || errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	return err
+}
+
+// ingestRange feeds ledgers from the source to the processor until to, or
+// indefinitely when to is 0.
+func ingestRange(ctx context.Context, source ledgerSource, processor *LatestLedgerProcessor, from, to uint32) error {
+	for seq := from; to == 0 || seq <= to; seq++ {
+		lcm, err := source.GetLedger(ctx, seq)
+		if err != nil {
+			return fmt.Errorf("error getting ledger %d: %w", seq, err)
+		}
+		if err := processor.Process(ctx, pluginapi.Message{Payload: lcm, Timestamp: time.Now()}); err != nil {
+			return fmt.Errorf("error processing ledger %d: %w", seq, err)
+		}
+	}
+	return nil
+}
+
+// newServeMux returns the HTTP API of the serve command: the ledger API
+// of the http_api block, the WebSocket feed, plus stats and pause control.
+func newServeMux(processor *LatestLedgerProcessor, store *ledgerStore, ws *webSocketServer) *http.ServeMux {
+	mux := http.NewServeMux()
+	registerLedgerAPI(mux, store, processor)
+	mux.HandleFunc("GET /ws", ws.serveWebSocket)
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /latest", func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := store.latest()
+		if !ok {
+			http.Error(w, "no ledger processed yet", http.StatusNotFound)
+			return
+		}
+		writeJSONPayload(w, payload)
+	})
+	mux.HandleFunc("GET /ledgers/{sequence}", func(w http.ResponseWriter, r *http.Request) {
+		seq, err := strconv.ParseUint(r.PathValue("sequence"), 10, 32)
+		if err != nil {
+			http.Error(w, "invalid ledger sequence", http.StatusBadRequest)
+			return
+		}
+		payload, ok, err := lookupLedger(store, processor, uint32(seq))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "ledger not retained", http.StatusNotFound)
+			return
+		}
+		writeJSONPayload(w, payload)
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		lastN := defaultStatsWindow
+		if v := r.URL.Query().Get("last_n"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "last_n must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			lastN = n
+		}
+		stats, ok := processor.Stats(lastN)
+		if !ok {
+			http.Error(w, "no ledger processed yet", http.StatusNotFound)
+			return
+		}
+		payload, err := processor.marshalPayload(stats)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSONPayload(w, payload)
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		processor.Pause()
+		writePausedState(w, processor)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		if err := processor.Resume(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		writePausedState(w, processor)
+	})
+	return mux
+}
+
+func writePausedState(w http.ResponseWriter, processor *LatestLedgerProcessor) {
+	payload, _ := json.Marshal(map[string]bool{"paused": processor.Paused()})
+	writeJSONPayload(w, payload)
+}
+
+func writeJSONPayload(w http.ResponseWriter, payload []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
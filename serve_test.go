@@ -0,0 +1,76 @@
+// serve_test.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stellar/go/network"
+	"github.com/withObsrvr/pluginapi"
+)
+
+func TestServeMuxPushesLedgersOverWebSocket(t *testing.T) {
+	processor, err := NewLatestLedgerProcessor(map[string]interface{}{
+		"network_passphrase": network.TestNetworkPassphrase,
+		"payload_encoding":   payloadEncodingJSON,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer processor.Close()
+	store := newLedgerStore(defaultServeRetain, "latest_ledger")
+	processor.RegisterConsumer(store)
+	ws := newWebSocketServer(defaultWebSocketMaxClients, "latest_ledger", nil)
+	processor.outputs = append(processor.outputs, ws)
+	server := httptest.NewServer(newServeMux(processor, store, ws))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: serve\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake answered %s", resp.Status)
+	}
+
+	lcm := testLedger(t, network.TestNetworkPassphrase, 5, 1_700_000_000, 1)
+	if err := processor.Process(context.Background(), pluginapi.Message{Payload: lcm}); err != nil {
+		t.Fatal(err)
+	}
+	want, ok := store.latest()
+	if !ok {
+		t.Fatal("ledger not stored")
+	}
+	// Records are longer than 125 bytes, so the frame has a 16-bit length.
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatal(err)
+	}
+	if header[0] != 0x81 || header[1] != 126 || int(binary.BigEndian.Uint16(header[2:])) != len(want) {
+		t.Fatalf("frame header %x, want a %d-byte text frame", header, len(want))
+	}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("pushed %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+// setoptions.go
+package main
+
+import (
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// ConfigChanges counts account option changes applied by SetOptions
+// operations in successful transactions.
+type ConfigChanges struct {
+	SetOptionsCount   int `json:"set_options_count"`
+	SignersAdded      int `json:"signers_added"`     // Signers added or re-weighted (weight > 0)
+	SignersRemoved    int `json:"signers_removed"`   // Signers removed (weight = 0)
+	ThresholdChanges  int `json:"threshold_changes"` // Operations changing the master weight or any threshold
+	HomeDomainChanges int `json:"home_domain_changes"`
+}
+
+// addConfigChanges records the SetOptions operations of a successful
+// transaction.
+func addConfigChanges(changes *ConfigChanges, tx ingest.LedgerTransaction) {
+	if !tx.Result.Successful() {
+		return
+	}
+	for _, op := range tx.Envelope.Operations() {
+		if op.Body.Type != xdr.OperationTypeSetOptions {
+			continue
+		}
+		setOptions := op.Body.MustSetOptionsOp()
+		changes.SetOptionsCount++
+
+		if setOptions.Signer != nil {
+			if setOptions.Signer.Weight > 0 {
+				changes.SignersAdded++
+			} else {
+				changes.SignersRemoved++
+			}
+		}
+		if setOptions.MasterWeight != nil || setOptions.LowThreshold != nil ||
+			setOptions.MedThreshold != nil || setOptions.HighThreshold != nil {
+			changes.ThresholdChanges++
+		}
+		if setOptions.HomeDomain != nil {
+			changes.HomeDomainChanges++
+		}
+	}
+}
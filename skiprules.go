@@ -0,0 +1,108 @@
+// skiprules.go
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stellar/go/ingest"
+)
+
+// Reasons a transaction is skipped, as reported in the skip_reasons
+// metadata.
+const (
+	skipUnparseable      = "unparseable_envelope"
+	skipFeeBumpDuplicate = "fee_bump_duplicate"
+	skipBelowMinFee      = "below_min_fee"
+)
+
+// skipRules decides which transactions are left out of the ledger metrics.
+// Skipped transactions still count towards TransactionCount and
+// SkippedTxCount, but towards nothing else.
+type skipRules struct {
+	unparseable       bool  // skip transactions whose hash could not be matched instead of counting them as failed
+	feeBumpDuplicates bool  // skip fee bumps whose inner transaction already appeared in the ledger
+	minFeeCharged     int64 // skip transactions charged less than this; 0 disables the rule
+}
+
+// newSkipRulesFromConfig parses the optional skip_rules config block:
+//
+//	"skip_rules": {"unparseable_envelopes": true, "fee_bump_duplicates": true, "min_fee_charged": 100}
+func newSkipRulesFromConfig(config map[string]interface{}) (skipRules, error) {
+	var rules skipRules
+	raw, ok := config["skip_rules"]
+	if !ok || raw == nil {
+		return rules, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return rules, fmt.Errorf("skip_rules must be an object, got %T", raw)
+	}
+
+	var err error
+	if rules.unparseable, err = configBool(block, "unparseable_envelopes", false); err != nil {
+		return rules, fmt.Errorf("skip_rules: %w", err)
+	}
+	if rules.feeBumpDuplicates, err = configBool(block, "fee_bump_duplicates", false); err != nil {
+		return rules, fmt.Errorf("skip_rules: %w", err)
+	}
+	minFee, err := configInt(block, "min_fee_charged", 0)
+	if err != nil {
+		return rules, fmt.Errorf("skip_rules: %w", err)
+	}
+	if minFee < 0 {
+		return rules, fmt.Errorf("skip_rules: min_fee_charged must not be negative, got %d", minFee)
+	}
+	rules.minFeeCharged = int64(minFee)
+	return rules, nil
+}
+
+// skipTally tracks the skip decisions of a ledger.
+type skipTally struct {
+	reasons     map[string]int
+	innerHashes map[string]bool // hashes of the (inner) transactions seen so far
+}
+
+func (t *skipTally) skip(reason string) {
+	if t.reasons == nil {
+		t.reasons = make(map[string]int)
+	}
+	t.reasons[reason]++
+}
+
+// check returns the reason a transaction is skipped, or "" when it is kept.
+func (r skipRules) check(t *skipTally, tx ingest.LedgerTransaction) string {
+	if r.feeBumpDuplicates {
+		hash := tx.Result.TransactionHash.HexString()
+		if tx.Envelope.IsFeeBump() {
+			hash = tx.Result.InnerHash().HexString()
+		}
+		if t.innerHashes == nil {
+			t.innerHashes = make(map[string]bool)
+		}
+		duplicate := t.innerHashes[hash] && tx.Envelope.IsFeeBump()
+		t.innerHashes[hash] = true
+		if duplicate {
+			return skipFeeBumpDuplicate
+		}
+	}
+	if r.minFeeCharged > 0 && int64(tx.Result.Result.FeeCharged) < r.minFeeCharged {
+		return skipBelowMinFee
+	}
+	return ""
+}
+
+// metadata formats the skip reasons as "reason=count" pairs in reason
+// order, or "" when nothing was skipped.
+func (t *skipTally) metadata() string {
+	if len(t.reasons) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(t.reasons))
+	for reason, count := range t.reasons {
+		parts = append(parts, fmt.Sprintf("%s=%d", reason, count))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,134 @@
+// snapshot.go
+package main
+
+import "sync"
+
+// Clone returns a deep copy of the metrics. Emitted metrics are shared with
+// in-process readers, so anything that hands them out must hand out a clone
+// rather than the stored value.
+func (l LatestLedger) Clone() LatestLedger {
+	c := l
+	c.ClosedAtEpochSeconds = cloneInt64(l.ClosedAtEpochSeconds)
+	c.ClosedAtEpochMillis = cloneInt64(l.ClosedAtEpochMillis)
+	c.FeePoolDelta = cloneInt64(l.FeePoolDelta)
+	c.TotalCoinsDelta = cloneInt64(l.TotalCoinsDelta)
+	c.SorobanInstructionUtilization = cloneFloat(l.SorobanInstructionUtilization)
+	c.SorobanReadBytesUtilization = cloneFloat(l.SorobanReadBytesUtilization)
+	c.SorobanWriteBytesUtilization = cloneFloat(l.SorobanWriteBytesUtilization)
+	c.SorobanTxCountUtilization = cloneFloat(l.SorobanTxCountUtilization)
+	if l.SorobanInstructionHistogram != nil {
+		c.SorobanInstructionHistogram = make([]HistogramBucket, len(l.SorobanInstructionHistogram))
+		for i, bucket := range l.SorobanInstructionHistogram {
+			bucket.UpperBound = cloneUint64(bucket.UpperBound)
+			c.SorobanInstructionHistogram[i] = bucket
+		}
+	}
+	if l.Consensus != nil {
+		consensus := *l.Consensus
+		consensus.ScpMessageCount = cloneInt(l.Consensus.ScpMessageCount)
+		consensus.ScpValidatorCount = cloneInt(l.Consensus.ScpValidatorCount)
+		consensus.NominationSeconds = cloneFloat(l.Consensus.NominationSeconds)
+		c.Consensus = &consensus
+	}
+	if l.WorkShare != nil {
+		workShare := *l.WorkShare
+		c.WorkShare = &workShare
+	}
+	if l.SorobanAuthExpiration != nil {
+		expiration := *l.SorobanAuthExpiration
+		expiration.Histogram = make([]HistogramBucket, len(l.SorobanAuthExpiration.Histogram))
+		for i, bucket := range l.SorobanAuthExpiration.Histogram {
+			bucket.UpperBound = cloneUint64(bucket.UpperBound)
+			expiration.Histogram[i] = bucket
+		}
+		c.SorobanAuthExpiration = &expiration
+	}
+	if l.Watched != nil {
+		c.Watched = make([]WatchBreakdown, len(l.Watched))
+		for i, w := range l.Watched {
+			w.Tags = append([]Tag(nil), w.Tags...)
+			c.Watched[i] = w
+		}
+	}
+	c.DuplicateTxCount = cloneInt(l.DuplicateTxCount)
+	c.NewAssets = append([]string(nil), l.NewAssets...)
+	if l.Filtered != nil {
+		filtered := *l.Filtered
+		c.Filtered = &filtered
+	}
+	if l.Clawbacks != nil {
+		clawbacks := *l.Clawbacks
+		clawbacks.Amounts = append([]AssetAmount(nil), l.Clawbacks.Amounts...)
+		c.Clawbacks = &clawbacks
+	}
+	return c
+}
+
+func cloneInt64(i *int64) *int64 {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
+
+func cloneUint64(u *uint64) *uint64 {
+	if u == nil {
+		return nil
+	}
+	v := *u
+	return &v
+}
+
+func cloneInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
+
+func cloneFloat(f *float64) *float64 {
+	if f == nil {
+		return nil
+	}
+	v := *f
+	return &v
+}
+
+// snapshotStore holds the metrics of the most recently emitted ledger and
+// the stats samples of the retained window. The stored values are private
+// to the store and never mutated after they are set.
+type snapshotStore struct {
+	mu      sync.RWMutex
+	latest  *LatestLedger
+	history []statsSample // oldest first, at most retain samples
+	retain  int
+}
+
+// storeSnapshot records the metrics of an emitted ledger.
+func (p *LatestLedgerProcessor) storeSnapshot(metrics LatestLedger) {
+	snapshot := metrics.Clone()
+	p.snapshots.mu.Lock()
+	p.snapshots.latest = &snapshot
+	p.snapshots.history = append(p.snapshots.history, newStatsSample(metrics))
+	if len(p.snapshots.history) > p.snapshots.retain {
+		p.snapshots.history = p.snapshots.history[len(p.snapshots.history)-p.snapshots.retain:]
+	}
+	p.snapshots.mu.Unlock()
+}
+
+// LatestSnapshot returns a copy of the most recently emitted ledger metrics.
+// The boolean is false until the first ledger has been processed. Callers are
+// free to modify the returned value.
+func (p *LatestLedgerProcessor) LatestSnapshot() (LatestLedger, bool) {
+	if p.snapshots == nil {
+		return LatestLedger{}, false
+	}
+	p.snapshots.mu.RLock()
+	defer p.snapshots.mu.RUnlock()
+	if p.snapshots.latest == nil {
+		return LatestLedger{}, false
+	}
+	return p.snapshots.latest.Clone(), true
+}
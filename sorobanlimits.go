@@ -0,0 +1,92 @@
+// sorobanlimits.go
+package main
+
+import (
+	"fmt"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// sorobanLimits holds the per-ledger Soroban network limits used to compute
+// utilization. A zero value means the limit is unknown.
+type sorobanLimits struct {
+	ledgerMaxInstructions int64
+	ledgerMaxReadBytes    int64
+	ledgerMaxWriteBytes   int64
+	ledgerMaxTxCount      int64
+}
+
+// newSorobanLimitsFromConfig reads the optional soroban_limits config block.
+func newSorobanLimitsFromConfig(config map[string]interface{}) (sorobanLimits, error) {
+	var limits sorobanLimits
+	raw, ok := config["soroban_limits"]
+	if !ok || raw == nil {
+		return limits, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return limits, fmt.Errorf("soroban_limits must be an object, got %T", raw)
+	}
+
+	for key, dst := range map[string]*int64{
+		"ledger_max_instructions": &limits.ledgerMaxInstructions,
+		"ledger_max_read_bytes":   &limits.ledgerMaxReadBytes,
+		"ledger_max_write_bytes":  &limits.ledgerMaxWriteBytes,
+		"ledger_max_tx_count":     &limits.ledgerMaxTxCount,
+	} {
+		v, err := configInt(block, key, 0)
+		if err != nil {
+			return limits, fmt.Errorf("soroban_limits: %w", err)
+		}
+		if v < 0 {
+			return limits, fmt.Errorf("soroban_limits: %s must not be negative", key)
+		}
+		*dst = int64(v)
+	}
+	return limits, nil
+}
+
+// updateFromUpgrades applies any network config upgrades carried in the
+// ledger's meta, so limits stay accurate after protocol setting votes even
+// when they were configured statically.
+func (l *sorobanLimits) updateFromUpgrades(lcm xdr.LedgerCloseMeta) {
+	v1, ok := lcm.GetV1()
+	if !ok {
+		return
+	}
+	for _, upgrade := range v1.UpgradesProcessing {
+		for _, change := range ingest.GetChangesFromLedgerEntryChanges(upgrade.Changes) {
+			if change.Type != xdr.LedgerEntryTypeConfigSetting || change.Post == nil {
+				continue
+			}
+			setting := change.Post.Data.MustConfigSetting()
+			switch setting.ConfigSettingId {
+			case xdr.ConfigSettingIdConfigSettingContractComputeV0:
+				l.ledgerMaxInstructions = int64(setting.MustContractCompute().LedgerMaxInstructions)
+			case xdr.ConfigSettingIdConfigSettingContractLedgerCostV0:
+				cost := setting.MustContractLedgerCost()
+				l.ledgerMaxReadBytes = int64(cost.LedgerMaxReadBytes)
+				l.ledgerMaxWriteBytes = int64(cost.LedgerMaxWriteBytes)
+			case xdr.ConfigSettingIdConfigSettingContractExecutionLanes:
+				l.ledgerMaxTxCount = int64(setting.MustContractExecutionLanes().LedgerMaxTxCount)
+			}
+		}
+	}
+}
+
+// applyUtilization sets the utilization fractions of metrics for every limit
+// that is known.
+func (l sorobanLimits) applyUtilization(metrics *LatestLedger) {
+	ratio := func(used, limit int64) *float64 {
+		if limit <= 0 {
+			return nil
+		}
+		r := float64(used) / float64(limit)
+		return &r
+	}
+	metrics.SorobanInstructionUtilization = ratio(int64(metrics.TotalResourceInstructions), l.ledgerMaxInstructions)
+	metrics.SorobanReadBytesUtilization = ratio(int64(metrics.TotalResourceReadBytes), l.ledgerMaxReadBytes)
+	metrics.SorobanWriteBytesUtilization = ratio(int64(metrics.TotalResourceWriteBytes), l.ledgerMaxWriteBytes)
+	metrics.SorobanTxCountUtilization = ratio(int64(metrics.SorobanTxCount), l.ledgerMaxTxCount)
+}
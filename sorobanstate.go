@@ -0,0 +1,44 @@
+// sorobanstate.go
+package main
+
+import (
+	"log"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// SorobanState holds state archival metrics for a ledger.
+type SorobanState struct {
+	ExtendFootprintTtlCount int `json:"extend_footprint_ttl_count"` // ExtendFootprintTtl operations submitted
+	RestoreFootprintCount   int `json:"restore_footprint_count"`    // RestoreFootprint operations submitted
+	EntriesRestored         int `json:"entries_restored"`           // Archived entries brought back by successful restores
+}
+
+// addSorobanStateMetrics counts the state archival operations of a transaction.
+// Restored entries are derived from the TTL entries a successful
+// RestoreFootprint operation touched; entries that were already live are a
+// no-op for the network and produce no change.
+func addSorobanStateMetrics(state *SorobanState, tx ingest.LedgerTransaction) {
+	for i, op := range tx.Envelope.Operations() {
+		switch op.Body.Type {
+		case xdr.OperationTypeExtendFootprintTtl:
+			state.ExtendFootprintTtlCount++
+		case xdr.OperationTypeRestoreFootprint:
+			state.RestoreFootprintCount++
+			if !tx.Result.Successful() {
+				continue
+			}
+			changes, err := tx.GetOperationChanges(uint32(i))
+			if err != nil {
+				log.Printf("Warning: could not read restore changes for tx %s: %v", tx.Result.TransactionHash.HexString(), err)
+				continue
+			}
+			for _, change := range changes {
+				if change.Type == xdr.LedgerEntryTypeTtl {
+					state.EntriesRestored++
+				}
+			}
+		}
+	}
+}
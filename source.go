@@ -0,0 +1,265 @@
+// source.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stellar/go/ingest/ledgerbackend"
+	"github.com/stellar/go/support/datastore"
+	"github.com/stellar/go/xdr"
+)
+
+// ledgerSource provides raw ledgers outside of the Flow pipeline, for the
+// command line tools.
+type ledgerSource interface {
+	// PrepareRange tells the source which ledgers will be requested. A to
+	// of 0 requests an unbounded range where the source supports it.
+	PrepareRange(ctx context.Context, from, to uint32) error
+	// GetLedger returns the LedgerCloseMeta of a single ledger.
+	GetLedger(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error)
+	Close() error
+}
+
+// fixtureSource reads ledgers from a directory containing one raw XDR
+// LedgerCloseMeta file per ledger, named <sequence>.xdr.
+type fixtureSource struct {
+	dir string
+}
+
+func newFixtureSource(dir string) *fixtureSource {
+	return &fixtureSource{dir: dir}
+}
+
+func (s *fixtureSource) PrepareRange(ctx context.Context, from, to uint32) error {
+	return nil
+}
+
+func (s *fixtureSource) GetLedger(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error) {
+	var lcm xdr.LedgerCloseMeta
+	path := filepath.Join(s.dir, fmt.Sprintf("%d.xdr", sequence))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lcm, fmt.Errorf("error reading fixture: %w", err)
+	}
+	if err := xdr.SafeUnmarshal(data, &lcm); err != nil {
+		return lcm, fmt.Errorf("error decoding fixture %s: %w", path, err)
+	}
+	return lcm, nil
+}
+
+func (s *fixtureSource) Close() error {
+	return nil
+}
+
+// datastoreSource reads ledgers from a ledger export data store (the
+// archive format written by the Stellar ledger exporter).
+type datastoreSource struct {
+	store   datastore.DataStore
+	backend *ledgerbackend.BufferedStorageBackend
+}
+
+func newDatastoreSource(ctx context.Context, config datastore.DataStoreConfig) (*datastoreSource, error) {
+	store, err := datastore.NewDataStore(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating data store: %w", err)
+	}
+	backend, err := ledgerbackend.NewBufferedStorageBackend(ledgerbackend.BufferedStorageBackendConfig{
+		BufferSize: 100,
+		NumWorkers: 5,
+		RetryLimit: 3,
+		RetryWait:  5 * time.Second,
+	}, store)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("error creating storage backend: %w", err)
+	}
+	return &datastoreSource{store: store, backend: backend}, nil
+}
+
+func (s *datastoreSource) PrepareRange(ctx context.Context, from, to uint32) error {
+	if to == 0 {
+		return s.backend.PrepareRange(ctx, ledgerbackend.UnboundedRange(from))
+	}
+	return s.backend.PrepareRange(ctx, ledgerbackend.BoundedRange(from, to))
+}
+
+func (s *datastoreSource) GetLedger(ctx context.Context, sequence uint32) (xdr.LedgerCloseMeta, error) {
+	return s.backend.GetLedger(ctx, sequence)
+}
+
+func (s *datastoreSource) Close() error {
+	if err := s.backend.Close(); err != nil {
+		return err
+	}
+	return s.store.Close()
+}
+
+// archiveConfig describes where raw ledgers can be fetched from outside of
+// the Flow pipeline, as configured by the archive config block:
+//
+//	"archive": {"type": "GCS", "bucket_path": "bucket/ledgers/pubnet", "ledgers_per_file": 1, "files_per_partition": 64000}
+//	"archive": {"type": "RPC", "url": "https://rpc.example.com"}
+//	"archive": {"type": "fixtures", "path": "/data/fixtures"}
+//
+// Fallback archives, tried in order when the preceding ones fail, are listed
+// in "fallbacks" with the same settings.
+type archiveConfig struct {
+	sourceType        string
+	path              string
+	ledgersPerFile    uint32
+	filesPerPartition uint32
+	fallbacks         []*archiveConfig
+}
+
+// newArchiveConfig parses the optional archive config block. It returns nil
+// when no archive is configured.
+func newArchiveConfig(config map[string]interface{}) (*archiveConfig, error) {
+	raw, ok := config["archive"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("archive must be an object, got %T", raw)
+	}
+	cfg, err := parseArchiveBlock(block)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+
+	rawFallbacks, ok := block["fallbacks"]
+	if !ok || rawFallbacks == nil {
+		return cfg, nil
+	}
+	list, ok := rawFallbacks.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("archive: fallbacks must be an array, got %T", rawFallbacks)
+	}
+	for i, item := range list {
+		fallbackBlock, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("archive: fallbacks[%d] must be an object, got %T", i, item)
+		}
+		fallback, err := parseArchiveBlock(fallbackBlock)
+		if err != nil {
+			return nil, fmt.Errorf("archive: fallbacks[%d]: %w", i, err)
+		}
+		cfg.fallbacks = append(cfg.fallbacks, fallback)
+	}
+	return cfg, nil
+}
+
+// parseArchiveBlock parses the settings of a single archive.
+func parseArchiveBlock(block map[string]interface{}) (*archiveConfig, error) {
+	sourceType, err := configString(block, "type", "")
+	if err != nil {
+		return nil, err
+	}
+	cfg := &archiveConfig{sourceType: sourceType}
+	switch sourceType {
+	case "fixtures":
+		if cfg.path, err = configString(block, "path", ""); err != nil {
+			return nil, err
+		}
+	case "RPC":
+		if cfg.path, err = configString(block, "url", ""); err != nil {
+			return nil, err
+		}
+	case "GCS":
+		if cfg.path, err = configString(block, "bucket_path", ""); err != nil {
+			return nil, err
+		}
+		ledgersPerFile, err := configInt(block, "ledgers_per_file", 1)
+		if err != nil {
+			return nil, err
+		}
+		filesPerPartition, err := configInt(block, "files_per_partition", 64000)
+		if err != nil {
+			return nil, err
+		}
+		if ledgersPerFile < 1 || filesPerPartition < 1 {
+			return nil, fmt.Errorf("ledgers_per_file and files_per_partition must be positive")
+		}
+		cfg.ledgersPerFile = uint32(ledgersPerFile)
+		cfg.filesPerPartition = uint32(filesPerPartition)
+	default:
+		return nil, fmt.Errorf("unsupported type %q, expected \"GCS\", \"RPC\" or \"fixtures\"", sourceType)
+	}
+	if cfg.path == "" {
+		return nil, fmt.Errorf("a path is required for type %q", sourceType)
+	}
+	return cfg, nil
+}
+
+// open creates a ledger source for the archive. With fallbacks, the source
+// fails over between the archives.
+func (c *archiveConfig) open(ctx context.Context) (ledgerSource, error) {
+	if len(c.fallbacks) > 0 {
+		return newFailoverSource(append([]*archiveConfig{c}, c.fallbacks...)), nil
+	}
+	return c.openSingle(ctx)
+}
+
+func (c *archiveConfig) openSingle(ctx context.Context) (ledgerSource, error) {
+	switch c.sourceType {
+	case "fixtures":
+		return newFixtureSource(c.path), nil
+	case "RPC":
+		return newRPCSource(c.path), nil
+	}
+	return newDatastoreSource(ctx, c.dataStoreConfig())
+}
+
+func (c *archiveConfig) dataStoreConfig() datastore.DataStoreConfig {
+	return datastore.DataStoreConfig{
+		Type:   c.sourceType,
+		Params: map[string]string{"destination_bucket_path": c.path},
+		Schema: datastore.DataStoreSchema{
+			LedgersPerFile:    c.ledgersPerFile,
+			FilesPerPartition: c.filesPerPartition,
+		},
+	}
+}
+
+// probe checks that the archive is reachable and holds the ledger, without
+// reading it.
+func (c *archiveConfig) probe(ctx context.Context, sequence uint32) error {
+	switch c.sourceType {
+	case "fixtures":
+		_, err := os.Stat(filepath.Join(c.path, fmt.Sprintf("%d.xdr", sequence)))
+		return err
+	case "RPC":
+		oldest, latest, err := newRPCSource(c.path).health(ctx)
+		if err != nil {
+			return err
+		}
+		if sequence < oldest || sequence > latest {
+			return fmt.Errorf("ledger %d is outside the retention window %d-%d of %s", sequence, oldest, latest, c.path)
+		}
+		return nil
+	}
+	config := c.dataStoreConfig()
+	store, err := datastore.NewDataStore(ctx, config)
+	if err != nil {
+		return fmt.Errorf("error creating data store: %w", err)
+	}
+	defer store.Close()
+	key := config.Schema.GetObjectKeyFromSequenceNumber(sequence)
+	exists, err := store.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("ledger %d not found at %s", sequence, key)
+	}
+	return nil
+}
+
+// describe returns a short name of the archive for log messages.
+func (c *archiveConfig) describe() string {
+	return c.sourceType + ":" + c.path
+}
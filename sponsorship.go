@@ -0,0 +1,47 @@
+// sponsorship.go
+package main
+
+import (
+	"log"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/xdr"
+)
+
+// addSponsorshipMetrics counts ledger entries whose reserve sponsorship was
+// established or revoked by a transaction. A transfer to a different sponsor
+// counts as one removal and one creation, since the reserve liability moves
+// between accounts.
+func addSponsorshipMetrics(metrics *LatestLedger, tx ingest.LedgerTransaction) {
+	changes, err := tx.GetChanges()
+	if err != nil {
+		log.Printf("Warning: could not read changes for tx %s: %v", tx.Result.TransactionHash.HexString(), err)
+		return
+	}
+
+	for _, change := range changes {
+		var pre, post xdr.SponsorshipDescriptor
+		if change.Pre != nil {
+			pre = change.Pre.SponsoringID()
+		}
+		if change.Post != nil {
+			post = change.Post.SponsoringID()
+		}
+		if sameSponsor(pre, post) {
+			continue
+		}
+		if pre != nil {
+			metrics.SponsoredReservesRemoved++
+		}
+		if post != nil {
+			metrics.SponsoredReservesCreated++
+		}
+	}
+}
+
+func sameSponsor(a, b xdr.SponsorshipDescriptor) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Address() == b.Address()
+}
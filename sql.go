@@ -0,0 +1,205 @@
+// sql.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported SQL dialects.
+const (
+	sqlDialectPostgres   = "postgres"
+	sqlDialectClickHouse = "clickhouse"
+)
+
+// sqlStatement is the payload of SQL encoded messages: a parameterized
+// INSERT of one row, ready for a generic SQL executor.
+type sqlStatement struct {
+	Dialect    string        `json:"dialect"`
+	Table      string        `json:"table"`
+	Statement  string        `json:"statement"`
+	Parameters []interface{} `json:"parameters"`
+}
+
+// sqlEncoder renders payloads as INSERT statements into a table per
+// data_type. Columns are flattened as in the CSV and Parquet outputs:
+// nested objects become parent_child columns, lists and maps are JSON text
+// and every row starts with the network_id and network columns.
+type sqlEncoder struct {
+	dialect   string
+	rename    func(string) string
+	constants []parquetConstant
+	tables    map[reflect.Type]string // table name per payload type
+
+	mu         sync.Mutex
+	statements map[reflect.Type]string
+}
+
+// newSQLEncoderFromConfig parses the sql settings:
+//
+//	"sql": {"dialect": "postgres", "table_prefix": "stellar_"}
+func newSQLEncoderFromConfig(config map[string]interface{}, keyCase, networkPassphrase, network string) (*sqlEncoder, error) {
+	block := map[string]interface{}{}
+	if raw, ok := config["sql"]; ok && raw != nil {
+		if block, ok = raw.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("sql must be an object, got %T", raw)
+		}
+	}
+	dialect, err := configString(block, "dialect", sqlDialectPostgres)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	if dialect != sqlDialectPostgres && dialect != sqlDialectClickHouse {
+		return nil, fmt.Errorf("sql: dialect must be %q or %q, got %q", sqlDialectPostgres, sqlDialectClickHouse, dialect)
+	}
+	tablePrefix, err := configString(block, "table_prefix", "")
+	if err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+
+	rename := parquetRename(keyCase)
+	tables := make(map[reflect.Type]string, len(payloadTypes))
+	for dataType, t := range payloadTypes {
+		tables[t] = tablePrefix + dataType
+	}
+	return &sqlEncoder{
+		dialect: dialect,
+		rename:  rename,
+		constants: []parquetConstant{
+			{rename("network_id"), networkIDHex(networkPassphrase)},
+			{"network", network},
+			{rename("schema_version"), outputSchemaVersion},
+		},
+		tables:     tables,
+		statements: make(map[reflect.Type]string),
+	}, nil
+}
+
+// marshal renders v as a JSON encoded sqlStatement.
+func (e *sqlEncoder) marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	table, ok := e.tables[rv.Type()]
+	if !ok {
+		return nil, fmt.Errorf("sql: no table for payload type %s", rv.Type())
+	}
+	columns, params, err := e.row(rv)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	statement, ok := e.statements[rv.Type()]
+	if !ok {
+		statement = e.insertStatement(table, columns)
+		e.statements[rv.Type()] = statement
+	}
+	e.mu.Unlock()
+
+	return json.Marshal(sqlStatement{
+		Dialect:    e.dialect,
+		Table:      table,
+		Statement:  statement,
+		Parameters: params,
+	})
+}
+
+// row returns the column names and values of the row of a payload,
+// starting with the constant columns.
+func (e *sqlEncoder) row(v reflect.Value) ([]string, []interface{}, error) {
+	var columns []string
+	var params []interface{}
+	for _, constant := range e.constants {
+		columns = append(columns, constant.name)
+		params = append(params, constant.value)
+	}
+	if err := e.flattenValue(v, "", true, &columns, &params); err != nil {
+		return nil, nil, err
+	}
+	return columns, params, nil
+}
+
+// insertStatement renders the INSERT of one row with positional
+// placeholders: $1, $2, ... for Postgres and ? for ClickHouse.
+func (e *sqlEncoder) insertStatement(table string, columns []string) string {
+	quote := func(name string) string { return `"` + strings.ReplaceAll(name, `"`, `""`) + `"` }
+	if e.dialect == sqlDialectClickHouse {
+		quote = func(name string) string { return "`" + strings.ReplaceAll(name, "`", "``") + "`" }
+	}
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quote(column)
+		placeholders[i] = "?"
+		if e.dialect == sqlDialectPostgres {
+			placeholders[i] = "$" + strconv.Itoa(i+1)
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quote(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+}
+
+func (e *sqlEncoder) flattenValue(v reflect.Value, name string, present bool, columns *[]string, params *[]interface{}) error {
+	typ := v.Type()
+	switch {
+	case typ == timeType:
+	case typ.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			return e.flattenValue(reflect.Zero(typ.Elem()), name, false, columns, params)
+		}
+		return e.flattenValue(v.Elem(), name, present, columns, params)
+	case typ.Kind() == reflect.Struct:
+		prefix := ""
+		if name != "" {
+			prefix = name + "_"
+		}
+		for _, f := range payloadFields(typ) {
+			if err := e.flattenValue(v.Field(f.index), prefix+f.name, present, columns, params); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	*columns = append(*columns, e.rename(name))
+	if (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map) && v.IsNil() {
+		present = false
+	}
+	if !present {
+		*params = append(*params, nil)
+		return nil
+	}
+
+	var value interface{}
+	switch {
+	case typ == timeType:
+		value = v.Interface().(time.Time).UTC().Format(time.RFC3339Nano)
+	case typ.Kind() == reflect.Bool:
+		value = v.Bool()
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Int64:
+		value = v.Int()
+	case typ.Kind() >= reflect.Uint && typ.Kind() <= reflect.Uint64:
+		value = v.Uint()
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		value = v.Float()
+	case typ.Kind() == reflect.String:
+		value = v.String()
+	case typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map:
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return fmt.Errorf("sql: %s: %w", name, err)
+		}
+		if data, err = rewriteJSONKeys(data, e.rename); err != nil {
+			return fmt.Errorf("sql: %s: %w", name, err)
+		}
+		value = string(data)
+	default:
+		return fmt.Errorf("sql: %s: unsupported type %s", name, typ)
+	}
+	*params = append(*params, value)
+	return nil
+}
@@ -0,0 +1,318 @@
+// sse.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Defaults of the sse config block.
+const (
+	defaultSSEListenAddress = ":8082"
+	defaultSSEPath          = "/events"
+	defaultSSERetain        = 1000
+	defaultSSEMaxClients    = 1000
+)
+
+// sseSendBuffer is the number of live events queued for a client before it
+// is considered too slow and disconnected.
+const sseSendBuffer = 16
+
+const (
+	sseWriteTimeout      = 10 * time.Second
+	sseKeepaliveInterval = 30 * time.Second
+)
+
+// sseServer streams the payload of every new ledger as Server-Sent Events,
+// for browser consumers that cannot use WebSockets. Event IDs are ledger
+// sequences, so a reconnecting client resumes after the last ledger it
+// received from the events still retained. It is dispatched to like a
+// registered consumer and ignores messages other than latest_ledger.
+type sseServer struct {
+	server         *http.Server
+	listener       net.Listener
+	allowedOrigins map[string]bool // nil when every origin is allowed
+	retain         int
+	maxClients     int
+	dataType       string // data_type of the messages streamed
+
+	mu      sync.Mutex
+	clients map[*sseClient]struct{}
+	events  []sseEvent // retained events, oldest first
+	closed  bool
+}
+
+// sseEvent is an encoded event of a ledger.
+type sseEvent struct {
+	seq  uint64
+	data []byte
+}
+
+// sseClient is a connected client.
+type sseClient struct {
+	send chan []byte
+	done chan struct{}
+	once sync.Once
+}
+
+// newSSEServerFromConfig parses the optional sse config block:
+//
+//	"sse": {
+//	  "listen_address": ":8082",
+//	  "path": "/events",
+//	  "retain": 1000,
+//	  "allowed_origins": ["https://status.example.com"],
+//	  "max_clients": 1000
+//	}
+//
+// The listener is opened here, so an address in use fails the config. It
+// returns nil when no SSE endpoint is configured.
+func newSSEServerFromConfig(config map[string]interface{}, namespace string) (*sseServer, error) {
+	raw, ok := config["sse"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("sse must be an object, got %T", raw)
+	}
+	address, err := configString(block, "listen_address", defaultSSEListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("sse: %w", err)
+	}
+	path, err := configString(block, "path", defaultSSEPath)
+	if err != nil {
+		return nil, fmt.Errorf("sse: %w", err)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("sse: path must start with /, got %q", path)
+	}
+	retain, err := configInt(block, "retain", defaultSSERetain)
+	if err != nil {
+		return nil, fmt.Errorf("sse: %w", err)
+	}
+	origins, err := configStringSlice(block, "allowed_origins")
+	if err != nil {
+		return nil, fmt.Errorf("sse: %w", err)
+	}
+	maxClients, err := configInt(block, "max_clients", defaultSSEMaxClients)
+	if err != nil {
+		return nil, fmt.Errorf("sse: %w", err)
+	}
+	if retain < 1 || maxClients < 1 {
+		return nil, fmt.Errorf("sse: retain and max_clients must be at least 1")
+	}
+
+	s := &sseServer{
+		retain:     retain,
+		maxClients: maxClients,
+		dataType:   namespace + "latest_ledger",
+		clients:    make(map[*sseClient]struct{}),
+	}
+	if len(origins) > 0 {
+		s.allowedOrigins = make(map[string]bool, len(origins))
+		for _, origin := range origins {
+			s.allowedOrigins[origin] = true
+		}
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("sse: %w", err)
+	}
+	s.listener = listener
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, s.serveEvents)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Warning: sse server stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving ledger events on %s%s", listener.Addr(), path)
+	return s, nil
+}
+
+// Name identifies the server in logs and dispatch reports.
+func (s *sseServer) Name() string {
+	return "sse"
+}
+
+// Process retains the payload of a latest_ledger message as an event and
+// sends it to every client. Messages of an older ledger than the last one
+// streamed, such as reprocessed corrections, are skipped so event IDs only
+// increase. A client whose queue is full is disconnected rather than
+// holding up the pipeline; it can reconnect and resume.
+func (s *sseServer) Process(ctx context.Context, msg pluginapi.Message) error {
+	if msg.Metadata["data_type"] != s.dataType {
+		return nil
+	}
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("unsupported payload type %T", msg.Payload)
+	}
+	seq, _ := strconv.ParseUint(fmt.Sprint(msg.Metadata["ledger_sequence"]), 10, 64)
+	event := sseEvent{seq: seq, data: encodeSSEEvent(seq, s.dataType, payload)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.events); n > 0 && seq <= s.events[n-1].seq {
+		return nil
+	}
+	s.events = append(s.events, event)
+	if len(s.events) > s.retain {
+		s.events = s.events[len(s.events)-s.retain:]
+	}
+	for c := range s.clients {
+		select {
+		case c.send <- event.data:
+		default:
+			log.Printf("Warning: disconnecting slow sse client")
+			c.shutdown()
+		}
+	}
+	return nil
+}
+
+// serveEvents streams events to a client until it disconnects. A client
+// sending Last-Event-ID, or a last_event_id query parameter on its first
+// connection, first receives the retained events after that ledger;
+// other clients first receive the most recent ledger.
+func (s *sseServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	origin := r.Header.Get("Origin")
+	switch {
+	case s.allowedOrigins == nil:
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	case origin == "":
+	case s.allowedOrigins[origin]:
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Vary", "Origin")
+	default:
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	resume := lastID != ""
+	var after uint64
+	if resume {
+		var err error
+		if after, err = strconv.ParseUint(lastID, 10, 32); err != nil {
+			http.Error(w, "Last-Event-ID must be a ledger sequence", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if s.closed || len(s.clients) >= s.maxClients {
+		s.mu.Unlock()
+		http.Error(w, "too many sse clients", http.StatusServiceUnavailable)
+		return
+	}
+	var backlog []sseEvent
+	if resume {
+		for i, event := range s.events {
+			if event.seq > after {
+				backlog = s.events[i:]
+				break
+			}
+		}
+	} else if n := len(s.events); n > 0 {
+		backlog = s.events[n-1:]
+	}
+	c := &sseClient{
+		send: make(chan []byte, len(backlog)+sseSendBuffer),
+		done: make(chan struct{}),
+	}
+	for _, event := range backlog {
+		c.send <- event.data
+	}
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	defer s.remove(c)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		var data []byte
+		select {
+		case data = <-c.send:
+		case <-keepalive.C:
+			data = []byte(": keepalive\n\n")
+		case <-c.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		if _, err := w.Write(data); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// remove forgets a client that has disconnected.
+func (s *sseServer) remove(c *sseClient) {
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+}
+
+// Close stops accepting clients and ends the open streams.
+func (s *sseServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.clients {
+		c.shutdown()
+	}
+	s.mu.Unlock()
+	err := s.server.Close()
+	s.listener.Close() // in case Serve has not started yet
+	return err
+}
+
+// shutdown ends the client's stream.
+func (c *sseClient) shutdown() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// encodeSSEEvent encodes an event named after the data type, with the
+// ledger sequence as its ID. Each line of the payload becomes a data field.
+func encodeSSEEvent(seq uint64, event string, payload []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "id: %d\nevent: %s\n", seq, event)
+	for _, line := range bytes.Split(bytes.TrimRight(payload, "\n"), []byte("\n")) {
+		b.WriteString("data: ")
+		b.Write(bytes.TrimSuffix(line, []byte("\r")))
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
@@ -0,0 +1,140 @@
+// state.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// windowedStateFlushLedgers is how often, in ledgers, persisted windowed
+// state is written to disk.
+const windowedStateFlushLedgers = 60
+
+// windowedSet remembers keys seen within a rolling window of ledgers. Keys
+// not seen for more than retention ledgers are forgotten. When a path is
+// set, the set is loaded from and periodically saved to that file so the
+// window survives restarts.
+type windowedSet struct {
+	retention uint32
+	path      string
+
+	lastSeen   map[string]uint32
+	since      uint32 // first ledger observed by this set
+	lastLedger uint32 // most recently observed ledger
+	dirty      int    // ledgers observed since the last save
+}
+
+// windowedSetFile is the on-disk form of a windowedSet.
+type windowedSetFile struct {
+	Retention  uint32            `json:"retention"`
+	Since      uint32            `json:"since"`
+	LastLedger uint32            `json:"last_ledger"`
+	Entries    map[string]uint32 `json:"entries"`
+}
+
+// newWindowedSet creates a set with the given retention. When stateDir is
+// not empty, the set is persisted as name.json in that directory and any
+// existing state is loaded. State saved with a different retention is
+// discarded.
+func newWindowedSet(retention uint32, stateDir, name string) (*windowedSet, error) {
+	s := &windowedSet{retention: retention, lastSeen: make(map[string]uint32)}
+	if stateDir == "" {
+		return s, nil
+	}
+	s.path = filepath.Join(stateDir, name+".json")
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state %s: %w", s.path, err)
+	}
+	var file windowedSetFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error decoding state %s: %w", s.path, err)
+	}
+	if file.Retention != retention {
+		return s, nil
+	}
+	s.since = file.Since
+	s.lastLedger = file.LastLedger
+	if file.Entries != nil {
+		s.lastSeen = file.Entries
+	}
+	return s, nil
+}
+
+// advance moves the window to seq, forgetting keys that fell out of it. It
+// must be called once per ledger before the ledger's keys are observed.
+func (s *windowedSet) advance(seq uint32) {
+	if s.since == 0 || seq < s.lastLedger {
+		// First ledger, or the stream moved backwards: start a new window.
+		s.since = seq
+		s.lastSeen = make(map[string]uint32)
+	}
+	s.lastLedger = seq
+	s.dirty++
+	if seq <= s.retention {
+		return
+	}
+	cutoff := seq - s.retention
+	for key, last := range s.lastSeen {
+		if last < cutoff {
+			delete(s.lastSeen, key)
+		}
+	}
+}
+
+// observe records key as seen in the current ledger and reports whether it
+// had not been seen within the window.
+func (s *windowedSet) observe(key string) bool {
+	_, seen := s.lastSeen[key]
+	s.lastSeen[key] = s.lastLedger
+	return !seen
+}
+
+// warm reports whether the set has observed a full window. Until then, keys
+// reported as new may simply predate the observed ledgers.
+func (s *windowedSet) warm() bool {
+	return s.since != 0 && s.lastLedger-s.since >= s.retention
+}
+
+// flush saves the set if it is persisted and enough ledgers have been
+// observed since the last save. The file is replaced atomically.
+func (s *windowedSet) flush() error {
+	if s.path == "" || s.dirty < windowedStateFlushLedgers {
+		return nil
+	}
+	data, err := json.Marshal(windowedSetFile{
+		Retention:  s.retention,
+		Since:      s.since,
+		LastLedger: s.lastLedger,
+		Entries:    s.lastSeen,
+	})
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing state %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("error replacing state %s: %w", s.path, err)
+	}
+	s.dirty = 0
+	return nil
+}
+
+// sortedKeys returns the keys of a set of strings in ascending order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
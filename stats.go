@@ -0,0 +1,124 @@
+// stats.go
+package main
+
+import (
+	"time"
+)
+
+// defaultStatsWindow is the number of recent ledgers retained for Stats.
+const defaultStatsWindow = 100
+
+// LedgerStats aggregates metrics over the most recent ledgers, as served by
+// the stats(lastN) GraphQL query.
+type LedgerStats struct {
+	LedgerCount           int          `json:"ledger_count"`
+	FromSequence          uint32       `json:"from_sequence"`
+	ToSequence            uint32       `json:"to_sequence"`
+	TransactionsPerSecond StatSummary  `json:"transactions_per_second"`
+	TotalFeeCharged       StatSummary  `json:"total_fee_charged"`
+	AvgFeePerOperation    StatSummary  `json:"avg_fee_per_operation"`
+	CloseTimeDelta        *StatSummary `json:"close_time_delta,omitempty"` // Seconds between consecutive ledgers (omitted without consecutive ledgers)
+	FailureRate           StatSummary  `json:"failure_rate"`               // Failed transactions / transactions, for ledgers with transactions
+}
+
+// StatSummary is the average, minimum and maximum of a metric.
+type StatSummary struct {
+	Avg float64 `json:"avg"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// statsSample holds the values of an emitted ledger that Stats aggregates.
+type statsSample struct {
+	sequence           uint32
+	closedAt           time.Time
+	tps                float64
+	totalFeeCharged    int64
+	avgFeePerOperation float64
+	transactionCount   int
+	failedTxCount      int
+}
+
+func newStatsSample(metrics LatestLedger) statsSample {
+	return statsSample{
+		sequence:           metrics.Sequence,
+		closedAt:           metrics.ClosedAt,
+		tps:                metrics.TransactionsPerSecond,
+		totalFeeCharged:    metrics.TotalFeeCharged,
+		avgFeePerOperation: metrics.AvgFeePerOperation,
+		transactionCount:   metrics.TransactionCount,
+		failedTxCount:      metrics.FailedTxCount,
+	}
+}
+
+// summaryBuilder accumulates a StatSummary.
+type summaryBuilder struct {
+	n             int
+	sum, min, max float64
+}
+
+func (b *summaryBuilder) add(v float64) {
+	if b.n == 0 || v < b.min {
+		b.min = v
+	}
+	if b.n == 0 || v > b.max {
+		b.max = v
+	}
+	b.sum += v
+	b.n++
+}
+
+func (b *summaryBuilder) summary() StatSummary {
+	if b.n == 0 {
+		return StatSummary{}
+	}
+	return StatSummary{Avg: b.sum / float64(b.n), Min: b.min, Max: b.max}
+}
+
+// Stats aggregates the metrics of the last lastN emitted ledgers, or of all
+// retained ledgers when fewer are available. The boolean is false when no
+// ledger has been processed or lastN is not positive.
+func (p *LatestLedgerProcessor) Stats(lastN int) (LedgerStats, bool) {
+	if p.snapshots == nil || lastN < 1 {
+		return LedgerStats{}, false
+	}
+	p.snapshots.mu.RLock()
+	samples := p.snapshots.history
+	if len(samples) > lastN {
+		samples = samples[len(samples)-lastN:]
+	}
+	samples = append([]statsSample(nil), samples...)
+	p.snapshots.mu.RUnlock()
+
+	if len(samples) == 0 {
+		return LedgerStats{}, false
+	}
+
+	var tps, fees, avgFees, closeDelta, failureRate summaryBuilder
+	for i, s := range samples {
+		tps.add(s.tps)
+		fees.add(float64(s.totalFeeCharged))
+		avgFees.add(s.avgFeePerOperation)
+		if s.transactionCount > 0 {
+			failureRate.add(float64(s.failedTxCount) / float64(s.transactionCount))
+		}
+		if i > 0 && samples[i-1].sequence+1 == s.sequence {
+			closeDelta.add(s.closedAt.Sub(samples[i-1].closedAt).Seconds())
+		}
+	}
+
+	stats := LedgerStats{
+		LedgerCount:           len(samples),
+		FromSequence:          samples[0].sequence,
+		ToSequence:            samples[len(samples)-1].sequence,
+		TransactionsPerSecond: tps.summary(),
+		TotalFeeCharged:       fees.summary(),
+		AvgFeePerOperation:    avgFees.summary(),
+		FailureRate:           failureRate.summary(),
+	}
+	if closeDelta.n > 0 {
+		summary := closeDelta.summary()
+		stats.CloseTimeDelta = &summary
+	}
+	return stats, true
+}
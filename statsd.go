@@ -0,0 +1,158 @@
+// statsd.go
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Defaults of the telemetry statsd block.
+const (
+	defaultStatsdAddress = "127.0.0.1:8125"
+	// statsdMaxPacketBytes keeps packets below the common 1500 byte MTU.
+	statsdMaxPacketBytes = 1432
+)
+
+// statsdTelemetryExporter sends telemetry to a StatsD or DogStatsD agent
+// over UDP. Sends never wait on the agent; packets it does not read are
+// lost, as usual for StatsD.
+type statsdTelemetryExporter struct {
+	conn      net.Conn
+	prefix    string
+	dogstatsd bool              // add tags in the DogStatsD format
+	tags      map[string]string // tags added to every metric
+}
+
+// newStatsdTelemetryExporter parses the telemetry statsd block:
+//
+//	"statsd": {
+//	  "address": "127.0.0.1:8125",
+//	  "prefix": "stellar.ledger",
+//	  "dogstatsd": true,
+//	  "tags": {"env": "prod"}
+//	}
+func newStatsdTelemetryExporter(block map[string]interface{}) (telemetryExporter, error) {
+	address, err := configString(block, "address", defaultStatsdAddress)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := configString(block, "prefix", "")
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	dogstatsd, err := configBool(block, "dogstatsd", true)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := configStringMap(block, "tags")
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > 0 && !dogstatsd {
+		return nil, fmt.Errorf("tags require dogstatsd")
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdTelemetryExporter{conn: conn, prefix: prefix, dogstatsd: dogstatsd, tags: tags}, nil
+}
+
+// Export sends the points of a batch, packing as many lines into each
+// packet as fit. Gauges are sent as gauges, counter deltas as counts and
+// timings as milliseconds. With dogstatsd, resource attributes, point
+// attributes and the configured tags become tags.
+func (e *statsdTelemetryExporter) Export(batch telemetryBatch) error {
+	var packet []byte
+	var errs []error
+	send := func() {
+		if len(packet) == 0 {
+			return
+		}
+		if _, err := e.conn.Write(packet); err != nil {
+			errs = append(errs, err)
+		}
+		packet = packet[:0]
+	}
+	add := func(line string) {
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdMaxPacketBytes {
+			send()
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+
+	for _, point := range batch.Points {
+		name := e.prefix + statsdName(point.Name)
+		tags := e.tagSuffix(batch.Attributes, point.Attributes)
+		switch point.Kind {
+		case telemetryCounter:
+			add(name + ":" + formatStatsdValue(point.Value) + "|c" + tags)
+		case telemetryTiming:
+			add(name + ":" + formatStatsdValue(point.Value*1000) + "|ms" + tags)
+		default:
+			// A signed gauge value adjusts the gauge instead of setting it,
+			// so negative values are sent as a reset followed by a decrement.
+			if point.Value < 0 {
+				add(name + ":0|g" + tags)
+			}
+			add(name + ":" + formatStatsdValue(point.Value) + "|g" + tags)
+		}
+	}
+	send()
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of the statsd packets failed, first error: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// tagSuffix returns the DogStatsD tag section of a line, or "" without
+// dogstatsd or tags.
+func (e *statsdTelemetryExporter) tagSuffix(resource, point map[string]string) string {
+	if !e.dogstatsd {
+		return ""
+	}
+	merged := make(map[string]string, len(resource)+len(point)+len(e.tags))
+	for _, attrs := range []map[string]string{resource, e.tags, point} {
+		for k, v := range attrs {
+			merged[k] = v
+		}
+	}
+	if len(merged) == 0 {
+		return ""
+	}
+	tags := make([]string, 0, len(merged))
+	for k, v := range merged {
+		tags = append(tags, statsdName(k)+":"+statsdName(v))
+	}
+	sort.Strings(tags)
+	return "|#" + strings.Join(tags, ",")
+}
+
+func (e *statsdTelemetryExporter) Close() error {
+	return e.conn.Close()
+}
+
+// statsdName replaces the characters that delimit the parts of a StatsD
+// line with underscores.
+func statsdName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func formatStatsdValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,289 @@
+// telemetry.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// instrumentationScope names the processor as the source of exported
+// metrics and trace spans.
+const instrumentationScope = "github.com/withObsrvr/flow-processor-latestledger"
+
+// telemetryKind distinguishes point-in-time values from monotonic counters
+// and durations.
+type telemetryKind int
+
+const (
+	telemetryGauge telemetryKind = iota
+	telemetryCounter
+	telemetryTiming // a duration in seconds; a gauge to exporters without timers
+)
+
+// telemetryPoint is a single measurement. Counter values are deltas since
+// the previous batch.
+type telemetryPoint struct {
+	Name       string
+	Kind       telemetryKind
+	Value      float64
+	Attributes map[string]string // point-specific attributes, e.g. the consumer; may be nil
+}
+
+func gauge(name string, value float64) telemetryPoint {
+	return telemetryPoint{Name: name, Kind: telemetryGauge, Value: value}
+}
+
+func counter(name string, value float64) telemetryPoint {
+	return telemetryPoint{Name: name, Kind: telemetryCounter, Value: value}
+}
+
+func timing(name string, d time.Duration) telemetryPoint {
+	return telemetryPoint{Name: name, Kind: telemetryTiming, Value: d.Seconds()}
+}
+
+// telemetryBatch is the set of measurements recorded for one ledger.
+type telemetryBatch struct {
+	Time       time.Time
+	Attributes map[string]string // common resource attributes
+	Points     []telemetryPoint
+}
+
+// telemetryExporter ships telemetry batches to a monitoring backend.
+// Exporters must not block the pipeline for long; push-based exporters
+// should buffer or drop rather than wait on a slow backend.
+type telemetryExporter interface {
+	Export(batch telemetryBatch) error
+	Close() error
+}
+
+// telemetryExporterFactory builds an exporter from its config block, which
+// is empty when the telemetry section has no block for the exporter.
+type telemetryExporterFactory func(block map[string]interface{}) (telemetryExporter, error)
+
+// telemetryExporters lists the available exporters by the name used in the
+// telemetry exporters list. New exporters register themselves here.
+var telemetryExporters = map[string]telemetryExporterFactory{
+	"log":        newLogTelemetryExporter,
+	"otlp":       newOTLPTelemetryExporter,
+	"prometheus": newPrometheusTelemetryExporter,
+	"statsd":     newStatsdTelemetryExporter,
+}
+
+// telemetry is the single facade through which the processor reports
+// metrics, regardless of which exporters are configured.
+type telemetry struct {
+	exporters   map[string]telemetryExporter
+	attributes  map[string]string
+	selfMetrics bool
+	namespace   string // prefixed to every metric name
+
+	// Self-metric counters accumulated between batches.
+	processingErrors int
+	deliveryErrors   int
+	bytesForwarded   map[string]int // payload bytes delivered, by consumer name
+}
+
+// newTelemetryFromConfig parses the optional telemetry config block:
+//
+//	"telemetry": {
+//	  "exporters": ["log"],
+//	  "resource_attributes": {"service.name": "latest-ledger", "deployment.environment": "prod"},
+//	  "self_metrics": true,
+//	  "log": {}
+//	}
+//
+// Each exporter reads its own settings from the block named after it. It
+// returns nil when no exporter is selected.
+func newTelemetryFromConfig(config map[string]interface{}) (*telemetry, error) {
+	raw, ok := config["telemetry"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("telemetry must be an object, got %T", raw)
+	}
+
+	names, err := configStringSlice(block, "exporters")
+	if err != nil {
+		return nil, fmt.Errorf("telemetry: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	selfMetrics, err := configBool(block, "self_metrics", true)
+	if err != nil {
+		return nil, fmt.Errorf("telemetry: %w", err)
+	}
+	namespace, err := configNamespace(config)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := configStringMap(block, "resource_attributes")
+	if err != nil {
+		return nil, fmt.Errorf("telemetry: %w", err)
+	}
+
+	t := &telemetry{
+		exporters:      make(map[string]telemetryExporter, len(names)),
+		attributes:     attributes,
+		selfMetrics:    selfMetrics,
+		namespace:      namespace,
+		bytesForwarded: make(map[string]int),
+	}
+	for _, name := range names {
+		factory, ok := telemetryExporters[name]
+		if !ok {
+			t.Close()
+			return nil, fmt.Errorf("telemetry: unknown exporter %q (available: %s)", name, availableTelemetryExporters())
+		}
+		if _, dup := t.exporters[name]; dup {
+			t.Close()
+			return nil, fmt.Errorf("telemetry: exporter %q listed more than once", name)
+		}
+		var exporterBlock map[string]interface{}
+		if rawBlock, ok := block[name]; ok && rawBlock != nil {
+			if exporterBlock, ok = rawBlock.(map[string]interface{}); !ok {
+				t.Close()
+				return nil, fmt.Errorf("telemetry: %s must be an object, got %T", name, rawBlock)
+			}
+		}
+		if exporterBlock == nil {
+			exporterBlock = map[string]interface{}{}
+		}
+		exporter, err := factory(exporterBlock)
+		if err != nil {
+			t.Close()
+			return nil, fmt.Errorf("telemetry: %s: %w", name, err)
+		}
+		t.exporters[name] = exporter
+	}
+	return t, nil
+}
+
+func availableTelemetryExporters() string {
+	names := make([]string, 0, len(telemetryExporters))
+	for name := range telemetryExporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// processingFailed counts a ledger that failed to process.
+func (t *telemetry) processingFailed() {
+	t.processingErrors++
+}
+
+// deliveryFailed counts failed downstream deliveries.
+func (t *telemetry) deliveryFailed(n int) {
+	t.deliveryErrors += n
+}
+
+// forwarded counts payload bytes delivered to a downstream consumer or
+// processor.
+func (t *telemetry) forwarded(consumer string, bytes int) {
+	t.bytesForwarded[consumer] += bytes
+}
+
+// recordLedger exports the metrics of a processed ledger together with the
+// processor's self-metrics.
+func (t *telemetry) recordLedger(metrics LatestLedger, processingTime time.Duration) {
+	batch := telemetryBatch{
+		Time:       metrics.ClosedAt,
+		Attributes: t.attributes,
+		Points: []telemetryPoint{
+			gauge("ledger_sequence", float64(metrics.Sequence)),
+			gauge("transaction_count", float64(metrics.TransactionCount)),
+			gauge("successful_tx_count", float64(metrics.SuccessfulTxCount)),
+			gauge("failed_tx_count", float64(metrics.FailedTxCount)),
+			gauge("tx_set_operation_count", float64(metrics.TxSetOperationCount)),
+			gauge("successful_operation_count", float64(metrics.SuccessfulOperationCount)),
+			gauge("total_fee_charged", float64(metrics.TotalFeeCharged)),
+			gauge("transactions_per_second", metrics.TransactionsPerSecond),
+			gauge("soroban_tx_count", float64(metrics.SorobanTxCount)),
+			gauge("total_resource_instructions", float64(metrics.TotalResourceInstructions)),
+		},
+	}
+	if metrics.Consensus != nil {
+		gap := time.Duration(metrics.Consensus.CloseTimeDelta * float64(time.Second))
+		batch.Points = append(batch.Points, timing("close_time_delta_seconds", gap))
+	}
+	if t.selfMetrics {
+		batch.Points = append(batch.Points,
+			counter("processor_ledgers_processed", 1),
+			timing("processor_processing_seconds", processingTime),
+			counter("processor_processing_errors", float64(t.processingErrors)),
+			counter("processor_delivery_errors", float64(t.deliveryErrors)),
+		)
+		consumers := make([]string, 0, len(t.bytesForwarded))
+		for consumer := range t.bytesForwarded {
+			consumers = append(consumers, consumer)
+		}
+		sort.Strings(consumers)
+		for _, consumer := range consumers {
+			point := counter("processor_forwarded_bytes", float64(t.bytesForwarded[consumer]))
+			point.Attributes = map[string]string{"consumer": consumer}
+			batch.Points = append(batch.Points, point)
+		}
+		t.processingErrors = 0
+		t.deliveryErrors = 0
+		clear(t.bytesForwarded)
+	}
+
+	if t.namespace != "" {
+		for i := range batch.Points {
+			batch.Points[i].Name = t.namespace + batch.Points[i].Name
+		}
+	}
+	for name, exporter := range t.exporters {
+		if err := exporter.Export(batch); err != nil {
+			log.Printf("Warning: telemetry exporter %s failed: %v", name, err)
+		}
+	}
+}
+
+// Close shuts down all exporters.
+func (t *telemetry) Close() error {
+	var errs []error
+	for name, exporter := range t.exporters {
+		if err := exporter.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// logTelemetryExporter writes each batch as a single log line. It is mostly
+// useful for debugging exporter configuration.
+type logTelemetryExporter struct{}
+
+func newLogTelemetryExporter(block map[string]interface{}) (telemetryExporter, error) {
+	return logTelemetryExporter{}, nil
+}
+
+func (logTelemetryExporter) Export(batch telemetryBatch) error {
+	parts := make([]string, 0, len(batch.Points))
+	for _, point := range batch.Points {
+		name := point.Name
+		if len(point.Attributes) > 0 {
+			attrs := make([]string, 0, len(point.Attributes))
+			for k, v := range point.Attributes {
+				attrs = append(attrs, k+"="+v)
+			}
+			sort.Strings(attrs)
+			name += "{" + strings.Join(attrs, ",") + "}"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%g", name, point.Value))
+	}
+	log.Printf("Telemetry: %s", strings.Join(parts, " "))
+	return nil
+}
+
+func (logTelemetryExporter) Close() error {
+	return nil
+}
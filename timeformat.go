@@ -0,0 +1,46 @@
+// timeformat.go
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Supported values of the timestamp_format setting.
+const (
+	timeFormatRFC3339     = "rfc3339"
+	timeFormatUnixSeconds = "unix_seconds"
+	timeFormatUnixMillis  = "unix_millis"
+)
+
+// configTimeFormat parses the timestamp_format setting, which selects how
+// times such as closed_at are written to JSON, CBOR and CSV payloads.
+func configTimeFormat(config map[string]interface{}) (string, error) {
+	format, err := configString(config, "timestamp_format", timeFormatRFC3339)
+	if err != nil {
+		return "", err
+	}
+	switch format {
+	case timeFormatRFC3339, timeFormatUnixSeconds, timeFormatUnixMillis:
+		return format, nil
+	}
+	return "", fmt.Errorf("timestamp_format must be %q, %q or %q, got %q", timeFormatRFC3339, timeFormatUnixSeconds, timeFormatUnixMillis, format)
+}
+
+// appendUnixTime appends t as integer Unix seconds or milliseconds.
+// Seconds are truncated, as with time.Unix.
+func appendUnixTime(buf []byte, t time.Time, format string) []byte {
+	if format == timeFormatUnixMillis {
+		return strconv.AppendInt(buf, t.UnixMilli(), 10)
+	}
+	return strconv.AppendInt(buf, t.Unix(), 10)
+}
+
+// formatTime returns t as text in the given timestamp_format.
+func formatTime(t time.Time, format string) string {
+	if format == timeFormatUnixSeconds || format == timeFormatUnixMillis {
+		return string(appendUnixTime(nil, t, format))
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
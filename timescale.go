@@ -0,0 +1,104 @@
+// timescale.go
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Defaults of the timescale block of the postgres config.
+const defaultTimescaleChunkIntervalDays = 7
+
+// timescaleSettings makes the Postgres ledger table a TimescaleDB
+// hypertable partitioned on closed_at, optionally with a continuous
+// aggregate of hourly throughput and fees.
+type timescaleSettings struct {
+	chunkIntervalDays int
+	aggregates        bool
+}
+
+// newTimescaleSettingsFromConfig parses the optional timescale block of the
+// postgres config:
+//
+//	"timescale": {"chunk_interval_days": 7, "continuous_aggregates": true}
+//
+// It returns nil when the table is a plain Postgres table.
+func newTimescaleSettingsFromConfig(block map[string]interface{}) (*timescaleSettings, error) {
+	raw, ok := block["timescale"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	settings, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("timescale must be an object, got %T", raw)
+	}
+	days, err := configInt(settings, "chunk_interval_days", defaultTimescaleChunkIntervalDays)
+	if err != nil {
+		return nil, fmt.Errorf("timescale: %w", err)
+	}
+	if days < 1 {
+		return nil, fmt.Errorf("timescale: chunk_interval_days must be at least 1")
+	}
+	aggregates, err := configBool(settings, "continuous_aggregates", true)
+	if err != nil {
+		return nil, fmt.Errorf("timescale: %w", err)
+	}
+	return &timescaleSettings{chunkIntervalDays: days, aggregates: aggregates}, nil
+}
+
+// createHypertable turns the ledger table into a hypertable, if it is not
+// one yet, and creates the hourly continuous aggregate and its refresh
+// policy.
+func (w *postgresWriter) createHypertable(ctx context.Context) error {
+	_, err := w.db.ExecContext(ctx, `SELECT create_hypertable($1::regclass, 'closed_at',
+		chunk_time_interval => make_interval(days => $2), if_not_exists => TRUE, migrate_data => TRUE)`,
+		w.quotedTable(), w.timescale.chunkIntervalDays)
+	if err != nil {
+		return fmt.Errorf("creating hypertable: %w", err)
+	}
+	if !w.timescale.aggregates {
+		return nil
+	}
+
+	view := pq.QuoteIdentifier(w.table + "_hourly")
+	if w.schema != "" {
+		view = pq.QuoteIdentifier(w.schema) + "." + view
+	}
+	// Sums are kept alongside the rates so coarser rollups can be derived
+	// from the hourly rows.
+	create := fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %s
+		WITH (timescaledb.continuous) AS
+		SELECT network_id,
+			time_bucket(INTERVAL '1 hour', closed_at) AS bucket,
+			count(*) AS ledger_count,
+			min(sequence) AS first_sequence,
+			max(sequence) AS last_sequence,
+			sum(transaction_count) AS transaction_count,
+			sum(successful_tx_count) AS successful_tx_count,
+			sum(failed_tx_count) AS failed_tx_count,
+			sum(successful_operation_count) AS successful_operation_count,
+			sum(transaction_count)::double precision / 3600 AS tps,
+			sum(successful_operation_count)::double precision / 3600 AS ops,
+			sum(total_fee_charged) AS total_fee_charged,
+			sum(classic_fees) AS classic_fees,
+			sum(soroban_inclusion_fees) AS soroban_inclusion_fees,
+			sum(soroban_resource_fees) AS soroban_resource_fees,
+			sum(total_fee_charged)::double precision / NULLIF(sum(successful_operation_count), 0) AS avg_fee_per_operation
+		FROM %s
+		GROUP BY network_id, bucket
+		WITH NO DATA`, view, w.quotedTable())
+	if _, err := w.db.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("creating continuous aggregate: %w", err)
+	}
+	// Refresh the hours that may still receive rows, up to the last
+	// complete hour, every half hour.
+	_, err = w.db.ExecContext(ctx, `SELECT add_continuous_aggregate_policy($1::regclass,
+		start_offset => INTERVAL '3 hours', end_offset => INTERVAL '1 hour',
+		schedule_interval => INTERVAL '30 minutes', if_not_exists => TRUE)`, view)
+	if err != nil {
+		return fmt.Errorf("adding continuous aggregate policy: %w", err)
+	}
+	return nil
+}
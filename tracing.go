@@ -0,0 +1,105 @@
+// tracing.go
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/withObsrvr/pluginapi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ledgerTracing creates OpenTelemetry spans for the processing of each
+// ledger. Spans are recorded by the host's global TracerProvider; without
+// one they are not recorded, but the trace context of upstream messages is
+// still carried through to downstream plugins.
+type ledgerTracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// newLedgerTracingFromConfig parses the tracing setting. It returns nil
+// when tracing is disabled.
+func newLedgerTracingFromConfig(config map[string]interface{}) (*ledgerTracing, error) {
+	enabled, err := configBool(config, "tracing", false)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	return &ledgerTracing{
+		tracer:     otel.GetTracerProvider().Tracer(instrumentationScope),
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}, nil
+}
+
+// metadataCarrier adapts message metadata to the propagation carrier
+// interface. Trace context is stored under the W3C header names,
+// traceparent, tracestate and baggage.
+type metadataCarrier map[string]interface{}
+
+func (c metadataCarrier) Get(key string) string {
+	if v, ok := c[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startLedgerSpan starts the span of a ledger, continuing the trace of the
+// upstream message when its metadata carries one.
+func (p *LatestLedgerProcessor) startLedgerSpan(ctx context.Context, msg pluginapi.Message, seq uint32) (context.Context, trace.Span) {
+	if p.tracing == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	ctx = p.tracing.propagator.Extract(ctx, metadataCarrier(msg.Metadata))
+	return p.tracing.tracer.Start(ctx, "process_ledger",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.Int64("stellar.ledger.sequence", int64(seq))))
+}
+
+// startSpan starts a span for a step of the pipeline. Without tracing it
+// returns a span that records nothing.
+func (p *LatestLedgerProcessor) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	if p.tracing == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return p.tracing.tracer.Start(ctx, name)
+}
+
+// endSpan ends a span, marking it failed when err is set.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedDelivery starts the span of a delivery to a downstream plugin and
+// stores its trace context in a copy of the message metadata, so the
+// plugin can continue the trace.
+func (p *LatestLedgerProcessor) tracedDelivery(ctx context.Context, target downstream, msg pluginapi.Message) (context.Context, pluginapi.Message, trace.Span) {
+	ctx, span := p.tracing.tracer.Start(ctx, "forward "+target.Name(),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", target.Name()),
+			attribute.String("stellar.data_type", fmt.Sprint(msg.Metadata["data_type"])),
+		))
+	msg = withMetadataCopy(msg)
+	p.tracing.propagator.Inject(ctx, metadataCarrier(msg.Metadata))
+	return ctx, msg, span
+}
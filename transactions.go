@@ -0,0 +1,60 @@
+// transactions.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stellar/go/ingest"
+	"github.com/withObsrvr/pluginapi"
+)
+
+// LedgerTransactionRecord is a lightweight per-transaction record emitted
+// alongside the ledger summary when emit_transactions is enabled.
+type LedgerTransactionRecord struct {
+	LedgerSequence uint32    `json:"ledger_sequence"`
+	ClosedAt       time.Time `json:"closed_at"`
+	Hash           string    `json:"hash"`
+	SourceAccount  string    `json:"source_account"` // Inner transaction source for fee bumps, muxed accounts resolved to G...
+	FeeCharged     int64     `json:"fee_charged"`
+	Successful     bool      `json:"successful"`
+	OperationCount int       `json:"operation_count"`
+	Soroban        bool      `json:"soroban"`
+}
+
+// newLedgerTransactionRecord builds the record of a transaction.
+func newLedgerTransactionRecord(metrics *LatestLedger, tx ingest.LedgerTransaction) LedgerTransactionRecord {
+	return LedgerTransactionRecord{
+		LedgerSequence: metrics.Sequence,
+		ClosedAt:       metrics.ClosedAt,
+		Hash:           tx.Result.TransactionHash.HexString(),
+		SourceAccount:  muxedAccountID(tx.Envelope.SourceAccount()),
+		FeeCharged:     int64(tx.Result.Result.FeeCharged),
+		Successful:     tx.Result.Successful(),
+		OperationCount: len(tx.Envelope.Operations()),
+		Soroban:        hasSorobanTransaction(tx),
+	}
+}
+
+// forwardTransactions emits one ledger_transaction message per record, in
+// application order.
+func (p *LatestLedgerProcessor) forwardTransactions(ctx context.Context, msg pluginapi.Message, records []LedgerTransactionRecord) error {
+	for _, record := range records {
+		payload, err := p.encodePayload(record)
+		if err != nil {
+			return fmt.Errorf("error marshaling transaction %s: %w", record.Hash, err)
+		}
+		p.forward(ctx, pluginapi.Message{
+			Payload:   payload,
+			Timestamp: msg.Timestamp,
+			Metadata: map[string]interface{}{
+				"ledger_sequence":  record.LedgerSequence,
+				"transaction_hash": record.Hash,
+				"source":           "latest-ledger-processor",
+				"data_type":        "ledger_transaction",
+			},
+		})
+	}
+	return nil
+}
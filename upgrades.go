@@ -0,0 +1,133 @@
+// upgrades.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/stellar/go/xdr"
+	"github.com/withObsrvr/pluginapi"
+)
+
+// LedgerUpgradeEvent is emitted for every ledger in which network upgrades
+// were applied.
+type LedgerUpgradeEvent struct {
+	LedgerSequence uint32          `json:"ledger_sequence"`
+	ClosedAt       time.Time       `json:"closed_at"`
+	Upgrades       []UpgradeChange `json:"upgrades"`
+}
+
+// UpgradeChange describes a single applied upgrade. PreviousValue is only
+// set when the preceding ledger was processed and the value lives in the
+// ledger header.
+type UpgradeChange struct {
+	Type          string  `json:"type"`
+	PreviousValue *uint32 `json:"previous_value,omitempty"`
+	NewValue      *uint32 `json:"new_value,omitempty"`
+
+	// Set for network config (Soroban settings) upgrades
+	ConfigContractID  string `json:"config_contract_id,omitempty"`
+	ConfigContentHash string `json:"config_content_hash,omitempty"`
+}
+
+// ledgerUpgrades decodes the upgrades voted into the ledger's SCP value.
+func ledgerUpgrades(lcm xdr.LedgerCloseMeta, previous *ledgerHeaderValues) ([]UpgradeChange, error) {
+	header := lcm.LedgerHeaderHistoryEntry().Header
+	var changes []UpgradeChange
+	for _, raw := range header.ScpValue.Upgrades {
+		var upgrade xdr.LedgerUpgrade
+		if err := xdr.SafeUnmarshal(raw, &upgrade); err != nil {
+			return nil, fmt.Errorf("error decoding ledger upgrade: %w", err)
+		}
+
+		var change UpgradeChange
+		var prev *uint32
+		switch upgrade.Type {
+		case xdr.LedgerUpgradeTypeLedgerUpgradeVersion:
+			change = newUpgradeChange("protocol_version", upgrade.NewLedgerVersion)
+			if previous != nil {
+				prev = &previous.protocolVersion
+			}
+		case xdr.LedgerUpgradeTypeLedgerUpgradeBaseFee:
+			change = newUpgradeChange("base_fee", upgrade.NewBaseFee)
+			if previous != nil {
+				prev = &previous.baseFee
+			}
+		case xdr.LedgerUpgradeTypeLedgerUpgradeMaxTxSetSize:
+			change = newUpgradeChange("max_tx_set_size", upgrade.NewMaxTxSetSize)
+			if previous != nil {
+				prev = &previous.maxTxSetSize
+			}
+		case xdr.LedgerUpgradeTypeLedgerUpgradeBaseReserve:
+			change = newUpgradeChange("base_reserve", upgrade.NewBaseReserve)
+			if previous != nil {
+				prev = &previous.baseReserve
+			}
+		case xdr.LedgerUpgradeTypeLedgerUpgradeFlags:
+			change = newUpgradeChange("flags", upgrade.NewFlags)
+		case xdr.LedgerUpgradeTypeLedgerUpgradeMaxSorobanTxSetSize:
+			change = newUpgradeChange("max_soroban_tx_set_size", upgrade.NewMaxSorobanTxSetSize)
+		case xdr.LedgerUpgradeTypeLedgerUpgradeConfig:
+			change = UpgradeChange{Type: "config"}
+			if key := upgrade.NewConfig; key != nil {
+				change.ConfigContractID = key.ContractId.HexString()
+				change.ConfigContentHash = key.ContentHash.HexString()
+			}
+		default:
+			change = UpgradeChange{Type: upgrade.Type.String()}
+		}
+		if prev != nil {
+			v := *prev
+			change.PreviousValue = &v
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func newUpgradeChange(upgradeType string, value *xdr.Uint32) UpgradeChange {
+	change := UpgradeChange{Type: upgradeType}
+	if value != nil {
+		v := uint32(*value)
+		change.NewValue = &v
+	}
+	return change
+}
+
+// forwardLedgerUpgrades emits a ledger_upgrade message when the ledger
+// applied any upgrades. previous holds the header values of the immediately
+// preceding ledger, or nil when it was not processed.
+func (p *LatestLedgerProcessor) forwardLedgerUpgrades(ctx context.Context, msg pluginapi.Message, lcm xdr.LedgerCloseMeta, metrics LatestLedger, previous *ledgerHeaderValues) error {
+	upgrades, err := ledgerUpgrades(lcm, previous)
+	if err != nil {
+		return err
+	}
+	if len(upgrades) == 0 {
+		return nil
+	}
+
+	event := LedgerUpgradeEvent{
+		LedgerSequence: metrics.Sequence,
+		ClosedAt:       metrics.ClosedAt,
+		Upgrades:       upgrades,
+	}
+	payload, err := p.encodePayload(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling ledger upgrade: %w", err)
+	}
+
+	log.Printf("Ledger upgrade: %d upgrade(s) applied in ledger %d", len(upgrades), metrics.Sequence)
+
+	p.forward(ctx, pluginapi.Message{
+		Payload:   payload,
+		Timestamp: msg.Timestamp,
+		Metadata: map[string]interface{}{
+			"ledger_sequence": metrics.Sequence,
+			"source":          "latest-ledger-processor",
+			"data_type":       "ledger_upgrade",
+		},
+	})
+	return nil
+}
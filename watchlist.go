@@ -0,0 +1,209 @@
+// watchlist.go
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stellar/go/ingest"
+	"github.com/stellar/go/strkey"
+)
+
+// Watched entity types.
+const (
+	watchAccount  = "account"
+	watchAsset    = "asset"
+	watchContract = "contract"
+)
+
+// WatchBreakdown holds the activity of one watched entity in a ledger.
+// Tags are copied verbatim from the watchlist config so that downstream
+// systems can join on their own identifiers.
+type WatchBreakdown struct {
+	Type                     string `json:"type"`
+	ID                       string `json:"id"`
+	Tags                     []Tag  `json:"tags,omitempty"`
+	TxCount                  int    `json:"tx_count"`        // Transactions touching the entity
+	OperationCount           int    `json:"operation_count"` // Operations touching the entity
+	SuccessfulOperationCount int    `json:"successful_operation_count"`
+	FeeCharged               int64  `json:"fee_charged"` // Fees charged to transactions touching the entity
+}
+
+// Tag is an operator-defined key/value label.
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type watchEntity struct {
+	entityType string
+	id         string
+	tags       []Tag
+}
+
+// watchlist matches transactions against the configured accounts, assets
+// and contracts.
+type watchlist struct {
+	entities []watchEntity
+	index    map[string]int // entityType + ":" + id -> position in entities
+}
+
+// newWatchlistFromConfig parses the optional watchlist config block:
+//
+//	"watchlist": {
+//	  "accounts":  ["G...", {"id": "G...", "tags": {"crm_id": "42"}}],
+//	  "assets":    ["USDC:G..."],
+//	  "contracts": [{"id": "C...", "tags": {"team": "defi"}}]
+//	}
+//
+// It returns nil when no watchlist is configured.
+func newWatchlistFromConfig(config map[string]interface{}) (*watchlist, error) {
+	raw, ok := config["watchlist"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("watchlist must be an object, got %T", raw)
+	}
+
+	w := &watchlist{index: make(map[string]int)}
+	for key, entityType := range map[string]string{
+		"accounts":  watchAccount,
+		"assets":    watchAsset,
+		"contracts": watchContract,
+	} {
+		entries, ok := block[key]
+		if !ok || entries == nil {
+			continue
+		}
+		list, ok := entries.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("watchlist.%s must be a list, got %T", key, entries)
+		}
+		for _, entry := range list {
+			entity, err := parseWatchEntity(entityType, entry)
+			if err != nil {
+				return nil, fmt.Errorf("watchlist.%s: %w", key, err)
+			}
+			indexKey := entity.entityType + ":" + entity.id
+			if _, dup := w.index[indexKey]; dup {
+				return nil, fmt.Errorf("watchlist.%s: %s is listed more than once", key, entity.id)
+			}
+			w.index[indexKey] = len(w.entities)
+			w.entities = append(w.entities, entity)
+		}
+	}
+	if len(w.entities) == 0 {
+		return nil, nil
+	}
+
+	// Keep emitted breakdowns in a stable order.
+	sort.Slice(w.entities, func(i, j int) bool {
+		if w.entities[i].entityType != w.entities[j].entityType {
+			return w.entities[i].entityType < w.entities[j].entityType
+		}
+		return w.entities[i].id < w.entities[j].id
+	})
+	for i, entity := range w.entities {
+		w.index[entity.entityType+":"+entity.id] = i
+	}
+	return w, nil
+}
+
+func parseWatchEntity(entityType string, entry interface{}) (watchEntity, error) {
+	entity := watchEntity{entityType: entityType}
+	switch v := entry.(type) {
+	case string:
+		entity.id = v
+	case map[string]interface{}:
+		id, ok := v["id"].(string)
+		if !ok {
+			return entity, fmt.Errorf("entry is missing a string id")
+		}
+		entity.id = id
+		if rawTags, ok := v["tags"]; ok && rawTags != nil {
+			tags, ok := rawTags.(map[string]interface{})
+			if !ok {
+				return entity, fmt.Errorf("tags of %s must be an object, got %T", id, rawTags)
+			}
+			for key, value := range tags {
+				entity.tags = append(entity.tags, Tag{Key: key, Value: fmt.Sprint(value)})
+			}
+			sort.Slice(entity.tags, func(i, j int) bool { return entity.tags[i].Key < entity.tags[j].Key })
+		}
+	default:
+		return entity, fmt.Errorf("entry must be a string or an object, got %T", entry)
+	}
+
+	switch entityType {
+	case watchAccount:
+		if _, err := strkey.Decode(strkey.VersionByteAccountID, entity.id); err != nil {
+			return entity, fmt.Errorf("invalid account %q: %w", entity.id, err)
+		}
+	case watchContract:
+		if _, err := strkey.Decode(strkey.VersionByteContract, entity.id); err != nil {
+			return entity, fmt.Errorf("invalid contract %q: %w", entity.id, err)
+		}
+	case watchAsset:
+		if entity.id != "native" && !strings.Contains(entity.id, ":") {
+			return entity, fmt.Errorf("invalid asset %q, expected CODE:ISSUER or native", entity.id)
+		}
+	}
+	return entity, nil
+}
+
+// newBreakdowns returns an empty breakdown for every watched entity.
+func (w *watchlist) newBreakdowns() []WatchBreakdown {
+	breakdowns := make([]WatchBreakdown, len(w.entities))
+	for i, entity := range w.entities {
+		breakdowns[i] = WatchBreakdown{Type: entity.entityType, ID: entity.id, Tags: entity.tags}
+	}
+	return breakdowns
+}
+
+// add records a transaction in the breakdowns of every watched entity it
+// touches.
+func (w *watchlist) add(breakdowns []WatchBreakdown, tx ingest.LedgerTransaction) {
+	successful := tx.Result.Successful()
+	touchedTx := make(map[int]bool)
+
+	if feeAccount, ok := tx.FeeAccount(); ok {
+		if i, ok := w.index[watchAccount+":"+feeAccount]; ok {
+			touchedTx[i] = true
+		}
+	}
+
+	for _, op := range tx.Envelope.Operations() {
+		touchedOp := make(map[int]bool)
+		for _, account := range operationAccounts(tx, op) {
+			if i, ok := w.index[watchAccount+":"+account]; ok {
+				touchedOp[i] = true
+			}
+		}
+		for _, asset := range operationAssets(op) {
+			if i, ok := w.index[watchAsset+":"+asset.StringCanonical()]; ok {
+				touchedOp[i] = true
+			}
+		}
+		if contract, ok := operationContract(op); ok {
+			if i, ok := w.index[watchContract+":"+contract]; ok {
+				touchedOp[i] = true
+			}
+		}
+
+		for i := range touchedOp {
+			breakdowns[i].OperationCount++
+			if successful {
+				breakdowns[i].SuccessfulOperationCount++
+			}
+			touchedTx[i] = true
+		}
+	}
+
+	for i := range touchedTx {
+		breakdowns[i].TxCount++
+		breakdowns[i].FeeCharged += int64(tx.Result.Result.FeeCharged)
+	}
+}
@@ -0,0 +1,260 @@
+// webhook.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Defaults of a webhooks entry.
+const (
+	defaultWebhookMaxAttempts    = 3
+	defaultWebhookRetryBackoffMs = 500
+	defaultWebhookTimeoutSeconds = 10
+	maxWebhookRetryBackoff       = 30 * time.Second
+)
+
+// payloadContentTypes maps the encoding metadata of a payload to its MIME
+// type.
+var payloadContentTypes = map[string]string{
+	payloadEncodingJSON: "application/json",
+	payloadEncodingAvro: "application/avro",
+	payloadEncodingCSV:  "text/csv",
+	payloadEncodingCBOR: "application/cbor",
+	payloadEncodingSQL:  "application/sql",
+}
+
+// webhookTarget POSTs forwarded messages to an HTTP endpoint, for
+// serverless functions and third-party services. It is dispatched to like
+// a registered consumer. Requests that fail with a network error, a 429 or
+// a 5xx response are retried with exponential backoff.
+type webhookTarget struct {
+	name        string
+	url         string
+	headers     map[string]string
+	secret      []byte // HMAC-SHA256 signing key, nil when unsigned
+	maxAttempts int
+	backoff     time.Duration // before the first retry, doubled for each next one
+	client      *http.Client
+	attempts    atomic.Int32 // requests made by the latest delivery
+}
+
+// newWebhookTargetsFromConfig parses the optional webhooks list:
+//
+//	"webhooks": [
+//	  {
+//	    "url": "https://example.com/hooks/ledger",
+//	    "name": "example",
+//	    "headers": {"Authorization": "Bearer secret"},
+//	    "secret": "signing-key",
+//	    "max_attempts": 3,
+//	    "retry_backoff_ms": 500,
+//	    "timeout_seconds": 10
+//	  }
+//	]
+//
+// The name defaults to webhook:<host>.
+func newWebhookTargetsFromConfig(config map[string]interface{}) ([]*webhookTarget, error) {
+	raw, ok := config["webhooks"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	entries, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("webhooks must be a list, got %T", raw)
+	}
+	var targets []*webhookTarget
+	names := make(map[string]bool)
+	for i, entry := range entries {
+		block, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("webhooks[%d] must be an object, got %T", i, entry)
+		}
+		target, err := parseWebhookTarget(block)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks[%d]: %w", i, err)
+		}
+		if names[target.name] {
+			return nil, fmt.Errorf("webhooks[%d]: duplicate name %q, set a name to tell the webhooks apart", i, target.name)
+		}
+		names[target.name] = true
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func parseWebhookTarget(block map[string]interface{}) (*webhookTarget, error) {
+	rawURL, err := configString(block, "url", "")
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", rawURL)
+	}
+	name, err := configString(block, "name", "webhook:"+u.Host)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := configStringMap(block, "headers")
+	if err != nil {
+		return nil, err
+	}
+	for k := range headers {
+		if http.CanonicalHeaderKey(k) == "Content-Length" || http.CanonicalHeaderKey(k) == "Host" {
+			return nil, fmt.Errorf("header %s is set by the request", k)
+		}
+	}
+	secret, err := configString(block, "secret", "")
+	if err != nil {
+		return nil, err
+	}
+	maxAttempts, err := configInt(block, "max_attempts", defaultWebhookMaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if maxAttempts < 1 {
+		return nil, fmt.Errorf("max_attempts must be at least 1")
+	}
+	backoffMs, err := configInt(block, "retry_backoff_ms", defaultWebhookRetryBackoffMs)
+	if err != nil {
+		return nil, err
+	}
+	if backoffMs < 0 {
+		return nil, fmt.Errorf("retry_backoff_ms must not be negative")
+	}
+	timeoutSeconds, err := configInt(block, "timeout_seconds", defaultWebhookTimeoutSeconds)
+	if err != nil {
+		return nil, err
+	}
+	if timeoutSeconds < 1 {
+		return nil, fmt.Errorf("timeout_seconds must be at least 1")
+	}
+	target := &webhookTarget{
+		name:        name,
+		url:         rawURL,
+		headers:     headers,
+		maxAttempts: maxAttempts,
+		backoff:     time.Duration(backoffMs) * time.Millisecond,
+		client:      &http.Client{Timeout: time.Duration(timeoutSeconds) * time.Second},
+	}
+	if secret != "" {
+		target.secret = []byte(secret)
+	}
+	return target, nil
+}
+
+// Name identifies the webhook in logs and dispatch reports.
+func (w *webhookTarget) Name() string {
+	return w.name
+}
+
+// Process POSTs the payload of msg, retrying as the retry policy allows.
+func (w *webhookTarget) Process(ctx context.Context, msg pluginapi.Message) error {
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("unsupported payload type %T", msg.Payload)
+	}
+	backoff := w.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		w.attempts.Store(int32(attempt))
+		var retry bool
+		retry, err = w.post(ctx, msg.Metadata, payload)
+		if err == nil || !retry || attempt == w.maxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxWebhookRetryBackoff)
+	}
+	if err != nil && w.maxAttempts > 1 {
+		return fmt.Errorf("giving up after %d attempts: %w", w.maxAttempts, err)
+	}
+	return err
+}
+
+// lastAttempts returns the number of requests made by the latest delivery.
+func (w *webhookTarget) lastAttempts() int {
+	return int(w.attempts.Load())
+}
+
+// payloadContentType returns the MIME type of a forwarded payload, from
+// its content_type metadata or else its encoding.
+func payloadContentType(metadata map[string]interface{}) string {
+	if contentType, _ := metadata["content_type"].(string); contentType != "" {
+		return contentType
+	}
+	encoding, _ := metadata["encoding"].(string)
+	if encoding == "" {
+		encoding = payloadEncodingJSON
+	}
+	if contentType := payloadContentTypes[encoding]; contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// post sends one request and reports whether a failure may be retried.
+// Requests are signed anew for every attempt, so the timestamp is current.
+func (w *webhookTarget) post(ctx context.Context, metadata map[string]interface{}, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", payloadContentType(metadata))
+	if contentEncoding, ok := metadata["content_encoding"].(string); ok {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	req.Header.Set("X-Webhook-Id", messageID(metadata))
+	if dataType, ok := metadata["data_type"]; ok {
+		req.Header.Set("X-Webhook-Data-Type", fmt.Sprint(dataType))
+	}
+	if w.secret != nil {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", "sha256="+webhookSignature(w.secret, timestamp, payload))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return false, nil
+}
+
+// webhookSignature returns the hex HMAC-SHA256 of the timestamp, a dot and
+// the request body. Including the timestamp lets receivers reject replayed
+// requests.
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,443 @@
+// websocket.go
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+// Defaults of the websocket config block.
+const (
+	defaultWebSocketListenAddress = ":8081"
+	defaultWebSocketPath          = "/ws"
+	defaultWebSocketMaxClients    = 1000
+)
+
+// webSocketSendBuffer is the number of records queued for a client before
+// it is considered too slow and disconnected.
+const webSocketSendBuffer = 16
+
+const (
+	webSocketWriteTimeout = 10 * time.Second
+	webSocketPingInterval = 30 * time.Second
+	// webSocketMaxMessage bounds the frames clients may send; they are only
+	// expected to send control frames.
+	webSocketMaxMessage = 4096
+)
+
+// webSocketGUID is appended to the client key to compute the handshake
+// accept value (RFC 6455 section 1.3).
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes and close codes used by the server.
+const (
+	wsOpText   = 0x1
+	wsOpBinary = 0x2
+	wsOpClose  = 0x8
+	wsOpPing   = 0x9
+	wsOpPong   = 0xA
+
+	wsCloseNormal      = 1000
+	wsCloseGoingAway   = 1001
+	wsCloseProtocol    = 1002
+	wsCloseTooBig      = 1009
+	wsClosePolicyError = 1008
+)
+
+// webSocketServer pushes the payload of every new ledger to the connected
+// WebSocket clients, so live dashboards can be fed straight off the
+// processor. It is dispatched to like a registered consumer and ignores
+// messages other than latest_ledger.
+type webSocketServer struct {
+	server         *http.Server // nil when mounted on the serve command's mux
+	listener       net.Listener
+	allowedOrigins map[string]bool // nil when every origin is allowed
+	maxClients     int
+	dataType       string // data_type of the messages pushed
+
+	mu        sync.Mutex
+	clients   map[*webSocketClient]struct{}
+	latest    []byte // frame of the most recent ledger, sent to new clients
+	latestSeq uint64
+	closed    bool
+}
+
+// webSocketClient is a connected client. Frames are written by a single
+// goroutine draining send.
+type webSocketClient struct {
+	conn net.Conn
+	send chan []byte
+	done chan struct{}
+	once sync.Once
+	code uint16 // close code sent when done is closed
+}
+
+// newWebSocketServerFromConfig parses the optional websocket config block:
+//
+//	"websocket": {
+//	  "listen_address": ":8081",
+//	  "path": "/ws",
+//	  "allowed_origins": ["https://dashboard.example.com"],
+//	  "max_clients": 1000
+//	}
+//
+// The listener is opened here, so an address in use fails the config. It
+// returns nil when no WebSocket server is configured.
+func newWebSocketServerFromConfig(config map[string]interface{}, namespace string) (*webSocketServer, error) {
+	raw, ok := config["websocket"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("websocket must be an object, got %T", raw)
+	}
+	address, err := configString(block, "listen_address", defaultWebSocketListenAddress)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	path, err := configString(block, "path", defaultWebSocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("websocket: path must start with /, got %q", path)
+	}
+	origins, err := configStringSlice(block, "allowed_origins")
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	maxClients, err := configInt(block, "max_clients", defaultWebSocketMaxClients)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	if maxClients < 1 {
+		return nil, fmt.Errorf("websocket: max_clients must be at least 1")
+	}
+
+	s := newWebSocketServer(maxClients, namespace+"latest_ledger", origins)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: %w", err)
+	}
+	s.listener = listener
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, s.serveWebSocket)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Warning: websocket server stopped: %v", err)
+		}
+	}()
+	log.Printf("Serving ledger WebSocket on %s%s", listener.Addr(), path)
+	return s, nil
+}
+
+// newWebSocketServer returns a server without a listener of its own, for
+// mounting serveWebSocket on another server's mux. An empty origins list
+// allows every origin.
+func newWebSocketServer(maxClients int, dataType string, origins []string) *webSocketServer {
+	s := &webSocketServer{
+		maxClients: maxClients,
+		dataType:   dataType,
+		clients:    make(map[*webSocketClient]struct{}),
+	}
+	if len(origins) > 0 {
+		s.allowedOrigins = make(map[string]bool, len(origins))
+		for _, origin := range origins {
+			s.allowedOrigins[origin] = true
+		}
+	}
+	return s
+}
+
+// Name identifies the server in logs and dispatch reports.
+func (s *webSocketServer) Name() string {
+	return "websocket"
+}
+
+// Process pushes the payload of a latest_ledger message to every client.
+// Messages of an older ledger than the last one pushed, such as
+// reprocessed corrections, are skipped. A client whose queue is full is
+// disconnected rather than holding up the pipeline.
+func (s *webSocketServer) Process(ctx context.Context, msg pluginapi.Message) error {
+	if msg.Metadata["data_type"] != s.dataType {
+		return nil
+	}
+	payload, ok := msg.Payload.([]byte)
+	if !ok {
+		return fmt.Errorf("unsupported payload type %T", msg.Payload)
+	}
+	seq, _ := strconv.ParseUint(fmt.Sprint(msg.Metadata["ledger_sequence"]), 10, 64)
+
+	// JSON, CSV and SQL payloads are text; Avro, CBOR and compressed
+	// payloads are sent as binary messages.
+	opcode := byte(wsOpText)
+	if !utf8.Valid(payload) {
+		opcode = wsOpBinary
+	}
+	frame := webSocketFrame(opcode, payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq < s.latestSeq {
+		return nil
+	}
+	s.latest, s.latestSeq = frame, seq
+	for c := range s.clients {
+		select {
+		case c.send <- frame:
+		default:
+			log.Printf("Warning: disconnecting slow websocket client %s", c.conn.RemoteAddr())
+			c.shutdown(wsClosePolicyError)
+		}
+	}
+	return nil
+}
+
+// serveWebSocket performs the opening handshake and serves the client until
+// either side closes the connection.
+func (s *webSocketServer) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") || key == "" {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && s.allowedOrigins != nil && !s.allowedOrigins[origin] {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	full := s.closed || len(s.clients) >= s.maxClients
+	s.mu.Unlock()
+	if full {
+		http.Error(w, "too many websocket clients", http.StatusServiceUnavailable)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	accept := sha1.Sum([]byte(key + webSocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(accept[:]))
+	conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	c := &webSocketClient{
+		conn: conn,
+		send: make(chan []byte, webSocketSendBuffer),
+		done: make(chan struct{}),
+		code: wsCloseNormal,
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.clients[c] = struct{}{}
+	// New clients start from the most recent ledger.
+	if s.latest != nil {
+		c.send <- s.latest
+	}
+	s.mu.Unlock()
+
+	go c.writeLoop()
+	c.readLoop(rw.Reader)
+	s.remove(c)
+	c.shutdown(wsCloseNormal)
+}
+
+// remove forgets a client that has disconnected.
+func (s *webSocketServer) remove(c *webSocketClient) {
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+}
+
+// Close stops accepting clients and closes the connected ones.
+func (s *webSocketServer) Close() error {
+	var err error
+	if s.server != nil {
+		err = s.server.Close()
+		s.listener.Close() // in case Serve has not started yet
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for c := range s.clients {
+		c.shutdown(wsCloseGoingAway)
+	}
+	return err
+}
+
+// shutdown makes the write loop send a close frame with the code and close
+// the connection.
+func (c *webSocketClient) shutdown(code uint16) {
+	c.once.Do(func() {
+		c.code = code
+		close(c.done)
+	})
+}
+
+// writeLoop writes queued frames and periodic pings until the client is
+// shut down or a write fails.
+func (c *webSocketClient) writeLoop() {
+	defer c.conn.Close()
+	ticker := time.NewTicker(webSocketPingInterval)
+	defer ticker.Stop()
+	for {
+		var frame []byte
+		select {
+		case frame = <-c.send:
+		case <-ticker.C:
+			frame = webSocketFrame(wsOpPing, nil)
+		case <-c.done:
+			closePayload := binary.BigEndian.AppendUint16(nil, c.code)
+			c.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+			c.conn.Write(webSocketFrame(wsOpClose, closePayload))
+			return
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+		if _, err := c.conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+// readLoop reads client frames, answering pings and close frames, until the
+// connection fails or the client closes it. Data sent by clients is
+// discarded.
+func (c *webSocketClient) readLoop(r *bufio.Reader) {
+	for {
+		opcode, payload, err := readWebSocketFrame(r)
+		if err != nil {
+			if err == errWebSocketTooBig {
+				c.shutdown(wsCloseTooBig)
+			} else if err != io.EOF {
+				c.shutdown(wsCloseProtocol)
+			}
+			return
+		}
+		switch opcode {
+		case wsOpClose:
+			return
+		case wsOpPing:
+			select {
+			case c.send <- webSocketFrame(wsOpPong, payload):
+			default:
+			}
+		}
+	}
+}
+
+var errWebSocketTooBig = errors.New("websocket frame too big")
+
+// readWebSocketFrame reads a masked client frame and returns its opcode
+// and unmasked payload. Fragments are returned like whole messages.
+func readWebSocketFrame(r *bufio.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		return 0, nil, fmt.Errorf("unmasked client frame")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > webSocketMaxMessage {
+		return 0, nil, errWebSocketTooBig
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// webSocketFrame encodes an unfragmented, unmasked server frame.
+func webSocketFrame(opcode byte, payload []byte) []byte {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	return append(frame, payload...)
+}
+
+// headerContainsToken reports whether a comma-separated header contains the
+// token, ignoring case.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+// websocket_test.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/withObsrvr/pluginapi"
+)
+
+func TestWebSocketFrameGolden(t *testing.T) {
+	// Examples of RFC 6455 section 5.7.
+	tests := []struct {
+		name    string
+		opcode  byte
+		payload []byte
+		want    string // the frame without the payload for long ones
+	}{
+		{"text", wsOpText, []byte("Hello"), "810548656c6c6f"},
+		{"pong", wsOpPong, []byte("Hello"), "8a0548656c6c6f"},
+		{"empty", wsOpPing, nil, "8900"},
+		{"125 bytes", wsOpBinary, make([]byte, 125), "827d"},
+		{"256 bytes", wsOpBinary, make([]byte, 256), "827e0100"},
+		{"65535 bytes", wsOpBinary, make([]byte, 65535), "827effff"},
+		{"64 KiB", wsOpBinary, make([]byte, 65536), "827f0000000000010000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := webSocketFrame(tt.opcode, tt.payload)
+			header := frame[:len(frame)-len(tt.payload)]
+			if len(tt.payload) > 5 {
+				if hex.EncodeToString(header) != tt.want {
+					t.Errorf("header = %x, want %s", header, tt.want)
+				}
+				return
+			}
+			if hex.EncodeToString(frame) != tt.want {
+				t.Errorf("frame = %x, want %s", frame, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadWebSocketFrame(t *testing.T) {
+	long := bytes.Repeat([]byte{'a'}, 200)
+	maskedLong := append([]byte{0x82, 0xfe, 0x00, 0xc8, 0x00, 0x00, 0x00, 0x00}, long...)
+	tests := []struct {
+		name        string
+		frame       string
+		wantOpcode  byte
+		wantPayload []byte
+		wantErr     error
+	}{
+		// A masked text message and a masked ping from RFC 6455 section 5.7.
+		{name: "masked text", frame: "818537fa213d7f9f4d5158", wantOpcode: wsOpText, wantPayload: []byte("Hello")},
+		{name: "masked ping", frame: "898537fa213d7f9f4d5158", wantOpcode: wsOpPing, wantPayload: []byte("Hello")},
+		{name: "empty close", frame: "888000000000", wantOpcode: wsOpClose, wantPayload: []byte{}},
+		// Fragments are returned like whole messages.
+		{name: "fragment", frame: "018100000000" + "61", wantOpcode: wsOpText, wantPayload: []byte("a")},
+		{name: "16-bit length", frame: hex.EncodeToString(maskedLong), wantOpcode: wsOpBinary, wantPayload: long},
+		{name: "unmasked", frame: "810548656c6c6f", wantErr: errors.New("unmasked client frame")},
+		{name: "too big", frame: "82fe1001", wantErr: errWebSocketTooBig},
+		{name: "64-bit length too big", frame: "82ff0000000100000000", wantErr: errWebSocketTooBig},
+		{name: "truncated payload", frame: "818537fa213d7f9f", wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated header", frame: "81", wantErr: io.ErrUnexpectedEOF},
+		{name: "no frame", frame: "", wantErr: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := hex.DecodeString(tt.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opcode, payload, err := readWebSocketFrame(bufio.NewReader(bytes.NewReader(frame)))
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Fatalf("readWebSocketFrame error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opcode != tt.wantOpcode || !bytes.Equal(payload, tt.wantPayload) {
+				t.Errorf("readWebSocketFrame = %#x %q, want %#x %q", opcode, payload, tt.wantOpcode, tt.wantPayload)
+			}
+		})
+	}
+}
+
+func TestWebSocketServerHandshakeAndPush(t *testing.T) {
+	address := freeAddress(t)
+	s, err := newWebSocketServerFromConfig(map[string]interface{}{
+		"websocket": map[string]interface{}{"listen_address": address},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	msg := pluginapi.Message{
+		Payload:  []byte(`{"sequence":5}`),
+		Metadata: map[string]interface{}{"data_type": "latest_ledger", "ledger_sequence": uint32(5)},
+	}
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	// The handshake of RFC 6455 section 1.3.
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: server.example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake answered %s with accept %q", resp.Status, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	// New clients start from the most recent ledger.
+	want := append([]byte{0x81, 14}, `{"sequence":5}`...)
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("pushed frame %x, want %x", got, want)
+	}
+
+	// Pings are answered with pongs carrying the same data.
+	ping, _ := hex.DecodeString("898537fa213d7f9f4d5158")
+	conn.Write(ping)
+	want = []byte("\x8a\x05Hello")
+	got = make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("pong %x, want %x", got, want)
+	}
+
+	// Unmasked client frames violate the protocol and close the connection
+	// with 1002.
+	conn.Write([]byte{0x81, 0x00})
+	want = []byte{0x88, 0x02, 0x03, 0xea}
+	got = make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("close frame %x, want %x", got, want)
+	}
+}
+
+func TestWebSocketServerRejectsPlainRequests(t *testing.T) {
+	address := freeAddress(t)
+	s, err := newWebSocketServerFromConfig(map[string]interface{}{
+		"websocket": map[string]interface{}{"listen_address": address},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	resp, err := http.Get("http://" + address + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired || !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		t.Errorf("plain request answered %s, want 426 with Upgrade: websocket", resp.Status)
+	}
+}
@@ -0,0 +1,40 @@
+// workshare.go
+package main
+
+// defaultClassicOpCostInstructions is the rough cost of applying one classic
+// operation, expressed in Soroban instruction equivalents. It is only an
+// order-of-magnitude estimate and can be tuned with
+// classic_op_cost_instructions.
+const defaultClassicOpCostInstructions = 25000
+
+// WorkShare estimates how the ledger's apply work splits between Soroban and
+// classic transactions. Soroban work is taken from declared instructions and
+// classic work from the operation count multiplied by a per-operation cost,
+// so the figures are a capacity-planning signal rather than a measurement.
+type WorkShare struct {
+	SorobanInstructions uint64  `json:"soroban_instructions"`
+	ClassicInstructions uint64  `json:"classic_instructions"` // Estimated instruction equivalents
+	SorobanShare        float64 `json:"soroban_share"`
+	ClassicShare        float64 `json:"classic_share"`
+}
+
+// estimateWorkShare returns the work split of a ledger, or nil for an empty
+// ledger.
+func estimateWorkShare(metrics LatestLedger, classicOpCost uint64) *WorkShare {
+	// Every Soroban transaction carries exactly one operation.
+	classicOps := metrics.TxSetOperationCount - metrics.SorobanTxCount
+	if classicOps < 0 {
+		classicOps = 0
+	}
+	share := &WorkShare{
+		SorobanInstructions: metrics.TotalResourceInstructions,
+		ClassicInstructions: uint64(classicOps) * classicOpCost,
+	}
+	total := share.SorobanInstructions + share.ClassicInstructions
+	if total == 0 {
+		return nil
+	}
+	share.SorobanShare = float64(share.SorobanInstructions) / float64(total)
+	share.ClassicShare = float64(share.ClassicInstructions) / float64(total)
+	return share
+}